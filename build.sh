@@ -25,6 +25,7 @@ chmod +x "${DIST_DIR}/${BINARY_NAME}"
 
 # Copy config files
 cp systemd/ocserv-exporter.service "${DIST_DIR}/"
+cp systemd/ocserv-exporter.socket "${DIST_DIR}/"
 cp grafana/dashboard.json "${DIST_DIR}/grafana/"
 cp prometheus/alerts.yml "${DIST_DIR}/prometheus/"
 cp prometheus/scrape_config.yml "${DIST_DIR}/prometheus/"
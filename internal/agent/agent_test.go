@@ -0,0 +1,109 @@
+package agent
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mogilevich/ocserv_exporter/pkg/parser"
+)
+
+func TestForwarderStreamsEventsToServer(t *testing.T) {
+	var mu sync.Mutex
+	var received []*parser.Event
+	server := NewServer(nil, func(event *parser.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, event)
+	})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = server.Serve(listener) }()
+	defer server.Stop()
+
+	forwarder := NewForwarder(listener.Addr().String(), "vpn1", nil, 0)
+	ts := time.Unix(1700000000, 0).UTC()
+	forwarder.ProcessEvent(&parser.Event{Type: parser.EventUserLogin, Timestamp: ts, Server: "ocserv", Username: "bob", ClientIP: "62.4.32.53"})
+	forwarder.ProcessEvent(&parser.Event{Type: parser.EventUserDisconnect, Timestamp: ts, Server: "ocserv", Username: "bob", RxBytes: 1024, TxBytes: 2048})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = forwarder.Run(ctx)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		n := len(received)
+		mu.Unlock()
+		if n == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("received %d events, want 2", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	login, disconnect := received[0], received[1]
+	if login.Type != parser.EventUserLogin || login.Server != "vpn1/ocserv" || login.Username != "bob" ||
+		login.ClientIP != "62.4.32.53" || !login.Timestamp.Equal(ts) {
+		t.Errorf("login = %+v", login)
+	}
+	if disconnect.Type != parser.EventUserDisconnect || disconnect.RxBytes != 1024 || disconnect.TxBytes != 2048 {
+		t.Errorf("disconnect = %+v", disconnect)
+	}
+}
+
+func TestWireEventUnknownType(t *testing.T) {
+	w := newWireEvent("vpn1", &parser.Event{Type: parser.EventUserLogin})
+	if got := w.event().Type; got != parser.EventUserLogin {
+		t.Errorf("round trip type = %v, want %v", got, parser.EventUserLogin)
+	}
+	w.Type = "from-a-newer-agent"
+	if got := w.event().Type; got != parser.EventUnknown {
+		t.Errorf("unknown type = %v, want %v", got, parser.EventUnknown)
+	}
+}
+
+// Every field of a parsed event but the raw line reaches the aggregator
+func TestWireEventRoundTrip(t *testing.T) {
+	in := &parser.Event{Type: parser.EventAuthFailureReason, Timestamp: time.Date(2025, 1, 2, 3, 4, 5, 6, time.UTC)}
+	v := reflect.ValueOf(in).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		switch f := v.Field(i); f.Kind() {
+		case reflect.String:
+			f.SetString(v.Type().Field(i).Name)
+		case reflect.Int:
+			f.SetInt(int64(i + 1))
+		case reflect.Uint64:
+			f.SetUint(uint64(i + 1))
+		case reflect.Struct: // Timestamp
+		default:
+			t.Fatalf("field %s of kind %s not covered", v.Type().Field(i).Name, f.Kind())
+		}
+	}
+	in.Type = parser.EventAuthFailureReason
+	in.Raw = ""
+
+	data, err := jsonCodec{}.Marshal(newWireEvent("vpn1", in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var w wireEvent
+	if err := (jsonCodec{}).Unmarshal(data, &w); err != nil {
+		t.Fatal(err)
+	}
+	if out := w.event(); !reflect.DeepEqual(out, in) {
+		t.Errorf("round trip\n got %+v\nwant %+v", out, in)
+	}
+}
@@ -0,0 +1,114 @@
+package agent
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"log"
+	"net"
+
+	"github.com/mogilevich/ocserv_exporter/internal/collector"
+	"github.com/mogilevich/ocserv_exporter/pkg/parser"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// Server is the aggregator side: it receives the events agents stream and publishes them.
+// Events get the server label "<node>/<server>", so the instances of different nodes stay apart
+// even when they share a unit name.
+type Server struct {
+	grpc    *grpc.Server
+	publish func(event *parser.Event)
+}
+
+// NewServer creates an aggregator handing received events to publish, e.g. eventbus.Bus.Publish.
+// With a tlsConfig from TLSConfig.ServerTLS agents are identified by the common name of their
+// certificate; a nil tlsConfig disables TLS, for tests, and trusts the node agents report.
+func NewServer(tlsConfig *tls.Config, publish func(event *parser.Event)) *Server {
+	var opts []grpc.ServerOption
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	s := &Server{
+		grpc:    grpc.NewServer(opts...),
+		publish: publish,
+	}
+	s.grpc.RegisterService(&grpc.ServiceDesc{
+		ServiceName: serviceName,
+		HandlerType: (*any)(nil),
+		Streams: []grpc.StreamDesc{{
+			StreamName:    streamEventsName,
+			Handler:       handleStreamEvents,
+			ClientStreams: true,
+		}},
+	}, s)
+	return s
+}
+
+// Serve accepts agent connections on l until Stop is called
+func (s *Server) Serve(l net.Listener) error {
+	return s.grpc.Serve(l)
+}
+
+// Stop closes the listeners and waits for open streams to end
+func (s *Server) Stop() {
+	s.grpc.GracefulStop()
+}
+
+func handleStreamEvents(srv any, stream grpc.ServerStream) error {
+	return srv.(*Server).streamEvents(stream)
+}
+
+// streamEvents publishes the events of one agent stream
+func (s *Server) streamEvents(stream grpc.ServerStream) error {
+	node := certNode(stream)
+	if node != "" {
+		collector.AggregatorAgentsConnected.Inc()
+		defer collector.AggregatorAgentsConnected.Dec()
+		log.Printf("Agent %s connected", node)
+	}
+
+	var received uint64
+	for {
+		var w wireEvent
+		err := stream.RecvMsg(&w)
+		if errors.Is(err, io.EOF) {
+			return stream.SendMsg(&streamSummary{Events: received})
+		}
+		if err != nil {
+			if node != "" {
+				log.Printf("Agent %s disconnected: %v", node, err)
+			}
+			return err
+		}
+		if node == "" {
+			// Without TLS the agent names itself with its first event
+			node = w.Node
+			collector.AggregatorAgentsConnected.Inc()
+			defer collector.AggregatorAgentsConnected.Dec()
+		}
+
+		received++
+		collector.AggregatorEventsReceivedTotal.WithLabelValues(node).Inc()
+		event := w.event()
+		if event.Type == parser.EventUnknown {
+			continue // event type of a newer agent
+		}
+		event.Server = node + "/" + event.Server
+		s.publish(event)
+	}
+}
+
+// certNode returns the common name of the agent's client certificate, empty without TLS
+func certNode(stream grpc.ServerStream) string {
+	p, ok := peer.FromContext(stream.Context())
+	if !ok {
+		return ""
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.PeerCertificates) == 0 {
+		return ""
+	}
+	return info.State.PeerCertificates[0].Subject.CommonName
+}
@@ -0,0 +1,161 @@
+package agent
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"log"
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+
+	"github.com/mogilevich/ocserv_exporter/pkg/parser"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const (
+	// DefaultQueueSize is the number of events an agent buffers while the aggregator is unreachable
+	DefaultQueueSize = 10000
+	// maxReconnectDelay bounds the delay between connection attempts to the aggregator
+	maxReconnectDelay = 30 * time.Second
+	// closeTimeout bounds the wait for the aggregator's summary on shutdown
+	closeTimeout = 5 * time.Second
+)
+
+// Forwarder streams the events it consumes to an aggregator. It is an event bus consumer:
+// events are queued without blocking and dropped when the queue is full, e.g. during a long
+// aggregator outage. Events in flight when a connection breaks may be lost.
+type Forwarder struct {
+	target  string
+	node    string
+	creds   credentials.TransportCredentials
+	events  chan *wireEvent
+	dropped atomic.Uint64
+}
+
+// NewForwarder creates a forwarder to the aggregator at target (host:port) for the agent node.
+// A nil tlsConfig disables TLS, for tests.
+func NewForwarder(target, node string, tlsConfig *tls.Config, queueSize int) *Forwarder {
+	if queueSize <= 0 {
+		queueSize = DefaultQueueSize
+	}
+	creds := insecure.NewCredentials()
+	if tlsConfig != nil {
+		creds = credentials.NewTLS(tlsConfig)
+	}
+	return &Forwarder{
+		target: target,
+		node:   node,
+		creds:  creds,
+		events: make(chan *wireEvent, queueSize),
+	}
+}
+
+// ProcessEvent queues an event for the aggregator (eventbus.Consumer)
+func (f *Forwarder) ProcessEvent(event *parser.Event) {
+	select {
+	case f.events <- newWireEvent(f.node, event):
+	default:
+		if f.dropped.Add(1)%1000 == 1 {
+			log.Printf("Warning: Aggregator queue full, %d event(s) dropped so far", f.dropped.Load())
+		}
+	}
+}
+
+// Run streams queued events until ctx is cancelled, reconnecting with a growing delay while
+// the aggregator is unreachable
+func (f *Forwarder) Run(ctx context.Context) error {
+	conn, err := grpc.NewClient(f.target,
+		grpc.WithTransportCredentials(f.creds),
+		grpc.WithDefaultCallOptions(grpc.CallContentSubtype(codecName)),
+	)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var pending *wireEvent // event whose send failed, sent first on the next stream
+	failures := 0
+	for ctx.Err() == nil {
+		sent, err := f.stream(ctx, conn, &pending)
+		if ctx.Err() != nil {
+			break
+		}
+		if sent > 0 {
+			failures = 0
+		}
+		failures++
+		delay := min(time.Second<<min(failures-1, 5), maxReconnectDelay)
+		delay += rand.N(delay / 2)
+		log.Printf("Warning: Stream to aggregator %s failed: %v (retrying in %s)", f.target, err, delay.Round(time.Second))
+		select {
+		case <-ctx.Done():
+		case <-time.After(delay):
+		}
+	}
+	return nil
+}
+
+// stream sends events on one stream until it fails or ctx is cancelled, returning the number
+// of events sent. On cancellation the stream is closed and the aggregator's summary awaited.
+func (f *Forwarder) stream(ctx context.Context, conn *grpc.ClientConn, pending **wireEvent) (int, error) {
+	streamCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := conn.NewStream(streamCtx, &streamEventsDesc, streamEventsRoute)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for {
+		event := *pending
+		if event == nil {
+			select {
+			case <-ctx.Done():
+				// Send what is queued and give the aggregator a moment to acknowledge it
+				time.AfterFunc(closeTimeout, cancel)
+				n, err := f.drain(stream)
+				sent += n
+				if err != nil {
+					return sent, err
+				}
+				if err := stream.CloseSend(); err != nil {
+					return sent, err
+				}
+				var summary streamSummary
+				return sent, stream.RecvMsg(&summary)
+			case event = <-f.events:
+			}
+		}
+		if err := stream.SendMsg(event); err != nil {
+			*pending = event
+			if errors.Is(err, io.EOF) {
+				// The stream was closed by the aggregator, its status tells why
+				var summary streamSummary
+				err = stream.RecvMsg(&summary)
+			}
+			return sent, err
+		}
+		*pending = nil
+		sent++
+	}
+}
+
+// drain sends the queued events without waiting for more
+func (f *Forwarder) drain(stream grpc.ClientStream) (int, error) {
+	sent := 0
+	for {
+		select {
+		case event := <-f.events:
+			if err := stream.SendMsg(event); err != nil {
+				return sent, err
+			}
+			sent++
+		default:
+			return sent, nil
+		}
+	}
+}
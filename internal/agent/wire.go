@@ -0,0 +1,205 @@
+// Package agent streams parsed log events from agents on the VPN nodes to an aggregating
+// exporter over gRPC with mutual TLS. Agents read the logs and parse them; the aggregator
+// publishes the received events on its event bus, so its collector keeps the metrics of the
+// whole fleet.
+package agent
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mogilevich/ocserv_exporter/pkg/parser"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+)
+
+// The Aggregator service has one client-streaming method: an agent sends events and gets a
+// summary when it closes the stream. Messages are JSON (codec "ocserv-json"), so agents and
+// aggregators of different versions understand each other as long as event type names and
+// fields stay compatible, without generated protobuf code.
+const (
+	serviceName       = "ocserv_exporter.agent.v1.Aggregator"
+	streamEventsName  = "StreamEvents"
+	streamEventsRoute = "/" + serviceName + "/" + streamEventsName
+	codecName         = "ocserv-json"
+)
+
+var streamEventsDesc = grpc.StreamDesc{
+	StreamName:    streamEventsName,
+	ClientStreams: true,
+}
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+// jsonCodec encodes gRPC messages as JSON
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+func (jsonCodec) Name() string                       { return codecName }
+
+// wireEvent is a parsed event on the wire; the raw line stays on the agent
+type wireEvent struct {
+	Node        string    `json:"node"` // agent that read the line
+	Type        string    `json:"type"`
+	Time        time.Time `json:"time"`
+	Server      string    `json:"server"`
+	Username    string    `json:"username,omitempty"`
+	ClientIP    string    `json:"client_ip,omitempty"`
+	Port        int       `json:"port,omitempty"`
+	VpnIP       string    `json:"vpn_ip,omitempty"`
+	SessionID   string    `json:"session_id,omitempty"`
+	Reason      string    `json:"reason,omitempty"`
+	Group       string    `json:"group,omitempty"`
+	VHost       string    `json:"vhost,omitempty"`
+	RxBytes     uint64    `json:"rx_bytes,omitempty"`
+	TxBytes     uint64    `json:"tx_bytes,omitempty"`
+	DPDSeconds  int       `json:"dpd_seconds,omitempty"`
+	MTU         int       `json:"mtu,omitempty"`
+	Channel     string    `json:"channel,omitempty"`
+	UserAgent   string    `json:"user_agent,omitempty"`
+	Hostname    string    `json:"hostname,omitempty"`
+	AuthBackend string    `json:"auth_backend,omitempty"`
+	CertCN      string    `json:"cert_cn,omitempty"`
+	CertSerial  string    `json:"cert_serial,omitempty"`
+	CertError   string    `json:"cert_error,omitempty"`
+	TokenError  string    `json:"token_error,omitempty"`
+	Pattern     string    `json:"pattern,omitempty"`
+}
+
+// streamSummary is the aggregator's response to a closed stream
+type streamSummary struct {
+	Events uint64 `json:"events"`
+}
+
+// eventTypes maps event type names to types
+var eventTypes = func() map[string]parser.EventType {
+	types := make(map[string]parser.EventType)
+	for t := parser.EventUnknown + 1; t.String() != "unknown"; t++ {
+		types[t.String()] = t
+	}
+	return types
+}()
+
+func newWireEvent(node string, e *parser.Event) *wireEvent {
+	return &wireEvent{
+		Node:        node,
+		Type:        e.Type.String(),
+		Time:        e.Timestamp,
+		Server:      e.Server,
+		Username:    e.Username,
+		ClientIP:    e.ClientIP,
+		Port:        e.Port,
+		VpnIP:       e.VpnIP,
+		SessionID:   e.SessionID,
+		Reason:      e.Reason,
+		Group:       e.Group,
+		VHost:       e.VHost,
+		RxBytes:     e.RxBytes,
+		TxBytes:     e.TxBytes,
+		DPDSeconds:  e.DPDSeconds,
+		MTU:         e.MTU,
+		Channel:     e.Channel,
+		UserAgent:   e.UserAgent,
+		Hostname:    e.Hostname,
+		AuthBackend: e.AuthBackend,
+		CertCN:      e.CertCN,
+		CertSerial:  e.CertSerial,
+		CertError:   e.CertError,
+		TokenError:  e.TokenError,
+		Pattern:     e.Pattern,
+	}
+}
+
+// event returns the parsed event, EventUnknown for types this version doesn't know
+func (w *wireEvent) event() *parser.Event {
+	return &parser.Event{
+		Type:        eventTypes[w.Type],
+		Timestamp:   w.Time,
+		Server:      w.Server,
+		Username:    w.Username,
+		ClientIP:    w.ClientIP,
+		Port:        w.Port,
+		VpnIP:       w.VpnIP,
+		SessionID:   w.SessionID,
+		Reason:      w.Reason,
+		Group:       w.Group,
+		VHost:       w.VHost,
+		RxBytes:     w.RxBytes,
+		TxBytes:     w.TxBytes,
+		DPDSeconds:  w.DPDSeconds,
+		MTU:         w.MTU,
+		Channel:     w.Channel,
+		UserAgent:   w.UserAgent,
+		Hostname:    w.Hostname,
+		AuthBackend: w.AuthBackend,
+		CertCN:      w.CertCN,
+		CertSerial:  w.CertSerial,
+		CertError:   w.CertError,
+		TokenError:  w.TokenError,
+		Pattern:     w.Pattern,
+	}
+}
+
+// TLSConfig names the PEM files for mutual TLS: the own certificate and key, and the CA that
+// signed the certificates of the other side
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+	CAFile   string
+}
+
+// load returns the own certificate and the pool of the CA
+func (c TLSConfig) load() (tls.Certificate, *x509.CertPool, error) {
+	if c.CertFile == "" || c.KeyFile == "" || c.CAFile == "" {
+		return tls.Certificate{}, nil, fmt.Errorf("certificate, key and CA files are required for mutual TLS")
+	}
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	pem, err := os.ReadFile(c.CAFile)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return tls.Certificate{}, nil, fmt.Errorf("no certificates in %s", c.CAFile)
+	}
+	return cert, pool, nil
+}
+
+// ServerTLS returns the TLS configuration of an aggregator, requiring agent certificates
+// signed by the CA
+func (c TLSConfig) ServerTLS() (*tls.Config, error) {
+	cert, pool, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// ClientTLS returns the TLS configuration of an agent, trusting aggregator certificates
+// signed by the CA
+func (c TLSConfig) ClientTLS() (*tls.Config, error) {
+	cert, pool, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
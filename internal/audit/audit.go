@@ -0,0 +1,172 @@
+// Package audit runs log lines through the parser to report its coverage: the events recognized
+// by type and samples of the lines no pattern matches, grouped by similarity. It validates the
+// parser against the logs of a new ocserv version before deploying.
+package audit
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mogilevich/ocserv_exporter/internal/eventbus"
+	"github.com/mogilevich/ocserv_exporter/pkg/parser"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+// maxGroups bounds the groups of unmatched lines kept, so a file of unrelated lines doesn't
+// exhaust memory; further templates are counted as ungrouped
+const maxGroups = 10000
+
+// Group is a set of similar unmatched lines
+type Group struct {
+	Template string // the line with variable parts (names, addresses, numbers) replaced by *
+	Sample   string // first line of the group
+	Count    int
+}
+
+// Audit counts the events of the lines it is given
+type Audit struct {
+	bus       *eventbus.Bus
+	published int // events published by the bus, to tell whether a line was recognized
+	lines     int
+	types     map[parser.EventType]int
+	groups    map[string]*Group
+	ungrouped int
+}
+
+// New creates an audit of the lines processed by bus, subscribing to it
+func New(bus *eventbus.Bus) *Audit {
+	a := &Audit{
+		bus:    bus,
+		types:  make(map[parser.EventType]int),
+		groups: make(map[string]*Group),
+	}
+	bus.Subscribe(eventbus.ConsumerFunc(func(event *parser.Event) {
+		a.published++
+		a.types[event.Type]++
+	}))
+	return a
+}
+
+// Add processes a log line. Lines must be added from one goroutine.
+func (a *Audit) Add(ts time.Time, message, unit string) {
+	a.lines++
+	before := a.published
+	a.bus.ProcessLogLine(ts, message, unit)
+	if a.published != before {
+		return
+	}
+
+	template := Template(message)
+	group, ok := a.groups[template]
+	if !ok {
+		if len(a.groups) >= maxGroups {
+			a.ungrouped++
+			return
+		}
+		group = &Group{Template: template, Sample: message}
+		a.groups[template] = group
+	}
+	group.Count++
+}
+
+var (
+	reBracketed = regexp.MustCompile(`\[[^\]]*\]`)
+	reQuoted    = regexp.MustCompile(`'[^']*'|"[^"]*"`)
+	reVariable  = regexp.MustCompile(`[^\s'"\[\]():,;=]*[0-9][^\s'"\[\]():,;=]*`)
+)
+
+// Template returns a line with its variable parts replaced, so similar lines of different users,
+// addresses or sessions get the same template: names in brackets and quotes, and words with
+// digits (addresses, ports, session IDs, byte counts)
+func Template(message string) string {
+	template := reBracketed.ReplaceAllString(message, "[*]")
+	template = reQuoted.ReplaceAllString(template, "'*'")
+	return reVariable.ReplaceAllString(template, "*")
+}
+
+// Groups returns the groups of unmatched lines, the largest first
+func (a *Audit) Groups() []*Group {
+	groups := make([]*Group, 0, len(a.groups))
+	for _, group := range a.groups {
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Count != groups[j].Count {
+			return groups[i].Count > groups[j].Count
+		}
+		return groups[i].Template < groups[j].Template
+	})
+	return groups
+}
+
+// WriteReport writes the line and event counts and up to samples groups of unmatched lines
+func (a *Audit) WriteReport(w io.Writer, samples int) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Lines:       %d\n", a.lines)
+	fmt.Fprintf(&b, "Recognized:  %d (%s)\n", a.published, percent(a.published, a.lines))
+	fmt.Fprintf(&b, "Unmatched:   %d (%s)\n", a.unmatched(), percent(a.unmatched(), a.lines))
+
+	if len(a.types) > 0 {
+		types := make([]parser.EventType, 0, len(a.types))
+		for t := range a.types {
+			types = append(types, t)
+		}
+		sort.Slice(types, func(i, j int) bool {
+			if a.types[types[i]] != a.types[types[j]] {
+				return a.types[types[i]] > a.types[types[j]]
+			}
+			return types[i] < types[j]
+		})
+		b.WriteString("\nEvents by type:\n")
+		for _, t := range types {
+			fmt.Fprintf(&b, "  %-24s %d\n", t, a.types[t])
+		}
+	}
+
+	groups := a.Groups()
+	if len(groups) > 0 && samples > 0 {
+		fmt.Fprintf(&b, "\nUnmatched lines by similarity (%d of %d groups):\n", min(samples, len(groups)), len(groups))
+		for _, group := range groups[:min(samples, len(groups))] {
+			fmt.Fprintf(&b, "  %8d  %s\n", group.Count, group.Template)
+			fmt.Fprintf(&b, "            e.g. %s\n", group.Sample)
+		}
+	}
+	if a.ungrouped > 0 {
+		fmt.Fprintf(&b, "  %8d  (lines of further templates, not grouped)\n", a.ungrouped)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// unmatched returns the number of lines without a recognized event
+func (a *Audit) unmatched() int {
+	return a.lines - a.published
+}
+
+// percent formats n as a share of total
+func percent(n, total int) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(n)/float64(total))
+}
+
+// WriteMetrics writes the metrics gathered from g in the text exposition format
+func WriteMetrics(w io.Writer, g prometheus.Gatherer) error {
+	families, err := g.Gather()
+	if err != nil {
+		return err
+	}
+	for _, family := range families {
+		if _, err := expfmt.MetricFamilyToText(w, family); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package audit
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mogilevich/ocserv_exporter/internal/eventbus"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestTemplate(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"main[bob]:62.4.32.53:30595 new thing happened", "main[*]:*:* new thing happened"},
+		{"main[alice]:10.0.0.1:1234 new thing happened", "main[*]:*:* new thing happened"},
+		{"sec-mod: user 'bob' did something (session: yKsy7b)", "sec-mod: user '*' did something (session: *)"},
+		{"worker: 2001:db8::1 rekeyed after 3600 secs", "worker: *:*::* rekeyed after * secs"},
+	}
+	for _, tt := range tests {
+		if got := Template(tt.line); got != tt.want {
+			t.Errorf("Template(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestAuditReport(t *testing.T) {
+	audit := New(eventbus.New())
+	ts := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	lines := []string{
+		"main[bob]:62.4.32.53:30595 user logged in",
+		"main[bob]:62.4.32.53:30595 user disconnected (reason: user disconnected, rx: 1, tx: 2)",
+		"main[bob]:62.4.32.53:30595 new thing happened",
+		"main[alice]:10.0.0.1:1234 new thing happened",
+		"main: something else",
+	}
+	for _, line := range lines {
+		audit.Add(ts, line, "ocserv")
+	}
+
+	groups := audit.Groups()
+	if len(groups) != 2 || groups[0].Count != 2 || groups[0].Sample != lines[2] {
+		t.Fatalf("groups = %+v, want the two new thing lines first", groups)
+	}
+
+	var b strings.Builder
+	if err := audit.WriteReport(&b, 10); err != nil {
+		t.Fatal(err)
+	}
+	report := b.String()
+	for _, want := range []string{"Lines:       5", "Recognized:  2 (40.0%)", "Unmatched:   3 (60.0%)", "login", "disconnect", "main[*]:*:* new thing happened"} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report lacks %q:\n%s", want, report)
+		}
+	}
+}
+
+func TestWriteMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "ocserv_test_total", Help: "Test."})
+	reg.MustRegister(counter)
+	counter.Add(3)
+
+	var b strings.Builder
+	if err := WriteMetrics(&b, reg); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "ocserv_test_total 3\n") {
+		t.Errorf("metrics:\n%s", b.String())
+	}
+}
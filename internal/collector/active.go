@@ -0,0 +1,55 @@
+package collector
+
+import "strings"
+
+// activeSeries is an ActiveSessions series and the number of sessions it counts
+type activeSeries struct {
+	labels []string
+	count  int
+}
+
+// adjustActiveSessions adds delta sessions to the ActiveSessions series of session.
+// Series are set from the tracked count rather than incremented, so they never go negative,
+// and are deleted once no session is left. Must be called with c.mu held.
+func (c *Collector) adjustActiveSessions(session *Session, delta int) {
+	labels := userLabels(session.Server, session.Username, session.VHost, session.Group)
+	key := strings.Join(labels, "\xff")
+	series, ok := c.activeSeries[key]
+	if !ok {
+		series = &activeSeries{labels: labels}
+		c.activeSeries[key] = series
+	}
+	series.count = max(series.count+delta, 0)
+	if series.count == 0 {
+		delete(c.activeSeries, key)
+		ActiveSessions.DeleteLabelValues(labels...)
+		return
+	}
+	ActiveSessions.WithLabelValues(labels...).Set(float64(series.count))
+}
+
+// reconcileActiveSessions rebuilds ActiveSessions from the session map, the authoritative
+// state, repairing any drift. Must be called with c.mu held.
+func (c *Collector) reconcileActiveSessions() {
+	counts := make(map[string]*activeSeries, len(c.activeSeries))
+	for _, session := range c.sessions {
+		labels := userLabels(session.Server, session.Username, session.VHost, session.Group)
+		key := strings.Join(labels, "\xff")
+		series, ok := counts[key]
+		if !ok {
+			series = &activeSeries{labels: labels}
+			counts[key] = series
+		}
+		series.count++
+	}
+
+	for key, series := range c.activeSeries {
+		if _, ok := counts[key]; !ok {
+			ActiveSessions.DeleteLabelValues(series.labels...)
+		}
+	}
+	for _, series := range counts {
+		ActiveSessions.WithLabelValues(series.labels...).Set(float64(series.count))
+	}
+	c.activeSeries = counts
+}
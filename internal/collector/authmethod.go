@@ -0,0 +1,113 @@
+package collector
+
+import (
+	"slices"
+	"time"
+
+	"github.com/mogilevich/ocserv_exporter/internal/ocservconf"
+	"github.com/mogilevich/ocserv_exporter/pkg/parser"
+)
+
+// Values of the auth_method label
+const (
+	AuthMethodPassword     = "password"
+	AuthMethodCertificate  = "certificate"
+	AuthMethodCertPassword = "certificate+password"
+	AuthMethodOIDC         = "oidc"
+)
+
+// authBackendRecord remembers the auth module that logged about a user's authentication
+type authBackendRecord struct {
+	Backend   string
+	Timestamp time.Time
+}
+
+// rememberAuthBackend records the auth module of a backend line. Must be called with c.mu held.
+func (c *Collector) rememberAuthBackend(event *parser.Event) {
+	if event.AuthBackend == "" || event.Username == "" {
+		return
+	}
+	c.authBackends[authReasonUserKey(event.Server, event.Username)] = &authBackendRecord{
+		Backend:   event.AuthBackend,
+		Timestamp: event.Timestamp,
+	}
+}
+
+// takeAuthBackend returns and forgets the auth module of the user's current attempt.
+// Must be called with c.mu held.
+func (c *Collector) takeAuthBackend(event *parser.Event) string {
+	key := authReasonUserKey(event.Server, event.Username)
+	record, ok := c.authBackends[key]
+	if !ok {
+		return ""
+	}
+	delete(c.authBackends, key)
+	if event.Timestamp.Sub(record.Timestamp) > AuthPendingTimeout {
+		return ""
+	}
+	return record.Backend
+}
+
+// takeCertificate reports whether a client certificate was accepted for the client IP of the
+// attempt, forgetting it. Must be called with c.mu held.
+func (c *Collector) takeCertificate(event *parser.Event) bool {
+	key := authReasonIPKey(event.Server, event.ClientIP)
+	record, ok := c.certSeen[key]
+	if !ok {
+		return false
+	}
+	delete(c.certSeen, key)
+	return event.Timestamp.Sub(record.Timestamp) <= AuthPendingTimeout
+}
+
+// authMethod returns how the user of a login event authenticated, consuming any client
+// certificate and auth module recorded for the attempt. Must be called with c.mu held.
+func (c *Collector) authMethod(event *parser.Event) string {
+	return c.classifyAuthMethod(event, c.takeCertificate(event), c.takeAuthBackend(event))
+}
+
+// failedAuthMethod returns the method of a failed authentication attempt. Must be called with c.mu held.
+func (c *Collector) failedAuthMethod(event *parser.Event, reason string) string {
+	if reason == parser.AuthReasonCertificate {
+		return AuthMethodCertificate
+	}
+	return c.classifyAuthMethod(event, c.takeCertificate(event), c.takeAuthBackend(event))
+}
+
+// classifyAuthMethod combines what is known about an attempt: a certificate accepted by the
+// worker, the auth module that logged about the user and the auth methods of ocserv.conf
+func (c *Collector) classifyAuthMethod(event *parser.Event, certificate bool, backend string) string {
+	methods := c.configAuthMethods(event.Server, event.Username)
+	if backend == "oidc" || (backend == "" && slices.Equal(methods, []string{"oidc"})) {
+		return AuthMethodOIDC
+	}
+	if !certificate {
+		return AuthMethodPassword
+	}
+	// "auth" lines of ocserv.conf are chained: a certificate plus another method needs both
+	if backend != "" || (slices.Contains(methods, "certificate") && len(methods) > 1) {
+		return AuthMethodCertPassword
+	}
+	return AuthMethodCertificate
+}
+
+// configAuthMethods returns the chained "auth" methods of the user's virtual host in the
+// server's ocserv.conf, nil without a parsed config. Must be called with c.mu held.
+func (c *Collector) configAuthMethods(server, username string) []string {
+	settings, ok := c.serverSettings[server]
+	if !ok {
+		return nil
+	}
+	_, vhost := c.lookupUser(server, username)
+	var auth []string
+	for _, s := range settings {
+		if s.VHost == vhost {
+			auth = s.Auth
+			break
+		}
+		if s.VHost == ocservconf.DefaultVHost {
+			auth = s.Auth
+		}
+	}
+	return authMethodNames(auth)
+}
@@ -0,0 +1,130 @@
+package collector
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// ClientIPOther is the client_ip label value of ClientIPConnections for the IPs outside the top list
+const ClientIPOther = "other"
+
+// ClientIPRefreshInterval is how often the top client IPs are recomputed (and the window advances)
+const ClientIPRefreshInterval = time.Minute
+
+// ClientIPConfig sets up counting connections by client IP in a pruned structure instead of the
+// client_ip label of connections_total (see LabelConfig.ClientIPTopN)
+type ClientIPConfig struct {
+	TopN   int           // client IPs exported per server; the others add up to client_ip="other"
+	Window time.Duration // connections are counted over this window
+}
+
+// clientIPCounts counts connections by server and client IP in buckets of ClientIPRefreshInterval;
+// buckets leaving the window are dropped, so only recently seen IPs take memory
+type clientIPCounts struct {
+	cfg     ClientIPConfig
+	buckets []map[string]map[string]int // oldest first, the last one is current; server -> IP -> connections
+}
+
+// SetClientIPConfig enables counting connections by client IP. Must be called before events are processed.
+func (c *Collector) SetClientIPConfig(cfg ClientIPConfig) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if cfg.Window < ClientIPRefreshInterval {
+		cfg.Window = ClientIPRefreshInterval
+	}
+	c.clientIPs = &clientIPCounts{
+		cfg:     cfg,
+		buckets: []map[string]map[string]int{make(map[string]map[string]int)},
+	}
+}
+
+// countClientIP counts a connection from clientIP. Must be called with c.mu held.
+func (c *Collector) countClientIP(server, clientIP string) {
+	if c.clientIPs == nil {
+		return
+	}
+	current := c.clientIPs.buckets[len(c.clientIPs.buckets)-1]
+	ips, ok := current[server]
+	if !ok {
+		ips = make(map[string]int)
+		current[server] = ips
+	}
+	ips[ClientIP(clientIP)]++
+}
+
+// RunClientIPs refreshes ClientIPConnections every ClientIPRefreshInterval until ctx is cancelled
+func (c *Collector) RunClientIPs(ctx context.Context) {
+	ticker := time.NewTicker(ClientIPRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.refreshClientIPs()
+		}
+	}
+}
+
+// refreshClientIPs exports the top client IPs of each server over the window and advances the window
+func (c *Collector) refreshClientIPs() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counts := c.clientIPs
+	if counts == nil {
+		return
+	}
+
+	totals := make(map[string]map[string]int)
+	for _, bucket := range counts.buckets {
+		for server, ips := range bucket {
+			if totals[server] == nil {
+				totals[server] = make(map[string]int)
+			}
+			for ip, n := range ips {
+				totals[server][ip] += n
+			}
+		}
+	}
+
+	ClientIPConnections.Reset()
+	for server, ips := range totals {
+		type ipCount struct {
+			ip string
+			n  int
+		}
+		ranked := make([]ipCount, 0, len(ips))
+		for ip, n := range ips {
+			ranked = append(ranked, ipCount{ip, n})
+		}
+		sort.Slice(ranked, func(i, j int) bool {
+			if ranked[i].n != ranked[j].n {
+				return ranked[i].n > ranked[j].n
+			}
+			return ranked[i].ip < ranked[j].ip
+		})
+
+		other := 0
+		for i, rc := range ranked {
+			// Addresses dropped while shedding have no label value and count as other
+			if i >= counts.cfg.TopN || rc.ip == "" {
+				other += rc.n
+				continue
+			}
+			ClientIPConnections.WithLabelValues(server, rc.ip).Set(float64(rc.n))
+		}
+		if other > 0 {
+			ClientIPConnections.WithLabelValues(server, ClientIPOther).Set(float64(other))
+		}
+	}
+
+	keep := int(counts.cfg.Window / ClientIPRefreshInterval)
+	counts.buckets = append(counts.buckets, make(map[string]map[string]int))
+	if len(counts.buckets) > keep {
+		counts.buckets = counts.buckets[len(counts.buckets)-keep:]
+	}
+}
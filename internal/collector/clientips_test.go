@@ -0,0 +1,64 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestClientIPs(t *testing.T) {
+	c := New()
+	c.SetClientIPConfig(ClientIPConfig{TopN: 2, Window: 3 * ClientIPRefreshInterval})
+	connect := func(server, ip string, n int) {
+		for range n {
+			c.countClientIP(server, ip)
+		}
+	}
+	check := func(step string, want map[[2]string]float64) {
+		t.Helper()
+		if got := testutil.CollectAndCount(ClientIPConnections); got != len(want) {
+			t.Errorf("%s: %d series, want %d", step, got, len(want))
+		}
+		for labels, n := range want {
+			if got := testutil.ToFloat64(ClientIPConnections.WithLabelValues(labels[0], labels[1])); got != n {
+				t.Errorf("%s: %v = %v, want %v", step, labels, got, n)
+			}
+		}
+	}
+
+	connect("s1", "198.51.100.1", 1)
+	connect("s1", "198.51.100.2", 3)
+	connect("s1", "198.51.100.3", 1)
+	connect("s1", "198.51.100.4", 2)
+	connect("s2", "203.0.113.1", 1)
+	c.refreshClientIPs()
+	// Ties rank by address; the IPs below the top 2 add up to other
+	check("first refresh", map[[2]string]float64{
+		{"s1", "198.51.100.2"}: 3,
+		{"s1", "198.51.100.4"}: 2,
+		{"s1", ClientIPOther}:  2,
+		{"s2", "203.0.113.1"}:  1,
+	})
+
+	// Connections of later buckets add up with those still in the window
+	connect("s1", "198.51.100.1", 4)
+	c.refreshClientIPs()
+	check("second refresh", map[[2]string]float64{
+		{"s1", "198.51.100.1"}: 5,
+		{"s1", "198.51.100.2"}: 3,
+		{"s1", ClientIPOther}:  3,
+		{"s2", "203.0.113.1"}:  1,
+	})
+
+	// The first bucket leaves the 3 minute window after the third refresh
+	c.refreshClientIPs()
+	c.refreshClientIPs()
+	check("first bucket out of the window", map[[2]string]float64{
+		{"s1", "198.51.100.1"}: 4,
+	})
+	c.refreshClientIPs()
+	check("window passed", nil)
+	if got := len(c.clientIPs.buckets); got != 3 {
+		t.Errorf("%d buckets kept, want 3", got)
+	}
+}
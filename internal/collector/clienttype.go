@@ -0,0 +1,78 @@
+package collector
+
+import (
+	"time"
+
+	"github.com/mogilevich/ocserv_exporter/pkg/parser"
+)
+
+// clientInfoRecord remembers the user agent and hostname a worker logged for a client IP
+// until the login completes
+type clientInfoRecord struct {
+	UserAgent string
+	Hostname  string
+	Timestamp time.Time
+}
+
+// SetClientTypesFromLogs makes the collector maintain SessionsByClientType from user agents
+// seen in the logs, for setups without occtl polling. Must be called before events are processed.
+func (c *Collector) SetClientTypesFromLogs(enabled bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.logClientTypes = enabled
+}
+
+func (c *Collector) handleClientInfo(event *parser.Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := authReasonIPKey(event.Server, event.ClientIP)
+	record, ok := c.clientInfo[key]
+	if !ok || event.Timestamp.Sub(record.Timestamp) > AuthPendingTimeout {
+		if !ok {
+			c.makeRoomForClientInfo()
+		}
+		record = &clientInfoRecord{}
+		c.clientInfo[key] = record
+	}
+	if event.UserAgent != "" {
+		record.UserAgent = event.UserAgent
+	}
+	if event.Hostname != "" {
+		record.Hostname = event.Hostname
+	}
+	record.Timestamp = event.Timestamp
+}
+
+// takeClientInfo returns the client type and hostname logged during the handshake of a login,
+// consuming the record. The client type is empty when no user agent was seen.
+// Must be called with c.mu held.
+func (c *Collector) takeClientInfo(event *parser.Event) (clientType, hostname string) {
+	key := authReasonIPKey(event.Server, event.ClientIP)
+	record, ok := c.clientInfo[key]
+	if !ok {
+		return "", ""
+	}
+	delete(c.clientInfo, key)
+	if event.Timestamp.Sub(record.Timestamp) > AuthPendingTimeout {
+		return "", ""
+	}
+	if record.UserAgent != "" {
+		clientType = parser.ClassifyUserAgent(record.UserAgent)
+	}
+	return clientType, record.Hostname
+}
+
+// adjustClientTypeSessions updates the log-derived client type breakdown for a session.
+// Must be called with c.mu held.
+func (c *Collector) adjustClientTypeSessions(session *Session, delta float64) {
+	if !c.logClientTypes {
+		return
+	}
+	clientType := session.ClientType
+	if clientType == "" {
+		clientType = parser.ClassifyUserAgent("")
+	}
+	SessionsByClientType.WithLabelValues(session.Server, clientType).Add(delta)
+}
@@ -1,11 +1,16 @@
 package collector
 
 import (
-	"fmt"
+	"net"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/mogilevich/ocserv_exporter/internal/parser"
+	"github.com/mogilevich/ocserv_exporter/internal/ocservconf"
+	"github.com/mogilevich/ocserv_exporter/internal/sketch"
+	"github.com/mogilevich/ocserv_exporter/pkg/occtl"
+	"github.com/mogilevich/ocserv_exporter/pkg/parser"
 )
 
 const (
@@ -16,24 +21,48 @@ const (
 	// MaxSessionAge is the maximum age for a session before it's considered stale and cleaned up
 	// This prevents "stuck" sessions if disconnect event was missed
 	MaxSessionAge = 24 * time.Hour
+	// SessionInvalidatedReason is the disconnect reason of sessions closed by sec-mod invalidating
+	// their session ID without a disconnect line
+	SessionInvalidatedReason = "session invalidated"
+	// AuthReasonWindow is how long an auth backend failure reason waits for the matching failed attempt
+	AuthReasonWindow = 30 * time.Second
+	// AuthPendingTimeout is how long an auth init waits for a backend result before it is dropped
+	AuthPendingTimeout = 2 * time.Minute
 )
 
 // Session represents an active VPN session
 type Session struct {
-	Server    string
-	Username  string
-	ClientIP  string
-	Port      int
-	VpnIP     string
-	Country   string
-	SessionID string
-	StartTime time.Time
+	Server     string
+	Username   string
+	ClientIP   string
+	Port       int
+	VpnIP      string
+	Country    string
+	Group      string
+	VHost      string
+	SessionID  string
+	ClientType string // VPN client type from the user agent the worker logged, empty if unknown
+	MTU        int    // last link MTU configured by the worker, 0 if unknown
+	InterimRx  uint64 // bytes already added to ReceivedBytesTotal from occtl readings
+	InterimTx  uint64 // bytes already added to SentBytesTotal from occtl readings
+	StartTime  time.Time
+	Confirmed  time.Time // last occtl poll reporting the session (see ReconcileSessions)
+	infoLabels []string  // label values of the published SessionInfo series, nil if none
+	handles    *userHandles
+}
+
+// sessionIDRecord links an ocserv session ID (sec-mod cookie) to the session it was used for
+type sessionIDRecord struct {
+	Username   string
+	SessionKey string    // key in Collector.sessions, empty until the login is seen
+	Timestamp  time.Time // session start or last login with this ID
 }
 
 // DisconnectRecord tracks recent disconnects for reconnect detection
 type DisconnectRecord struct {
 	Server    string
 	Timestamp time.Time
+	handles   *userHandles
 }
 
 // WorkerContext tracks recent worker events for a session to enrich disconnect reasons
@@ -48,29 +77,126 @@ type WorkerContext struct {
 	LastUpdate  time.Time // for cleanup
 }
 
+// AuthFailureRecord holds a classified auth failure reason until the matching failed attempt is logged
+type AuthFailureRecord struct {
+	Reason    string
+	Timestamp time.Time
+}
+
+// userRecord remembers the ocserv group and virtual host a user was last seen with
+type userRecord struct {
+	Group      string
+	VHost      string
+	ClientType string // VPN client type reported by occtl or logged by the worker
+	LastSeen   time.Time
+}
+
+// CertRecord remembers a client certificate accepted for a client IP until the login completes
+type CertRecord struct {
+	CN        string
+	Timestamp time.Time
+}
+
 // GeoIPResolver resolves IP addresses to country information
 type GeoIPResolver interface {
 	Lookup(ip string) (country, countryCode string)
 	Close() error
 }
 
+// ReverseDNSResolver resolves IP addresses to the domain of their PTR record
+type ReverseDNSResolver interface {
+	// CachedDomain returns the domain without waiting for DNS, "" while it is being resolved
+	CachedDomain(ip string) string
+}
+
 // Collector processes ocserv events and updates metrics
 type Collector struct {
 	mu              sync.RWMutex
-	sessions        map[string]*Session          // key: "server:username:clientIP:port"
-	lastDisconnects map[string]*DisconnectRecord // key: "server:username" -> last disconnect time
-	workerContext   map[string]*WorkerContext    // key: "server:username:clientIP" -> worker context
-	parser          *parser.Parser
+	sessions        map[string]*Session           // key: "server:username:clientIP:port"
+	sessionIDs      map[string]*sessionIDRecord   // key: "server:sessionID" -> session using it
+	lastDisconnects map[string]*DisconnectRecord  // key: "server:username" -> last disconnect time
+	workerContext   map[string]*WorkerContext     // key: "server:username:clientIP" or "server:session:sessionID" -> worker context
+	serverTraffic   map[string]*serverTraffic     // key: server -> last occtl RX/TX totals
+	authReasons     map[string]*AuthFailureRecord // key: "server:username" or "server:ip:clientIP" -> pending auth failure reason
+	userRecords     map[string]*userRecord        // key: "server:username" -> group and vhost
+	proxySources    map[string]*sourceRecord      // key: "server:username" -> real address behind a proxy
+	proxyNetworks   []*net.IPNet                  // proxy protocol load balancers
+	certSeen        map[string]*CertRecord        // key: "server:ip:clientIP" -> accepted client certificate
+	clientInfo      map[string]*clientInfoRecord  // key: "server:ip:clientIP" -> user agent and hostname from the handshake
+	authPending     map[string]time.Time          // key: "server:username" -> auth init timestamp
+	authBackends    map[string]*authBackendRecord // key: "server:username" -> auth module of the current attempt
+	loginStarts     map[string]time.Time          // key: "server:username" -> first auth init of a pending connection attempt
+	activeUsers     map[string]map[string]int     // key: server -> username -> active session count
+	activeSeries    map[string]*activeSeries      // key: ActiveSessions label values -> sessions counted
+	uniqueUsers     map[string]*sketch.Window     // key: server -> rolling unique username sketch
 	geoIP           GeoIPResolver
+	rdns            ReverseDNSResolver
+	geoHistory      map[string]*geoHistory // key: username -> last login location and countries seen
+	geoAnomaly      GeoAnomalyConfig
+	countryPolicies map[string]CountryPolicy
+	clientIPs       *clientIPCounts
+	topUsers        *topUsers
+	interimUsers    map[string][]occtl.User // key: server -> sessions of the last interim query
+	logClientTypes  bool                    // maintain SessionsByClientType from logged user agents (no occtl)
+	infoSource      string                  // source of SessionInfo series (see SetSessionInfoSource)
+	flap            FlapConfig
+	limits          TrackingLimits
+	flapStates      map[string]*flapState // key: "server:username" -> recent reconnects
+	sinks           []eventSink
+	reasonMap       map[string]string                // lowercased raw disconnect reason -> canonical reason
+	serverSettings  map[string][]ocservconf.Settings // key: server -> settings per vhost (from ocserv.conf)
+	vpnIPRefs       map[string]map[string]int        // key: server -> VPN IP -> references (journal sessions + occtl)
+	occtlVpnIPs     map[string]map[string]bool       // key: server -> VPN IPs reported by last occtl poll
+	poolUsed        map[string]map[string]int        // key: server -> vhost -> assigned addresses
+	atSessionLimit  map[string]map[string]bool       // key: server -> usernames at max-same-clients in the last occtl poll
+	servers         map[string]*serverHandles        // key: server -> cached child metrics
+	backfillUntil   time.Time                        // events before this rebuild state without counting
+
+	lastUniqueRefresh time.Time
 }
 
 // New creates a new Collector
 func New() *Collector {
 	return &Collector{
 		sessions:        make(map[string]*Session),
+		sessionIDs:      make(map[string]*sessionIDRecord),
 		lastDisconnects: make(map[string]*DisconnectRecord),
 		workerContext:   make(map[string]*WorkerContext),
-		parser:          parser.New(),
+		serverTraffic:   make(map[string]*serverTraffic),
+		authReasons:     make(map[string]*AuthFailureRecord),
+		authPending:     make(map[string]time.Time),
+		authBackends:    make(map[string]*authBackendRecord),
+		loginStarts:     make(map[string]time.Time),
+		certSeen:        make(map[string]*CertRecord),
+		clientInfo:      make(map[string]*clientInfoRecord),
+		activeSeries:    make(map[string]*activeSeries),
+		userRecords:     make(map[string]*userRecord),
+		proxySources:    make(map[string]*sourceRecord),
+		geoHistory:      make(map[string]*geoHistory),
+		geoAnomaly: GeoAnomalyConfig{
+			MaxTravelSpeed:      DefaultMaxTravelSpeed,
+			CountryChangeWindow: DefaultCountryChangeWindow,
+		},
+		flap: FlapConfig{
+			Threshold: DefaultFlapThreshold,
+			Window:    DefaultFlapWindow,
+		},
+		limits: TrackingLimits{
+			Sessions:       DefaultMaxSessions,
+			Disconnects:    DefaultMaxDisconnects,
+			WorkerContexts: DefaultMaxWorkerContexts,
+			AuthStates:     DefaultMaxAuthStates,
+		},
+		flapStates:     make(map[string]*flapState),
+		infoSource:     SessionInfoMerged,
+		activeUsers:    make(map[string]map[string]int),
+		uniqueUsers:    make(map[string]*sketch.Window),
+		vpnIPRefs:      make(map[string]map[string]int),
+		occtlVpnIPs:    make(map[string]map[string]bool),
+		poolUsed:       make(map[string]map[string]int),
+		atSessionLimit: make(map[string]map[string]bool),
+		interimUsers:   make(map[string][]occtl.User),
+		servers:        make(map[string]*serverHandles),
 	}
 }
 
@@ -79,154 +205,337 @@ func (c *Collector) SetGeoIPResolver(resolver GeoIPResolver) {
 	c.geoIP = resolver
 }
 
-// LookupCountry returns the country name for an IP address
-func (c *Collector) LookupCountry(ip string) string {
-	if c.geoIP == nil {
-		return ""
-	}
-	country, _ := c.geoIP.Lookup(ip)
-	return country
+// SetReverseDNSResolver sets the reverse DNS resolver used for the rdns label
+func (c *Collector) SetReverseDNSResolver(resolver ReverseDNSResolver) {
+	c.rdns = resolver
+}
+
+// SetReasonMap sets the disconnect reason normalization map
+// Keys are lowercased raw reasons, values are canonical reasons used as label values
+func (c *Collector) SetReasonMap(m map[string]string) {
+	c.reasonMap = m
+}
+
+// SetBackfillUntil makes events with earlier timestamps (history replayed on startup) rebuild
+// session state and gauges only: counters, histograms and event sinks are left alone, so a
+// restart does not count the replayed connections, disconnections and traffic again.
+// Must be called before events are processed.
+func (c *Collector) SetBackfillUntil(t time.Time) {
+	c.backfillUntil = t
+}
+
+// live reports whether an event happened after the backfill phase and may be counted
+func (c *Collector) live(ts time.Time) bool {
+	return !ts.Before(c.backfillUntil)
 }
 
 // ProcessEvent processes a parsed event and updates metrics
 func (c *Collector) ProcessEvent(event *parser.Event) {
 	// Update last event timestamp
 	LastEventTimestamp.Set(float64(event.Timestamp.Unix()))
+	if !c.live(event.Timestamp) {
+		BackfilledEventsTotal.Inc()
+	}
+
+	// Pseudonymize before the username is used in labels, internal state and events; only
+	// sinks registered for clear usernames get the real one (see AddEventSink)
+	username := event.Username
+	event.Username = Username(username)
+
+	if (event.Group != "" || event.VHost != "") && event.Username != "" {
+		c.mu.Lock()
+		c.rememberUser(event.Server, event.Username, event.Group, event.VHost, event.Timestamp)
+		c.mu.Unlock()
+	}
 
 	switch event.Type {
 	case parser.EventUserLogin:
-		c.handleLogin(event)
+		c.handleLogin(event, username)
 	case parser.EventUserDisconnect:
-		c.handleDisconnect(event)
+		c.handleDisconnect(event, username)
 	case parser.EventSessionStart:
 		c.handleSessionStart(event)
+	case parser.EventSessionInvalidate:
+		c.handleSessionInvalidate(event)
 	case parser.EventVPNIPAssigned:
 		c.handleVPNIP(event)
 	case parser.EventAuthFailed:
-		c.handleAuthFailed(event)
+		c.handleAuthFailed(event, username)
 	case parser.EventByePacket:
 		c.handleByePacket(event)
 	case parser.EventDPDWarning:
 		c.handleDPDWarning(event)
 	case parser.EventSecModClose:
 		c.handleSecModClose(event)
+	case parser.EventAuthFailureReason:
+		c.handleAuthFailureReason(event)
+	case parser.EventAuthInit:
+		c.handleAuthInit(event)
+	case parser.EventAuthSuccess:
+		c.handleAuthSuccess(event)
+	case parser.EventAuthBackendError:
+		c.handleAuthBackendError(event)
+	case parser.EventCertAuth:
+		c.handleCertAuth(event)
+	case parser.EventClientInfo:
+		c.handleClientInfo(event)
+	case parser.EventMTU:
+		c.handleMTU(event)
+	case parser.EventRekey:
+		if c.live(event.Timestamp) {
+			RekeysTotal.WithLabelValues(event.Server, event.Channel).Inc()
+		}
+	case parser.EventConnectionRejected:
+		if c.live(event.Timestamp) {
+			ConnectionsRejectedTotal.WithLabelValues(event.Server, event.Reason).Inc()
+			if event.Reason == parser.RejectReasonMaxSameClients && event.Username != "" {
+				SessionLimitHitsTotal.WithLabelValues(event.Server, userLabel(event.Username)).Inc()
+			}
+		}
+	case parser.EventServerStart:
+		c.handleServerStart(event)
+	case parser.EventServerStop:
+		c.flushServer(event.Server)
+	case parser.EventServerReload:
+		if c.live(event.Timestamp) {
+			ServerReloadsTotal.WithLabelValues(event.Server).Inc()
+		}
+	case parser.EventCustom:
+		if c.live(event.Timestamp) {
+			CustomEventsTotal.WithLabelValues(event.Server, event.Pattern).Inc()
+		}
 	}
-}
 
-// ProcessLogLine parses a log line and processes the resulting event
-func (c *Collector) ProcessLogLine(ts time.Time, message string, server string) {
-	event := c.parser.Parse(ts, message, server)
-	if event.Type != parser.EventUnknown {
-		c.ProcessEvent(event)
+	// Logins, disconnects and auth failures are emitted by their handlers with extra context
+	if len(c.sinks) > 0 && event.Type != parser.EventUserLogin && event.Type != parser.EventUserDisconnect && event.Type != parser.EventAuthFailed {
+		out := newEvent(event)
+		c.mu.Lock()
+		c.enrichUser(out)
+		c.emit(out, username)
+		c.mu.Unlock()
 	}
 }
 
-func (c *Collector) handleLogin(event *parser.Event) {
+func (c *Collector) handleLogin(event *parser.Event, username string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	userKey := fmt.Sprintf("%s:%s", event.Server, event.Username)
+	userKey := serverUserKey(event.Server, event.Username)
+	adoptedKey := sessionKey(event.Server, event.Username, event.ClientIP, 0)
 	sessionKey := sessionKey(event.Server, event.Username, event.ClientIP, event.Port)
+	// Behind a proxy protocol load balancer the session is keyed by the balancer's address
+	// main logs, while GeoIP, labels and outputs use the real client address
+	event.ClientIP = c.clientIP(event.Server, event.Username, event.ClientIP)
 
 	// Check for reconnect (login within ReconnectWindow of last disconnect)
+	var handles *userHandles
 	if lastDisconnect, ok := c.lastDisconnects[userKey]; ok {
+		handles = handlesFor(lastDisconnect.handles, event.Server, event.Username)
+		lastDisconnect.handles = handles
 		if event.Timestamp.Sub(lastDisconnect.Timestamp) < ReconnectWindow {
-			ReconnectsTotal.WithLabelValues(event.Server, event.Username).Inc()
+			if c.live(event.Timestamp) {
+				handles.reconnectsTotal().Inc()
+			}
+			c.recordReconnect(event.Server, event.Username, event.Timestamp)
 		}
 	}
 
 	// GeoIP lookup for country
-	var country string
+	var country, countryCode string
 	if c.geoIP != nil {
-		country, _ = c.geoIP.Lookup(event.ClientIP)
+		country, countryCode = c.geoIP.Lookup(event.ClientIP)
+		c.checkGeoAnomaly(event.Server, event.Username, event.ClientIP, country, event.Timestamp)
 	}
 
-	// Store session
-	c.sessions[sessionKey] = &Session{
-		Server:    event.Server,
-		Username:  event.Username,
-		ClientIP:  event.ClientIP,
-		Port:      event.Port,
-		Country:   country,
-		StartTime: event.Timestamp,
+	group, vhost := c.lookupUser(event.Server, event.Username)
+	clientType, hostname := c.takeClientInfo(event)
+	if clientType != "" {
+		c.rememberUser(event.Server, event.Username, "", "", event.Timestamp)
+		c.userRecords[authReasonUserKey(event.Server, event.Username)].ClientType = clientType
 	}
 
+	// A login with the session ID of an earlier login resumed that session with its cookie
+	sessionID, resumed := c.linkSessionID(event.Server, event.Username, sessionKey, event.Timestamp)
+	if resumed && c.live(event.Timestamp) {
+		SessionResumptionsTotal.WithLabelValues(event.Server).Inc()
+	}
+
+	// A session adopted from occtl before its login line was read is the same session
+	if adopted, ok := c.sessions[adoptedKey]; ok {
+		c.removeSession(adoptedKey, adopted)
+	}
+
+	// Store session (a duplicate login for the same key replaces the old session)
+	if old, exists := c.sessions[sessionKey]; !exists {
+		c.makeRoomForSession()
+		c.trackActiveUser(event.Server, event.Username, event.Timestamp)
+	} else {
+		if old.MTU != 0 {
+			SessionsByMTU.WithLabelValues(old.Server, strconv.Itoa(old.MTU)).Dec()
+		}
+		c.adjustClientTypeSessions(old, -1)
+		c.adjustActiveSessions(old, -1)
+	}
+	session := &Session{
+		Server:     event.Server,
+		Username:   event.Username,
+		ClientIP:   event.ClientIP,
+		Port:       event.Port,
+		Country:    country,
+		Group:      group,
+		VHost:      vhost,
+		SessionID:  sessionID,
+		ClientType: clientType,
+		StartTime:  event.Timestamp,
+		handles:    handlesFor(handles, event.Server, event.Username),
+	}
+	c.sessions[sessionKey] = session
+	c.adjustClientTypeSessions(session, 1)
+
 	// Set session info metric (VPN IP will be updated later when assigned)
-	SessionInfo.WithLabelValues(event.Server, event.Username, "", country, "").Set(float64(event.Timestamp.Unix()))
+	c.publishSessionInfo(session)
 
 	// Update metrics
-	ActiveSessions.WithLabelValues(event.Server, event.Username).Inc()
-	ConnectionsTotal.WithLabelValues(event.Server, event.Username, event.ClientIP).Inc()
+	c.observeLoginLatency(event)
+	authMethod := c.authMethod(event)
+	c.adjustActiveSessions(session, 1)
+	if c.live(event.Timestamp) {
+		ConnectionsTotal.WithLabelValues(connectionLabels(event.Server, event.Username, vhost, group, event.ClientIP, authMethod)...).Inc()
+		c.countClientIP(event.Server, event.ClientIP)
+
+		// ConnectionsByCountry (uses countryCode too)
+		if c.geoIP != nil && country != "" {
+			ConnectionsByCountry.WithLabelValues(event.Server, userLabel(event.Username), country, countryCode).Inc()
+			c.checkCountryPolicy(event.Server, event.Username, country, countryCode)
+		}
+	}
 
-	// ConnectionsByCountry (uses countryCode too)
-	if c.geoIP != nil && country != "" {
-		_, countryCode := c.geoIP.Lookup(event.ClientIP)
-		ConnectionsByCountry.WithLabelValues(event.Server, event.Username, country, countryCode).Inc()
+	if len(c.sinks) > 0 {
+		out := newEvent(event)
+		out.Country, out.CountryCode = country, countryCode
+		out.Group, out.VHost = group, vhost
+		out.AuthMethod = authMethod
+		out.ClientType, out.Hostname = clientType, hostname
+		out.UserSessions = c.activeUsers[event.Server][event.Username]
+		c.enrichUser(out)
+		c.emit(out, username)
 	}
 }
 
-func (c *Collector) handleDisconnect(event *parser.Event) {
+func (c *Collector) handleDisconnect(event *parser.Event, username string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	userKey := fmt.Sprintf("%s:%s", event.Server, event.Username)
+	userKey := serverUserKey(event.Server, event.Username)
 	key := sessionKey(event.Server, event.Username, event.ClientIP, event.Port)
+	if _, ok := c.sessions[key]; !ok {
+		// The session may have been adopted from occtl without its login line
+		if adoptedKey := sessionKey(event.Server, event.Username, event.ClientIP, 0); c.sessions[adoptedKey] != nil {
+			key = adoptedKey
+		}
+	}
+	if session, ok := c.sessions[key]; ok {
+		event.ClientIP = session.ClientIP // real client address behind a proxy
+	} else {
+		event.ClientIP = c.clientIP(event.Server, event.Username, event.ClientIP)
+	}
 	ctxKey := workerContextKey(event.Server, event.Username, event.ClientIP)
+	secModKey := ""
 
 	var duration float64
-	var vpnIP, country string
+	var vpnIP, country, sessionID string
+	var interimRx, interimTx uint64
+	group, vhost := c.lookupUser(event.Server, event.Username)
 	sessionExists := false
+	var handles *userHandles
+	if record, ok := c.lastDisconnects[userKey]; ok {
+		handles = record.handles
+	}
 
 	if session, ok := c.sessions[key]; ok {
 		sessionExists = true
+		handles = session.handles
 		vpnIP = session.VpnIP
 		country = session.Country
+		group = session.Group
+		vhost = session.VHost
+		interimRx, interimTx = session.InterimRx, session.InterimTx
+		sessionID = session.SessionID
+		if sessionID != "" {
+			secModKey = sessionContextKey(event.Server, sessionID)
+		}
 		duration = event.Timestamp.Sub(session.StartTime).Seconds()
-		if duration > 0 {
-			SessionDuration.WithLabelValues(event.Server, event.Username).Observe(duration)
+		if duration > 0 && c.live(event.Timestamp) {
+			c.observeSessionDuration(session, duration)
 		}
-		// Remove session info metric
-		SessionInfo.DeleteLabelValues(event.Server, event.Username, vpnIP, country, "")
-		delete(c.sessions, key)
+		c.removeSession(key, session)
 	}
 
 	// Enrich disconnect reason based on worker context
-	reason := c.enrichDisconnectReason(event.Reason, ctxKey, event.Server, event.Username)
+	reason := c.enrichDisconnectReason(event.Reason, ctxKey, secModKey)
 
 	// Track problematic sessions (short duration + actual error reason)
 	// "client bye", "user disconnected", and "mobile sleep" are not errors - expected behavior
 	isProblematicReason := reason != "user disconnected" && reason != "client bye" && reason != "mobile sleep" && reason != ""
-	if sessionExists && duration < ProblematicSessionThreshold && duration > 0 && isProblematicReason {
-		ProblematicSessionsTotal.WithLabelValues(event.Server, event.Username, reason).Inc()
+	if sessionExists && duration < ProblematicSessionThreshold && duration > 0 && isProblematicReason && c.live(event.Timestamp) {
+		incWithExemplar(ProblematicSessionsTotal.WithLabelValues(event.Server, userLabel(event.Username), c.normalizeReason(reason)), sessionID, event.ClientIP)
 	}
 
 	// Store disconnect time for reconnect detection
+	if _, ok := c.lastDisconnects[userKey]; !ok {
+		c.makeRoomForDisconnect()
+	}
+	handles = handlesFor(handles, event.Server, event.Username)
 	c.lastDisconnects[userKey] = &DisconnectRecord{
 		Server:    event.Server,
 		Timestamp: event.Timestamp,
+		handles:   handles,
+	}
+
+	if c.live(event.Timestamp) {
+		handles.disconnectionsTotal(c.normalizeReason(reason)).Inc()
+		received, sent := handles.traffic(vhost, group)
+		received.Add(float64(remainder(event.RxBytes, interimRx)))
+		sent.Add(float64(remainder(event.TxBytes, interimTx)))
+		server := c.serverHandles(event.Server)
+		server.sessionRx.Observe(float64(event.RxBytes))
+		server.sessionTx.Observe(float64(event.TxBytes))
+
+		if c.geoIP != nil {
+			trafficCountry := country
+			if !sessionExists {
+				trafficCountry, _ = c.geoIP.Lookup(event.ClientIP)
+			}
+			if trafficCountry == "" {
+				trafficCountry = "Unknown"
+			}
+			TrafficBytesTotal.WithLabelValues(event.Server, "rx", trafficCountry).Add(float64(event.RxBytes))
+			TrafficBytesTotal.WithLabelValues(event.Server, "tx", trafficCountry).Add(float64(event.TxBytes))
+		}
 	}
 
-	// Update metrics - only decrement active sessions if we tracked the login
-	if sessionExists {
-		ActiveSessions.WithLabelValues(event.Server, event.Username).Dec()
+	if len(c.sinks) > 0 {
+		out := newEvent(event)
+		out.Reason = c.normalizeReason(reason)
+		out.VpnIP = vpnIP
+		out.Country = country
+		out.Group, out.VHost = group, vhost
+		out.DurationSeconds = duration
+		c.enrichUser(out)
+		c.emit(out, username)
 	}
-	DisconnectionsTotal.WithLabelValues(event.Server, event.Username, reason).Inc()
-	ReceivedBytesTotal.WithLabelValues(event.Server, event.Username).Add(float64(event.RxBytes))
-	SentBytesTotal.WithLabelValues(event.Server, event.Username).Add(float64(event.TxBytes))
 
 	// Clean up worker context after disconnect
 	delete(c.workerContext, ctxKey)
-	// Also clean up sec-mod context (stored with empty ClientIP)
-	secModKey := workerContextKey(event.Server, event.Username, "")
+	// Also clean up sec-mod context (stored by session ID)
 	delete(c.workerContext, secModKey)
 }
 
-// enrichDisconnectReason enriches the disconnect reason based on worker context
-func (c *Collector) enrichDisconnectReason(originalReason, ctxKey string, server, username string) string {
+// enrichDisconnectReason enriches the disconnect reason based on the worker context of the
+// client address (ctxKey) and the sec-mod context of the session (secModKey, empty if the
+// session ID is unknown)
+func (c *Collector) enrichDisconnectReason(originalReason, ctxKey, secModKey string) string {
 	ctx, ok := c.workerContext[ctxKey]
-
-	// Also check for sec-mod close context (stored with empty ClientIP)
-	secModKey := workerContextKey(server, username, "")
 	secModCtx, secModOk := c.workerContext[secModKey]
 
 	// If "unspecified error", try to enrich the reason
@@ -253,17 +562,171 @@ func (c *Collector) enrichDisconnectReason(originalReason, ctxKey string, server
 	return originalReason
 }
 
+// normalizeReason maps a disconnect reason to its canonical form using the configured reason map
+func (c *Collector) normalizeReason(reason string) string {
+	if canonical, ok := c.reasonMap[strings.ToLower(reason)]; ok {
+		return canonical
+	}
+	return reason
+}
+
 func (c *Collector) handleSessionStart(event *parser.Event) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	// Store session by ID for potential future use
-	c.sessions["sid:"+event.Server+":"+event.SessionID] = &Session{
-		Server:    event.Server,
+	// Remember the session ID until the login it is used for
+	c.sessionIDs[sessionIDKey(event.Server, event.SessionID)] = &sessionIDRecord{
 		Username:  event.Username,
-		SessionID: event.SessionID,
-		StartTime: event.Timestamp,
+		Timestamp: event.Timestamp,
+	}
+}
+
+// handleSessionInvalidate closes the session using an invalidated session ID. Normally the
+// session already ended with a disconnect line; this catches sessions that didn't log one.
+func (c *Collector) handleSessionInvalidate(event *parser.Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	idKey := sessionIDKey(event.Server, event.SessionID)
+	record, ok := c.sessionIDs[idKey]
+	if !ok {
+		return
+	}
+	delete(c.sessionIDs, idKey)
+	delete(c.workerContext, sessionContextKey(event.Server, event.SessionID))
+
+	session, ok := c.sessions[record.SessionKey]
+	if !ok || session.SessionID != event.SessionID {
+		return
+	}
+	c.removeSession(record.SessionKey, session)
+
+	handles := handlesFor(session.handles, session.Server, session.Username)
+	if c.live(event.Timestamp) {
+		if duration := event.Timestamp.Sub(session.StartTime).Seconds(); duration > 0 {
+			c.observeSessionDuration(session, duration)
+		}
+		handles.disconnectionsTotal(c.normalizeReason(SessionInvalidatedReason)).Inc()
+	}
+	userKey := serverUserKey(session.Server, session.Username)
+	if _, ok := c.lastDisconnects[userKey]; !ok {
+		c.makeRoomForDisconnect()
+	}
+	c.lastDisconnects[userKey] = &DisconnectRecord{
+		Server:    session.Server,
+		Timestamp: event.Timestamp,
+		handles:   handles,
+	}
+}
+
+// handleServerStart records an ocserv start. Sessions still tracked for the server did not
+// survive it, e.g. after a crash without disconnect lines.
+func (c *Collector) handleServerStart(event *parser.Event) {
+	c.flushServer(event.Server)
+	ServerStartTimestamp.WithLabelValues(event.Server).Set(float64(event.Timestamp.Unix()))
+	if c.live(event.Timestamp) {
+		ServerRestartsTotal.WithLabelValues(event.Server).Inc()
+	}
+}
+
+// flushServer drops all sessions and session state of a server whose ocserv stopped
+func (c *Collector) flushServer(server string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, session := range c.sessions {
+		if session.Server == server {
+			c.removeSession(key, session)
+		}
+	}
+	for key := range c.sessionIDs {
+		if strings.HasPrefix(key, server+":") {
+			delete(c.sessionIDs, key)
+		}
+	}
+	for key, ctx := range c.workerContext {
+		if ctx.Server == server {
+			delete(c.workerContext, key)
+		}
+	}
+}
+
+// linkSessionID finds the session ID a login of username uses - the latest one started or used
+// before that is not in use by another session - and links it to the session at sessionKey.
+// Returns the session ID, empty if none is known, and whether an earlier login used it already.
+// Must be called with c.mu held.
+func (c *Collector) linkSessionID(server, username, sessionKey string, ts time.Time) (string, bool) {
+	var id string
+	var best *sessionIDRecord
+	prefix := server + ":"
+	for key, record := range c.sessionIDs {
+		if record.Username != username || !strings.HasPrefix(key, prefix) || record.Timestamp.After(ts) {
+			continue
+		}
+		if _, inUse := c.sessions[record.SessionKey]; inUse && record.SessionKey != sessionKey {
+			continue
+		}
+		if best == nil || record.Timestamp.After(best.Timestamp) {
+			id, best = strings.TrimPrefix(key, prefix), record
+		}
 	}
+	if best == nil {
+		return "", false
+	}
+	resumed := best.SessionKey != ""
+	best.SessionKey = sessionKey
+	best.Timestamp = ts
+	return id, resumed
+}
+
+// handleMTU moves the sessions of the worker from their previous MTU to the new one
+func (c *Collector) handleMTU(event *parser.Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, session := range c.sessions {
+		if session.Server != event.Server || session.Username != event.Username || session.ClientIP != event.ClientIP || session.MTU == event.MTU {
+			continue
+		}
+		if session.MTU != 0 {
+			SessionsByMTU.WithLabelValues(session.Server, strconv.Itoa(session.MTU)).Dec()
+		}
+		session.MTU = event.MTU
+		SessionsByMTU.WithLabelValues(session.Server, strconv.Itoa(session.MTU)).Inc()
+	}
+}
+
+// removeSession drops an active session and its gauges. Must be called with c.mu held.
+func (c *Collector) removeSession(key string, session *Session) {
+	if session.MTU != 0 {
+		SessionsByMTU.WithLabelValues(session.Server, strconv.Itoa(session.MTU)).Dec()
+	}
+	c.adjustClientTypeSessions(session, -1)
+	c.unpublishSessionInfo(session)
+	c.releaseVpnIP(session.Server, session.VpnIP)
+	c.adjustActiveSessions(session, -1)
+	delete(c.sessions, key)
+	c.untrackActiveUser(session.Server, session.Username)
+}
+
+// observeSessionDuration records the duration of an ended session. Must be called with c.mu held.
+func (c *Collector) observeSessionDuration(session *Session, duration float64) {
+	labels := []string{session.Server, userLabel(session.Username)}
+	if labelConfig.ClientType {
+		clientType := session.ClientType
+		if record, ok := c.userRecords[authReasonUserKey(session.Server, session.Username)]; ok && clientType == "" {
+			clientType = record.ClientType // reported by occtl
+		}
+		if clientType == "" {
+			clientType = parser.ClassifyUserAgent("")
+		}
+		labels = append(labels, clientType)
+	}
+	SessionDuration.WithLabelValues(labels...).Observe(duration)
+}
+
+func sessionIDKey(server, sessionID string) string {
+	return server + ":" + sessionID
 }
 
 func (c *Collector) handleVPNIP(event *parser.Event) {
@@ -273,16 +736,219 @@ func (c *Collector) handleVPNIP(event *parser.Event) {
 	// Try to find and update session with VPN IP
 	for _, session := range c.sessions {
 		if session.Username == event.Username && session.Server == event.Server && session.VpnIP == "" {
-			// Delete old metric (without VPN IP) and set new one (with VPN IP)
-			SessionInfo.DeleteLabelValues(session.Server, session.Username, "", session.Country, "")
+			// Replace the session info metric (without VPN IP) with one with VPN IP
 			session.VpnIP = event.VpnIP
-			SessionInfo.WithLabelValues(session.Server, session.Username, session.VpnIP, session.Country, "").Set(float64(session.StartTime.Unix()))
+			c.acquireVpnIP(session.Server, session.VpnIP)
+			c.publishSessionInfo(session)
 			break
 		}
 	}
 }
 
-func (c *Collector) handleAuthFailed(event *parser.Event) {
+func (c *Collector) handleAuthFailureReason(event *parser.Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.observeAuthBackendDuration(event, "failure")
+	c.rememberAuthBackend(event)
+	if c.live(event.Timestamp) {
+		if event.CertError != "" {
+			CertAuthTotal.WithLabelValues(event.Server, event.CertError).Inc()
+		}
+		if event.TokenError != "" {
+			OIDCTokenFailuresTotal.WithLabelValues(event.Server, event.TokenError).Inc()
+		}
+		if event.Reason == parser.AuthReasonRadiusTimeout || event.Reason == parser.AuthReasonBackendTimeout {
+			AuthBackendErrorsTotal.WithLabelValues(event.Server, authBackendLabel(event, "unknown"), "timeout").Inc()
+		}
+	}
+
+	record := &AuthFailureRecord{Reason: event.Reason, Timestamp: event.Timestamp}
+	if event.Username != "" {
+		c.setAuthReason(authReasonUserKey(event.Server, event.Username), record)
+	}
+	if event.ClientIP != "" {
+		c.setAuthReason(authReasonIPKey(event.Server, event.ClientIP), record)
+	}
+}
+
+func (c *Collector) handleAuthInit(event *parser.Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := authReasonUserKey(event.Server, event.Username)
+	c.setAuthPending(key, event.Timestamp)
+	// Multi-step authentication (e.g. certificate plus password) may init again; keep the first
+	if start, ok := c.loginStarts[key]; !ok || event.Timestamp.Sub(start) > AuthPendingTimeout {
+		c.setLoginStart(key, event.Timestamp)
+	}
+	c.rememberSource(event.Server, event.Username, event.ClientIP, event.Timestamp)
+}
+
+func (c *Collector) handleAuthSuccess(event *parser.Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.observeAuthBackendDuration(event, "success")
+	c.rememberAuthBackend(event)
+}
+
+func (c *Collector) handleCertAuth(event *parser.Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.live(event.Timestamp) {
+		CertAuthTotal.WithLabelValues(event.Server, "success").Inc()
+	}
+	c.certSeen[authReasonIPKey(event.Server, event.ClientIP)] = &CertRecord{
+		CN:        event.CertCN,
+		Timestamp: event.Timestamp,
+	}
+}
+
+func (c *Collector) handleAuthBackendError(event *parser.Event) {
+	if !c.live(event.Timestamp) {
+		return
+	}
+	AuthBackendErrorsTotal.WithLabelValues(event.Server, authBackendLabel(event, "unknown"), event.Reason).Inc()
+}
+
+// observeAuthBackendDuration observes the time since the user's auth init, if one is pending.
+// Must be called with c.mu held.
+func (c *Collector) observeAuthBackendDuration(event *parser.Event, result string) {
+	key := authReasonUserKey(event.Server, event.Username)
+	start, ok := c.authPending[key]
+	if !ok {
+		return
+	}
+	delete(c.authPending, key)
+	if d := event.Timestamp.Sub(start).Seconds(); d >= 0 && c.live(event.Timestamp) {
+		AuthBackendDuration.WithLabelValues(event.Server, result).Observe(d)
+	}
+}
+
+// observeLoginLatency observes the time from the first event of a connection attempt - the
+// worker accepting a client certificate or sec-mod starting authentication - to the login.
+// Must be called with c.mu held, before authMethod consumes the certificate record.
+func (c *Collector) observeLoginLatency(event *parser.Event) {
+	key := authReasonUserKey(event.Server, event.Username)
+	start, ok := c.loginStarts[key]
+	delete(c.loginStarts, key)
+	if record, seen := c.certSeen[authReasonIPKey(event.Server, event.ClientIP)]; seen && (!ok || record.Timestamp.Before(start)) {
+		start, ok = record.Timestamp, true
+	}
+	if !ok || event.Timestamp.Sub(start) > AuthPendingTimeout {
+		return
+	}
+	if d := event.Timestamp.Sub(start).Seconds(); d >= 0 && c.live(event.Timestamp) {
+		LoginLatency.WithLabelValues(event.Server).Observe(d)
+	}
+}
+
+// SetUserGroups records ocserv groups reported by occtl for server (key: username)
+func (c *Collector) SetUserGroups(server string, groups map[string]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for username, group := range groups {
+		c.rememberUser(server, Username(username), group, "", now)
+	}
+}
+
+// SetUserVHosts records virtual hosts reported by occtl for server (key: username)
+func (c *Collector) SetUserVHosts(server string, vhosts map[string]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for username, vhost := range vhosts {
+		c.rememberUser(server, Username(username), "", vhost, now)
+	}
+}
+
+// rememberUser records the ocserv group and/or virtual host of a user; empty values
+// keep what was known before. Must be called with c.mu held.
+func (c *Collector) rememberUser(server, username, group, vhost string, ts time.Time) {
+	key := authReasonUserKey(server, username)
+	record, ok := c.userRecords[key]
+	if !ok {
+		record = &userRecord{}
+		c.userRecords[key] = record
+	}
+	if group != "" {
+		record.Group = group
+	}
+	if vhost != "" {
+		record.VHost = vhost
+	}
+	record.LastSeen = ts
+}
+
+// lookupUser returns the last known ocserv group and virtual host of a user.
+// The virtual host defaults to ocserv's "default" vhost. Must be called with c.mu held.
+func (c *Collector) lookupUser(server, username string) (group, vhost string) {
+	vhost = ocservconf.DefaultVHost
+	if record, ok := c.userRecords[authReasonUserKey(server, username)]; ok {
+		group = record.Group
+		if record.VHost != "" {
+			vhost = record.VHost
+		}
+	}
+	return group, vhost
+}
+
+func authBackendLabel(event *parser.Event, fallback string) string {
+	if event.AuthBackend == "" {
+		return fallback
+	}
+	return event.AuthBackend
+}
+
+// resolveAuthFailureReason returns the reason for a failed authentication attempt,
+// consuming a pending backend reason for the same user or client IP if one was logged recently
+func (c *Collector) resolveAuthFailureReason(event *parser.Event) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	reason := event.Reason
+	for _, key := range []string{authReasonUserKey(event.Server, event.Username), authReasonIPKey(event.Server, event.ClientIP)} {
+		record, ok := c.authReasons[key]
+		if !ok {
+			continue
+		}
+		delete(c.authReasons, key)
+		if reason == "" && event.Timestamp.Sub(record.Timestamp) <= AuthReasonWindow {
+			reason = record.Reason
+		}
+	}
+	if reason == "" {
+		reason = parser.AuthReasonUnknown
+	}
+	return reason
+}
+
+func authReasonUserKey(server, username string) string {
+	return server + ":" + username
+}
+
+func authReasonIPKey(server, clientIP string) string {
+	return server + ":ip:" + clientIP
+}
+
+func (c *Collector) handleAuthFailed(event *parser.Event, username string) {
+	c.mu.Lock()
+	event.ClientIP = c.clientIP(event.Server, event.Username, event.ClientIP)
+	delete(c.loginStarts, authReasonUserKey(event.Server, event.Username))
+	c.mu.Unlock()
+	reason := c.resolveAuthFailureReason(event)
+	c.mu.Lock()
+	authMethod := c.failedAuthMethod(event, reason)
+	c.mu.Unlock()
+	if !c.live(event.Timestamp) {
+		return
+	}
+
 	country := "Unknown"
 	countryCode := ""
 	if c.geoIP != nil {
@@ -291,7 +957,32 @@ func (c *Collector) handleAuthFailed(event *parser.Event) {
 			country = "Unknown"
 		}
 	}
-	AuthFailedTotal.WithLabelValues(event.Server, event.Username, event.ClientIP, country, countryCode).Inc()
+	labels := []string{event.Server, userLabel(event.Username), ClientIP(event.ClientIP), country, countryCode, reason}
+	if labelConfig.AuthMethod {
+		labels = append(labels, authMethod)
+	}
+	if labelConfig.RDNS {
+		rdns := ""
+		if c.rdns != nil {
+			// A lookup must not stall event processing during a brute-force burst from many addresses
+			rdns = c.rdns.CachedDomain(event.ClientIP)
+		}
+		labels = append(labels, rdns)
+	}
+	incWithExemplar(AuthFailedTotal.WithLabelValues(labels...), event.SessionID, event.ClientIP)
+	if reason == parser.AuthReasonSecondFactor {
+		SecondFactorFailuresTotal.WithLabelValues(event.Server, userLabel(event.Username)).Inc()
+	}
+
+	if len(c.sinks) > 0 {
+		out := newEvent(event)
+		out.Reason = reason
+		out.Country, out.CountryCode = country, countryCode
+		out.AuthMethod = authMethod
+		c.mu.Lock()
+		c.emit(out, username)
+		c.mu.Unlock()
+	}
 }
 
 func (c *Collector) handleByePacket(event *parser.Event) {
@@ -319,33 +1010,20 @@ func (c *Collector) handleSecModClose(event *parser.Event) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	// sec-mod close doesn't have ClientIP in the log, so we need to find existing context by username
-	// Mark all contexts for this user as having sec-mod close
-	for key, ctx := range c.workerContext {
-		if ctx.Username == event.Username && ctx.Server == event.Server {
-			ctx.SecModClose = true
-			ctx.LastUpdate = event.Timestamp
-			c.workerContext[key] = ctx
-		}
-	}
-
-	// If no existing context, create one with empty ClientIP (will be matched by username in enrichDisconnectReason)
-	// This handles the case where sec-mod close happens before any worker events
-	key := workerContextKey(event.Server, event.Username, "")
-	if _, ok := c.workerContext[key]; !ok {
-		c.workerContext[key] = &WorkerContext{
-			Username:    event.Username,
-			Server:      event.Server,
-			SecModClose: true,
-			LastUpdate:  event.Timestamp,
-		}
-	}
+	// sec-mod close doesn't have ClientIP in the log but names the session ID, so the context is
+	// kept for that session only: a phone going to sleep must not relabel the disconnect of the
+	// user's other devices
+	key := sessionContextKey(event.Server, event.SessionID)
+	ctx := c.getOrCreateWorkerContext(key, event)
+	ctx.SecModClose = true
+	ctx.LastUpdate = event.Timestamp
 }
 
 func (c *Collector) getOrCreateWorkerContext(key string, event *parser.Event) *WorkerContext {
 	if ctx, ok := c.workerContext[key]; ok {
 		return ctx
 	}
+	c.makeRoomForWorkerContext()
 	ctx := &WorkerContext{
 		Username:   event.Username,
 		ClientIP:   event.ClientIP,
@@ -357,7 +1035,12 @@ func (c *Collector) getOrCreateWorkerContext(key string, event *parser.Event) *W
 }
 
 func workerContextKey(server, username, clientIP string) string {
-	return fmt.Sprintf("%s:%s:%s", server, username, clientIP)
+	return server + ":" + username + ":" + clientIP
+}
+
+// sessionContextKey returns the worker context key of a sec-mod session ID
+func sessionContextKey(server, sessionID string) string {
+	return server + ":session:" + sessionID
 }
 
 // GetActiveSessions returns current active session count
@@ -365,14 +1048,7 @@ func (c *Collector) GetActiveSessions() int {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	count := 0
-	for k := range c.sessions {
-		// Only count real sessions, not session IDs
-		if len(k) > 4 && k[:4] != "sid:" {
-			count++
-		}
-	}
-	return count
+	return len(c.sessions)
 }
 
 // CleanupOldDisconnects removes disconnect records older than ReconnectWindow
@@ -385,9 +1061,61 @@ func (c *Collector) CleanupOldDisconnects() {
 	for key, record := range c.lastDisconnects {
 		if now.Sub(record.Timestamp) > ReconnectWindow*2 {
 			delete(c.lastDisconnects, key)
+			ExpiredDisconnectsTotal.Inc()
 		}
 	}
 
+	for key, record := range c.authReasons {
+		if now.Sub(record.Timestamp) > AuthReasonWindow {
+			delete(c.authReasons, key)
+		}
+	}
+
+	for key, start := range c.authPending {
+		if now.Sub(start) > AuthPendingTimeout {
+			delete(c.authPending, key)
+		}
+	}
+
+	for key, record := range c.authBackends {
+		if now.Sub(record.Timestamp) > AuthPendingTimeout {
+			delete(c.authBackends, key)
+		}
+	}
+
+	for key, start := range c.loginStarts {
+		if now.Sub(start) > AuthPendingTimeout {
+			delete(c.loginStarts, key)
+		}
+	}
+
+	for key, record := range c.certSeen {
+		if now.Sub(record.Timestamp) > AuthPendingTimeout {
+			delete(c.certSeen, key)
+		}
+	}
+
+	for key, record := range c.clientInfo {
+		if now.Sub(record.Timestamp) > AuthPendingTimeout {
+			delete(c.clientInfo, key)
+		}
+	}
+
+	for key, record := range c.userRecords {
+		if now.Sub(record.LastSeen) > MaxSessionAge {
+			delete(c.userRecords, key)
+		}
+	}
+
+	for key, record := range c.proxySources {
+		if now.Sub(record.Timestamp) > MaxSessionAge {
+			delete(c.proxySources, key)
+		}
+	}
+
+	c.pruneGeoHistory(now)
+	c.pruneFlapStates(now)
+
 	// Also clean up stale worker contexts (in case disconnect was missed)
 	for key, ctx := range c.workerContext {
 		if now.Sub(ctx.LastUpdate) > ReconnectWindow*2 {
@@ -397,19 +1125,41 @@ func (c *Collector) CleanupOldDisconnects() {
 
 	// Clean up stale sessions (if disconnect event was missed)
 	for key, session := range c.sessions {
-		// Skip session ID entries (they have different lifecycle)
-		if len(key) > 4 && key[:4] == "sid:" {
-			continue
+		if now.Sub(session.lastSeen()) > MaxSessionAge {
+			c.removeSession(key, session)
+			StaleSessionsRemovedTotal.WithLabelValues(session.Server).Inc()
 		}
-		if now.Sub(session.StartTime) > MaxSessionAge {
-			// Remove stale session info metric
-			SessionInfo.DeleteLabelValues(session.Server, session.Username, session.VpnIP, session.Country, "")
-			ActiveSessions.WithLabelValues(session.Server, session.Username).Dec()
-			delete(c.sessions, key)
+	}
+
+	// Session IDs of ended sessions are kept for reconnects with the same cookie until they
+	// are invalidated; drop those whose invalidation was missed
+	for key, record := range c.sessionIDs {
+		if _, active := c.sessions[record.SessionKey]; !active && now.Sub(record.Timestamp) > MaxSessionAge {
+			delete(c.sessionIDs, key)
 		}
 	}
+
+	// Repair ActiveSessions should a series have drifted from the session map
+	c.reconcileActiveSessions()
+
+	// Refresh rolling unique user estimates so they decay even without new logins
+	c.refreshUniqueUsers(now)
+
+	TrackingEntries.WithLabelValues(TrackedSessions).Set(float64(len(c.sessions)))
+	TrackingEntries.WithLabelValues(TrackedDisconnects).Set(float64(len(c.lastDisconnects)))
+	TrackingEntries.WithLabelValues(TrackedWorkerContexts).Set(float64(len(c.workerContext)))
+	TrackingEntries.WithLabelValues(TrackedAuthPending).Set(float64(len(c.authPending)))
+	TrackingEntries.WithLabelValues(TrackedAuthReasons).Set(float64(len(c.authReasons)))
+	TrackingEntries.WithLabelValues(TrackedClientInfo).Set(float64(len(c.clientInfo)))
+	TrackingEntries.WithLabelValues(TrackedLoginStarts).Set(float64(len(c.loginStarts)))
+	CleanupRunsTotal.Inc()
+}
+
+// serverUserKey returns the key of per-user state: "server:username"
+func serverUserKey(server, username string) string {
+	return server + ":" + username
 }
 
 func sessionKey(server, username, clientIP string, port int) string {
-	return fmt.Sprintf("%s:%s:%s:%d", server, username, clientIP, port)
+	return server + ":" + username + ":" + clientIP + ":" + strconv.Itoa(port)
 }
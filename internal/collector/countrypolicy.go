@@ -0,0 +1,68 @@
+package collector
+
+import (
+	"slices"
+	"strings"
+)
+
+// DefaultCountryPolicy is the server key of the country policy for servers without their own
+const DefaultCountryPolicy = "*"
+
+// CountryPolicy lists the client countries (ISO codes) expected on a server
+type CountryPolicy struct {
+	// Allow, when set, makes logins from all other countries violations
+	Allow []string
+	// Deny makes logins from these countries violations (e.g. embargoed countries)
+	Deny []string
+}
+
+// denies reports whether a login from countryCode violates the policy
+func (p CountryPolicy) denies(countryCode string) bool {
+	if slices.Contains(p.Deny, countryCode) {
+		return true
+	}
+	return len(p.Allow) > 0 && !slices.Contains(p.Allow, countryCode)
+}
+
+// SetCountryPolicies sets the country policies keyed by server label (DefaultCountryPolicy for
+// all other servers) and exports them as CountryPolicyInfo. Must be called before events are processed.
+func (c *Collector) SetCountryPolicies(policies map[string]CountryPolicy) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.countryPolicies = make(map[string]CountryPolicy, len(policies))
+	CountryPolicyInfo.Reset()
+	for server, p := range policies {
+		p.Allow = upperCodes(p.Allow)
+		p.Deny = upperCodes(p.Deny)
+		c.countryPolicies[server] = p
+		CountryPolicyInfo.WithLabelValues(server, strings.Join(p.Allow, ","), strings.Join(p.Deny, ",")).Set(1)
+	}
+}
+
+func upperCodes(codes []string) []string {
+	out := make([]string, len(codes))
+	for i, code := range codes {
+		out[i] = strings.ToUpper(strings.TrimSpace(code))
+	}
+	slices.Sort(out)
+	return out
+}
+
+// checkCountryPolicy counts a login from a country the server's policy doesn't allow.
+// Logins without a known country (GeoIP miss, private addresses) are not checked.
+// Must be called with c.mu held.
+func (c *Collector) checkCountryPolicy(server, username, country, countryCode string) {
+	if len(c.countryPolicies) == 0 || countryCode == "" || countryCode == "XX" {
+		return
+	}
+	p, ok := c.countryPolicies[server]
+	if !ok {
+		if p, ok = c.countryPolicies[DefaultCountryPolicy]; !ok {
+			return
+		}
+	}
+	if p.denies(countryCode) {
+		ConnectionsFromDeniedCountryTotal.WithLabelValues(server, userLabel(username), country, countryCode).Inc()
+	}
+}
@@ -0,0 +1,62 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCountryPolicyDenies(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  CountryPolicy
+		country string
+		want    bool
+	}{
+		{"empty policy", CountryPolicy{}, "DE", false},
+		{"allowed", CountryPolicy{Allow: []string{"DE", "FR"}}, "DE", false},
+		{"not allowed", CountryPolicy{Allow: []string{"DE", "FR"}}, "US", true},
+		{"denied", CountryPolicy{Deny: []string{"KP"}}, "KP", true},
+		{"not denied", CountryPolicy{Deny: []string{"KP"}}, "DE", false},
+		{"deny wins over allow", CountryPolicy{Allow: []string{"DE", "KP"}, Deny: []string{"KP"}}, "KP", true},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.denies(tt.country); got != tt.want {
+			t.Errorf("%s: denies(%s) = %v, want %v", tt.name, tt.country, got, tt.want)
+		}
+	}
+}
+
+func TestCheckCountryPolicy(t *testing.T) {
+	ConnectionsFromDeniedCountryTotal.Reset()
+	c := New()
+	c.SetCountryPolicies(map[string]CountryPolicy{
+		DefaultCountryPolicy: {Allow: []string{"de"}},
+		"s2":                 {Deny: []string{" us"}},
+	})
+
+	logins := []struct {
+		server, country, code string
+	}{
+		{"s1", "Germany", "DE"},       // allowed by the default policy
+		{"s1", "France", "FR"},        // not allowed by the default policy
+		{"s1", "Private", "XX"},       // private addresses are not checked
+		{"s1", "Unknown", ""},         // GeoIP misses are not checked
+		{"s2", "France", "FR"},        // s2 has its own policy, the default doesn't apply
+		{"s2", "United States", "US"}, // denied on s2
+	}
+	c.mu.Lock()
+	for _, l := range logins {
+		c.checkCountryPolicy(l.server, "alice", l.country, l.code)
+	}
+	c.mu.Unlock()
+
+	if got := testutil.CollectAndCount(ConnectionsFromDeniedCountryTotal); got != 2 {
+		t.Errorf("%d denied series, want 2", got)
+	}
+	for _, want := range [][]string{{"s1", "alice", "France", "FR"}, {"s2", "alice", "United States", "US"}} {
+		if got := testutil.ToFloat64(ConnectionsFromDeniedCountryTotal.WithLabelValues(want...)); got != 1 {
+			t.Errorf("denied logins %v = %v, want 1", want, got)
+		}
+	}
+}
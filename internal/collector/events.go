@@ -0,0 +1,134 @@
+package collector
+
+import (
+	"time"
+
+	"github.com/mogilevich/ocserv_exporter/pkg/parser"
+)
+
+// Event is a parsed ocserv event enriched with data the exporter computed
+// (GeoIP, client type, session duration, normalized reasons). It is handed to event sinks.
+type Event struct {
+	Time            time.Time `json:"time"`
+	Server          string    `json:"server"`
+	Type            string    `json:"type"`
+	Username        string    `json:"username,omitempty"`
+	ClientIP        string    `json:"client_ip,omitempty"`
+	Port            int       `json:"port,omitempty"`
+	VpnIP           string    `json:"vpn_ip,omitempty"`
+	SessionID       string    `json:"session_id,omitempty"`
+	Reason          string    `json:"reason,omitempty"`
+	Country         string    `json:"country,omitempty"`
+	CountryCode     string    `json:"country_code,omitempty"`
+	ClientType      string    `json:"client_type,omitempty"`
+	Hostname        string    `json:"hostname,omitempty"` // client hostname (X-CSTP-Hostname) logged during the handshake
+	Group           string    `json:"group,omitempty"`
+	VHost           string    `json:"vhost,omitempty"`
+	AuthMethod      string    `json:"auth_method,omitempty"`
+	AuthBackend     string    `json:"auth_backend,omitempty"`
+	RxBytes         uint64    `json:"rx_bytes,omitempty"`
+	TxBytes         uint64    `json:"tx_bytes,omitempty"`
+	DurationSeconds float64   `json:"duration_seconds,omitempty"`
+	UserSessions    int       `json:"user_sessions,omitempty"` // active sessions of the user after a login
+	Pattern         string    `json:"pattern,omitempty"`       // user-defined pattern that matched the line
+}
+
+// EventSink receives enriched events. Send is called with the collector lock held
+// and must not block (queue the event and deliver it asynchronously).
+type EventSink interface {
+	Send(event *Event)
+}
+
+// eventSink is a registered sink and whether it gets the real username (see AddEventSink)
+type eventSink struct {
+	sink           EventSink
+	clearUsernames bool
+}
+
+// AddEventSink registers a sink for enriched events. Events carry the username as in labels,
+// the pseudonym with --labels.hash-usernames, unless clearUsernames is set for a sink that
+// needs the real one (RADIUS accounting, billing). Must be called before events are processed.
+func (c *Collector) AddEventSink(sink EventSink, clearUsernames bool) {
+	c.sinks = append(c.sinks, eventSink{sink: sink, clearUsernames: clearUsernames})
+}
+
+// HasEventSinks reports whether any event sink is registered
+func (c *Collector) HasEventSinks() bool {
+	return len(c.sinks) > 0
+}
+
+// newEvent creates an event from a parsed log event with the fields every event type has
+func newEvent(event *parser.Event) *Event {
+	return &Event{
+		Time:        event.Timestamp,
+		Server:      event.Server,
+		Type:        event.Type.String(),
+		Username:    event.Username,
+		ClientIP:    event.ClientIP,
+		Port:        event.Port,
+		VpnIP:       event.VpnIP,
+		SessionID:   event.SessionID,
+		Reason:      event.Reason,
+		Group:       event.Group,
+		VHost:       event.VHost,
+		AuthBackend: event.AuthBackend,
+		RxBytes:     event.RxBytes,
+		TxBytes:     event.TxBytes,
+		Pattern:     event.Pattern,
+	}
+}
+
+// emit hands an event to all sinks. The event carries the pseudonym (see Username), sinks
+// registered for clear usernames get a copy with the real username.
+func (c *Collector) emit(event *Event, username string) {
+	if !c.live(event.Time) {
+		return // replayed history was delivered before the restart
+	}
+	var clear *Event
+	for _, s := range c.sinks {
+		if !s.clearUsernames || event.Username == username {
+			s.sink.Send(event)
+			continue
+		}
+		if clear == nil {
+			copied := *event
+			copied.Username = username
+			clear = &copied
+		}
+		s.sink.Send(clear)
+	}
+}
+
+// enrichUser fills client type, group and vhost from what is known about the user.
+// Must be called with c.mu held.
+func (c *Collector) enrichUser(event *Event) {
+	if event.Username == "" {
+		return
+	}
+	record, ok := c.userRecords[authReasonUserKey(event.Server, event.Username)]
+	if !ok {
+		return
+	}
+	if event.ClientType == "" {
+		event.ClientType = record.ClientType
+	}
+	if event.Group == "" {
+		event.Group = record.Group
+	}
+	if event.VHost == "" {
+		event.VHost = record.VHost
+	}
+}
+
+// SetUserClientTypes records VPN client types reported by occtl for server (key: username)
+func (c *Collector) SetUserClientTypes(server string, clientTypes map[string]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for username, clientType := range clientTypes {
+		username = Username(username)
+		c.rememberUser(server, username, "", "", now)
+		c.userRecords[authReasonUserKey(server, username)].ClientType = clientType
+	}
+}
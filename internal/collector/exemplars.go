@@ -0,0 +1,41 @@
+package collector
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Exemplar labels, exposed with OpenMetrics scrapes to link a counter increment to its session
+const (
+	ExemplarSessionID    = "session_id"
+	ExemplarClientIPHash = "client_ip_hash"
+)
+
+// ClientIPHash returns a stable pseudonym of a client IP for exemplars ("ip_" and 16 hex chars
+// of HMAC-SHA256 keyed with --labels.hash-salt), so the address can be matched against logs
+// hashed the same way without exposing it.
+func ClientIPHash(ip string) string {
+	mac := hmac.New(sha256.New, []byte(labelConfig.HashSalt))
+	mac.Write([]byte(ip))
+	return "ip_" + hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// incWithExemplar increments counter by one with an exemplar of the session ID and the hashed
+// client IP, leaving out those that are unknown
+func incWithExemplar(counter prometheus.Counter, sessionID, clientIP string) {
+	exemplar := prometheus.Labels{}
+	if sessionID != "" {
+		exemplar[ExemplarSessionID] = sessionID
+	}
+	if clientIP != "" {
+		exemplar[ExemplarClientIPHash] = ClientIPHash(clientIP)
+	}
+	if adder, ok := counter.(prometheus.ExemplarAdder); ok && len(exemplar) > 0 {
+		adder.AddWithExemplar(1, exemplar)
+		return
+	}
+	counter.Inc()
+}
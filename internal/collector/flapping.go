@@ -0,0 +1,89 @@
+package collector
+
+import "time"
+
+const (
+	// DefaultFlapThreshold is the number of reconnects within the flap window that marks a user as flapping
+	DefaultFlapThreshold = 10
+	// DefaultFlapWindow is the sliding window reconnects are counted in
+	DefaultFlapWindow = 10 * time.Minute
+)
+
+// FlapConfig controls reconnect-loop (flapping) detection
+type FlapConfig struct {
+	// Threshold is the number of reconnects within Window that starts a flap episode
+	Threshold int
+	// Window is the sliding window reconnects are counted in
+	Window time.Duration
+}
+
+// flapState tracks recent reconnects of a user
+type flapState struct {
+	Server     string
+	Username   string
+	Reconnects []time.Time
+	Flapping   bool
+}
+
+// SetFlapConfig sets flapping detection thresholds.
+// Must be called before events are processed.
+func (c *Collector) SetFlapConfig(cfg FlapConfig) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if cfg.Threshold <= 0 {
+		cfg.Threshold = DefaultFlapThreshold
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultFlapWindow
+	}
+	c.flap = cfg
+}
+
+// recordReconnect adds a reconnect of a user to its sliding window and starts a flap episode
+// once the threshold is reached. The episode ends when the reconnect rate drops below it again.
+// Must be called with c.mu held.
+func (c *Collector) recordReconnect(server, username string, ts time.Time) {
+	key := serverUserKey(server, username)
+	state, ok := c.flapStates[key]
+	if !ok {
+		state = &flapState{Server: server, Username: username}
+		c.flapStates[key] = state
+	}
+	state.Reconnects = append(state.Reconnects, ts)
+	state.prune(ts.Add(-c.flap.Window))
+
+	if len(state.Reconnects) >= c.flap.Threshold && !state.Flapping {
+		state.Flapping = true
+		if !Shedding() {
+			FlappingUsers.WithLabelValues(server, username).Set(1)
+		}
+		if c.live(ts) {
+			FlapEpisodesTotal.WithLabelValues(server, userLabel(username)).Inc()
+		}
+	}
+}
+
+// pruneFlapStates ends flap episodes whose reconnect rate dropped below the threshold and
+// forgets users without recent reconnects. Must be called with c.mu held.
+func (c *Collector) pruneFlapStates(now time.Time) {
+	for key, state := range c.flapStates {
+		state.prune(now.Add(-c.flap.Window))
+		if state.Flapping && len(state.Reconnects) < c.flap.Threshold {
+			state.Flapping = false
+			FlappingUsers.DeleteLabelValues(state.Server, state.Username)
+		}
+		if len(state.Reconnects) == 0 {
+			delete(c.flapStates, key)
+		}
+	}
+}
+
+// prune drops reconnects before cutoff
+func (s *flapState) prune(cutoff time.Time) {
+	i := 0
+	for i < len(s.Reconnects) && s.Reconnects[i].Before(cutoff) {
+		i++
+	}
+	s.Reconnects = s.Reconnects[i:]
+}
@@ -0,0 +1,137 @@
+package collector
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// GeoAnomalyImpossibleTravel is the anomaly type of consecutive logins too far apart for the time between them
+	GeoAnomalyImpossibleTravel = "impossible_travel"
+	// GeoAnomalyNewCountry is the anomaly type of a login from a country the user was not seen in before
+	GeoAnomalyNewCountry = "new_country"
+
+	// DefaultMaxTravelSpeed is the fastest plausible travel speed in km/h (roughly a passenger jet)
+	DefaultMaxTravelSpeed = 1000.0
+	// DefaultCountryChangeWindow is the minimum time between logins from different countries
+	// when coordinates are not available (Country database)
+	DefaultCountryChangeWindow = time.Hour
+	// GeoHistoryRetention is how long login locations of a user are remembered
+	GeoHistoryRetention = 90 * 24 * time.Hour
+
+	earthRadiusKm = 6371.0
+)
+
+// GeoLocator resolves IP addresses to coordinates (implemented by the GeoIP resolver with a City database)
+type GeoLocator interface {
+	Locate(ip string) (lat, lon float64, ok bool)
+}
+
+// GeoAnomalyConfig controls geo-anomaly detection
+type GeoAnomalyConfig struct {
+	// MaxTravelSpeed is the fastest plausible travel speed between two logins in km/h
+	MaxTravelSpeed float64
+	// CountryChangeWindow flags a country change faster than this when coordinates are unknown
+	CountryChangeWindow time.Duration
+}
+
+// geoHistory remembers where a user logged in from
+type geoHistory struct {
+	Country   string
+	Lat, Lon  float64
+	HasCoords bool
+	LastLogin time.Time
+	Countries map[string]bool
+}
+
+// SetGeoAnomalyConfig sets geo-anomaly detection thresholds
+func (c *Collector) SetGeoAnomalyConfig(cfg GeoAnomalyConfig) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if cfg.MaxTravelSpeed <= 0 {
+		cfg.MaxTravelSpeed = DefaultMaxTravelSpeed
+	}
+	if cfg.CountryChangeWindow <= 0 {
+		cfg.CountryChangeWindow = DefaultCountryChangeWindow
+	}
+	c.geoAnomaly = cfg
+}
+
+// checkGeoAnomaly compares a login with the previous login of the same user (on any server)
+// and counts impossible travel and first logins from a new country.
+// Must be called with c.mu held.
+func (c *Collector) checkGeoAnomaly(server, username, clientIP, country string, ts time.Time) {
+	if country == "" || country == "Unknown" || country == "Private" {
+		return
+	}
+
+	var lat, lon float64
+	var hasCoords bool
+	if locator, ok := c.geoIP.(GeoLocator); ok {
+		lat, lon, hasCoords = locator.Locate(clientIP)
+	}
+
+	prev, ok := c.geoHistory[username]
+	if !ok {
+		// First login we know of: nothing to compare with
+		c.geoHistory[username] = &geoHistory{
+			Country:   country,
+			Lat:       lat,
+			Lon:       lon,
+			HasCoords: hasCoords,
+			LastLogin: ts,
+			Countries: map[string]bool{country: true},
+		}
+		return
+	}
+
+	if !prev.Countries[country] && c.live(ts) {
+		GeoAnomalyTotal.WithLabelValues(server, userLabel(username), GeoAnomalyNewCountry).Inc()
+		prev.Countries[country] = true
+	}
+
+	elapsed := ts.Sub(prev.LastLogin)
+	if elapsed >= 0 && c.live(ts) && c.impossibleTravel(prev, country, lat, lon, hasCoords, elapsed) {
+		GeoAnomalyTotal.WithLabelValues(server, userLabel(username), GeoAnomalyImpossibleTravel).Inc()
+	}
+
+	prev.Country = country
+	prev.Lat, prev.Lon, prev.HasCoords = lat, lon, hasCoords
+	prev.LastLogin = ts
+}
+
+// impossibleTravel reports whether moving from the previous login location to the new one
+// in elapsed time is implausible. Must be called with c.mu held.
+func (c *Collector) impossibleTravel(prev *geoHistory, country string, lat, lon float64, hasCoords bool, elapsed time.Duration) bool {
+	if prev.HasCoords && hasCoords {
+		distance := haversineKm(prev.Lat, prev.Lon, lat, lon)
+		// City-level locations are approximate; ignore short hops
+		if distance < 500 {
+			return false
+		}
+		hours := math.Max(elapsed.Hours(), 1.0/60)
+		return distance/hours > c.geoAnomaly.MaxTravelSpeed
+	}
+	return prev.Country != country && elapsed < c.geoAnomaly.CountryChangeWindow
+}
+
+// pruneGeoHistory drops users not seen for GeoHistoryRetention. Must be called with c.mu held.
+func (c *Collector) pruneGeoHistory(now time.Time) {
+	for username, history := range c.geoHistory {
+		if now.Sub(history.LastLogin) > GeoHistoryRetention {
+			delete(c.geoHistory, username)
+		}
+	}
+}
+
+// haversineKm returns the great-circle distance between two points in kilometers
+func haversineKm(lat1, lon1, lat2, lon2 float64) float64 {
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := toRad(lat2 - lat1)
+	dLon := toRad(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
@@ -0,0 +1,91 @@
+package collector
+
+import (
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// labelEpoch changes whenever metric vectors are rebuilt or reset (ConfigureLabels,
+// ConfigureHistograms, SetShedding). Cached child metrics of an older epoch are orphaned: they
+// are no longer gathered, so they must be looked up again.
+var labelEpoch atomic.Uint64
+
+// userHandles caches the child metrics of a user, so logins, disconnects and occtl readings
+// don't format and hash the same label values for every event, e.g. during a reconnect storm.
+// The sessions and the disconnect record of a user share them. Children are looked up on first
+// use, so no series is published before it is counted.
+type userHandles struct {
+	epoch          uint64
+	server         string
+	username       string
+	reconnects     prometheus.Counter
+	disconnections map[string]prometheus.Counter // key: normalized reason
+
+	// Traffic counters of the vhost and group they were looked up for
+	vhost, group   string
+	received, sent prometheus.Counter
+}
+
+// handlesFor returns h if it is still valid for the user, or new handles
+func handlesFor(h *userHandles, server, username string) *userHandles {
+	epoch := labelEpoch.Load()
+	if h != nil && h.epoch == epoch && h.server == server && h.username == username {
+		return h
+	}
+	return &userHandles{epoch: epoch, server: server, username: username}
+}
+
+// traffic returns the user's ReceivedBytesTotal and SentBytesTotal children
+func (h *userHandles) traffic(vhost, group string) (received, sent prometheus.Counter) {
+	if h.received == nil || h.vhost != vhost || h.group != group {
+		labels := userLabels(h.server, h.username, vhost, group)
+		h.vhost, h.group = vhost, group
+		h.received = ReceivedBytesTotal.WithLabelValues(labels...)
+		h.sent = SentBytesTotal.WithLabelValues(labels...)
+	}
+	return h.received, h.sent
+}
+
+// reconnectsTotal returns the user's ReconnectsTotal child
+func (h *userHandles) reconnectsTotal() prometheus.Counter {
+	if h.reconnects == nil {
+		h.reconnects = ReconnectsTotal.WithLabelValues(h.server, userLabel(h.username))
+	}
+	return h.reconnects
+}
+
+// disconnectionsTotal returns the user's DisconnectionsTotal child for a normalized reason
+func (h *userHandles) disconnectionsTotal(reason string) prometheus.Counter {
+	counter, ok := h.disconnections[reason]
+	if !ok {
+		if h.disconnections == nil {
+			h.disconnections = make(map[string]prometheus.Counter)
+		}
+		counter = DisconnectionsTotal.WithLabelValues(h.server, userLabel(h.username), reason)
+		h.disconnections[reason] = counter
+	}
+	return counter
+}
+
+// serverHandles caches the per-server session traffic histograms observed at every disconnect
+type serverHandles struct {
+	epoch     uint64
+	sessionRx prometheus.Observer
+	sessionTx prometheus.Observer
+}
+
+// serverHandles returns the cached child metrics of a server. Must be called with c.mu held.
+func (c *Collector) serverHandles(server string) *serverHandles {
+	epoch := labelEpoch.Load()
+	h, ok := c.servers[server]
+	if !ok || h.epoch != epoch {
+		h = &serverHandles{
+			epoch:     epoch,
+			sessionRx: SessionRxBytes.WithLabelValues(server),
+			sessionTx: SessionTxBytes.WithLabelValues(server),
+		}
+		c.servers[server] = h
+	}
+	return h
+}
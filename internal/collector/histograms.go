@@ -0,0 +1,136 @@
+package collector
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// DefaultSessionDurationBuckets are the default buckets (in seconds) for session duration
+	DefaultSessionDurationBuckets = []float64{60, 300, 900, 1800, 3600, 7200, 14400, 28800, 43200, 86400}
+
+	// DefaultSessionTrafficBuckets are the default buckets (in bytes) for per-session traffic histograms:
+	// 64 KiB up to 16 GiB in powers of 4
+	DefaultSessionTrafficBuckets = prometheus.ExponentialBuckets(64*1024, 4, 10)
+
+	// DefaultAuthBackendBuckets are the buckets (in seconds) for auth backend latency
+	DefaultAuthBackendBuckets = []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+	// DefaultLoginLatencyBuckets are the buckets (in seconds) for the time to establish a session
+	DefaultLoginLatencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+)
+
+// HistogramConfig controls bucket layout of the exporter's histograms
+type HistogramConfig struct {
+	SessionDurationBuckets []float64
+	SessionTrafficBuckets  []float64
+
+	// NativeHistograms additionally emits Prometheus native (sparse) histograms.
+	// Classic buckets are still exposed for scrapers without native histogram support.
+	NativeHistograms bool
+	// NativeBucketFactor is the growth factor between native histogram buckets (e.g. 1.1)
+	NativeBucketFactor float64
+}
+
+var histogramConfig = HistogramConfig{
+	SessionDurationBuckets: DefaultSessionDurationBuckets,
+	SessionTrafficBuckets:  DefaultSessionTrafficBuckets,
+	NativeBucketFactor:     1.1,
+}
+
+// ConfigureHistograms rebuilds all histograms with the given configuration.
+// Empty bucket lists keep the defaults. Must be called before RegisterMetrics.
+func ConfigureHistograms(cfg HistogramConfig) {
+	if len(cfg.SessionDurationBuckets) == 0 {
+		cfg.SessionDurationBuckets = DefaultSessionDurationBuckets
+	}
+	if len(cfg.SessionTrafficBuckets) == 0 {
+		cfg.SessionTrafficBuckets = DefaultSessionTrafficBuckets
+	}
+	if cfg.NativeBucketFactor <= 1 {
+		cfg.NativeBucketFactor = 1.1
+	}
+	histogramConfig = cfg
+
+	SessionDuration = newSessionDurationHistogram()
+	SessionRxBytes = newSessionRxBytesHistogram()
+	SessionTxBytes = newSessionTxBytesHistogram()
+	AuthBackendDuration = newAuthBackendDurationHistogram()
+	LoginLatency = newLoginLatencyHistogram()
+	labelEpoch.Add(1)
+}
+
+func newSessionDurationHistogram() *prometheus.HistogramVec {
+	labels := []string{"server", "username"}
+	if labelConfig.ClientType {
+		labels = append(labels, "client_type")
+	}
+	return newHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "session_duration_seconds",
+			Help:      "VPN session duration in seconds",
+			Buckets:   histogramConfig.SessionDurationBuckets,
+		},
+		labels,
+	)
+}
+
+func newSessionRxBytesHistogram() *prometheus.HistogramVec {
+	return newHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "session_rx_bytes",
+			Help:      "Bytes received from the client per VPN session",
+			Buckets:   histogramConfig.SessionTrafficBuckets,
+		},
+		[]string{"server"},
+	)
+}
+
+func newSessionTxBytesHistogram() *prometheus.HistogramVec {
+	return newHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "session_tx_bytes",
+			Help:      "Bytes sent to the client per VPN session",
+			Buckets:   histogramConfig.SessionTrafficBuckets,
+		},
+		[]string{"server"},
+	)
+}
+
+func newAuthBackendDurationHistogram() *prometheus.HistogramVec {
+	return newHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "auth_backend_duration_seconds",
+			Help:      "Time from sec-mod auth init to the authentication backend result",
+			Buckets:   DefaultAuthBackendBuckets,
+		},
+		[]string{"server", "result"},
+	)
+}
+
+func newLoginLatencyHistogram() *prometheus.HistogramVec {
+	return newHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "login_latency_seconds",
+			Help:      "Time from the first worker or sec-mod event of a connection attempt to the user login",
+			Buckets:   DefaultLoginLatencyBuckets,
+		},
+		[]string{"server"},
+	)
+}
+
+// newHistogramVec creates a histogram vector honoring the native histogram setting
+func newHistogramVec(opts prometheus.HistogramOpts, labels []string) *prometheus.HistogramVec {
+	if histogramConfig.NativeHistograms {
+		opts.NativeHistogramBucketFactor = histogramConfig.NativeBucketFactor
+		opts.NativeHistogramMaxBucketNumber = 160
+		opts.NativeHistogramMinResetDuration = time.Hour
+	}
+	return prometheus.NewHistogramVec(opts, labels)
+}
@@ -0,0 +1,135 @@
+package collector
+
+import (
+	"net"
+
+	"github.com/mogilevich/ocserv_exporter/internal/ocservconf"
+)
+
+// acquireVpnIP records a VPN IP as assigned on server (from a journal session or occtl).
+// Must be called with c.mu held.
+func (c *Collector) acquireVpnIP(server, ip string) {
+	if ip == "" {
+		return
+	}
+	refs, ok := c.vpnIPRefs[server]
+	if !ok {
+		refs = make(map[string]int)
+		c.vpnIPRefs[server] = refs
+	}
+	refs[ip]++
+	if refs[ip] == 1 {
+		c.adjustPoolUsage(server, ip, 1)
+	}
+}
+
+// releaseVpnIP drops one reference to a VPN IP on server.
+// Must be called with c.mu held.
+func (c *Collector) releaseVpnIP(server, ip string) {
+	refs, ok := c.vpnIPRefs[server]
+	if !ok || refs[ip] == 0 {
+		return
+	}
+	refs[ip]--
+	if refs[ip] == 0 {
+		delete(refs, ip)
+		c.adjustPoolUsage(server, ip, -1)
+	}
+}
+
+// SetOcctlVpnIPs replaces the set of VPN IPs reported by occtl for server
+func (c *Collector) SetOcctlVpnIPs(server string, ips []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	current := make(map[string]bool, len(ips))
+	for _, ip := range ips {
+		current[ip] = true
+	}
+	previous := c.occtlVpnIPs[server]
+
+	for ip := range current {
+		if !previous[ip] {
+			c.acquireVpnIP(server, ip)
+		}
+	}
+	for ip := range previous {
+		if !current[ip] {
+			c.releaseVpnIP(server, ip)
+		}
+	}
+	c.occtlVpnIPs[server] = current
+}
+
+// adjustPoolUsage changes the used address count of the pool containing ip.
+// Must be called with c.mu held.
+func (c *Collector) adjustPoolUsage(server, ip string, delta int) {
+	vhost, ok := c.poolForIP(server, ip)
+	if !ok {
+		return
+	}
+	used, ok := c.poolUsed[server]
+	if !ok {
+		used = make(map[string]int)
+		c.poolUsed[server] = used
+	}
+	used[vhost] += delta
+	IPPoolUsed.WithLabelValues(server, vhost).Set(float64(used[vhost]))
+}
+
+// recomputePoolUsage rebuilds pool usage from assigned IPs, e.g. after a config reload.
+// Must be called with c.mu held.
+func (c *Collector) recomputePoolUsage() {
+	IPPoolUsed.Reset()
+	c.poolUsed = make(map[string]map[string]int)
+
+	// Pools without any assigned address are reported as 0
+	for server, sections := range c.serverSettings {
+		for _, settings := range pools(sections) {
+			IPPoolUsed.WithLabelValues(server, settings.VHost).Set(0)
+		}
+	}
+
+	for server, refs := range c.vpnIPRefs {
+		for ip := range refs {
+			c.adjustPoolUsage(server, ip, 1)
+		}
+	}
+}
+
+// poolForIP returns the vhost whose ipv4-network contains ip (most specific network wins)
+func (c *Collector) poolForIP(server, ip string) (string, bool) {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return "", false
+	}
+
+	vhost := ""
+	bestPrefix := -1
+	for _, settings := range pools(c.serverSettings[server]) {
+		if !settings.IPv4Network.Contains(addr) {
+			continue
+		}
+		if ones, _ := settings.IPv4Network.Mask.Size(); ones > bestPrefix {
+			bestPrefix = ones
+			vhost = settings.VHost
+		}
+	}
+	return vhost, bestPrefix >= 0
+}
+
+// pools returns the sections of a server with their own address pool. Vhosts inheriting the
+// global ipv4-network (or repeating another section's) share that pool, so it is counted once,
+// for the first section (the global one comes first).
+func pools(sections []ocservconf.Settings) []ocservconf.Settings {
+	var owners []ocservconf.Settings
+	seen := make(map[string]bool)
+	for _, settings := range sections {
+		if settings.IPv4Network == nil || seen[settings.IPv4Network.String()] {
+			continue
+		}
+		seen[settings.IPv4Network.String()] = true
+		owners = append(owners, settings)
+	}
+	return owners
+}
@@ -0,0 +1,36 @@
+package collector
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/mogilevich/ocserv_exporter/internal/ocservconf"
+)
+
+func TestIPPoolsInheritedNetwork(t *testing.T) {
+	file, err := ocservconf.Parse(strings.NewReader(`
+ipv4-network = 10.10.0.0/24
+[vhost:a.example.com]
+max-clients = 10
+[vhost:b.example.com]
+ipv4-network = 10.20.0.0/24
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := New()
+	c.SetServerConfigs(map[string]*ocservconf.File{"s1": file})
+	c.SetOcctlVpnIPs("s1", []string{"10.10.0.5", "10.20.0.7", "10.20.0.8"})
+
+	// a.example.com inherits the global network: its addresses are counted once, globally
+	if got := testutil.CollectAndCount(IPPoolSize); got != 2 {
+		t.Errorf("%d pool size series, want 2", got)
+	}
+	for vhost, want := range map[string]float64{ocservconf.DefaultVHost: 1, "b.example.com": 2} {
+		if got := testutil.ToFloat64(IPPoolUsed.WithLabelValues("s1", vhost)); got != want {
+			t.Errorf("used addresses of %s = %v, want %v", vhost, got, want)
+		}
+	}
+}
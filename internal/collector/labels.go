@@ -0,0 +1,240 @@
+package collector
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// LabelConfig controls optional labels on per-connection metrics
+type LabelConfig struct {
+	// AuthMethod adds an auth_method label (password, certificate, certificate+password, oidc)
+	// to connections_total and auth_failed_total
+	AuthMethod bool
+	// Group adds a group label (ocserv group) to connections, active sessions and traffic metrics
+	Group bool
+	// VHost adds a vhost label (ocserv virtual host) to connections, sessions and traffic metrics
+	VHost bool
+	// ClientType adds a client_type label (classified user agent) to the session duration histogram
+	ClientType bool
+	// RDNS adds an rdns label (PTR domain of the client IP) to auth_failed_total
+	RDNS bool
+	// HashUsernames replaces usernames in all labels with stable pseudonyms (see Username)
+	HashUsernames bool
+	// HashSalt is mixed into username pseudonyms so they can't be reversed by hashing known names
+	HashSalt string
+	// AnonymizeIPs masks client_ip label values (see ClientIP)
+	AnonymizeIPs bool
+	// ClientIPTopN drops the client_ip label of connections_total; the top client IPs are exported
+	// as ClientIPConnections instead (see SetClientIPConfig)
+	ClientIPTopN int
+}
+
+var labelConfig LabelConfig
+
+// shedding drops usernames and client IPs from metric labels (see Collector.SetShedding)
+var shedding atomic.Bool
+
+// Shedding reports whether per-user label values are dropped to limit cardinality
+func Shedding() bool {
+	return shedding.Load()
+}
+
+// userLabel returns the username label value: empty while shedding, so the series of all users
+// of a server add up to one
+func userLabel(username string) string {
+	if shedding.Load() {
+		return ""
+	}
+	return username
+}
+
+// ConfigureLabels rebuilds metrics whose label set depends on the configuration.
+// Must be called before RegisterMetrics.
+func ConfigureLabels(cfg LabelConfig) {
+	labelConfig = cfg
+
+	ActiveSessions = newActiveSessions()
+	SessionInfo = newSessionInfo()
+	SessionDuration = newSessionDurationHistogram()
+	ConnectionsTotal = newConnectionsTotal()
+	AuthFailedTotal = newAuthFailedTotal()
+	ReceivedBytesTotal = newReceivedBytesTotal()
+	SentBytesTotal = newSentBytesTotal()
+	labelEpoch.Add(1)
+}
+
+// Username returns the label value for a username: the username itself, or a stable
+// pseudonym ("u_" and 16 hex chars of HMAC-SHA256 keyed with the salt) when hashing is enabled.
+// Empty usernames (e.g. failed attempts without a user) stay empty.
+func Username(username string) string {
+	if !labelConfig.HashUsernames || username == "" {
+		return username
+	}
+	mac := hmac.New(sha256.New, []byte(labelConfig.HashSalt))
+	mac.Write([]byte(username))
+	return "u_" + hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// ClientIP returns the label value for a client IP: the address itself, or with anonymization
+// enabled the address with the host part zeroed (last octet for IPv4, last 80 bits for IPv6).
+// GeoIP and reverse DNS lookups always use the full address.
+func ClientIP(ip string) string {
+	if shedding.Load() {
+		return ""
+	}
+	if !labelConfig.AnonymizeIPs {
+		return ip
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ip
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return parsed.Mask(net.CIDRMask(48, 128)).String()
+}
+
+// GroupLabelEnabled reports whether the optional group label is enabled
+func GroupLabelEnabled() bool {
+	return labelConfig.Group
+}
+
+// VHostLabelEnabled reports whether the optional vhost label is enabled
+func VHostLabelEnabled() bool {
+	return labelConfig.VHost
+}
+
+func newActiveSessions() *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "active_sessions",
+			Help:      "Number of currently active VPN sessions",
+		},
+		userLabelNames(),
+	)
+}
+
+func newSessionInfo() *prometheus.GaugeVec {
+	labels := []string{"server", "username"}
+	if labelConfig.VHost {
+		labels = append(labels, "vhost")
+	}
+	return prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "session_info",
+			Help:      "Information about active sessions (value is session start timestamp)",
+		},
+		append(labels, "vpn_ip", "country", "client_type"),
+	)
+}
+
+func newConnectionsTotal() *prometheus.CounterVec {
+	labels := userLabelNames()
+	if labelConfig.ClientIPTopN == 0 {
+		labels = append(labels, "client_ip")
+	}
+	if labelConfig.AuthMethod {
+		labels = append(labels, "auth_method")
+	}
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "connections_total",
+			Help:      "Total number of VPN connections",
+		},
+		labels,
+	)
+}
+
+func newAuthFailedTotal() *prometheus.CounterVec {
+	labels := []string{"server", "username", "client_ip", "country", "country_code", "reason"}
+	if labelConfig.AuthMethod {
+		labels = append(labels, "auth_method")
+	}
+	if labelConfig.RDNS {
+		labels = append(labels, "rdns")
+	}
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "auth_failed_total",
+			Help:      "Total number of failed authentication attempts",
+		},
+		labels,
+	)
+}
+
+func newReceivedBytesTotal() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "received_bytes_total",
+			Help:      "Total bytes received from VPN clients",
+		},
+		userLabelNames(),
+	)
+}
+
+func newSentBytesTotal() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "sent_bytes_total",
+			Help:      "Total bytes sent to VPN clients",
+		},
+		userLabelNames(),
+	)
+}
+
+// userLabelNames returns label names of per-user metrics: server, username and optional labels
+func userLabelNames() []string {
+	labels := []string{"server", "username"}
+	if labelConfig.VHost {
+		labels = append(labels, "vhost")
+	}
+	if labelConfig.Group {
+		labels = append(labels, "group")
+	}
+	return labels
+}
+
+// userLabels returns label values for per-user metrics (ActiveSessions, ReceivedBytesTotal, SentBytesTotal)
+func userLabels(server, username, vhost, group string) []string {
+	values := []string{server, userLabel(username)}
+	if labelConfig.VHost {
+		values = append(values, vhost)
+	}
+	if labelConfig.Group {
+		values = append(values, group)
+	}
+	return values
+}
+
+// connectionLabels returns label values for ConnectionsTotal
+func connectionLabels(server, username, vhost, group, clientIP, authMethod string) []string {
+	values := userLabels(server, username, vhost, group)
+	if labelConfig.ClientIPTopN == 0 {
+		values = append(values, ClientIP(clientIP))
+	}
+	if labelConfig.AuthMethod {
+		values = append(values, authMethod)
+	}
+	return values
+}
+
+// SessionInfoLabels returns label values for SessionInfo
+func SessionInfoLabels(server, username, vhost, vpnIP, country, clientType string) []string {
+	values := []string{server, username}
+	if labelConfig.VHost {
+		values = append(values, vhost)
+	}
+	return append(values, vpnIP, country, clientType)
+}
@@ -0,0 +1,145 @@
+package collector
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	// DefaultMaxSessions is the default cap on tracked sessions
+	DefaultMaxSessions = 50000
+	// DefaultMaxDisconnects is the default cap on users remembered for reconnect detection
+	DefaultMaxDisconnects = 100000
+	// DefaultMaxWorkerContexts is the default cap on worker contexts kept for disconnect reasons
+	DefaultMaxWorkerContexts = 50000
+	// DefaultMaxAuthStates is the default cap on each map of pending authentication state
+	DefaultMaxAuthStates = 100000
+)
+
+// Tracking maps (TrackingEvictionsTotal map label)
+const (
+	TrackedSessions       = "sessions"
+	TrackedDisconnects    = "disconnects"
+	TrackedWorkerContexts = "worker_contexts"
+	TrackedAuthPending    = "auth_pending"
+	TrackedAuthReasons    = "auth_reasons"
+	TrackedClientInfo     = "client_info"
+	TrackedLoginStarts    = "login_starts"
+)
+
+// evictFraction is the share of a full map evicted at once, so the scan for the least
+// recently seen entries doesn't run on every insert under a flood
+const evictFraction = 10
+
+// TrackingLimits caps the tracking maps, so unique usernames from scanners can't grow
+// memory without bound. When a map is full its least recently seen entries are evicted.
+type TrackingLimits struct {
+	// Sessions caps active sessions
+	Sessions int
+	// Disconnects caps users remembered for reconnect detection
+	Disconnects int
+	// WorkerContexts caps worker contexts kept for disconnect reasons
+	WorkerContexts int
+	// AuthStates caps each map of pending authentication state: auth starts, login starts,
+	// failure reasons and client info, keyed by the usernames and addresses attempts come from
+	AuthStates int
+}
+
+// SetTrackingLimits sets the caps on the tracking maps; zero keeps a default.
+// Must be called before events are processed.
+func (c *Collector) SetTrackingLimits(limits TrackingLimits) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if limits.Sessions <= 0 {
+		limits.Sessions = DefaultMaxSessions
+	}
+	if limits.Disconnects <= 0 {
+		limits.Disconnects = DefaultMaxDisconnects
+	}
+	if limits.WorkerContexts <= 0 {
+		limits.WorkerContexts = DefaultMaxWorkerContexts
+	}
+	if limits.AuthStates <= 0 {
+		limits.AuthStates = DefaultMaxAuthStates
+	}
+	c.limits = limits
+}
+
+// makeRoomForSession evicts the least recently seen sessions if the session map is full.
+// Must be called with c.mu held, before adding a new key.
+func (c *Collector) makeRoomForSession() {
+	if len(c.sessions) < c.limits.Sessions {
+		return
+	}
+	for _, key := range leastRecent(c.sessions, (*Session).lastSeen) {
+		c.removeSession(key, c.sessions[key])
+		TrackingEvictionsTotal.WithLabelValues(TrackedSessions).Inc()
+	}
+}
+
+// makeRoomForDisconnect evicts the oldest disconnect records if the map is full.
+// Must be called with c.mu held, before adding a new key.
+func (c *Collector) makeRoomForDisconnect() {
+	makeRoom(c.lastDisconnects, c.limits.Disconnects, TrackedDisconnects, func(r *DisconnectRecord) time.Time { return r.Timestamp })
+}
+
+// makeRoomForWorkerContext evicts the least recently updated worker contexts if the map is full.
+// Must be called with c.mu held, before adding a new key.
+func (c *Collector) makeRoomForWorkerContext() {
+	makeRoom(c.workerContext, c.limits.WorkerContexts, TrackedWorkerContexts, func(ctx *WorkerContext) time.Time { return ctx.LastUpdate })
+}
+
+// setAuthPending records the start of an authentication, evicting the oldest ones if the map
+// is full. Must be called with c.mu held.
+func (c *Collector) setAuthPending(key string, ts time.Time) {
+	if _, ok := c.authPending[key]; !ok {
+		makeRoom(c.authPending, c.limits.AuthStates, TrackedAuthPending, func(t time.Time) time.Time { return t })
+	}
+	c.authPending[key] = ts
+}
+
+// setLoginStart records the first auth init of a connection attempt, evicting the oldest ones
+// if the map is full. Must be called with c.mu held.
+func (c *Collector) setLoginStart(key string, ts time.Time) {
+	if _, ok := c.loginStarts[key]; !ok {
+		makeRoom(c.loginStarts, c.limits.AuthStates, TrackedLoginStarts, func(t time.Time) time.Time { return t })
+	}
+	c.loginStarts[key] = ts
+}
+
+// setAuthReason records a pending auth failure reason, evicting the oldest ones if the map
+// is full. Must be called with c.mu held.
+func (c *Collector) setAuthReason(key string, record *AuthFailureRecord) {
+	if _, ok := c.authReasons[key]; !ok {
+		makeRoom(c.authReasons, c.limits.AuthStates, TrackedAuthReasons, func(r *AuthFailureRecord) time.Time { return r.Timestamp })
+	}
+	c.authReasons[key] = record
+}
+
+// makeRoomForClientInfo evicts the oldest client info records if the map is full.
+// Must be called with c.mu held, before adding a new key.
+func (c *Collector) makeRoomForClientInfo() {
+	makeRoom(c.clientInfo, c.limits.AuthStates, TrackedClientInfo, func(r *clientInfoRecord) time.Time { return r.Timestamp })
+}
+
+// makeRoom evicts the least recently seen entries of m if it holds limit entries or more
+func makeRoom[V any](m map[string]V, limit int, name string, seen func(V) time.Time) {
+	if len(m) < limit {
+		return
+	}
+	for _, key := range leastRecent(m, seen) {
+		delete(m, key)
+		TrackingEvictionsTotal.WithLabelValues(name).Inc()
+	}
+}
+
+// leastRecent returns the keys of the 1/evictFraction entries (at least one) with the oldest timestamps
+func leastRecent[V any](m map[string]V, seen func(V) time.Time) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return seen(m[keys[i]]).Before(seen(m[keys[j]])) })
+	return keys[:max(len(keys)/evictFraction, 1)]
+}
@@ -0,0 +1,132 @@
+package collector
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/mogilevich/ocserv_exporter/pkg/parser"
+)
+
+func TestTrackingLimits(t *testing.T) {
+	const limit = 10
+	tests := []struct {
+		name  string
+		event func(i int) *parser.Event // the i-th event adds a new key to the map
+		has   func(c *Collector, first *parser.Event) bool
+		len   func(c *Collector) int
+	}{
+		{
+			name: TrackedSessions,
+			event: func(i int) *parser.Event {
+				return &parser.Event{Type: parser.EventUserLogin, Username: fmt.Sprintf("user%d", i), ClientIP: "198.51.100.7", Port: 40000}
+			},
+			has: func(c *Collector, e *parser.Event) bool {
+				_, ok := c.sessions[sessionKey(e.Server, e.Username, e.ClientIP, e.Port)]
+				return ok
+			},
+			len: func(c *Collector) int { return len(c.sessions) },
+		},
+		{
+			name: TrackedDisconnects,
+			event: func(i int) *parser.Event {
+				return &parser.Event{Type: parser.EventUserDisconnect, Username: fmt.Sprintf("user%d", i), ClientIP: "198.51.100.7"}
+			},
+			has: func(c *Collector, e *parser.Event) bool {
+				_, ok := c.lastDisconnects[serverUserKey(e.Server, e.Username)]
+				return ok
+			},
+			len: func(c *Collector) int { return len(c.lastDisconnects) },
+		},
+		{
+			name: TrackedWorkerContexts,
+			event: func(i int) *parser.Event {
+				return &parser.Event{Type: parser.EventSecModClose, SessionID: fmt.Sprintf("session%d", i)}
+			},
+			has: func(c *Collector, e *parser.Event) bool {
+				_, ok := c.workerContext[sessionContextKey(e.Server, e.SessionID)]
+				return ok
+			},
+			len: func(c *Collector) int { return len(c.workerContext) },
+		},
+		{
+			name: TrackedAuthPending,
+			event: func(i int) *parser.Event {
+				return &parser.Event{Type: parser.EventAuthInit, Username: fmt.Sprintf("user%d", i), ClientIP: "198.51.100.7"}
+			},
+			has: func(c *Collector, e *parser.Event) bool {
+				_, ok := c.authPending[authReasonUserKey(e.Server, e.Username)]
+				return ok
+			},
+			len: func(c *Collector) int { return len(c.authPending) },
+		},
+		{
+			name: TrackedLoginStarts,
+			event: func(i int) *parser.Event {
+				return &parser.Event{Type: parser.EventAuthInit, Username: fmt.Sprintf("user%d", i), ClientIP: "198.51.100.7"}
+			},
+			has: func(c *Collector, e *parser.Event) bool {
+				_, ok := c.loginStarts[authReasonUserKey(e.Server, e.Username)]
+				return ok
+			},
+			len: func(c *Collector) int { return len(c.loginStarts) },
+		},
+		{
+			name: TrackedAuthReasons,
+			event: func(i int) *parser.Event {
+				return &parser.Event{Type: parser.EventAuthFailureReason, Username: fmt.Sprintf("user%d", i), Reason: "invalid password"}
+			},
+			has: func(c *Collector, e *parser.Event) bool {
+				_, ok := c.authReasons[authReasonUserKey(e.Server, e.Username)]
+				return ok
+			},
+			len: func(c *Collector) int { return len(c.authReasons) },
+		},
+		{
+			name: TrackedClientInfo,
+			event: func(i int) *parser.Event {
+				return &parser.Event{Type: parser.EventClientInfo, ClientIP: fmt.Sprintf("198.51.100.%d", i), UserAgent: "AnyConnect"}
+			},
+			has: func(c *Collector, e *parser.Event) bool {
+				_, ok := c.clientInfo[authReasonIPKey(e.Server, e.ClientIP)]
+				return ok
+			},
+			len: func(c *Collector) int { return len(c.clientInfo) },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New()
+			c.SetTrackingLimits(TrackingLimits{Sessions: limit, Disconnects: limit, WorkerContexts: limit, AuthStates: limit})
+			evictions := testutil.ToFloat64(TrackingEvictionsTotal.WithLabelValues(tt.name))
+
+			start := time.Now().Add(-time.Minute)
+			var first *parser.Event
+			for i := 0; i <= limit; i++ {
+				event := tt.event(i)
+				event.Server = "s1"
+				event.Timestamp = start.Add(time.Duration(i) * time.Second)
+				c.ProcessEvent(event)
+				if i == 0 {
+					first = event
+				}
+				if i == limit-1 && tt.len(c) != limit {
+					t.Fatalf("%d entries before the limit is reached, want %d", tt.len(c), limit)
+				}
+			}
+
+			// A full map evicts its oldest tenth, one entry here, before adding the new key
+			if got := tt.len(c); got != limit {
+				t.Errorf("%d entries, want %d", got, limit)
+			}
+			if tt.has(c, first) {
+				t.Error("oldest entry not evicted")
+			}
+			if got := testutil.ToFloat64(TrackingEvictionsTotal.WithLabelValues(tt.name)) - evictions; got != 1 {
+				t.Errorf("%v evictions, want 1", got)
+			}
+		})
+	}
+}
@@ -8,83 +8,201 @@ const namespace = "ocserv"
 
 var (
 	// ActiveSessions tracks current active sessions per user
-	ActiveSessions = prometheus.NewGaugeVec(
+	ActiveSessions = newActiveSessions()
+
+	// ConnectionsTotal counts total connections
+	ConnectionsTotal = newConnectionsTotal()
+
+	// DisconnectionsTotal counts disconnections by reason
+	DisconnectionsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "disconnections_total",
+			Help:      "Total number of VPN disconnections",
+		},
+		[]string{"server", "username", "reason"},
+	)
+
+	// ReceivedBytesTotal tracks total received bytes per user
+	ReceivedBytesTotal = newReceivedBytesTotal()
+
+	// SentBytesTotal tracks total sent bytes per user
+	SentBytesTotal = newSentBytesTotal()
+
+	// SessionDuration tracks session duration distribution
+	SessionDuration = newSessionDurationHistogram()
+
+	// SessionRxBytes tracks the distribution of bytes received per session
+	SessionRxBytes = newSessionRxBytesHistogram()
+
+	// SessionTxBytes tracks the distribution of bytes sent per session
+	SessionTxBytes = newSessionTxBytesHistogram()
+
+	// Info provides exporter info
+	Info = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: namespace,
-			Name:      "active_sessions",
-			Help:      "Number of currently active VPN sessions",
+			Name:      "exporter_info",
+			Help:      "Exporter information",
 		},
-		[]string{"server", "username"},
+		[]string{"version"},
 	)
 
-	// ConnectionsTotal counts total connections
-	ConnectionsTotal = prometheus.NewCounterVec(
+	// LastEventTimestamp tracks when the last log event was processed
+	LastEventTimestamp = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "last_event_timestamp_seconds",
+			Help:      "Unix timestamp of the last processed log event",
+		},
+	)
+
+	// BackfilledEventsTotal counts historical events replayed on startup without updating counters
+	BackfilledEventsTotal = prometheus.NewCounter(
 		prometheus.CounterOpts{
 			Namespace: namespace,
-			Name:      "connections_total",
-			Help:      "Total number of VPN connections",
+			Name:      "backfilled_events_total",
+			Help:      "Total number of historical log events replayed on startup to rebuild session state (not counted in other counters)",
 		},
-		[]string{"server", "username", "client_ip"},
 	)
 
-	// DisconnectionsTotal counts disconnections by reason
-	DisconnectionsTotal = prometheus.NewCounterVec(
+	// TrackingEvictionsTotal counts entries evicted from full tracking maps
+	TrackingEvictionsTotal = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: namespace,
-			Name:      "disconnections_total",
-			Help:      "Total number of VPN disconnections",
+			Name:      "tracking_evictions_total",
+			Help:      "Total number of least recently seen entries evicted from a full tracking map",
 		},
-		[]string{"server", "username", "reason"},
+		[]string{"map"},
 	)
 
-	// ReceivedBytesTotal tracks total received bytes per user
-	ReceivedBytesTotal = prometheus.NewCounterVec(
+	// TrackingEntries tracks the size of each tracking map
+	TrackingEntries = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "tracking_entries",
+			Help:      "Number of entries in a tracking map as of the last cleanup",
+		},
+		[]string{"map"},
+	)
+
+	// StaleSessionsRemovedTotal counts sessions the cleanup dropped because their disconnect was missed
+	StaleSessionsRemovedTotal = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: namespace,
-			Name:      "received_bytes_total",
-			Help:      "Total bytes received from VPN clients",
+			Name:      "stale_sessions_removed_total",
+			Help:      "Total number of sessions removed by cleanup after 24h without a disconnect line",
 		},
-		[]string{"server", "username"},
+		[]string{"server"},
 	)
 
-	// SentBytesTotal tracks total sent bytes per user
-	SentBytesTotal = prometheus.NewCounterVec(
+	// ExpiredDisconnectsTotal counts disconnect records the cleanup dropped after the reconnect window
+	ExpiredDisconnectsTotal = prometheus.NewCounter(
 		prometheus.CounterOpts{
 			Namespace: namespace,
-			Name:      "sent_bytes_total",
-			Help:      "Total bytes sent to VPN clients",
+			Name:      "expired_disconnects_total",
+			Help:      "Total number of disconnect records expired by cleanup (no reconnect within the window)",
 		},
-		[]string{"server", "username"},
 	)
 
-	// SessionDuration tracks session duration distribution
-	SessionDuration = prometheus.NewHistogramVec(
-		prometheus.HistogramOpts{
+	// CleanupRunsTotal counts runs of the periodic cleanup
+	CleanupRunsTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "cleanup_runs_total",
+			Help:      "Total number of periodic cleanup runs",
+		},
+	)
+
+	// ConnectionsRejectedTotal counts connections refused before authentication
+	ConnectionsRejectedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "connections_rejected_total",
+			Help:      "Total number of connections rejected before authentication by reason (max clients, max same clients, banned, tls auth required)",
+		},
+		[]string{"server", "reason"},
+	)
+
+	// SessionLimitHitsTotal counts users reaching max-same-clients: occtl session counts reaching
+	// the limit and connections rejected for it in the logs
+	SessionLimitHitsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
 			Namespace: namespace,
-			Name:      "session_duration_seconds",
-			Help:      "VPN session duration in seconds",
-			Buckets:   []float64{60, 300, 900, 1800, 3600, 7200, 14400, 28800, 43200, 86400},
+			Name:      "session_limit_hits_total",
+			Help:      "Total number of times a user reached max-same-clients (occtl session counts) or was rejected for it (logs)",
 		},
 		[]string{"server", "username"},
 	)
 
-	// Info provides exporter info
-	Info = prometheus.NewGaugeVec(
+	// SessionsByMTU tracks active sessions by their current link MTU
+	SessionsByMTU = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: namespace,
-			Name:      "exporter_info",
-			Help:      "Exporter information",
+			Name:      "sessions_by_mtu",
+			Help:      "Active sessions by link MTU configured by the worker",
 		},
-		[]string{"version"},
+		[]string{"server", "mtu"},
 	)
 
-	// LastEventTimestamp tracks when the last log event was processed
-	LastEventTimestamp = prometheus.NewGauge(
+	// RekeysTotal counts CSTP and DTLS rekeys
+	RekeysTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rekeys_total",
+			Help:      "Total number of channel rekeys by channel (cstp, dtls)",
+		},
+		[]string{"server", "channel"},
+	)
+
+	// ServerRestartsTotal counts ocserv starts seen in the logs
+	ServerRestartsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "server_restarts_total",
+			Help:      "Total number of ocserv (re)starts seen in the logs",
+		},
+		[]string{"server"},
+	)
+
+	// ServerReloadsTotal counts ocserv configuration reloads seen in the logs
+	ServerReloadsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "server_reloads_total",
+			Help:      "Total number of ocserv configuration reloads (SIGHUP) seen in the logs",
+		},
+		[]string{"server"},
+	)
+
+	// ServerStartTimestamp is when ocserv last started according to the logs
+	ServerStartTimestamp = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: namespace,
-			Name:      "last_event_timestamp_seconds",
-			Help:      "Unix timestamp of the last processed log event",
+			Name:      "server_start_timestamp_seconds",
+			Help:      "Unix timestamp of the last ocserv start seen in the logs",
+		},
+		[]string{"server"},
+	)
+
+	// CustomEventsTotal counts log lines matched by user-defined patterns without event type
+	CustomEventsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "custom_events_total",
+			Help:      "Total number of log lines matched by user-defined patterns",
+		},
+		[]string{"server", "name"},
+	)
+
+	// SessionResumptionsTotal tracks logins resuming a session with its cookie
+	SessionResumptionsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "session_resumptions_total",
+			Help:      "Total logins that resumed an existing session with its cookie instead of authenticating",
 		},
+		[]string{"server"},
 	)
 
 	// ReconnectsTotal tracks rapid reconnections (login within 5 min of disconnect)
@@ -97,6 +215,26 @@ var (
 		[]string{"server", "username"},
 	)
 
+	// FlappingUsers marks users currently stuck in a reconnect loop
+	FlappingUsers = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "flapping_users",
+			Help:      "Users currently reconnecting at or above the flapping threshold (value is 1)",
+		},
+		[]string{"server", "username"},
+	)
+
+	// FlapEpisodesTotal counts reconnect loops (flap episodes) per user
+	FlapEpisodesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "flap_episodes_total",
+			Help:      "Total number of flap episodes (reconnects reaching the flapping threshold) per user",
+		},
+		[]string{"server", "username"},
+	)
+
 	// ProblematicSessionsTotal tracks sessions that ended with error and lasted < 60s
 	ProblematicSessionsTotal = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
@@ -117,32 +255,116 @@ var (
 		[]string{"server", "username", "country", "country_code"},
 	)
 
+	// TrafficBytesTotal tracks session traffic by client country (GeoIP)
+	TrafficBytesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "traffic_bytes_total",
+			Help:      "Total bytes of ended sessions by direction (rx from clients, tx to clients) and client country",
+		},
+		[]string{"server", "direction", "country"},
+	)
+
 	// AuthFailedTotal tracks failed authentication attempts
-	AuthFailedTotal = prometheus.NewCounterVec(
+	AuthFailedTotal = newAuthFailedTotal()
+
+	// GeoAnomalyTotal tracks suspicious login locations (impossible travel, new country)
+	GeoAnomalyTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "geo_anomaly_total",
+			Help:      "Total number of logins from an implausible or previously unseen location (requires GeoIP)",
+		},
+		[]string{"server", "username", "type"},
+	)
+
+	// AuthBackendErrorsTotal tracks auth backend (radius/pam) errors
+	AuthBackendErrorsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "auth_backend_errors_total",
+			Help:      "Total number of authentication backend errors (radius/pam) by error class",
+		},
+		[]string{"server", "backend", "error"},
+	)
+
+	// CertAuthTotal tracks client certificate authentication results
+	CertAuthTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "cert_auth_total",
+			Help:      "Total number of client certificate authentications by result (success, expired, untrusted, revoked, missing, failed)",
+		},
+		[]string{"server", "result"},
+	)
+
+	// SecondFactorFailuresTotal tracks authentication attempts failing at the second factor
+	SecondFactorFailuresTotal = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: namespace,
-			Name:      "auth_failed_total",
-			Help:      "Total number of failed authentication attempts",
+			Name:      "second_factor_failures_total",
+			Help:      "Total number of failed authentication attempts rejected at the second factor (OTP, GSSAPI)",
 		},
-		[]string{"server", "username", "client_ip", "country", "country_code"},
+		[]string{"server", "username"},
+	)
+
+	// OIDCTokenFailuresTotal tracks OIDC tokens rejected by the oidc auth module
+	OIDCTokenFailuresTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "oidc_token_failures_total",
+			Help:      "Total number of OIDC tokens rejected by error (expired, issuer_mismatch, audience_mismatch, invalid_signature, malformed, invalid)",
+		},
+		[]string{"server", "error"},
 	)
 
+	// AuthBackendDuration tracks time from sec-mod auth init to the backend result
+	AuthBackendDuration = newAuthBackendDurationHistogram()
+
+	// LoginLatency tracks time from the start of a connection attempt to the login
+	LoginLatency = newLoginLatencyHistogram()
+
 	// SessionInfo provides detailed info about each active session
 	// Value is session start timestamp (unix), labels provide session details
-	SessionInfo = prometheus.NewGaugeVec(
+	SessionInfo = newSessionInfo()
+
+	// UniqueActiveUsers tracks distinct usernames with at least one active session
+	UniqueActiveUsers = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "unique_active_users",
+			Help:      "Number of distinct users with at least one active session",
+		},
+		[]string{"server"},
+	)
+
+	// UniqueUsers24h estimates distinct users that logged in during the last 24 hours
+	UniqueUsers24h = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "unique_users_24h",
+			Help:      "Estimated number of distinct users that logged in during the last 24 hours (HyperLogLog)",
+		},
+		[]string{"server"},
+	)
+
+	// UniqueUsers7d estimates distinct users that logged in during the last 7 days
+	UniqueUsers7d = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: namespace,
-			Name:      "session_info",
-			Help:      "Information about active sessions (value is session start timestamp)",
+			Name:      "unique_users_7d",
+			Help:      "Estimated number of distinct users that logged in during the last 7 days (HyperLogLog)",
 		},
-		[]string{"server", "username", "vpn_ip", "country", "client_type"},
+		[]string{"server"},
 	)
 
 	// Server-level metrics from occtl
 
 	// ServerRxBytesTotal tracks total received bytes at server level (from occtl)
-	ServerRxBytesTotal = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
+	// occtl reports a cumulative value that resets on ocserv restart, so it is
+	// exported as a counter fed with deltas (see Collector.UpdateServerTraffic)
+	ServerRxBytesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
 			Namespace: namespace,
 			Name:      "server_rx_bytes_total",
 			Help:      "Total bytes received by server (from occtl show status)",
@@ -151,8 +373,8 @@ var (
 	)
 
 	// ServerTxBytesTotal tracks total sent bytes at server level (from occtl)
-	ServerTxBytesTotal = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
+	ServerTxBytesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
 			Namespace: namespace,
 			Name:      "server_tx_bytes_total",
 			Help:      "Total bytes sent by server (from occtl show status)",
@@ -220,6 +442,96 @@ var (
 		[]string{"server"},
 	)
 
+	// ServerMaxSessionTime tracks the longest session time
+	ServerMaxSessionTime = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "server_max_session_time_seconds",
+			Help:      "Maximum session time in seconds",
+		},
+		[]string{"server"},
+	)
+
+	// ServerAuthFailuresTotal tracks authentication failures at server level (from occtl)
+	ServerAuthFailuresTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "server_auth_failures_total",
+			Help:      "Total authentication failures reported by server (from occtl show status)",
+		},
+		[]string{"server"},
+	)
+
+	// OcctlUp tracks whether the last occtl poll of a server succeeded
+	OcctlUp = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "occtl_up",
+			Help:      "Whether the last occtl poll succeeded (1) or failed (0)",
+		},
+		[]string{"server"},
+	)
+
+	// OcctlConsecutiveFailures tracks failed occtl polls of a server since its last success
+	OcctlConsecutiveFailures = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "occtl_consecutive_failures",
+			Help:      "Number of occtl polls of a server failed in a row (polls back off from the second)",
+		},
+		[]string{"server"},
+	)
+
+	// OcctlQueryUp tracks the result of each occtl query (see OcctlQuery)
+	OcctlQueryUp = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "occtl_query_up",
+			Help:      "Whether the last run of an occtl query succeeded (1) or failed (0)",
+		},
+		[]string{"server", "query"},
+	)
+
+	// OcctlQueryErrorsTotal tracks failed occtl queries
+	OcctlQueryErrorsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "occtl_query_errors_total",
+			Help:      "Total failed runs of an occtl query",
+		},
+		[]string{"server", "query"},
+	)
+
+	// IPBans tracks the IP addresses ocserv banned
+	IPBans = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "ip_bans",
+			Help:      "Number of IP addresses currently banned by ocserv (occtl show ip bans)",
+		},
+		[]string{"server"},
+	)
+
+	// ServerInfo provides the version and build features of each ocserv
+	ServerInfo = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "server_info",
+			Help:      "ocserv version and features it was compiled with (from ocserv -v), always 1",
+		},
+		[]string{"server", "version", "compiled_with"},
+	)
+
+	// SessionsByState tracks occtl sessions by state
+	SessionsByState = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "sessions_by_state",
+			Help:      "Number of ocserv sessions by state (connected, authenticated, disconnected, authenticating, pre-auth, failed)",
+		},
+		[]string{"server", "state"},
+	)
+
 	// SessionsByClientType tracks sessions by VPN client type
 	SessionsByClientType = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -239,28 +551,538 @@ var (
 		},
 		[]string{"server", "username"},
 	)
+
+	// UsersAtSessionLimit tracks users whose occtl session count reached max-same-clients
+	UsersAtSessionLimit = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "users_at_session_limit",
+			Help:      "Current number of users whose concurrent sessions (from occtl) reached the configured max-same-clients",
+		},
+		[]string{"server"},
+	)
+
+	// SessionReconciliationsTotal counts sessions closed or adopted to match occtl
+	SessionReconciliationsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "session_reconciliations_total",
+			Help:      "Total number of tracked sessions closed because occtl no longer reports them (closed) or added because only occtl reports them (adopted)",
+		},
+		[]string{"server", "action"},
+	)
+
+	// SessionsByDTLSCipher tracks sessions by negotiated DTLS cipher (from occtl)
+	SessionsByDTLSCipher = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "sessions_by_dtls_cipher",
+			Help:      "Current sessions by DTLS cipher, \"none\" for TLS-only sessions (from occtl)",
+		},
+		[]string{"server", "cipher"},
+	)
+
+	// SessionsTLSOnly tracks sessions without a DTLS channel (UDP blocked or disabled)
+	SessionsTLSOnly = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "sessions_tls_only",
+			Help:      "Current sessions running over TLS only, without DTLS (from occtl)",
+		},
+		[]string{"server"},
+	)
 )
 
-// RegisterMetrics registers all metrics with the provided registry
-func RegisterMetrics(reg prometheus.Registerer) {
-	reg.MustRegister(
-		ActiveSessions,
-		ConnectionsTotal,
-		DisconnectionsTotal,
-		ReceivedBytesTotal,
-		SentBytesTotal,
-		SessionDuration,
-		Info,
-		LastEventTimestamp,
-		ReconnectsTotal,
-		ProblematicSessionsTotal,
-		ConnectionsByCountry,
-		AuthFailedTotal,
-		SessionInfo,
+// Push metrics (Pushgateway push mode)
+var (
+	// PushTotal tracks pushes to the Pushgateway by result
+	PushTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "push_total",
+			Help:      "Total number of pushes to the Pushgateway by result (success, failure)",
+		},
+		[]string{"result"},
 	)
-}
 
-// RegisterOcctlMetrics registers occtl-specific metrics
+	// PushLastSuccessTimestamp is the time of the last successful push
+	PushLastSuccessTimestamp = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "push_last_success_timestamp_seconds",
+			Help:      "Unix timestamp of the last successful push to the Pushgateway",
+		},
+	)
+
+	// PushDuration tracks how long pushes take
+	PushDuration = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "push_duration_seconds",
+			Help:      "Duration of the last push to the Pushgateway",
+		},
+	)
+)
+
+// Remote write metrics
+var (
+	// RemoteWriteTotal tracks remote write requests by result
+	RemoteWriteTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "remote_write_requests_total",
+			Help:      "Total number of remote write requests by result (success, failure)",
+		},
+		[]string{"result"},
+	)
+
+	// RemoteWriteSamplesTotal tracks samples successfully sent via remote write
+	RemoteWriteSamplesTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "remote_write_samples_total",
+			Help:      "Total number of samples successfully sent via remote write",
+		},
+	)
+
+	// RemoteWriteLastSuccessTimestamp is the time of the last successful remote write
+	RemoteWriteLastSuccessTimestamp = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "remote_write_last_success_timestamp_seconds",
+			Help:      "Unix timestamp of the last successful remote write request",
+		},
+	)
+)
+
+// OTLP export metrics
+var (
+	// OTLPExportsTotal tracks OTLP export requests by result
+	OTLPExportsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "otlp_exports_total",
+			Help:      "Total number of OTLP export requests by result (success, failure)",
+		},
+		[]string{"result"},
+	)
+
+	// OTLPDataPointsTotal tracks data points successfully exported via OTLP
+	OTLPDataPointsTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "otlp_data_points_total",
+			Help:      "Total number of data points successfully exported via OTLP",
+		},
+	)
+
+	// OTLPLastSuccessTimestamp is the time of the last successful OTLP export
+	OTLPLastSuccessTimestamp = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "otlp_last_success_timestamp_seconds",
+			Help:      "Unix timestamp of the last successful OTLP export",
+		},
+	)
+)
+
+// Event sink metrics (Loki and other event outputs)
+var (
+	// EventsSentTotal tracks events delivered by each sink
+	EventsSentTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "events_sent_total",
+			Help:      "Total number of events delivered by an event sink",
+		},
+		[]string{"sink"},
+	)
+
+	// EventsDroppedTotal tracks events lost because a sink's queue was full or delivery failed
+	EventsDroppedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "events_dropped_total",
+			Help:      "Total number of events dropped by an event sink (queue full or delivery failed)",
+		},
+		[]string{"sink"},
+	)
+
+	// EventSinkErrorsTotal tracks failed deliveries
+	EventSinkErrorsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "event_sink_errors_total",
+			Help:      "Total number of failed event deliveries by sink",
+		},
+		[]string{"sink"},
+	)
+)
+
+// ClientIPConnections tracks recent connections of the top client IPs (--metrics.client-ip-top-n)
+var ClientIPConnections = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "client_ip_connections",
+		Help:      "Connections within the window from the top client IPs of a server; client_ip=\"other\" sums the rest",
+	},
+	[]string{"server", "client_ip"},
+)
+
+// TopUserBytes tracks the users transferring the most bytes between occtl polls (--occtl.top-users)
+var TopUserBytes = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "top_user_bytes",
+		Help:      "Bytes transferred (RX+TX) between the last two occtl polls by the top users of a server, rank 1 being the heaviest",
+	},
+	[]string{"server", "rank", "username"},
+)
+
+// Country policy metrics (country_policies of the config file)
+var (
+	// ConnectionsFromDeniedCountryTotal tracks logins from countries a server's policy doesn't allow
+	ConnectionsFromDeniedCountryTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "connections_from_denied_country_total",
+			Help:      "Total number of connections from countries denied or not allowed by the server's country policy",
+		},
+		[]string{"server", "username", "country", "country_code"},
+	)
+
+	// CountryPolicyInfo exports the configured country policies
+	CountryPolicyInfo = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "country_policy_info",
+			Help:      "Country policy of a server (\"*\" for servers without their own), value is always 1",
+		},
+		[]string{"server", "allow", "deny"},
+	)
+)
+
+// FirstSeenTotal tracks logins of known users from a new country, device or subnet (--firstseen.enabled)
+var FirstSeenTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "first_seen_total",
+		Help:      "Total number of logins of known users from a country, device (client type) or client subnet not seen for them before",
+	},
+	[]string{"server", "kind"},
+)
+
+// Policy metrics (automation hooks of the config file's policies)
+var (
+	// PolicyViolationsTotal tracks events meeting the conditions of a policy
+	PolicyViolationsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "policy_violations_total",
+			Help:      "Total number of events violating a policy",
+		},
+		[]string{"server", "policy"},
+	)
+
+	// PolicyActionsTotal tracks the actions run for violations
+	PolicyActionsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "policy_actions_total",
+			Help:      "Total number of policy actions run, by action and result (success, error or suppressed during the cooldown)",
+		},
+		[]string{"policy", "action", "result"},
+	)
+)
+
+// Aggregator metrics (events streamed by agents)
+var (
+	// AggregatorAgentsConnected tracks agents with an open event stream
+	AggregatorAgentsConnected = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "aggregator_agents_connected",
+			Help:      "Number of agents currently streaming events to the aggregator",
+		},
+	)
+
+	// AggregatorEventsReceivedTotal tracks events received from each agent
+	AggregatorEventsReceivedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "aggregator_events_received_total",
+			Help:      "Total number of events received from agents by node",
+		},
+		[]string{"node"},
+	)
+)
+
+// Federation metrics (scrapes of other exporters)
+var (
+	// FederationTargetUp tracks whether the last scrape of each federated exporter succeeded
+	FederationTargetUp = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "federation_target_up",
+			Help:      "Whether the last scrape of a federated exporter succeeded (1 = success, 0 = failure)",
+		},
+		[]string{"target"},
+	)
+
+	// FederationScrapeErrorsTotal tracks failed scrapes of federated exporters
+	FederationScrapeErrorsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "federation_scrape_errors_total",
+			Help:      "Total number of failed scrapes of a federated exporter",
+		},
+		[]string{"target"},
+	)
+)
+
+// HA metrics (leader election)
+var (
+	// HALeader tracks whether this instance is the leader of its HA group
+	HALeader = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "exporter",
+			Name:      "ha_leader",
+			Help:      "Whether this instance is the HA leader publishing metrics and events (1 = leader, 0 = follower)",
+		},
+	)
+
+	// HATransitionsTotal tracks changes of leadership
+	HATransitionsTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "exporter",
+			Name:      "ha_transitions_total",
+			Help:      "Total number of times this instance became or stopped being the HA leader",
+		},
+	)
+)
+
+// Cardinality shedding metrics
+var (
+	// CardinalityShedding tracks whether per-user labels are shed
+	CardinalityShedding = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "exporter",
+			Name:      "cardinality_shedding",
+			Help:      "Whether username and client_ip labels are dropped because of memory pressure (1 = shedding)",
+		},
+	)
+
+	// ShedEpisodesTotal tracks how often shedding started
+	ShedEpisodesTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "exporter",
+			Name:      "cardinality_shed_episodes_total",
+			Help:      "Total number of times the exporter started shedding username and client_ip labels",
+		},
+	)
+
+	// RegistrySeries tracks the number of series the exporter exposes
+	RegistrySeries = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "exporter",
+			Name:      "series",
+			Help:      "Number of series exposed by the exporter at the last shedding check",
+		},
+	)
+)
+
+// Configuration-derived metrics (from ocserv.conf)
+var (
+	// ConfigInfo exposes configuration details of each server/vhost
+	ConfigInfo = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "config_info",
+			Help:      "ocserv configuration details (from ocserv.conf, value is always 1)",
+		},
+		[]string{"server", "vhost", "auth", "device", "ipv4_network"},
+	)
+
+	// ConfigMaxClients tracks the configured max-clients limit
+	ConfigMaxClients = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "config_max_clients",
+			Help:      "Configured max-clients (0 means unlimited)",
+		},
+		[]string{"server", "vhost"},
+	)
+
+	// ConfigMaxSameClients tracks the configured max-same-clients limit
+	ConfigMaxSameClients = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "config_max_same_clients",
+			Help:      "Configured max-same-clients (0 means unlimited)",
+		},
+		[]string{"server", "vhost"},
+	)
+
+	// ConfigServerCertExpiry tracks when the configured server-cert expires
+	ConfigServerCertExpiry = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "config_server_cert_expiry_timestamp_seconds",
+			Help:      "Unix timestamp when the server-cert configured in ocserv.conf expires",
+		},
+		[]string{"server", "vhost"},
+	)
+
+	// IPPoolSize tracks the number of assignable addresses in the ipv4-network pool
+	IPPoolSize = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "ip_pool_size",
+			Help:      "Number of assignable addresses in the configured ipv4-network pool",
+		},
+		[]string{"server", "vhost"},
+	)
+
+	// IPPoolUsed tracks assigned addresses in the ipv4-network pool (journal sessions and occtl users)
+	IPPoolUsed = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "ip_pool_used",
+			Help:      "Number of addresses currently assigned from the ipv4-network pool",
+		},
+		[]string{"server", "vhost"},
+	)
+)
+
+// ocpasswd inventory metrics
+var (
+	// PasswdUsers tracks the number of accounts in the ocpasswd file
+	PasswdUsers = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "ocpasswd_users",
+			Help:      "Number of accounts configured in the ocpasswd file",
+		},
+		[]string{"server"},
+	)
+
+	// PasswdLockedUsers tracks the number of locked accounts in the ocpasswd file
+	PasswdLockedUsers = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "ocpasswd_locked_users",
+			Help:      "Number of locked accounts in the ocpasswd file",
+		},
+		[]string{"server"},
+	)
+
+	// PasswdUsersByGroup tracks the number of ocpasswd accounts per group
+	PasswdUsersByGroup = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "ocpasswd_users_by_group",
+			Help:      "Number of accounts per group in the ocpasswd file",
+		},
+		[]string{"server", "group"},
+	)
+)
+
+// Metrics endpoint (/metrics handler) metrics
+var (
+	// HTTPRequestsInFlight tracks scrapes being served
+	HTTPRequestsInFlight = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "exporter",
+			Name:      "http_requests_in_flight",
+			Help:      "Number of metrics requests currently being served",
+		},
+	)
+
+	// HTTPRequestDuration tracks how long serializing and serving a scrape takes
+	HTTPRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "exporter",
+			Name:      "http_request_duration_seconds",
+			Help:      "Duration of metrics requests by status code",
+			Buckets:   []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+		},
+		[]string{"code"},
+	)
+
+	// HTTPResponseSize tracks the size of scrape responses
+	HTTPResponseSize = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "exporter",
+			Name:      "http_response_size_bytes",
+			Help:      "Size of metrics responses by status code",
+			Buckets:   prometheus.ExponentialBuckets(1024, 4, 8),
+		},
+		[]string{"code"},
+	)
+)
+
+// RegisterMetrics registers all metrics with the provided registry
+func RegisterMetrics(reg prometheus.Registerer) {
+	reg.MustRegister(
+		ActiveSessions,
+		ConnectionsTotal,
+		DisconnectionsTotal,
+		ReceivedBytesTotal,
+		SentBytesTotal,
+		SessionDuration,
+		SessionRxBytes,
+		SessionTxBytes,
+		Info,
+		LastEventTimestamp,
+		BackfilledEventsTotal,
+		TrackingEvictionsTotal,
+		TrackingEntries,
+		StaleSessionsRemovedTotal,
+		ExpiredDisconnectsTotal,
+		CleanupRunsTotal,
+		ConnectionsRejectedTotal,
+		SessionLimitHitsTotal,
+		SessionsByMTU,
+		RekeysTotal,
+		ServerRestartsTotal,
+		ServerReloadsTotal,
+		ServerStartTimestamp,
+		ReconnectsTotal,
+		SessionResumptionsTotal,
+		FlappingUsers,
+		FlapEpisodesTotal,
+		ProblematicSessionsTotal,
+		ConnectionsByCountry,
+		TrafficBytesTotal,
+		AuthFailedTotal,
+		GeoAnomalyTotal,
+		AuthBackendErrorsTotal,
+		AuthBackendDuration,
+		LoginLatency,
+		CertAuthTotal,
+		OIDCTokenFailuresTotal,
+		SecondFactorFailuresTotal,
+		SessionInfo,
+		UniqueActiveUsers,
+		UniqueUsers24h,
+		UniqueUsers7d,
+	)
+}
+
+// RegisterPatternMetrics registers metrics for user-defined log patterns
+func RegisterPatternMetrics(reg prometheus.Registerer) {
+	reg.MustRegister(CustomEventsTotal)
+}
+
+// RegisterOcctlMetrics registers occtl-specific metrics
 func RegisterOcctlMetrics(reg prometheus.Registerer) {
 	reg.MustRegister(
 		ServerRxBytesTotal,
@@ -271,7 +1093,156 @@ func RegisterOcctlMetrics(reg prometheus.Registerer) {
 		ServerLatencyStdev,
 		ServerUptime,
 		ServerAvgSessionTime,
+		ServerMaxSessionTime,
+		ServerAuthFailuresTotal,
+		OcctlUp,
+		OcctlConsecutiveFailures,
+		OcctlQueryUp,
+		OcctlQueryErrorsTotal,
+		IPBans,
+		ServerInfo,
+		SessionsByState,
 		SessionsByClientType,
 		UserConcurrentSessions,
+		SessionReconciliationsTotal,
+		SessionsByDTLSCipher,
+		SessionsTLSOnly,
+	)
+}
+
+// RegisterClientTypeMetrics registers the client type breakdown maintained from logged user
+// agents when occtl polling (which exports it otherwise) is disabled
+func RegisterClientTypeMetrics(reg prometheus.Registerer) {
+	reg.MustRegister(SessionsByClientType)
+}
+
+// RegisterConfigMetrics registers ocserv.conf-derived metrics
+func RegisterConfigMetrics(reg prometheus.Registerer) {
+	reg.MustRegister(
+		ConfigInfo,
+		ConfigMaxClients,
+		ConfigMaxSameClients,
+		ConfigServerCertExpiry,
+		UsersAtSessionLimit,
+		IPPoolSize,
+		IPPoolUsed,
+	)
+}
+
+// RegisterPushMetrics registers Pushgateway push metrics
+func RegisterPushMetrics(reg prometheus.Registerer) {
+	reg.MustRegister(
+		PushTotal,
+		PushLastSuccessTimestamp,
+		PushDuration,
+	)
+}
+
+// RegisterRemoteWriteMetrics registers remote write metrics
+func RegisterRemoteWriteMetrics(reg prometheus.Registerer) {
+	reg.MustRegister(
+		RemoteWriteTotal,
+		RemoteWriteSamplesTotal,
+		RemoteWriteLastSuccessTimestamp,
+	)
+}
+
+// RegisterOTLPMetrics registers OTLP export metrics
+func RegisterOTLPMetrics(reg prometheus.Registerer) {
+	reg.MustRegister(
+		OTLPExportsTotal,
+		OTLPDataPointsTotal,
+		OTLPLastSuccessTimestamp,
+	)
+}
+
+// RegisterEventSinkMetrics registers event sink metrics
+func RegisterEventSinkMetrics(reg prometheus.Registerer) {
+	reg.MustRegister(
+		EventsSentTotal,
+		EventsDroppedTotal,
+		EventSinkErrorsTotal,
+	)
+}
+
+// RegisterAggregatorMetrics registers aggregator metrics
+func RegisterAggregatorMetrics(reg prometheus.Registerer) {
+	reg.MustRegister(
+		AggregatorAgentsConnected,
+		AggregatorEventsReceivedTotal,
+	)
+}
+
+// RegisterFederationMetrics registers federation metrics
+func RegisterFederationMetrics(reg prometheus.Registerer) {
+	reg.MustRegister(
+		FederationTargetUp,
+		FederationScrapeErrorsTotal,
+	)
+}
+
+// RegisterHAMetrics registers HA metrics
+func RegisterHAMetrics(reg prometheus.Registerer) {
+	reg.MustRegister(
+		HALeader,
+		HATransitionsTotal,
+	)
+}
+
+// RegisterSheddingMetrics registers cardinality shedding metrics
+func RegisterSheddingMetrics(reg prometheus.Registerer) {
+	reg.MustRegister(
+		CardinalityShedding,
+		ShedEpisodesTotal,
+		RegistrySeries,
+	)
+}
+
+// RegisterPasswdMetrics registers ocpasswd inventory metrics
+func RegisterPasswdMetrics(reg prometheus.Registerer) {
+	reg.MustRegister(
+		PasswdUsers,
+		PasswdLockedUsers,
+		PasswdUsersByGroup,
+	)
+}
+
+// RegisterClientIPMetrics registers the top client IP metric
+func RegisterClientIPMetrics(reg prometheus.Registerer) {
+	reg.MustRegister(ClientIPConnections)
+}
+
+// RegisterTopUserMetrics registers top user metrics
+func RegisterTopUserMetrics(reg prometheus.Registerer) {
+	reg.MustRegister(TopUserBytes)
+}
+
+// RegisterCountryPolicyMetrics registers country policy metrics
+func RegisterCountryPolicyMetrics(reg prometheus.Registerer) {
+	reg.MustRegister(
+		ConnectionsFromDeniedCountryTotal,
+		CountryPolicyInfo,
+	)
+}
+
+// RegisterFirstSeenMetrics registers first-seen metrics
+func RegisterFirstSeenMetrics(reg prometheus.Registerer) {
+	reg.MustRegister(FirstSeenTotal)
+}
+
+// RegisterPolicyMetrics registers policy metrics
+func RegisterPolicyMetrics(reg prometheus.Registerer) {
+	reg.MustRegister(
+		PolicyViolationsTotal,
+		PolicyActionsTotal,
+	)
+}
+
+// RegisterHTTPMetrics registers metrics endpoint metrics
+func RegisterHTTPMetrics(reg prometheus.Registerer) {
+	reg.MustRegister(
+		HTTPRequestsInFlight,
+		HTTPRequestDuration,
+		HTTPResponseSize,
 	)
 }
@@ -0,0 +1,121 @@
+package collector
+
+import "github.com/mogilevich/ocserv_exporter/pkg/occtl"
+
+// serverTraffic holds the last cumulative RX/TX and auth failure values reported by occtl for a server
+type serverTraffic struct {
+	rx           int64
+	tx           int64
+	authFailures int64
+}
+
+// UpdateServerTraffic feeds cumulative server RX/TX totals from occtl into the
+// server byte counters. occtl values reset to zero when ocserv restarts, so only
+// the increase since the previous poll is added; a value lower than the previous
+// one is treated as a reset and added in full.
+func (c *Collector) UpdateServerTraffic(server string, rx, tx int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	last, ok := c.serverTraffic[server]
+	if !ok {
+		last = &serverTraffic{}
+		c.serverTraffic[server] = last
+	}
+
+	ServerRxBytesTotal.WithLabelValues(server).Add(float64(counterDelta(last.rx, rx)))
+	ServerTxBytesTotal.WithLabelValues(server).Add(float64(counterDelta(last.tx, tx)))
+
+	last.rx = rx
+	last.tx = tx
+}
+
+// UpdateServerAuthFailures feeds the cumulative auth failure count from occtl into the
+// server auth failure counter, with the same reset handling as UpdateServerTraffic.
+func (c *Collector) UpdateServerAuthFailures(server string, failures int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	last, ok := c.serverTraffic[server]
+	if !ok {
+		last = &serverTraffic{}
+		c.serverTraffic[server] = last
+	}
+
+	ServerAuthFailuresTotal.WithLabelValues(server).Add(float64(counterDelta(last.authFailures, failures)))
+	last.authFailures = failures
+}
+
+// counterDelta returns the increase between two cumulative readings,
+// treating a decrease as a counter reset
+func counterDelta(previous, current int64) int64 {
+	if current < previous {
+		return current
+	}
+	return current - previous
+}
+
+// SessionTraffic is the cumulative traffic of an active session reported by occtl
+type SessionTraffic struct {
+	ID       int
+	Username string
+	ClientIP string
+	VpnIP    string
+	RxBytes  uint64
+	TxBytes  uint64
+}
+
+// UpdateSessionTraffic adds the traffic of active sessions since the previous reading to the
+// per-user byte counters, so they advance during long sessions instead of jumping at disconnect.
+// The disconnect line then only adds the remainder. Readings are matched to sessions known from
+// the logs by VPN IP, or by client IP; unmatched sessions are counted in full at disconnect.
+func (c *Collector) UpdateSessionTraffic(server string, readings []SessionTraffic) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	byUser := make(map[string][]*Session)
+	for _, session := range c.sessions {
+		if session.Server == server {
+			byUser[session.Username] = append(byUser[session.Username], session)
+		}
+	}
+
+	for _, reading := range readings {
+		for _, session := range byUser[reading.Username] {
+			if (reading.VpnIP == "" || session.VpnIP != reading.VpnIP) && session.ClientIP != reading.ClientIP {
+				continue
+			}
+			session.handles = handlesFor(session.handles, session.Server, session.Username)
+			received, sent := session.handles.traffic(session.VHost, session.Group)
+			if reading.RxBytes > session.InterimRx {
+				received.Add(float64(reading.RxBytes - session.InterimRx))
+				session.InterimRx = reading.RxBytes
+			}
+			if reading.TxBytes > session.InterimTx {
+				sent.Add(float64(reading.TxBytes - session.InterimTx))
+				session.InterimTx = reading.TxBytes
+			}
+			break
+		}
+	}
+}
+
+// InterimReadings takes the sessions of each server (key: server) recorded by the interim query
+// since the previous call, with the usernames occtl reports. Servers that weren't polled
+// successfully since are left out.
+func (c *Collector) InterimReadings() map[string][]occtl.User {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	readings := c.interimUsers
+	c.interimUsers = make(map[string][]occtl.User)
+	return readings
+}
+
+// remainder returns the part of a session total not yet added from interim readings
+func remainder(total, accounted uint64) uint64 {
+	if total < accounted {
+		return 0
+	}
+	return total - accounted
+}
@@ -0,0 +1,258 @@
+package collector
+
+import (
+	"strings"
+
+	"github.com/mogilevich/ocserv_exporter/pkg/occtl"
+)
+
+// occtl query names
+const (
+	OcctlQuerySessions       = "sessions"        // client types and per-user session counts
+	OcctlQuerySessionStates  = "session-states"  // sessions by state
+	OcctlQueryGroups         = "groups"          // groups for the optional group label
+	OcctlQuerySessionTraffic = "session-traffic" // per-session traffic (--occtl.session-traffic)
+	OcctlQueryUsers          = "users"           // DTLS ciphers, VPN IPs and session reconciliation
+	OcctlQueryVersion        = "version"         // ocserv version and build features
+	OcctlQueryBans           = "bans"            // banned IP addresses
+	OcctlQueryTopUsers       = "top-users"       // users transferring the most bytes (--occtl.top-users)
+	OcctlQueryInterim        = "interim"         // per-session traffic for RADIUS Interim-Update (--radius.interim-interval)
+)
+
+// occtlQueries are the available queries in the order they run: queries recording user
+// details (client types, groups) run before reconciliation adopts sessions with them
+var occtlQueries = []OcctlQuery{
+	{Name: OcctlQuerySessions, Run: runSessionsQuery, Reset: resetSessionsQuery},
+	{Name: OcctlQuerySessionStates, Run: runSessionStatesQuery, Reset: resetSessionStatesQuery},
+	{Name: OcctlQueryGroups, Run: runGroupsQuery, Reset: func(string) {}},
+	{Name: OcctlQuerySessionTraffic, Run: runSessionTrafficQuery, Reset: func(string) {}},
+	{Name: OcctlQueryUsers, Run: runUsersQuery, Reset: resetUsersQuery},
+	{Name: OcctlQueryVersion, Run: runVersionQuery, Reset: resetVersionQuery},
+	{Name: OcctlQueryBans, Run: runBansQuery, Reset: resetBansQuery},
+	{Name: OcctlQueryTopUsers, Run: runTopUsersQuery, Reset: resetTopUsersQuery},
+	{Name: OcctlQueryInterim, Run: runInterimQuery, Reset: func(string) {}},
+}
+
+// OcctlQueryNames returns the names of the available occtl queries
+func OcctlQueryNames() []string {
+	names := make([]string, 0, len(occtlQueries))
+	for _, q := range occtlQueries {
+		names = append(names, q.Name)
+	}
+	return names
+}
+
+// OcctlQueries returns the available occtl queries except the disabled ones
+func OcctlQueries(disabled []string) []OcctlQuery {
+	skip := make(map[string]bool, len(disabled))
+	for _, name := range disabled {
+		skip[name] = true
+	}
+	var queries []OcctlQuery
+	for _, q := range occtlQueries {
+		if !skip[q.Name] {
+			queries = append(queries, q)
+		}
+	}
+	return queries
+}
+
+func runSessionsQuery(p *OcctlPoll) error {
+	sessions, err := p.Sessions()
+	if err != nil {
+		return err
+	}
+	resetSessionsQuery(p.Server)
+
+	for clientType, count := range occtl.UserAgentStats(sessions) {
+		SessionsByClientType.WithLabelValues(p.Server, clientType).Set(float64(count))
+	}
+
+	// Concurrent sessions per user, and users at their max-same-clients limit
+	userSessionCounts := occtl.UserSessionCounts(sessions)
+	if !Shedding() {
+		for username, count := range userSessionCounts {
+			UserConcurrentSessions.WithLabelValues(p.Server, Username(username)).Set(float64(count))
+		}
+	}
+	p.Collector.SetUserSessionCounts(p.Server, userSessionCounts)
+
+	p.Collector.SetUserClientTypes(p.Server, occtl.UserClientTypes(sessions))
+	return nil
+}
+
+func resetSessionsQuery(server string) {
+	SessionsByClientType.DeletePartialMatch(serverLabels(server))
+	UserConcurrentSessions.DeletePartialMatch(serverLabels(server))
+	UsersAtSessionLimit.DeletePartialMatch(serverLabels(server))
+}
+
+// runSessionStatesQuery counts sessions by state; valid but disconnected sessions are clients
+// failing to resume
+func runSessionStatesQuery(p *OcctlPoll) error {
+	sessions, err := p.Sessions()
+	if err != nil {
+		return err
+	}
+	valid, err := p.Client.GetValidSessions()
+	if err != nil {
+		return err
+	}
+	resetSessionStatesQuery(p.Server)
+	for state, count := range occtl.SessionStates(sessions, valid) {
+		SessionsByState.WithLabelValues(p.Server, state).Set(float64(count))
+	}
+	return nil
+}
+
+func resetSessionStatesQuery(server string) {
+	SessionsByState.DeletePartialMatch(serverLabels(server))
+}
+
+// runGroupsQuery records user groups for the optional group label (requires JSON output)
+func runGroupsQuery(p *OcctlPoll) error {
+	if !GroupLabelEnabled() {
+		return nil
+	}
+	users, err := p.UsersJSON()
+	if err != nil {
+		return err
+	}
+	p.Collector.SetUserGroups(p.Server, occtl.UserGroups(users))
+	return nil
+}
+
+// runSessionTrafficQuery advances per-user traffic counters from per-session readings
+// (requires JSON output)
+func runSessionTrafficQuery(p *OcctlPoll) error {
+	users, err := p.UsersJSON()
+	if err != nil {
+		return err
+	}
+	p.Collector.UpdateSessionTraffic(p.Server, sessionTrafficReadings(users))
+	return nil
+}
+
+// sessionTrafficReadings converts the sessions of occtl JSON output to traffic readings
+func sessionTrafficReadings(users []occtl.User) []SessionTraffic {
+	readings := make([]SessionTraffic, 0, len(users))
+	for _, user := range users {
+		readings = append(readings, SessionTraffic{
+			ID:       user.ID,
+			Username: Username(user.Username),
+			ClientIP: user.ClientIP,
+			VpnIP:    user.VpnIP,
+			RxBytes:  uint64(max(user.RxBytes, 0)),
+			TxBytes:  uint64(max(user.TxBytes, 0)),
+		})
+	}
+	return readings
+}
+
+// runUsersQuery updates the DTLS cipher distribution and the VPN IPs in use, and reconciles
+// the tracked sessions (and with them session info) with the sessions occtl reports
+func runUsersQuery(p *OcctlPoll) error {
+	users, err := p.Users()
+	if err != nil {
+		return err
+	}
+
+	vpnIPs := make([]string, 0, len(users))
+	for _, user := range users {
+		vpnIPs = append(vpnIPs, user.VpnIP)
+	}
+	p.Collector.SetOcctlVpnIPs(p.Server, vpnIPs)
+
+	if VHostLabelEnabled() {
+		userVHosts := make(map[string]string, len(users))
+		for _, user := range users {
+			userVHosts[user.Username] = user.VHost
+		}
+		p.Collector.SetUserVHosts(p.Server, userVHosts)
+	}
+
+	resetUsersQuery(p.Server)
+	stats := occtl.DTLSCipherStats(users)
+	for cipher, count := range stats {
+		SessionsByDTLSCipher.WithLabelValues(p.Server, cipher).Set(float64(count))
+	}
+	SessionsTLSOnly.WithLabelValues(p.Server).Set(float64(stats[occtl.NoDTLSCipher]))
+
+	// Client types come from the sessions, reconciliation goes ahead without them
+	var userClientTypes map[string]string
+	if sessions, err := p.Sessions(); err == nil {
+		userClientTypes = occtl.UserClientTypes(sessions)
+	}
+	reported := make([]OcctlSession, 0, len(users))
+	for _, user := range users {
+		reported = append(reported, OcctlSession{
+			Username:   Username(user.Username),
+			ClientIP:   user.ClientIP,
+			VpnIP:      user.VpnIP,
+			VHost:      user.VHost,
+			ClientType: userClientTypes[user.Username],
+			Since:      user.Since,
+		})
+	}
+	p.Collector.ReconcileSessions(p.Server, reported)
+	return nil
+}
+
+func resetUsersQuery(server string) {
+	SessionsByDTLSCipher.DeletePartialMatch(serverLabels(server))
+}
+
+// runVersionQuery exports the ocserv version, which may change with every restart
+func runVersionQuery(p *OcctlPoll) error {
+	version, err := p.Client.GetVersion()
+	if err != nil {
+		return err
+	}
+	resetVersionQuery(p.Server)
+	ServerInfo.WithLabelValues(p.Server, version.Version, strings.Join(version.CompiledWith, ",")).Set(1)
+	return nil
+}
+
+func resetVersionQuery(server string) {
+	ServerInfo.DeletePartialMatch(serverLabels(server))
+}
+
+func runBansQuery(p *OcctlPoll) error {
+	bans, err := p.Client.GetIPBans()
+	if err != nil {
+		return err
+	}
+	IPBans.WithLabelValues(p.Server).Set(float64(len(bans)))
+	return nil
+}
+
+func resetBansQuery(server string) {
+	IPBans.DeleteLabelValues(server)
+}
+
+// runTopUsersQuery ranks users by the bytes transferred since the previous poll (requires JSON output)
+func runTopUsersQuery(p *OcctlPoll) error {
+	users, err := p.UsersJSON()
+	if err != nil {
+		return err
+	}
+	p.Collector.UpdateTopUsers(p.Server, sessionTrafficReadings(users))
+	return nil
+}
+
+func resetTopUsersQuery(server string) {
+	TopUserBytes.DeletePartialMatch(serverLabels(server))
+}
+
+// runInterimQuery keeps the per-session traffic of the poll for RADIUS Interim-Update (requires
+// JSON output), so accounting reads occtl on the poller's schedule
+func runInterimQuery(p *OcctlPoll) error {
+	users, err := p.UsersJSON()
+	if err != nil {
+		return err
+	}
+	p.Collector.mu.Lock()
+	defer p.Collector.mu.Unlock()
+	p.Collector.interimUsers[p.Server] = users
+	return nil
+}
@@ -0,0 +1,128 @@
+package collector
+
+import (
+	"log"
+	"strings"
+
+	"github.com/mogilevich/ocserv_exporter/internal/ocservconf"
+)
+
+// SetServerConfigs updates configuration-derived metrics from parsed ocserv.conf files
+// (key: server name). Previously exported values are replaced.
+func (c *Collector) SetServerConfigs(configs map[string]*ocservconf.File) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ConfigInfo.Reset()
+	ConfigMaxClients.Reset()
+	ConfigMaxSameClients.Reset()
+	ConfigServerCertExpiry.Reset()
+	IPPoolSize.Reset()
+
+	c.serverSettings = make(map[string][]ocservconf.Settings)
+	for server, file := range configs {
+		for _, section := range file.Sections() {
+			settings := section.Settings()
+			c.serverSettings[server] = append(c.serverSettings[server], settings)
+
+			network := ""
+			if settings.IPv4Network != nil {
+				network = settings.IPv4Network.String()
+			}
+			ConfigInfo.WithLabelValues(server, settings.VHost, authMethods(settings.Auth), settings.Device, network).Set(1)
+			ConfigMaxClients.WithLabelValues(server, settings.VHost).Set(float64(settings.MaxClients))
+			ConfigMaxSameClients.WithLabelValues(server, settings.VHost).Set(float64(settings.MaxSameClients))
+
+			if settings.ServerCert != "" {
+				expiry, err := ocservconf.CertExpiry(settings.ServerCert)
+				if err != nil {
+					log.Printf("Warning: Failed to read server-cert of %s/%s: %v", server, settings.VHost, err)
+				} else {
+					ConfigServerCertExpiry.WithLabelValues(server, settings.VHost).Set(float64(expiry.Unix()))
+				}
+			}
+		}
+		for _, settings := range pools(c.serverSettings[server]) {
+			IPPoolSize.WithLabelValues(server, settings.VHost).Set(float64(settings.PoolSize))
+		}
+	}
+
+	c.recomputePoolUsage()
+}
+
+// SetUserSessionCounts updates the number of users at their max-same-clients limit from
+// occtl per-user session counts (keyed by the usernames occtl reports), and counts a session
+// limit hit for each user who reached it since the previous poll. The limit is taken from the
+// user's last known virtual host. Servers without a parsed ocserv.conf are skipped.
+func (c *Collector) SetUserSessionCounts(server string, counts map[string]int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	settings, ok := c.serverSettings[server]
+	if !ok {
+		delete(c.atSessionLimit, server)
+		return
+	}
+	limits := make(map[string]int, len(settings))
+	for _, s := range settings {
+		limits[s.VHost] = s.MaxSameClients
+	}
+
+	previous := c.atSessionLimit[server]
+	atLimit := make(map[string]bool)
+	for username, count := range counts {
+		username = Username(username)
+		_, vhost := c.lookupUser(server, username)
+		limit, ok := limits[vhost]
+		if !ok {
+			limit = limits[ocservconf.DefaultVHost]
+		}
+		if limit <= 0 || count < limit {
+			continue
+		}
+		atLimit[username] = true
+		// Counted once per crossing: the user must drop below the limit to count again
+		if !previous[username] {
+			SessionLimitHitsTotal.WithLabelValues(server, userLabel(username)).Inc()
+		}
+	}
+	c.atSessionLimit[server] = atLimit
+	UsersAtSessionLimit.WithLabelValues(server).Set(float64(len(atLimit)))
+}
+
+// authMethods reduces "auth" values like "plain[passwd=/etc/ocserv/ocpasswd]" to their
+// method names, joined with "+" when several methods are chained
+func authMethods(auth []string) string {
+	return strings.Join(authMethodNames(auth), "+")
+}
+
+// authMethodNames returns the method names of "auth" values
+func authMethodNames(auth []string) []string {
+	names := make([]string, 0, len(auth))
+	for _, a := range auth {
+		name, _, _ := strings.Cut(a, "[")
+		names = append(names, strings.TrimSpace(name))
+	}
+	return names
+}
+
+// SetPasswdUsers updates ocpasswd inventory metrics for server
+func (c *Collector) SetPasswdUsers(server string, users []ocservconf.PasswdUser) {
+	locked := 0
+	groups := make(map[string]int)
+	for _, user := range users {
+		if user.Locked {
+			locked++
+		}
+		for _, group := range user.Groups {
+			groups[group]++
+		}
+	}
+
+	PasswdUsers.WithLabelValues(server).Set(float64(len(users)))
+	PasswdLockedUsers.WithLabelValues(server).Set(float64(locked))
+	PasswdUsersByGroup.DeletePartialMatch(map[string]string{"server": server})
+	for group, count := range groups {
+		PasswdUsersByGroup.WithLabelValues(server, group).Set(float64(count))
+	}
+}
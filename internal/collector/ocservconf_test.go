@@ -0,0 +1,57 @@
+package collector
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/mogilevich/ocserv_exporter/internal/ocservconf"
+	"github.com/mogilevich/ocserv_exporter/pkg/parser"
+)
+
+func TestSessionLimitFromOcctl(t *testing.T) {
+	file, err := ocservconf.Parse(strings.NewReader("max-same-clients = 2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := New()
+	c.SetServerConfigs(map[string]*ocservconf.File{"limits": file})
+
+	steps := []struct {
+		sessions    int // of alice in the poll
+		wantAtLimit float64
+		wantHits    float64
+	}{
+		{1, 0, 0},
+		{2, 1, 1},
+		{3, 1, 1}, // still at the limit, no new crossing
+		{1, 0, 1},
+		{2, 1, 2},
+	}
+	for i, step := range steps {
+		c.SetUserSessionCounts("limits", map[string]int{"alice": step.sessions, "bob": 1})
+		if got := testutil.ToFloat64(UsersAtSessionLimit.WithLabelValues("limits")); got != step.wantAtLimit {
+			t.Errorf("poll %d: %v users at the limit, want %v", i+1, got, step.wantAtLimit)
+		}
+		if got := testutil.ToFloat64(SessionLimitHitsTotal.WithLabelValues("limits", "alice")); got != step.wantHits {
+			t.Errorf("poll %d: %v hits, want %v", i+1, got, step.wantHits)
+		}
+	}
+
+	// Without ocserv.conf the limit is unknown
+	c.SetUserSessionCounts("noconfig", map[string]int{"alice": 10})
+	if got := testutil.ToFloat64(SessionLimitHitsTotal.WithLabelValues("noconfig", "alice")); got != 0 {
+		t.Errorf("%v hits on a server without ocserv.conf, want 0", got)
+	}
+}
+
+func TestSessionLimitFromLogs(t *testing.T) {
+	c := New()
+	c.ProcessEvent(&parser.Event{Type: parser.EventConnectionRejected, Timestamp: time.Now(), Server: "rejects",
+		Username: "bob", ClientIP: "203.0.113.7", Reason: parser.RejectReasonMaxSameClients})
+	if got := testutil.ToFloat64(SessionLimitHitsTotal.WithLabelValues("rejects", "bob")); got != 1 {
+		t.Errorf("%v hits, want 1", got)
+	}
+}
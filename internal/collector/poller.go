@@ -0,0 +1,201 @@
+package collector
+
+import (
+	"context"
+	"log"
+	"math/rand/v2"
+	"time"
+
+	"github.com/mogilevich/ocserv_exporter/internal/health"
+	"github.com/mogilevich/ocserv_exporter/pkg/occtl"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// OcctlQuery is an occtl command polled for metrics. Each query is enabled, run and tracked
+// (OcctlQueryUp, OcctlQueryErrorsTotal) on its own, so one failing command doesn't take the
+// metrics of the others with it.
+type OcctlQuery struct {
+	Name string
+	// Run runs the query for a poll and updates the metrics and collector state derived from it
+	Run func(p *OcctlPoll) error
+	// Reset deletes the series Run sets for a server, after the query or the server failed
+	Reset func(server string)
+}
+
+// OcctlPoll is one poll of an occtl server that answered the status query. Queries get the
+// output of shared occtl commands from it, so each command runs at most once per poll.
+type OcctlPoll struct {
+	Server    string
+	Client    *occtl.Client
+	Collector *Collector
+	Status    *occtl.ServerStatus
+
+	sessions     []occtl.Session
+	sessionsErr  error
+	users        []occtl.User
+	usersErr     error
+	usersJSON    []occtl.User
+	usersJSONErr error
+	fetched      map[string]bool
+}
+
+// Sessions returns the sessions of "occtl show sessions all"
+func (p *OcctlPoll) Sessions() ([]occtl.Session, error) {
+	if !p.fetched["sessions"] {
+		p.sessions, p.sessionsErr = p.Client.GetSessions()
+		p.fetched["sessions"] = true
+	}
+	return p.sessions, p.sessionsErr
+}
+
+// Users returns the users of "occtl show users"
+func (p *OcctlPoll) Users() ([]occtl.User, error) {
+	if !p.fetched["users"] {
+		p.users, p.usersErr = p.Client.GetUsers()
+		p.fetched["users"] = true
+	}
+	return p.users, p.usersErr
+}
+
+// UsersJSON returns the users of "occtl --json show users"
+func (p *OcctlPoll) UsersJSON() ([]occtl.User, error) {
+	if !p.fetched["users-json"] {
+		p.usersJSON, p.usersJSONErr = p.Client.GetUsersJSON()
+		p.fetched["users-json"] = true
+	}
+	return p.usersJSON, p.usersJSONErr
+}
+
+// OcctlPoller polls one occtl server: the status query, which tells whether the server is up,
+// and then the enabled queries
+type OcctlPoller struct {
+	client  *occtl.Client
+	coll    *Collector
+	checks  *health.Checker
+	queries []OcctlQuery
+
+	// Interval is the delay between polls, Jitter the limit of a random delay added to it.
+	// After consecutive failures the interval doubles up to MaxBackoff.
+	Interval   time.Duration
+	Jitter     time.Duration
+	MaxBackoff time.Duration
+}
+
+// NewOcctlPoller creates a poller of client running queries (see OcctlQueries)
+func NewOcctlPoller(client *occtl.Client, coll *Collector, checks *health.Checker, queries []OcctlQuery) *OcctlPoller {
+	return &OcctlPoller{
+		client:  client,
+		coll:    coll,
+		checks:  checks,
+		queries: queries,
+	}
+}
+
+// Run polls the server every interval plus a random delay of up to jitter, starting after such
+// a delay, so that many servers don't run occtl at the same moment. After consecutive failures
+// the interval doubles up to MaxBackoff, until the server answers again.
+func (p *OcctlPoller) Run(ctx context.Context) {
+	serverName := p.client.ServerName()
+	failures := 0
+	delay := randomDelay(p.Jitter)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		if p.Poll() {
+			if failures > 1 {
+				log.Printf("occtl of server %s is back after %d failed polls", serverName, failures)
+			}
+			failures = 0
+		} else {
+			failures++
+		}
+		OcctlConsecutiveFailures.WithLabelValues(serverName).Set(float64(failures))
+
+		if failures == 2 {
+			log.Printf("occtl of server %s keeps failing, backing off up to %s between probes", serverName, p.MaxBackoff)
+		}
+		delay = occtlBackoff(p.Interval, p.MaxBackoff, failures) + randomDelay(p.Jitter)
+	}
+}
+
+// Poll runs the status query and, if the server answered, the enabled queries. Series of
+// queries that failed or weren't run disappear. It reports whether the server is up: while
+// it isn't, only the cheap status query is run.
+func (p *OcctlPoller) Poll() bool {
+	serverName := p.client.ServerName()
+	component := p.checks.Component("occtl/"+serverName, false, 0)
+
+	status, err := p.client.GetStatus()
+	if err != nil {
+		log.Printf("Warning: Failed to get occtl status for %s: %v", serverName, err)
+		OcctlUp.WithLabelValues(serverName).Set(0)
+		component.Failure(err)
+		for _, q := range p.queries {
+			q.Reset(serverName)
+		}
+		return false
+	}
+	OcctlUp.WithLabelValues(serverName).Set(1)
+	component.Success()
+	p.updateStatus(serverName, status)
+
+	poll := &OcctlPoll{
+		Server:    serverName,
+		Client:    p.client,
+		Collector: p.coll,
+		Status:    status,
+		fetched:   make(map[string]bool),
+	}
+	for _, q := range p.queries {
+		if err := q.Run(poll); err != nil {
+			log.Printf("Warning: occtl query %s failed for %s: %v", q.Name, serverName, err)
+			q.Reset(serverName)
+			OcctlQueryUp.WithLabelValues(serverName, q.Name).Set(0)
+			OcctlQueryErrorsTotal.WithLabelValues(serverName, q.Name).Inc()
+			component.SetDetail("query_"+q.Name, err.Error())
+			continue
+		}
+		OcctlQueryUp.WithLabelValues(serverName, q.Name).Set(1)
+		component.SetDetail("query_"+q.Name, health.StatusOK)
+	}
+	return true
+}
+
+// updateStatus updates the server metrics of "occtl show status"
+func (p *OcctlPoller) updateStatus(serverName string, status *occtl.ServerStatus) {
+	p.coll.UpdateServerTraffic(serverName, status.RxBytes, status.TxBytes)
+	ServerActiveSessions.WithLabelValues(serverName).Set(float64(status.ActiveSessions))
+	ServerTotalSessions.WithLabelValues(serverName).Set(float64(status.TotalSessions))
+	ServerLatencyMedian.WithLabelValues(serverName).Set(status.LatencyMedianMs / 1000.0)
+	ServerLatencyStdev.WithLabelValues(serverName).Set(status.LatencyStdevMs / 1000.0)
+	ServerUptime.WithLabelValues(serverName).Set(status.UptimeSeconds)
+	ServerAvgSessionTime.WithLabelValues(serverName).Set(status.AvgSessionTimeSec)
+	ServerMaxSessionTime.WithLabelValues(serverName).Set(status.MaxSessionTimeSec)
+	p.coll.UpdateServerAuthFailures(serverName, int64(status.AuthFailures))
+}
+
+// occtlBackoff returns the delay before the next poll after failures consecutive failures:
+// the interval after at most one failure, then doubling per failure up to maxBackoff
+func occtlBackoff(interval, maxBackoff time.Duration, failures int) time.Duration {
+	backoff := interval
+	for i := 1; i < failures && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	return max(min(backoff, maxBackoff), interval)
+}
+
+// randomDelay returns a random duration in [0, limit)
+func randomDelay(limit time.Duration) time.Duration {
+	if limit <= 0 {
+		return 0
+	}
+	return rand.N(limit)
+}
+
+// serverLabels returns the labels matching all series of a server
+func serverLabels(server string) prometheus.Labels {
+	return prometheus.Labels{"server": server}
+}
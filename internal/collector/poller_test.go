@@ -0,0 +1,163 @@
+package collector
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/mogilevich/ocserv_exporter/internal/health"
+	"github.com/mogilevich/ocserv_exporter/pkg/occtl"
+)
+
+func TestOcctlBackoff(t *testing.T) {
+	tests := []struct {
+		interval, maxBackoff time.Duration
+		failures             int
+		want                 time.Duration
+	}{
+		{30 * time.Second, 5 * time.Minute, 0, 30 * time.Second},
+		{30 * time.Second, 5 * time.Minute, 1, 30 * time.Second},
+		{30 * time.Second, 5 * time.Minute, 2, time.Minute},
+		{30 * time.Second, 5 * time.Minute, 3, 2 * time.Minute},
+		{30 * time.Second, 5 * time.Minute, 4, 4 * time.Minute},
+		{30 * time.Second, 5 * time.Minute, 5, 5 * time.Minute},
+		{30 * time.Second, 5 * time.Minute, 1000, 5 * time.Minute},
+		// A cap below the interval never shortens it
+		{30 * time.Second, 10 * time.Second, 3, 30 * time.Second},
+		{30 * time.Second, 0, 3, 30 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := occtlBackoff(tt.interval, tt.maxBackoff, tt.failures); got != tt.want {
+			t.Errorf("occtlBackoff(%s, %s, %d) = %s, want %s", tt.interval, tt.maxBackoff, tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestRandomDelay(t *testing.T) {
+	for _, limit := range []time.Duration{0, -time.Second} {
+		if got := randomDelay(limit); got != 0 {
+			t.Errorf("randomDelay(%s) = %s, want 0", limit, got)
+		}
+	}
+	const limit = 10 * time.Millisecond
+	for range 1000 {
+		if got := randomDelay(limit); got < 0 || got >= limit {
+			t.Fatalf("randomDelay(%s) = %s, want within [0, %s)", limit, got, limit)
+		}
+	}
+}
+
+func TestOcctlPollerResets(t *testing.T) {
+	dir := t.TempDir()
+	client := occtl.NewClient("/run/occtl.socket", "s1")
+	client.SetMockDir(dir)
+
+	var ran, reset []string
+	query := func(name string, err error) OcctlQuery {
+		return OcctlQuery{
+			Name:  name,
+			Run:   func(*OcctlPoll) error { ran = append(ran, name); return err },
+			Reset: func(server string) { reset = append(reset, server+"/"+name) },
+		}
+	}
+	p := NewOcctlPoller(client, New(), health.New("test"), []OcctlQuery{
+		query("ok", nil),
+		query("failing", errors.New("no such command")),
+	})
+
+	// The server is down: no query runs and the series of all of them are reset
+	if p.Poll() {
+		t.Fatal("poll without a status fixture succeeded")
+	}
+	if len(ran) != 0 || !slices.Equal(reset, []string{"s1/ok", "s1/failing"}) {
+		t.Errorf("server down: ran %v, reset %v", ran, reset)
+	}
+	if got := testutil.ToFloat64(OcctlUp.WithLabelValues("s1")); got != 0 {
+		t.Errorf("up = %v, want 0", got)
+	}
+
+	// The server is up: only the failing query is reset
+	if err := os.WriteFile(filepath.Join(dir, occtl.FixtureName("show", "status")), []byte("Active sessions: 1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ran, reset = nil, nil
+	if !p.Poll() {
+		t.Fatal("poll with a status fixture failed")
+	}
+	if !slices.Equal(ran, []string{"ok", "failing"}) || !slices.Equal(reset, []string{"s1/failing"}) {
+		t.Errorf("server up: ran %v, reset %v", ran, reset)
+	}
+	for name, want := range map[string]float64{"ok": 1, "failing": 0} {
+		if got := testutil.ToFloat64(OcctlQueryUp.WithLabelValues("s1", name)); got != want {
+			t.Errorf("query %s up = %v, want %v", name, got, want)
+		}
+	}
+}
+
+// occtl lists no users on an idle server: the users query must still reconcile and reset
+func TestOcctlPollerNoUsers(t *testing.T) {
+	dir := t.TempDir()
+	for args, output := range map[[3]string]string{
+		{"show", "status"}: "Active sessions: 0\n",
+		{"show", "users"}:  "      id     user    vhost             ip         vpn-ip device   since    dtls-cipher    status\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, occtl.FixtureName(args[0], args[1])), []byte(output), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	client := occtl.NewClient("/run/occtl.socket", "s1")
+	client.SetMockDir(dir)
+
+	c := New()
+	c.ProcessEvent(testLogin{"alice", "198.51.100.7", 51234, ReconcileGrace + time.Minute}.event())
+	SessionsByDTLSCipher.WithLabelValues("s1", "AES-256-GCM").Set(1)
+	closed := testutil.ToFloat64(SessionReconciliationsTotal.WithLabelValues("s1", ReconcileClosed))
+
+	p := NewOcctlPoller(client, c, health.New("test"), []OcctlQuery{{Name: OcctlQueryUsers, Run: runUsersQuery, Reset: resetUsersQuery}})
+	if !p.Poll() {
+		t.Fatal("poll failed")
+	}
+	if len(c.sessions) != 0 {
+		t.Errorf("%d sessions tracked, want 0", len(c.sessions))
+	}
+	if got := testutil.ToFloat64(SessionReconciliationsTotal.WithLabelValues("s1", ReconcileClosed)) - closed; got != 1 {
+		t.Errorf("closed %v, want 1", got)
+	}
+	if got := testutil.CollectAndCount(SessionsByDTLSCipher); got != 0 {
+		t.Errorf("%d DTLS cipher series, want 0", got)
+	}
+}
+
+// Interim-Update reads the sessions of the last poll once; a server not polled since is left out
+func TestInterimReadings(t *testing.T) {
+	dir := t.TempDir()
+	for _, args := range [][]string{{"show", "status"}, {"--json", "show", "users"}} {
+		fixture, err := os.ReadFile(filepath.Join("../../pkg/occtl/testdata/ocserv-1.3", occtl.FixtureName(args...)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, occtl.FixtureName(args...)), fixture, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	client := occtl.NewClient("/run/occtl.socket", "s1")
+	client.SetMockDir(dir)
+
+	c := New()
+	p := NewOcctlPoller(client, c, health.New("test"), []OcctlQuery{{Name: OcctlQueryInterim, Run: runInterimQuery, Reset: func(string) {}}})
+	if !p.Poll() {
+		t.Fatal("poll failed")
+	}
+	readings := c.InterimReadings()
+	if len(readings) != 1 || len(readings["s1"]) == 0 {
+		t.Fatalf("readings %v, want the sessions of s1", readings)
+	}
+	if readings := c.InterimReadings(); len(readings) != 0 {
+		t.Errorf("readings %v after they were taken, want none", readings)
+	}
+}
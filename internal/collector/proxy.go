@@ -0,0 +1,56 @@
+package collector
+
+import (
+	"net"
+	"time"
+)
+
+// sourceRecord is the real address of a user's last authentication behind a proxy
+type sourceRecord struct {
+	IP        string
+	Timestamp time.Time
+}
+
+// SetProxyNetworks sets the networks of load balancers that forward connections with the
+// proxy protocol. main logs their address for logins and failed attempts, so the client
+// address is taken from the user's sec-mod auth init line instead, which carries the
+// source address from the proxy protocol header. Must be called before events are processed.
+func (c *Collector) SetProxyNetworks(networks []*net.IPNet) {
+	c.proxyNetworks = networks
+}
+
+// isProxy reports whether ip belongs to a proxy protocol load balancer
+func (c *Collector) isProxy(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range c.proxyNetworks {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// rememberSource records the real address a user authenticated from.
+// Must be called with c.mu held.
+func (c *Collector) rememberSource(server, username, ip string, ts time.Time) {
+	if len(c.proxyNetworks) == 0 || ip == "" || c.isProxy(ip) {
+		return
+	}
+	c.proxySources[authReasonUserKey(server, username)] = &sourceRecord{IP: ip, Timestamp: ts}
+}
+
+// clientIP returns the real client address for an address logged by main: ip itself, or
+// for a load balancer the address the user last authenticated from.
+// Must be called with c.mu held.
+func (c *Collector) clientIP(server, username, ip string) string {
+	if len(c.proxyNetworks) == 0 || !c.isProxy(ip) {
+		return ip
+	}
+	if record, ok := c.proxySources[authReasonUserKey(server, username)]; ok {
+		return record.IP
+	}
+	return ip
+}
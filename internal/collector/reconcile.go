@@ -0,0 +1,159 @@
+package collector
+
+import (
+	"time"
+)
+
+const (
+	// ReconcileGrace is how long a session may go unreported by occtl before reconciliation
+	// closes it. It covers the lag between occtl and the logs: a login may be read before
+	// occtl lists the session, and a disconnect line may still be on its way.
+	ReconcileGrace = 2 * time.Minute
+
+	// ReconcileClosed is the action of closing a session occtl no longer reports
+	ReconcileClosed = "closed"
+	// ReconcileAdopted is the action of tracking a session only occtl reports
+	ReconcileAdopted = "adopted"
+)
+
+// OcctlSession is an active session reported by occtl
+type OcctlSession struct {
+	Username   string
+	ClientIP   string
+	VpnIP      string
+	VHost      string
+	ClientType string
+	Since      time.Duration // time since the session started
+}
+
+// ReconcileSessions aligns the tracked sessions of server with the sessions occtl reports.
+// Sessions occtl hasn't reported for ReconcileGrace are closed (their disconnect line was
+// missed), sessions only occtl knows are adopted (their login line was missed). Adopted
+// sessions have no port; a later login or disconnect line of the same client takes them over.
+// Matched sessions get the VPN IP and client type occtl knows if the logs didn't carry them.
+// With SessionInfoOcctl, SessionInfo is replaced with the reported sessions.
+func (c *Collector) ReconcileSessions(server string, reported []OcctlSession) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	unmatched := make(map[string]*Session)
+	byVpnIP := make(map[string]string)
+	byClient := make(map[string][]string)
+	for key, session := range c.sessions {
+		if session.Server != server {
+			continue
+		}
+		unmatched[key] = session
+		if session.VpnIP != "" {
+			byVpnIP[session.VpnIP] = key
+		}
+		client := session.Username + ":" + session.ClientIP
+		byClient[client] = append(byClient[client], key)
+	}
+
+	for _, r := range reported {
+		key, ok := byVpnIP[r.VpnIP]
+		if _, open := unmatched[key]; r.VpnIP == "" || !ok || !open {
+			key, ok = "", false
+			for _, candidate := range byClient[r.Username+":"+r.ClientIP] {
+				if _, open := unmatched[candidate]; open {
+					key, ok = candidate, true
+					break
+				}
+			}
+		}
+		if !ok {
+			c.adoptSession(server, r, now)
+			continue
+		}
+		session := unmatched[key]
+		delete(unmatched, key)
+		session.Confirmed = now
+		c.completeSession(session, r)
+	}
+
+	for key, session := range unmatched {
+		if now.Sub(session.lastSeen()) < ReconcileGrace {
+			continue
+		}
+		c.removeSession(key, session)
+		SessionReconciliationsTotal.WithLabelValues(server, ReconcileClosed).Inc()
+	}
+
+	if c.infoSource == SessionInfoOcctl {
+		c.publishOcctlSessionInfo(server, reported, now)
+	}
+}
+
+// adoptSession starts tracking a session whose login line was missed.
+// Must be called with c.mu held.
+func (c *Collector) adoptSession(server string, r OcctlSession, now time.Time) {
+	key := sessionKey(server, r.Username, r.ClientIP, 0)
+	if _, exists := c.sessions[key]; exists {
+		return // another session of the user from the same address is adopted already
+	}
+	c.makeRoomForSession()
+
+	var country string
+	if c.geoIP != nil {
+		country, _ = c.geoIP.Lookup(r.ClientIP)
+	}
+	group, vhost := c.lookupUser(server, r.Username)
+	if r.VHost != "" {
+		vhost = r.VHost
+	}
+	session := &Session{
+		Server:     server,
+		Username:   r.Username,
+		ClientIP:   r.ClientIP,
+		VpnIP:      r.VpnIP,
+		Country:    country,
+		Group:      group,
+		VHost:      vhost,
+		ClientType: r.ClientType,
+		StartTime:  now.Add(-r.Since),
+		Confirmed:  now,
+	}
+	c.sessions[key] = session
+	c.trackActiveUser(server, r.Username, now)
+	c.adjustActiveSessions(session, 1)
+	c.adjustClientTypeSessions(session, 1)
+	c.acquireVpnIP(server, session.VpnIP)
+	c.publishSessionInfo(session)
+	SessionReconciliationsTotal.WithLabelValues(server, ReconcileAdopted).Inc()
+}
+
+// completeSession fills the VPN IP and client type of a session from occtl when the logs
+// didn't provide them, unless SessionInfo is published from the journal only.
+// Must be called with c.mu held.
+func (c *Collector) completeSession(session *Session, r OcctlSession) {
+	if c.infoSource == SessionInfoJournal {
+		return // sessions keep log data only
+	}
+	vpnIP := session.VpnIP == "" && r.VpnIP != ""
+	clientType := session.ClientType == "" && r.ClientType != ""
+	if !vpnIP && !clientType {
+		return
+	}
+
+	if vpnIP {
+		session.VpnIP = r.VpnIP
+		c.acquireVpnIP(session.Server, session.VpnIP)
+	}
+	if clientType {
+		c.adjustClientTypeSessions(session, -1)
+		session.ClientType = r.ClientType
+		c.adjustClientTypeSessions(session, 1)
+	}
+	c.publishSessionInfo(session)
+}
+
+// lastSeen returns when the session was last known to be active: its login or the
+// last occtl poll reporting it
+func (s *Session) lastSeen() time.Time {
+	if s.Confirmed.After(s.StartTime) {
+		return s.Confirmed
+	}
+	return s.StartTime
+}
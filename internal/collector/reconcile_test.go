@@ -0,0 +1,131 @@
+package collector
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/mogilevich/ocserv_exporter/pkg/parser"
+)
+
+type testLogin struct {
+	username, clientIP string
+	port               int
+	age                time.Duration // how long ago the login line was logged
+}
+
+func (l testLogin) event() *parser.Event {
+	return &parser.Event{Type: parser.EventUserLogin, Timestamp: time.Now().Add(-l.age), Server: "s1",
+		Username: l.username, ClientIP: l.clientIP, Port: l.port}
+}
+
+func TestReconcileSessions(t *testing.T) {
+	tests := []struct {
+		name        string
+		logins      []testLogin // before the poll
+		reported    []OcctlSession
+		loginsAfter []testLogin // after the poll
+		want        []string    // tracked session keys
+		wantAdopted float64
+		wantClosed  float64
+	}{
+		{
+			name:        "adopt a session without a login line",
+			reported:    []OcctlSession{{Username: "alice", ClientIP: "198.51.100.7", VpnIP: "10.0.0.2", Since: 5 * time.Minute}},
+			want:        []string{"s1:alice:198.51.100.7:0"},
+			wantAdopted: 1,
+		},
+		{
+			name:        "adopt one session per user and address",
+			reported:    []OcctlSession{{Username: "alice", ClientIP: "198.51.100.7", VpnIP: "10.0.0.2"}, {Username: "alice", ClientIP: "198.51.100.7", VpnIP: "10.0.0.3"}},
+			want:        []string{"s1:alice:198.51.100.7:0"},
+			wantAdopted: 1,
+		},
+		{
+			name:     "match a logged session by client",
+			logins:   []testLogin{{"alice", "198.51.100.7", 51234, 10 * time.Minute}},
+			reported: []OcctlSession{{Username: "alice", ClientIP: "198.51.100.7", VpnIP: "10.0.0.2"}},
+			want:     []string{"s1:alice:198.51.100.7:51234"},
+		},
+		{
+			name:   "keep an unreported session within the grace period",
+			logins: []testLogin{{"alice", "198.51.100.7", 51234, 30 * time.Second}},
+			want:   []string{"s1:alice:198.51.100.7:51234"},
+		},
+		{
+			name:       "close an unreported session after the grace period",
+			logins:     []testLogin{{"alice", "198.51.100.7", 51234, ReconcileGrace + time.Minute}, {"bob", "203.0.113.9", 40000, time.Hour}},
+			reported:   []OcctlSession{{Username: "bob", ClientIP: "203.0.113.9"}},
+			want:       []string{"s1:bob:203.0.113.9:40000"},
+			wantClosed: 1,
+		},
+		{
+			name:        "a later login takes over the adopted session",
+			reported:    []OcctlSession{{Username: "alice", ClientIP: "198.51.100.7", VpnIP: "10.0.0.2"}},
+			loginsAfter: []testLogin{{"alice", "198.51.100.7", 51234, 0}},
+			want:        []string{"s1:alice:198.51.100.7:51234"},
+			wantAdopted: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SessionReconciliationsTotal.Reset()
+			c := New()
+			for _, l := range tt.logins {
+				c.ProcessEvent(l.event())
+			}
+			c.ReconcileSessions("s1", tt.reported)
+			for _, l := range tt.loginsAfter {
+				c.ProcessEvent(l.event())
+			}
+
+			var keys []string
+			for key := range c.sessions {
+				keys = append(keys, key)
+			}
+			slices.Sort(keys)
+			if !slices.Equal(keys, tt.want) {
+				t.Errorf("sessions %v, want %v", keys, tt.want)
+			}
+			if got := testutil.ToFloat64(SessionReconciliationsTotal.WithLabelValues("s1", ReconcileAdopted)); got != tt.wantAdopted {
+				t.Errorf("adopted %v, want %v", got, tt.wantAdopted)
+			}
+			if got := testutil.ToFloat64(SessionReconciliationsTotal.WithLabelValues("s1", ReconcileClosed)); got != tt.wantClosed {
+				t.Errorf("closed %v, want %v", got, tt.wantClosed)
+			}
+		})
+	}
+}
+
+func TestAdoptedSessionFromOcctl(t *testing.T) {
+	c := New()
+	c.ReconcileSessions("s1", []OcctlSession{{Username: "alice", ClientIP: "198.51.100.7", VpnIP: "10.0.0.2",
+		VHost: "corp", ClientType: "AnyConnect", Since: 5 * time.Minute}})
+
+	session := c.sessions["s1:alice:198.51.100.7:0"]
+	if session == nil {
+		t.Fatal("session not adopted")
+	}
+	if session.VpnIP != "10.0.0.2" || session.VHost != "corp" || session.ClientType != "AnyConnect" {
+		t.Errorf("adopted session %+v", session)
+	}
+	if age := time.Since(session.StartTime); age < 5*time.Minute || age > 6*time.Minute {
+		t.Errorf("adopted session started %s ago, want 5m", age)
+	}
+}
+
+func TestCompleteSessionFromOcctl(t *testing.T) {
+	c := New()
+	c.ProcessEvent(testLogin{"alice", "198.51.100.7", 51234, time.Minute}.event())
+	c.ReconcileSessions("s1", []OcctlSession{{Username: "alice", ClientIP: "198.51.100.7", VpnIP: "10.0.0.2", ClientType: "AnyConnect"}})
+
+	session := c.sessions["s1:alice:198.51.100.7:51234"]
+	if session.VpnIP != "10.0.0.2" || session.ClientType != "AnyConnect" {
+		t.Errorf("matched session %+v, want VPN IP and client type from occtl", session)
+	}
+	if session.Confirmed.IsZero() {
+		t.Error("matched session not confirmed")
+	}
+}
@@ -0,0 +1,63 @@
+package collector
+
+import (
+	"github.com/mogilevich/ocserv_exporter/internal/health"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// componentHealth exports the /healthz component states as metrics
+type componentHealth struct {
+	checks      *health.Checker
+	up          *prometheus.Desc
+	lastSuccess *prometheus.Desc
+}
+
+// RegisterRuntimeMetrics registers the exporter's own ocserv_exporter_* metrics: the number of
+// occtl clients and the health of each component. They are read on every scrape. The sizes of
+// the tracking maps are in TrackingEntries.
+func RegisterRuntimeMetrics(reg prometheus.Registerer, occtlClients int, checks *health.Checker) {
+	reg.MustRegister(
+		prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Subsystem: "exporter",
+				Name:      "occtl_clients",
+				Help:      "Number of ocserv instances polled with occtl",
+			},
+			func() float64 { return float64(occtlClients) },
+		),
+		&componentHealth{
+			checks: checks,
+			up: prometheus.NewDesc(
+				prometheus.BuildFQName(namespace, "exporter", "component_up"),
+				"Whether an exporter component (journal reader, occtl server, ...) is healthy (see /healthz)",
+				[]string{"component"}, nil,
+			),
+			lastSuccess: prometheus.NewDesc(
+				prometheus.BuildFQName(namespace, "exporter", "component_last_success_timestamp_seconds"),
+				"Time of the last successful operation of an exporter component",
+				[]string{"component"}, nil,
+			),
+		},
+	)
+}
+
+// Describe implements prometheus.Collector
+func (h *componentHealth) Describe(ch chan<- *prometheus.Desc) {
+	ch <- h.up
+	ch <- h.lastSuccess
+}
+
+// Collect implements prometheus.Collector
+func (h *componentHealth) Collect(ch chan<- prometheus.Metric) {
+	for name, component := range h.checks.Report().Components {
+		up := 0.0
+		if component.Status == health.StatusOK {
+			up = 1
+		}
+		ch <- prometheus.MustNewConstMetric(h.up, prometheus.GaugeValue, up, name)
+		if component.LastSuccess != nil {
+			ch <- prometheus.MustNewConstMetric(h.lastSuccess, prometheus.GaugeValue, float64(component.LastSuccess.Unix()), name)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package collector
+
+import "time"
+
+// Sources of SessionInfo (see SetSessionInfoSource)
+const (
+	// SessionInfoMerged publishes sessions tracked from the logs, reconciled with occtl
+	SessionInfoMerged = "merged"
+	// SessionInfoJournal publishes sessions tracked from the logs, with log data only
+	SessionInfoJournal = "journal"
+	// SessionInfoOcctl publishes the sessions the last occtl poll reported
+	SessionInfoOcctl = "occtl"
+)
+
+// SetSessionInfoSource selects where SessionInfo series come from: merged (default), journal or occtl.
+// Must be called before events are processed.
+func (c *Collector) SetSessionInfoSource(source string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.infoSource = source
+}
+
+// publishSessionInfo sets the SessionInfo series of a tracked session, replacing the one
+// published before. In occtl mode sessions are published from polls instead, in journal mode
+// sessions adopted from occtl are not published. Must be called with c.mu held.
+func (c *Collector) publishSessionInfo(session *Session) {
+	if c.infoSource == SessionInfoOcctl || (c.infoSource == SessionInfoJournal && session.Port == 0) || Shedding() {
+		return
+	}
+	labels := SessionInfoLabels(session.Server, session.Username, session.VHost, session.VpnIP, session.Country, session.ClientType)
+	if session.infoLabels != nil {
+		SessionInfo.DeleteLabelValues(session.infoLabels...)
+	}
+	SessionInfo.WithLabelValues(labels...).Set(float64(session.StartTime.Unix()))
+	session.infoLabels = labels
+}
+
+// unpublishSessionInfo deletes the SessionInfo series of a tracked session.
+// Must be called with c.mu held.
+func (c *Collector) unpublishSessionInfo(session *Session) {
+	if session.infoLabels != nil {
+		SessionInfo.DeleteLabelValues(session.infoLabels...)
+		session.infoLabels = nil
+	}
+}
+
+// publishOcctlSessionInfo replaces the SessionInfo series of server with the sessions occtl
+// reported. Must be called with c.mu held.
+func (c *Collector) publishOcctlSessionInfo(server string, reported []OcctlSession, now time.Time) {
+	SessionInfo.DeletePartialMatch(map[string]string{"server": server})
+	if Shedding() {
+		return
+	}
+	for _, r := range reported {
+		var country string
+		if c.geoIP != nil {
+			country, _ = c.geoIP.Lookup(r.ClientIP)
+		}
+		labels := SessionInfoLabels(server, r.Username, r.VHost, r.VpnIP, country, r.ClientType)
+		SessionInfo.WithLabelValues(labels...).Set(float64(now.Add(-r.Since).Unix()))
+	}
+}
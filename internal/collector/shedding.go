@@ -0,0 +1,125 @@
+package collector
+
+import (
+	"context"
+	"log"
+	"runtime"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ShedConfig sets when the collector sheds per-user labels to protect itself from running out of
+// memory, e.g. while a scanner cycles through usernames and source addresses
+type ShedConfig struct {
+	MaxHeapBytes uint64        // heap size that starts shedding (0 for no limit)
+	MaxSeries    int           // series in the registry that start shedding (0 for no limit)
+	Interval     time.Duration // interval of the checks
+	HoldTime     time.Duration // minimum duration of shedding, so it doesn't flap
+}
+
+// resetter is a metric vector whose series can all be deleted
+type resetter interface {
+	Reset()
+}
+
+// perUserMetrics returns the metrics with username or client_ip labels
+func perUserMetrics() []resetter {
+	return []resetter{
+		ConnectionsTotal, DisconnectionsTotal, ReceivedBytesTotal, SentBytesTotal, AuthFailedTotal,
+		ConnectionsByCountry, ProblematicSessionsTotal, ReconnectsTotal, SessionLimitHitsTotal,
+		FlappingUsers, FlapEpisodesTotal, GeoAnomalyTotal, SessionDuration, UserConcurrentSessions,
+		SessionInfo, SecondFactorFailuresTotal, ConnectionsFromDeniedCountryTotal,
+	}
+}
+
+// SetShedding turns shedding of per-user labels on or off. While shedding, username and client_ip
+// label values are empty, so the series of all users of a server add up to one, and per-session
+// or per-user gauges (session info, concurrent sessions, flapping users) are not published.
+// Switching deletes the per-user metrics, so their counters start over with the new label values
+// instead of being counted twice; active sessions and session info are rebuilt from the tracked
+// sessions.
+func (c *Collector) SetShedding(on bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if shedding.Swap(on) == on {
+		return
+	}
+	for _, metric := range perUserMetrics() {
+		metric.Reset()
+	}
+	labelEpoch.Add(1) // cached children were deleted by the reset
+	c.reconcileActiveSessions()
+	for _, session := range c.sessions {
+		session.infoLabels = nil // deleted by the reset
+		c.publishSessionInfo(session)
+	}
+	if !on {
+		for _, state := range c.flapStates {
+			if state.Flapping {
+				FlappingUsers.WithLabelValues(state.Server, state.Username).Set(1)
+			}
+		}
+	}
+
+	if on {
+		CardinalityShedding.Set(1)
+		ShedEpisodesTotal.Inc()
+	} else {
+		CardinalityShedding.Set(0)
+	}
+}
+
+// RunShedder checks the heap and the number of series gathered from g every cfg.Interval until
+// ctx is cancelled. Past a limit the collector sheds per-user labels; it stops once both are below
+// half their limit again, after at least cfg.HoldTime.
+func (c *Collector) RunShedder(ctx context.Context, cfg ShedConfig, g prometheus.Gatherer) {
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	var since time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		var mem runtime.MemStats
+		runtime.ReadMemStats(&mem)
+		series := 0
+		if cfg.MaxSeries > 0 {
+			series = countSeries(g)
+			RegistrySeries.Set(float64(series))
+		}
+		overHeap := cfg.MaxHeapBytes > 0 && mem.HeapAlloc > cfg.MaxHeapBytes
+		overSeries := cfg.MaxSeries > 0 && series > cfg.MaxSeries
+
+		if !Shedding() && (overHeap || overSeries) {
+			log.Printf("Warning: Shedding username and client_ip labels (heap %d MiB, %d series)", mem.HeapAlloc>>20, series)
+			c.SetShedding(true)
+			since = time.Now()
+			continue
+		}
+		underHeap := cfg.MaxHeapBytes == 0 || mem.HeapAlloc < cfg.MaxHeapBytes/2
+		underSeries := cfg.MaxSeries == 0 || series < cfg.MaxSeries/2
+		if Shedding() && underHeap && underSeries && time.Since(since) >= cfg.HoldTime {
+			log.Printf("Restoring username and client_ip labels (heap %d MiB, %d series)", mem.HeapAlloc>>20, series)
+			c.SetShedding(false)
+		}
+	}
+}
+
+// countSeries returns the number of series g gathers
+func countSeries(g prometheus.Gatherer) int {
+	families, err := g.Gather()
+	if err != nil && len(families) == 0 {
+		return 0
+	}
+	series := 0
+	for _, family := range families {
+		series += len(family.GetMetric())
+	}
+	return series
+}
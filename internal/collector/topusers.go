@@ -0,0 +1,75 @@
+package collector
+
+import (
+	"sort"
+	"strconv"
+)
+
+// topUsers keeps the last traffic reading of each occtl session to rank users by the bytes
+// they transferred between polls (--occtl.top-users)
+type topUsers struct {
+	n    int
+	last map[string]map[int]uint64 // key: server -> occtl session ID -> last RX+TX bytes
+}
+
+// SetTopUsers enables exporting the n users of each server that transferred the most bytes
+// between occtl polls as TopUserBytes. Must be called before polling starts.
+func (c *Collector) SetTopUsers(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.topUsers = &topUsers{n: n, last: make(map[string]map[int]uint64)}
+}
+
+// UpdateTopUsers ranks the users of a server by the traffic of their sessions since the
+// previous reading. The first reading of a server only sets the baseline; later, sessions
+// not seen before are counted in full and a decrease is treated as a counter reset.
+func (c *Collector) UpdateTopUsers(server string, readings []SessionTraffic) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.topUsers == nil {
+		return
+	}
+	last, polled := c.topUsers.last[server]
+	current := make(map[int]uint64, len(readings))
+	bytes := make(map[string]uint64)
+	for _, reading := range readings {
+		total := reading.RxBytes + reading.TxBytes
+		current[reading.ID] = total
+		if !polled {
+			continue
+		}
+		previous := last[reading.ID]
+		if total < previous {
+			previous = 0
+		}
+		if delta := total - previous; delta > 0 {
+			bytes[reading.Username] += delta
+		}
+	}
+	c.topUsers.last[server] = current
+
+	type userBytes struct {
+		username string
+		bytes    uint64
+	}
+	ranked := make([]userBytes, 0, len(bytes))
+	for username, n := range bytes {
+		ranked = append(ranked, userBytes{username, n})
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].bytes != ranked[j].bytes {
+			return ranked[i].bytes > ranked[j].bytes
+		}
+		return ranked[i].username < ranked[j].username
+	})
+
+	resetTopUsersQuery(server)
+	for i, ub := range ranked {
+		if i >= c.topUsers.n {
+			break
+		}
+		TopUserBytes.WithLabelValues(server, strconv.Itoa(i+1), ub.username).Set(float64(ub.bytes))
+	}
+}
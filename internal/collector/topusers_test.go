@@ -0,0 +1,68 @@
+package collector
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestUpdateTopUsers(t *testing.T) {
+	type ranked struct {
+		username string
+		bytes    float64
+	}
+	steps := []struct {
+		name     string
+		readings []SessionTraffic
+		want     []ranked // by rank
+	}{
+		{
+			name:     "first reading sets the baseline",
+			readings: []SessionTraffic{{ID: 1, Username: "alice", RxBytes: 1000, TxBytes: 500}, {ID: 2, Username: "bob", RxBytes: 300}},
+		},
+		{
+			name:     "deltas since the baseline",
+			readings: []SessionTraffic{{ID: 1, Username: "alice", RxBytes: 1100, TxBytes: 500}, {ID: 2, Username: "bob", RxBytes: 600}},
+			want:     []ranked{{"bob", 300}, {"alice", 100}},
+		},
+		{
+			name:     "sessions of a user add up and a new session counts in full",
+			readings: []SessionTraffic{{ID: 1, Username: "alice", RxBytes: 1200, TxBytes: 500}, {ID: 2, Username: "bob", RxBytes: 600}, {ID: 3, Username: "alice", TxBytes: 250}},
+			want:     []ranked{{"alice", 350}},
+		},
+		{
+			name:     "a decrease is a counter reset",
+			readings: []SessionTraffic{{ID: 1, Username: "alice", RxBytes: 40}, {ID: 2, Username: "bob", RxBytes: 650}, {ID: 3, Username: "alice", TxBytes: 250}},
+			want:     []ranked{{"bob", 50}, {"alice", 40}},
+		},
+		{
+			name:     "only the top n are exported",
+			readings: []SessionTraffic{{ID: 1, Username: "alice", RxBytes: 140}, {ID: 2, Username: "bob", RxBytes: 700}, {ID: 3, Username: "alice", TxBytes: 250}, {ID: 4, Username: "carol", RxBytes: 10}},
+			want:     []ranked{{"alice", 100}, {"bob", 50}},
+		},
+		{
+			name:     "no traffic removes the ranking",
+			readings: []SessionTraffic{{ID: 1, Username: "alice", RxBytes: 140}},
+		},
+	}
+
+	c := New()
+	c.SetTopUsers(2)
+	for _, step := range steps {
+		c.UpdateTopUsers("s1", step.readings)
+
+		var want strings.Builder
+		if len(step.want) > 0 {
+			want.WriteString("# HELP ocserv_top_user_bytes Bytes transferred (RX+TX) between the last two occtl polls by the top users of a server, rank 1 being the heaviest\n")
+			want.WriteString("# TYPE ocserv_top_user_bytes gauge\n")
+		}
+		for i, r := range step.want {
+			fmt.Fprintf(&want, "ocserv_top_user_bytes{rank=\"%d\",server=\"s1\",username=\"%s\"} %v\n", i+1, r.username, r.bytes)
+		}
+		if err := testutil.CollectAndCompare(TopUserBytes, strings.NewReader(want.String())); err != nil {
+			t.Errorf("%s: %v", step.name, err)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package collector
+
+import (
+	"time"
+
+	"github.com/mogilevich/ocserv_exporter/internal/sketch"
+)
+
+const (
+	// uniqueUsersResolution is the bucket size of the rolling unique user sketches
+	uniqueUsersResolution = time.Hour
+	// uniqueUsersRetention is the longest period unique users are reported for
+	uniqueUsersRetention = 7 * 24 * time.Hour
+	// uniqueUsersRefreshInterval limits how often the rolling estimates are recomputed
+	uniqueUsersRefreshInterval = time.Minute
+)
+
+// trackActiveUser records a new session for the user and updates unique user metrics.
+// Must be called with c.mu held.
+func (c *Collector) trackActiveUser(server, username string, ts time.Time) {
+	users, ok := c.activeUsers[server]
+	if !ok {
+		users = make(map[string]int)
+		c.activeUsers[server] = users
+	}
+	users[username]++
+	UniqueActiveUsers.WithLabelValues(server).Set(float64(len(users)))
+
+	window, ok := c.uniqueUsers[server]
+	if !ok {
+		window = sketch.NewWindow(uniqueUsersResolution, uniqueUsersRetention, sketch.DefaultPrecision)
+		c.uniqueUsers[server] = window
+	}
+	window.Add(ts, username)
+
+	if ts.Sub(c.lastUniqueRefresh) >= uniqueUsersRefreshInterval {
+		c.refreshUniqueUsers(ts)
+	}
+}
+
+// untrackActiveUser records the end of a session for the user.
+// Must be called with c.mu held.
+func (c *Collector) untrackActiveUser(server, username string) {
+	users, ok := c.activeUsers[server]
+	if !ok {
+		return
+	}
+	if users[username] <= 1 {
+		delete(users, username)
+	} else {
+		users[username]--
+	}
+	UniqueActiveUsers.WithLabelValues(server).Set(float64(len(users)))
+}
+
+// refreshUniqueUsers recomputes the rolling 24h/7d unique user estimates.
+// Must be called with c.mu held.
+func (c *Collector) refreshUniqueUsers(now time.Time) {
+	for server, window := range c.uniqueUsers {
+		window.Prune(now)
+		UniqueUsers24h.WithLabelValues(server).Set(float64(window.Estimate(now, 24*time.Hour)))
+		UniqueUsers7d.WithLabelValues(server).Set(float64(window.Estimate(now, 7*24*time.Hour)))
+	}
+	c.lastUniqueRefresh = now
+}
@@ -0,0 +1,214 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/units"
+	"go.yaml.in/yaml/v2"
+
+	"github.com/mogilevich/ocserv_exporter/internal/policy"
+	"github.com/mogilevich/ocserv_exporter/pkg/parser"
+)
+
+// Config is the optional YAML configuration file (--config.file)
+type Config struct {
+	// DisconnectReasons maps a canonical reason to the raw ocserv reason strings it replaces
+	// e.g. "idle timeout": ["idle timeout", "inactivity timeout"]
+	DisconnectReasons map[string][]string `yaml:"disconnect_reasons"`
+
+	// ServerAliases maps a unit or occtl socket derived server name to the server label
+	// e.g. "ocserv-ru3": "frankfurt-3"
+	ServerAliases map[string]string `yaml:"server_aliases"`
+
+	// Patterns are additional log line patterns for lines the built-in parser doesn't know
+	Patterns []Pattern `yaml:"patterns"`
+
+	// CountryPolicies are the client countries expected per server label ("*" for all other servers)
+	// e.g. "*": {deny: [KP, IR]}, "frankfurt-3": {allow: [DE, AT, CH]}
+	CountryPolicies map[string]CountryPolicy `yaml:"country_policies"`
+
+	// Policies are conditions on events and the actions run for events violating them
+	Policies []Policy `yaml:"policies"`
+}
+
+// Pattern is a user-defined log line pattern (see parser.NewPattern)
+type Pattern struct {
+	// Name identifies the pattern; for counters it is the name label of ocserv_custom_events_total
+	Name string `yaml:"name"`
+	// Regex is matched against the log message (after the vhost prefix is removed)
+	Regex string `yaml:"regex"`
+	// Event is a built-in event type such as auth_failure; empty counts the line as custom event
+	Event string `yaml:"event"`
+	// Fields maps event fields to capture group names or numbers
+	Fields map[string]string `yaml:"fields"`
+}
+
+// CountryPolicy lists allowed or denied ISO country codes (see collector.CountryPolicy)
+type CountryPolicy struct {
+	Allow []string `yaml:"allow"`
+	Deny  []string `yaml:"deny"`
+}
+
+// Policy is an automation hook (see policy.Policy); all set conditions must hold
+type Policy struct {
+	Name string `yaml:"name"`
+	// Events are the event types checked, login by default
+	Events []string `yaml:"events"`
+	// Groups limits the policy to users of these ocserv groups
+	Groups []string `yaml:"groups"`
+	// Countries are the ISO codes of blocked client IP countries
+	Countries []string `yaml:"countries"`
+	// MaxSessions is the number of concurrent sessions a user may have
+	MaxSessions int `yaml:"max_sessions"`
+	// Quota is the traffic a user may use per quota period, e.g. 10GiB
+	Quota       string        `yaml:"quota"`
+	QuotaPeriod time.Duration `yaml:"quota_period"`
+	// Count events of the same user or client IP (By) within Window violate the policy
+	Count  int           `yaml:"count"`
+	Window time.Duration `yaml:"window"`
+	By     string        `yaml:"by"`
+	// Cooldown is the minimum time between actions for the same user or client IP
+	Cooldown time.Duration  `yaml:"cooldown"`
+	Actions  []PolicyAction `yaml:"actions"`
+}
+
+// PolicyAction is one action of a policy: exactly one field is set
+type PolicyAction struct {
+	Webhook    string   `yaml:"webhook"`
+	Disconnect bool     `yaml:"disconnect"`
+	Unban      bool     `yaml:"unban"`
+	Command    []string `yaml:"command"`
+}
+
+// Load reads and validates the configuration file at path
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+// Validate checks the configuration for inconsistencies
+func (c *Config) Validate() error {
+	seen := make(map[string]string)
+	for canonical, raws := range c.DisconnectReasons {
+		if strings.TrimSpace(canonical) == "" {
+			return fmt.Errorf("disconnect_reasons: empty canonical reason")
+		}
+		for _, raw := range raws {
+			key := strings.ToLower(strings.TrimSpace(raw))
+			if prev, ok := seen[key]; ok && prev != canonical {
+				return fmt.Errorf("disconnect_reasons: %q mapped to both %q and %q", raw, prev, canonical)
+			}
+			seen[key] = canonical
+		}
+	}
+	for name, alias := range c.ServerAliases {
+		if strings.TrimSpace(name) == "" || strings.TrimSpace(alias) == "" {
+			return fmt.Errorf("server_aliases: empty server name or alias (%q: %q)", name, alias)
+		}
+	}
+	if _, err := c.ParserPatterns(); err != nil {
+		return fmt.Errorf("patterns: %w", err)
+	}
+	for server, p := range c.CountryPolicies {
+		if strings.TrimSpace(server) == "" || len(p.Allow)+len(p.Deny) == 0 {
+			return fmt.Errorf("country_policies: empty server name or policy (%q)", server)
+		}
+		for _, code := range append(slices.Clone(p.Allow), p.Deny...) {
+			if len(strings.TrimSpace(code)) != 2 {
+				return fmt.Errorf("country_policies: %s: %q is not an ISO country code", server, code)
+			}
+		}
+	}
+	if _, err := c.PolicyRules(); err != nil {
+		return fmt.Errorf("policies: %w", err)
+	}
+	return nil
+}
+
+// ParserPatterns compiles the user-defined patterns in the order they are listed
+func (c *Config) ParserPatterns() ([]*parser.Pattern, error) {
+	patterns := make([]*parser.Pattern, 0, len(c.Patterns))
+	names := make(map[string]bool)
+	for _, pc := range c.Patterns {
+		if pc.Name != "" && names[pc.Name] {
+			return nil, fmt.Errorf("duplicate pattern name %q", pc.Name)
+		}
+		names[pc.Name] = true
+		pattern, err := parser.NewPattern(pc.Name, pc.Regex, pc.Event, pc.Fields)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// PolicyRules validates the policies and applies their defaults
+func (c *Config) PolicyRules() ([]*policy.Policy, error) {
+	policies := make([]*policy.Policy, 0, len(c.Policies))
+	names := make(map[string]bool)
+	for _, pc := range c.Policies {
+		if names[pc.Name] {
+			return nil, fmt.Errorf("duplicate policy name %q", pc.Name)
+		}
+		names[pc.Name] = true
+		var quota int64
+		if pc.Quota != "" {
+			var err error
+			if quota, err = units.ParseStrictBytes(pc.Quota); err != nil || quota <= 0 {
+				return nil, fmt.Errorf("policy %s: invalid quota %q", pc.Name, pc.Quota)
+			}
+		}
+		actions := make([]policy.Action, 0, len(pc.Actions))
+		for _, ac := range pc.Actions {
+			actions = append(actions, policy.Action(ac))
+		}
+		p, err := policy.New(policy.Policy{
+			Name:        pc.Name,
+			Events:      pc.Events,
+			Groups:      pc.Groups,
+			Countries:   pc.Countries,
+			MaxSessions: pc.MaxSessions,
+			Quota:       uint64(quota),
+			QuotaPeriod: pc.QuotaPeriod,
+			Count:       pc.Count,
+			Window:      pc.Window,
+			By:          pc.By,
+			Cooldown:    pc.Cooldown,
+			Actions:     actions,
+		})
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, p)
+	}
+	return policies, nil
+}
+
+// ReasonMap returns the disconnect reason mapping keyed by lowercased raw reason
+func (c *Config) ReasonMap() map[string]string {
+	m := make(map[string]string)
+	for canonical, raws := range c.DisconnectReasons {
+		for _, raw := range raws {
+			m[strings.ToLower(strings.TrimSpace(raw))] = canonical
+		}
+	}
+	return m
+}
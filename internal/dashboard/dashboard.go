@@ -0,0 +1,356 @@
+// Package dashboard generates Grafana dashboards matching the exporter's enabled metric set.
+package dashboard
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Options selects the panels and filters of a generated dashboard.
+// They mirror the exporter flags the dashboard is generated for.
+type Options struct {
+	Title   string
+	UID     string
+	Occtl   bool // occtl metrics (--occtl.enabled)
+	GeoIP   bool // country labels and geo anomaly metrics (--geoip.db)
+	PerUser bool // per-user panels and username variable
+	Group   bool // group label (--metrics.group-label)
+	VHost   bool // vhost label (--metrics.vhost-label)
+}
+
+// Grafana JSON model (only the fields we set)
+
+type dashboard struct {
+	Annotations   map[string]any `json:"annotations"`
+	Editable      bool           `json:"editable"`
+	GraphTooltip  int            `json:"graphTooltip"`
+	ID            any            `json:"id"`
+	Links         []any          `json:"links"`
+	Panels        []*panel       `json:"panels"`
+	Refresh       string         `json:"refresh"`
+	SchemaVersion int            `json:"schemaVersion"`
+	Tags          []string       `json:"tags"`
+	Templating    templating     `json:"templating"`
+	Time          timeRange      `json:"time"`
+	Title         string         `json:"title"`
+	UID           string         `json:"uid"`
+	Version       int            `json:"version"`
+}
+
+type templating struct {
+	List []variable `json:"list"`
+}
+
+type timeRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type variable struct {
+	AllValue   string      `json:"allValue,omitempty"`
+	Datasource *datasource `json:"datasource,omitempty"`
+	IncludeAll bool        `json:"includeAll"`
+	Label      string      `json:"label"`
+	Multi      bool        `json:"multi"`
+	Name       string      `json:"name"`
+	Query      any         `json:"query"`
+	Refresh    int         `json:"refresh"`
+	Sort       int         `json:"sort,omitempty"`
+	Type       string      `json:"type"`
+}
+
+type datasource struct {
+	Type string `json:"type"`
+	UID  string `json:"uid"`
+}
+
+type gridPos struct {
+	H int `json:"h"`
+	W int `json:"w"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type target struct {
+	Expr         string `json:"expr"`
+	LegendFormat string `json:"legendFormat,omitempty"`
+	Format       string `json:"format,omitempty"`
+	Instant      bool   `json:"instant,omitempty"`
+	RefID        string `json:"refId"`
+}
+
+type panel struct {
+	Collapsed   *bool          `json:"collapsed,omitempty"`
+	Datasource  *datasource    `json:"datasource,omitempty"`
+	FieldConfig map[string]any `json:"fieldConfig,omitempty"`
+	GridPos     gridPos        `json:"gridPos"`
+	ID          int            `json:"id"`
+	Options     map[string]any `json:"options,omitempty"`
+	Panels      []*panel       `json:"panels,omitempty"`
+	Targets     []target       `json:"targets,omitempty"`
+	Title       string         `json:"title"`
+	Type        string         `json:"type"`
+}
+
+var promDatasource = &datasource{Type: "prometheus", UID: "${datasource}"}
+
+// builder lays out panels left to right in rows of 24 grid units
+type builder struct {
+	opts   Options
+	panels []*panel
+	x, y   int
+	rowH   int
+	nextID int
+}
+
+// row starts a new dashboard row
+func (b *builder) row(title string) {
+	b.newline()
+	collapsed := false
+	b.nextID++
+	b.panels = append(b.panels, &panel{
+		Collapsed: &collapsed,
+		GridPos:   gridPos{H: 1, W: 24, X: 0, Y: b.y},
+		ID:        b.nextID,
+		Title:     title,
+		Type:      "row",
+	})
+	b.y++
+}
+
+func (b *builder) newline() {
+	if b.x > 0 {
+		b.y += b.rowH
+		b.x, b.rowH = 0, 0
+	}
+}
+
+// add places a panel of the given size, wrapping to the next line when it does not fit
+func (b *builder) add(p *panel, w, h int) {
+	if b.x+w > 24 {
+		b.newline()
+	}
+	b.nextID++
+	p.ID = b.nextID
+	p.Datasource = promDatasource
+	p.GridPos = gridPos{H: h, W: w, X: b.x, Y: b.y}
+	for i := range p.Targets {
+		p.Targets[i].RefID = string(rune('A' + i))
+	}
+	b.panels = append(b.panels, p)
+	b.x += w
+	if h > b.rowH {
+		b.rowH = h
+	}
+}
+
+// sel returns the label matchers for a metric with the given optional labels
+// (server is always filtered; username, group and vhost only where the metric has them and they are enabled)
+func (b *builder) sel(labels ...string) string {
+	matchers := []string{`server=~"$server"`}
+	for _, l := range labels {
+		switch {
+		case l == "username" && b.opts.PerUser,
+			l == "group" && b.opts.Group,
+			l == "vhost" && b.opts.VHost:
+			matchers = append(matchers, fmt.Sprintf(`%s=~"$%s"`, l, l))
+		}
+	}
+	return "{" + strings.Join(matchers, ",") + "}"
+}
+
+// userSel is sel for the per-user metrics carrying the optional vhost and group labels
+func (b *builder) userSel() string {
+	return b.sel("username", "vhost", "group")
+}
+
+func stat(title, unit, expr string) *panel {
+	return &panel{
+		Title:       title,
+		Type:        "stat",
+		FieldConfig: fieldConfig(unit),
+		Options:     map[string]any{"reduceOptions": map[string]any{"calcs": []string{"lastNotNull"}}, "colorMode": "value", "graphMode": "area"},
+		Targets:     []target{{Expr: expr}},
+	}
+}
+
+func timeseries(title, unit string, targets ...target) *panel {
+	return &panel{
+		Title:       title,
+		Type:        "timeseries",
+		FieldConfig: fieldConfig(unit),
+		Options:     map[string]any{"legend": map[string]any{"displayMode": "list", "placement": "bottom"}, "tooltip": map[string]any{"mode": "multi"}},
+		Targets:     targets,
+	}
+}
+
+func piechart(title, expr, legend string) *panel {
+	return &panel{
+		Title:       title,
+		Type:        "piechart",
+		FieldConfig: fieldConfig("short"),
+		Options:     map[string]any{"legend": map[string]any{"displayMode": "table", "placement": "right", "values": []string{"value"}}, "pieType": "donut"},
+		Targets:     []target{{Expr: expr, LegendFormat: legend, Instant: true}},
+	}
+}
+
+func table(title, unit, expr string) *panel {
+	return &panel{
+		Title:       title,
+		Type:        "table",
+		FieldConfig: fieldConfig(unit),
+		Options:     map[string]any{"showHeader": true, "sortBy": []map[string]any{{"desc": true, "displayName": "Value"}}},
+		Targets:     []target{{Expr: expr, Format: "table", Instant: true}},
+	}
+}
+
+func fieldConfig(unit string) map[string]any {
+	return map[string]any{
+		"defaults":  map[string]any{"color": map[string]any{"mode": "palette-classic"}, "unit": unit},
+		"overrides": []any{},
+	}
+}
+
+// Generate returns the dashboard JSON for opts
+func Generate(opts Options) ([]byte, error) {
+	if opts.Title == "" {
+		opts.Title = "ocserv VPN"
+	}
+	if opts.UID == "" {
+		opts.UID = "ocserv-vpn"
+	}
+	b := &builder{opts: opts}
+
+	user := b.userSel()
+	byUser := "server"
+	if opts.PerUser {
+		byUser = "server, username"
+	}
+
+	b.row("Overview")
+	b.add(stat("Active Sessions", "short", "sum(ocserv_active_sessions"+user+")"), 4, 4)
+	b.add(stat("Connections", "short", "round(sum(increase(ocserv_connections_total"+user+"[$__range])))"), 4, 4)
+	b.add(stat("Auth Failed", "short", "round(sum(increase(ocserv_auth_failed_total"+b.sel("username")+"[$__range])))"), 4, 4)
+	b.add(stat("Traffic", "decbytes", "sum(increase(ocserv_received_bytes_total"+user+"[$__range])) + sum(increase(ocserv_sent_bytes_total"+user+"[$__range]))"), 4, 4)
+	b.add(stat("Reconnects", "short", "round(sum(increase(ocserv_reconnects_total"+b.sel("username")+"[$__range])))"), 4, 4)
+	b.add(stat("Problematic Sessions", "short", "round(sum(increase(ocserv_problematic_sessions_total"+b.sel("username")+"[$__range])))"), 4, 4)
+
+	activeBy := "server"
+	if opts.Group {
+		activeBy = "server, group"
+	}
+	b.add(timeseries("Active Sessions Over Time", "short",
+		target{Expr: "sum by (" + activeBy + ") (ocserv_active_sessions" + user + ")", LegendFormat: legend(activeBy)}), 12, 8)
+	b.add(timeseries("Connections & Auth Failures", "short",
+		target{Expr: "round(sum(increase(ocserv_connections_total" + user + "[$__rate_interval])))", LegendFormat: "connections"},
+		target{Expr: "round(sum(increase(ocserv_auth_failed_total" + b.sel("username") + "[$__rate_interval])))", LegendFormat: "auth failures"}), 12, 8)
+	b.add(piechart("Disconnect Reasons", "round(sum by (reason) (increase(ocserv_disconnections_total"+b.sel("username")+"[$__range])))", "{{ reason }}"), 8, 8)
+	b.add(timeseries("Session Duration (p50 / p95)", "s",
+		target{Expr: "histogram_quantile(0.5, sum by (le) (rate(ocserv_session_duration_seconds_bucket" + b.sel("username") + "[$__rate_interval])))", LegendFormat: "p50"},
+		target{Expr: "histogram_quantile(0.95, sum by (le) (rate(ocserv_session_duration_seconds_bucket" + b.sel("username") + "[$__rate_interval])))", LegendFormat: "p95"}), 16, 8)
+
+	if opts.PerUser {
+		b.row("Users")
+		b.add(timeseries("Traffic Received by User", "Bps",
+			target{Expr: "sum by (username) (rate(ocserv_received_bytes_total" + user + "[$__rate_interval]))", LegendFormat: "{{ username }}"}), 12, 8)
+		b.add(timeseries("Traffic Sent by User", "Bps",
+			target{Expr: "sum by (username) (rate(ocserv_sent_bytes_total" + user + "[$__rate_interval]))", LegendFormat: "{{ username }}"}), 12, 8)
+		b.add(table("Top Users by Traffic", "decbytes",
+			"topk(20, sum by ("+byUser+") (increase(ocserv_received_bytes_total"+user+"[$__range]) + increase(ocserv_sent_bytes_total"+user+"[$__range])))"), 12, 8)
+		b.add(table("Problematic Users", "short",
+			"round(sum by (server, username, reason) (increase(ocserv_problematic_sessions_total"+b.sel("username")+"[$__range]))) > 0"), 12, 8)
+	}
+
+	b.row("Authentication")
+	b.add(table("Failed Auth by IP", "short",
+		"round(sum by (server, username, client_ip) (increase(ocserv_auth_failed_total"+b.sel("username")+"[$__range]))) > 0"), 12, 8)
+	b.add(timeseries("Auth Backend Errors", "short",
+		target{Expr: "sum by (backend, error) (increase(ocserv_auth_backend_errors_total" + b.sel() + "[$__rate_interval]))", LegendFormat: "{{ backend }}: {{ error }}"}), 12, 8)
+
+	if opts.GeoIP {
+		b.row("GeoIP")
+		b.add(piechart("Connections by Country", "round(sum by (country) (increase(ocserv_connections_by_country_total"+b.sel("username")+"[$__range])))", "{{ country }}"), 8, 8)
+		b.add(piechart("Failed Auth by Country", "round(sum by (country) (increase(ocserv_auth_failed_total"+b.sel("username")+"[$__range])))", "{{ country }}"), 8, 8)
+		b.add(table("Geo Anomalies", "short",
+			"round(sum by (server, username, type) (increase(ocserv_geo_anomaly_total"+b.sel("username")+"[$__range]))) > 0"), 8, 8)
+	}
+
+	if opts.Occtl {
+		b.row("Server Statistics (occtl)")
+		b.add(stat("Server Active Sessions", "short", "sum(ocserv_server_active_sessions"+b.sel()+")"), 6, 4)
+		b.add(stat("Latency (Median)", "s", "max(ocserv_server_latency_median_seconds"+b.sel()+")"), 6, 4)
+		b.add(stat("Avg Session Time", "s", "max(ocserv_server_avg_session_time_seconds"+b.sel()+")"), 6, 4)
+		b.add(stat("Uptime", "s", "min(ocserv_server_uptime_seconds"+b.sel()+")"), 6, 4)
+		b.add(timeseries("Server Traffic", "Bps",
+			target{Expr: "rate(ocserv_server_rx_bytes_total" + b.sel() + "[$__rate_interval])", LegendFormat: "{{ server }} RX"},
+			target{Expr: "rate(ocserv_server_tx_bytes_total" + b.sel() + "[$__rate_interval])", LegendFormat: "{{ server }} TX"}), 12, 8)
+		b.add(timeseries("IP Pool Usage", "percentunit",
+			target{Expr: "ocserv_ip_pool_used" + b.sel("vhost") + " / ocserv_ip_pool_size" + b.sel("vhost"), LegendFormat: "{{ server }} {{ vhost }}"}), 12, 8)
+		b.add(piechart("Sessions by Client Type", "sum by (client_type) (ocserv_sessions_by_client_type"+b.sel()+")", "{{ client_type }}"), 8, 8)
+		b.add(piechart("Sessions by DTLS Cipher", "sum by (cipher) (ocserv_sessions_by_dtls_cipher"+b.sel()+")", "{{ cipher }}"), 8, 8)
+		if opts.PerUser {
+			b.add(table("Users with Multiple Sessions", "short", "ocserv_user_concurrent_sessions"+b.sel("username")+" > 1"), 8, 8)
+			b.add(table("Online Users", "dateTimeAsIso", "ocserv_session_info"+b.sel("username", "vhost")+" * 1000"), 24, 10)
+		}
+	}
+
+	d := dashboard{
+		Annotations:   map[string]any{"list": []any{}},
+		Editable:      true,
+		Links:         []any{},
+		Panels:        b.panels,
+		Refresh:       "30s",
+		SchemaVersion: 39,
+		Tags:          []string{"ocserv", "vpn"},
+		Templating:    templating{List: b.variables()},
+		Time:          timeRange{From: "now-24h", To: "now"},
+		Title:         opts.Title,
+		UID:           opts.UID,
+		Version:       1,
+	}
+	return json.MarshalIndent(d, "", "  ")
+}
+
+// variables returns the datasource variable and one query variable per enabled filter label
+func (b *builder) variables() []variable {
+	vars := []variable{{Label: "Datasource", Name: "datasource", Query: "prometheus", Refresh: 1, Type: "datasource"}}
+	add := func(name, label string) {
+		query := fmt.Sprintf("label_values(ocserv_active_sessions, %s)", name)
+		if name != "server" {
+			query = fmt.Sprintf(`label_values(ocserv_active_sessions{server=~"$server"}, %s)`, name)
+		}
+		vars = append(vars, variable{
+			AllValue:   ".*",
+			Datasource: promDatasource,
+			IncludeAll: true,
+			Label:      label,
+			Multi:      true,
+			Name:       name,
+			Query:      map[string]string{"query": query, "refId": "StandardVariableQuery"},
+			Refresh:    2,
+			Sort:       1,
+			Type:       "query",
+		})
+	}
+	add("server", "Server")
+	if b.opts.VHost {
+		add("vhost", "Virtual host")
+	}
+	if b.opts.Group {
+		add("group", "Group")
+	}
+	if b.opts.PerUser {
+		add("username", "Username")
+	}
+	return vars
+}
+
+// legend returns a legend format for a comma-separated "by" clause
+func legend(by string) string {
+	parts := strings.Split(by, ", ")
+	for i, p := range parts {
+		parts[i] = "{{ " + p + " }}"
+	}
+	return strings.Join(parts, " ")
+}
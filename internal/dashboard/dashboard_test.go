@@ -0,0 +1,62 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func titles(t *testing.T, opts Options) (map[string]bool, string) {
+	t.Helper()
+	data, err := Generate(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var d dashboard
+	if err := json.Unmarshal(data, &d); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	result := make(map[string]bool)
+	ids := make(map[int]bool)
+	for _, p := range d.Panels {
+		result[p.Title] = true
+		if ids[p.ID] {
+			t.Errorf("duplicate panel id %d", p.ID)
+		}
+		ids[p.ID] = true
+		if p.GridPos.X+p.GridPos.W > 24 {
+			t.Errorf("panel %q overflows the grid", p.Title)
+		}
+	}
+	return result, string(data)
+}
+
+func TestGenerateMinimal(t *testing.T) {
+	got, data := titles(t, Options{})
+	if !got["Active Sessions"] {
+		t.Error("overview panels missing")
+	}
+	for _, title := range []string{"Server Statistics (occtl)", "GeoIP", "Users"} {
+		if got[title] {
+			t.Errorf("row %q present although disabled", title)
+		}
+	}
+	if strings.Contains(data, "$username") {
+		t.Error("username filter present without per-user panels")
+	}
+}
+
+func TestGenerateAll(t *testing.T) {
+	got, data := titles(t, Options{Occtl: true, GeoIP: true, PerUser: true, Group: true})
+	for _, title := range []string{"Server Statistics (occtl)", "GeoIP", "Users", "Online Users"} {
+		if !got[title] {
+			t.Errorf("row %q missing", title)
+		}
+	}
+	if !strings.Contains(data, `ocserv_active_sessions{server=~\"$server\",username=~\"$username\",group=~\"$group\"}`) {
+		t.Error("group filter missing from per-user metrics")
+	}
+	if strings.Contains(data, `ocserv_reconnects_total{server=~\"$server\",username=~\"$username\",group`) {
+		t.Error("group filter applied to a metric without group label")
+	}
+}
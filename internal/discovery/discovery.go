@@ -0,0 +1,87 @@
+// Package discovery finds the ocserv instances running on this host.
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+)
+
+const (
+	// DefaultUnitPattern matches ocserv.service, ocserv-ru.service, ocserv@corp.service, ...
+	DefaultUnitPattern = "ocserv*.service"
+)
+
+// DefaultSocketGlobs are the usual locations of occtl-socket-file
+var DefaultSocketGlobs = []string{
+	"/run/occtl*.socket", "/var/run/occtl*.socket",
+	"/run/ocserv*.socket", "/var/run/ocserv*.socket",
+}
+
+// Socket is a discovered occtl socket
+type Socket struct {
+	Server string // server name derived from the file name, e.g. "ocserv-ru"
+	Path   string
+}
+
+// Units asks systemd over D-Bus for running units matching pattern and
+// returns their names without the .service suffix
+func Units(ctx context.Context, pattern string) ([]string, error) {
+	conn, err := dbus.NewSystemConnectionContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to systemd: %w", err)
+	}
+	defer conn.Close()
+
+	units, err := conn.ListUnitsByPatternsContext(ctx, []string{"active", "activating", "reloading"}, []string{pattern})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list units: %w", err)
+	}
+
+	names := make([]string, 0, len(units))
+	for _, u := range units {
+		names = append(names, strings.TrimSuffix(u.Name, ".service"))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Sockets returns the occtl sockets matching globs. Paths resolving to the
+// same file (/var/run is usually a symlink to /run) are returned once.
+func Sockets(globs []string) ([]Socket, error) {
+	var sockets []Socket
+	seen := make(map[string]bool)
+	for _, glob := range globs {
+		paths, err := filepath.Glob(glob)
+		if err != nil {
+			return nil, fmt.Errorf("invalid socket glob %q: %w", glob, err)
+		}
+		for _, path := range paths {
+			real, err := filepath.EvalSymlinks(path)
+			if err != nil {
+				continue
+			}
+			if seen[real] {
+				continue
+			}
+			seen[real] = true
+			sockets = append(sockets, Socket{Server: ServerFromSocket(path), Path: path})
+		}
+	}
+	return sockets, nil
+}
+
+// ServerFromSocket derives the server name from an occtl socket file name the
+// same way units are named: occtl.socket is "ocserv", occtl-ru.socket is
+// "ocserv-ru". Other names are used as is, without extension.
+func ServerFromSocket(path string) string {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	if rest, ok := strings.CutPrefix(name, "occtl"); ok {
+		return "ocserv" + rest
+	}
+	return name
+}
@@ -0,0 +1,47 @@
+package discovery
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestServerFromSocket(t *testing.T) {
+	for path, want := range map[string]string{
+		"/run/occtl.socket":          "ocserv",
+		"/run/occtl-ru.socket":       "ocserv-ru",
+		"/var/run/occtl@corp.socket": "ocserv@corp",
+		"/run/vpn-lab.socket":        "vpn-lab",
+	} {
+		if got := ServerFromSocket(path); got != want {
+			t.Errorf("ServerFromSocket(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestSockets(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"occtl.socket", "occtl-ru.socket"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A symlinked directory must not produce duplicates
+	link := filepath.Join(t.TempDir(), "run")
+	if err := os.Symlink(dir, link); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Sockets([]string{filepath.Join(dir, "occtl*.socket"), filepath.Join(link, "occtl*.socket")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Socket{
+		{Server: "ocserv-ru", Path: filepath.Join(dir, "occtl-ru.socket")},
+		{Server: "ocserv", Path: filepath.Join(dir, "occtl.socket")},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Sockets() = %+v, want %+v", got, want)
+	}
+}
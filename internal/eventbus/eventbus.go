@@ -0,0 +1,141 @@
+// Package eventbus parses ocserv log lines and distributes the resulting events to independent
+// consumers: the Prometheus collector and any other integration that works on parsed events.
+// Consumers that need the collector's enrichment (GeoIP, session durations, ...) register as
+// collector event sinks instead.
+package eventbus
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mogilevich/ocserv_exporter/internal/collector"
+	"github.com/mogilevich/ocserv_exporter/pkg/parser"
+)
+
+// RateLimitSink is the sink label of ocserv_events_dropped_total for lines dropped by the rate limit
+const RateLimitSink = "rate_limit"
+
+// Consumer receives parsed events. ProcessEvent may be called concurrently from several parser
+// workers, with the events of one user always in order, and must not block: consumers doing
+// I/O queue the event and handle it asynchronously. *collector.Collector is a Consumer.
+type Consumer interface {
+	ProcessEvent(event *parser.Event)
+}
+
+// ConsumerFunc adapts a function to a Consumer
+type ConsumerFunc func(event *parser.Event)
+
+// ProcessEvent calls f(event)
+func (f ConsumerFunc) ProcessEvent(event *parser.Event) {
+	f(event)
+}
+
+// Bus parses log lines and publishes the events to its consumers in subscription order
+type Bus struct {
+	parser    *parser.Parser
+	aliases   map[string]string // unit name -> server label
+	consumers []Consumer
+	limiter   *rateLimiter // nil without rate limit
+}
+
+// New creates a bus without consumers
+func New() *Bus {
+	return &Bus{parser: parser.New()}
+}
+
+// SetPatterns sets user-defined log line patterns, tried when no built-in pattern matches
+func (b *Bus) SetPatterns(patterns []*parser.Pattern) {
+	b.parser.SetPatterns(patterns)
+}
+
+// SetServerAliases sets the server label used for log lines from a unit, keyed by unit name
+func (b *Bus) SetServerAliases(m map[string]string) {
+	b.aliases = m
+}
+
+// Subscribe adds a consumer of all events. Must be called before lines are processed.
+func (b *Bus) Subscribe(consumer Consumer) {
+	b.consumers = append(b.consumers, consumer)
+}
+
+// SetRateLimit limits processing to perSecond log lines per second with bursts of up to burst
+// lines; lines beyond it are dropped and counted. With preferKnown lines are parsed before the
+// limit applies and lines without a recognized event are dropped once the burst budget is half
+// used, saving the rest for recognized events. Must be called before lines are processed.
+func (b *Bus) SetRateLimit(perSecond float64, burst int, preferKnown bool) {
+	b.limiter = newRateLimiter(perSecond, burst, preferKnown)
+}
+
+// ProcessLogLine parses a log line and publishes the resulting event, if any
+func (b *Bus) ProcessLogLine(ts time.Time, message string, server string) {
+	if b.limiter != nil && !b.limiter.preferKnown && !b.limiter.allow(false) {
+		collector.EventsDroppedTotal.WithLabelValues(RateLimitSink).Inc()
+		return
+	}
+	if alias, ok := b.aliases[server]; ok {
+		server = alias
+	}
+	event := b.parser.Parse(ts, message, server)
+	if b.limiter != nil && b.limiter.preferKnown && !b.limiter.allow(event.Type == parser.EventUnknown) {
+		collector.EventsDroppedTotal.WithLabelValues(RateLimitSink).Inc()
+		return
+	}
+	if event.Type != parser.EventUnknown {
+		b.Publish(event)
+	}
+}
+
+// Publish hands an event to all consumers. Each consumer gets its own copy, as the collector
+// rewrites fields (pseudonymized usernames, real client addresses behind a proxy) while
+// other consumers get the event as logged.
+func (b *Bus) Publish(event *parser.Event) {
+	for i, consumer := range b.consumers {
+		if i < len(b.consumers)-1 {
+			copied := *event
+			consumer.ProcessEvent(&copied)
+			continue
+		}
+		consumer.ProcessEvent(event)
+	}
+}
+
+// rateLimiter is a token bucket refilled at rate tokens per second up to burst tokens
+type rateLimiter struct {
+	rate        float64
+	burst       float64
+	preferKnown bool
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(perSecond float64, burst int, preferKnown bool) *rateLimiter {
+	return &rateLimiter{
+		rate:        perSecond,
+		burst:       float64(max(burst, 1)),
+		preferKnown: preferKnown,
+		tokens:      float64(max(burst, 1)),
+		last:        time.Now(),
+	}
+}
+
+// allow takes a token if one is available; unknown lines need more than half the burst left
+func (l *rateLimiter) allow(unknown bool) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+
+	reserve := 0.0
+	if unknown {
+		reserve = l.burst / 2
+	}
+	if l.tokens < 1+reserve {
+		return false
+	}
+	l.tokens--
+	return true
+}
@@ -0,0 +1,75 @@
+package eventbus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mogilevich/ocserv_exporter/pkg/parser"
+)
+
+func TestBusPublishesCopiesToConsumers(t *testing.T) {
+	b := New()
+	b.SetServerAliases(map[string]string{"ocserv@corp": "corp"})
+
+	var first, second []*parser.Event
+	b.Subscribe(ConsumerFunc(func(event *parser.Event) {
+		event.Username = "pseudonym" // rewriting must not leak to other consumers
+		first = append(first, event)
+	}))
+	b.Subscribe(ConsumerFunc(func(event *parser.Event) {
+		second = append(second, event)
+	}))
+
+	ts := time.Unix(1700000000, 0)
+	b.ProcessLogLine(ts, "main[bob]:62.4.32.53:30595 user logged in", "ocserv@corp")
+	b.ProcessLogLine(ts, "unrelated line", "ocserv@corp")
+
+	if len(first) != 1 || len(second) != 1 {
+		t.Fatalf("consumers got %d and %d events, want 1 each", len(first), len(second))
+	}
+	if got := second[0]; got.Type != parser.EventUserLogin || got.Server != "corp" || got.Username != "bob" {
+		t.Errorf("second consumer got %+v", got)
+	}
+}
+
+func TestBusRateLimitDropsUnknownLinesFirst(t *testing.T) {
+	b := New()
+	var logins int
+	b.Subscribe(ConsumerFunc(func(event *parser.Event) {
+		logins++
+	}))
+	// Practically no refill: the burst of 4 lines is all the budget
+	b.SetRateLimit(0.001, 4, true)
+
+	ts := time.Unix(1700000000, 0)
+	for range 3 {
+		b.ProcessLogLine(ts, "unrelated line", "ocserv")
+	}
+	// Two unknown lines used the half of the budget they may use, two logins get the rest
+	for range 3 {
+		b.ProcessLogLine(ts, "main[bob]:62.4.32.53:30595 user logged in", "ocserv")
+	}
+	if logins != 2 {
+		t.Errorf("published %d logins, want 2", logins)
+	}
+}
+
+func TestBusRateLimitBeforeParsing(t *testing.T) {
+	b := New()
+	var logins int
+	b.Subscribe(ConsumerFunc(func(event *parser.Event) {
+		logins++
+	}))
+	b.SetRateLimit(0.001, 4, false)
+
+	ts := time.Unix(1700000000, 0)
+	for range 3 {
+		b.ProcessLogLine(ts, "unrelated line", "ocserv")
+	}
+	for range 3 {
+		b.ProcessLogLine(ts, "main[bob]:62.4.32.53:30595 user logged in", "ocserv")
+	}
+	if logins != 1 {
+		t.Errorf("published %d logins, want 1", logins)
+	}
+}
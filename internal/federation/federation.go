@@ -0,0 +1,279 @@
+// Package federation scrapes other ocserv_exporter instances and re-exposes their metrics
+// summed across the fleet, dropping the per-node labels that make shipping raw metrics expensive.
+package federation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mogilevich/ocserv_exporter/internal/collector"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// acceptHeader asks for the protobuf format and falls back to text
+const acceptHeader = `application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited;q=0.7,text/plain;version=0.0.4;q=0.3`
+
+// Rule aggregates a metric: samples of all targets are summed by the By labels, all other
+// labels are dropped
+type Rule struct {
+	Metric string
+	By     []string
+}
+
+// DefaultRules are the fleet-level metrics exposed without --federation.rule
+var DefaultRules = []Rule{
+	{Metric: "ocserv_active_sessions"},
+	{Metric: "ocserv_connections_total"},
+	{Metric: "ocserv_disconnections_total", By: []string{"reason"}},
+	{Metric: "ocserv_auth_failed_total", By: []string{"reason"}},
+	{Metric: "ocserv_connections_by_country_total", By: []string{"country", "country_code"}},
+	{Metric: "ocserv_traffic_bytes_total", By: []string{"direction", "country"}},
+	{Metric: "ocserv_received_bytes_total"},
+	{Metric: "ocserv_sent_bytes_total"},
+	{Metric: "ocserv_unique_active_users"},
+	{Metric: "ocserv_session_duration_seconds"},
+	{Metric: "ocserv_server_active_sessions"},
+	{Metric: "ocserv_sessions_by_client_type", By: []string{"client_type"}},
+	{Metric: "ocserv_ip_pool_size"},
+	{Metric: "ocserv_ip_pool_used"},
+}
+
+// ParseRule parses a rule in format 'metric' or 'metric:label,label'
+func ParseRule(s string) (Rule, error) {
+	metric, labels, _ := strings.Cut(s, ":")
+	if metric == "" {
+		return Rule{}, fmt.Errorf("missing metric name")
+	}
+	rule := Rule{Metric: metric}
+	for _, label := range strings.Split(labels, ",") {
+		if label = strings.TrimSpace(label); label != "" {
+			rule.By = append(rule.By, label)
+		}
+	}
+	return rule, nil
+}
+
+// target is a scraped exporter with the families of its last successful scrape
+type target struct {
+	url      string
+	families map[string]*dto.MetricFamily
+	updated  time.Time
+}
+
+// Federator scrapes the targets and collects the aggregated metrics (prometheus.Collector).
+// A failing target contributes the values of its last successful scrape for StaleAfter, so a
+// short outage doesn't make the summed counters drop and jump back.
+type Federator struct {
+	Interval   time.Duration
+	StaleAfter time.Duration
+
+	client *http.Client
+	rules  map[string]Rule
+
+	mu      sync.Mutex
+	targets []*target
+}
+
+// New creates a federator for the metrics endpoints at urls (e.g. http://vpn1:9617/metrics)
+func New(urls []string, rules []Rule, timeout time.Duration) *Federator {
+	f := &Federator{
+		Interval:   30 * time.Second,
+		StaleAfter: 5 * time.Minute,
+		client:     &http.Client{Timeout: timeout},
+		rules:      make(map[string]Rule, len(rules)),
+	}
+	for _, rule := range rules {
+		f.rules[rule.Metric] = rule
+	}
+	for _, url := range urls {
+		f.targets = append(f.targets, &target{url: url})
+	}
+	return f
+}
+
+// Run scrapes all targets every Interval until ctx is cancelled
+func (f *Federator) Run(ctx context.Context) {
+	ticker := time.NewTicker(f.Interval)
+	defer ticker.Stop()
+
+	for {
+		f.ScrapeAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ScrapeAll scrapes all targets in parallel
+func (f *Federator) ScrapeAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, t := range f.targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			families, err := f.scrape(ctx, t.url)
+			if err != nil {
+				log.Printf("Warning: Federation scrape of %s failed: %v", t.url, err)
+				collector.FederationTargetUp.WithLabelValues(t.url).Set(0)
+				collector.FederationScrapeErrorsTotal.WithLabelValues(t.url).Inc()
+				return
+			}
+			collector.FederationTargetUp.WithLabelValues(t.url).Set(1)
+			f.mu.Lock()
+			t.families = families
+			t.updated = time.Now()
+			f.mu.Unlock()
+		}()
+	}
+	wg.Wait()
+}
+
+// scrape fetches the metric families of a target that match a rule
+func (f *Federator) scrape(ctx context.Context, url string) (map[string]*dto.MetricFamily, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", acceptHeader)
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	families := make(map[string]*dto.MetricFamily)
+	decoder := expfmt.NewDecoder(resp.Body, expfmt.ResponseFormat(resp.Header))
+	for {
+		var family dto.MetricFamily
+		err := decoder.Decode(&family)
+		if errors.Is(err, io.EOF) {
+			return families, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := f.rules[family.GetName()]; ok {
+			families[family.GetName()] = &family
+		}
+	}
+}
+
+// Describe sends no descriptors: the aggregated metrics depend on what the targets expose
+func (f *Federator) Describe(chan<- *prometheus.Desc) {}
+
+// Collect sums the metrics of the targets by the labels of their rules
+func (f *Federator) Collect(ch chan<- prometheus.Metric) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for name, rule := range f.rules {
+		var sums map[string]*sum
+		var help string
+		var metricType dto.MetricType
+		for _, t := range f.targets {
+			family, ok := t.families[name]
+			if !ok || time.Since(t.updated) > f.StaleAfter {
+				continue
+			}
+			if sums == nil {
+				sums = make(map[string]*sum)
+				help, metricType = family.GetHelp(), family.GetType()
+			}
+			if family.GetType() != metricType {
+				continue // a target of another version exposes the metric as another type
+			}
+			for _, m := range family.GetMetric() {
+				values := ruleLabelValues(rule, m)
+				key := strings.Join(values, "\xff")
+				s, ok := sums[key]
+				if !ok {
+					s = &sum{labels: values}
+					sums[key] = s
+				}
+				s.add(metricType, m)
+			}
+		}
+
+		desc := prometheus.NewDesc(name, help, rule.By, nil)
+		for _, s := range sums {
+			metric, err := s.metric(desc, metricType)
+			if err != nil {
+				log.Printf("Warning: Failed to aggregate %s: %v", name, err)
+				continue
+			}
+			ch <- metric
+		}
+	}
+}
+
+// ruleLabelValues returns the values of the rule's labels on a sample, empty when missing
+func ruleLabelValues(rule Rule, m *dto.Metric) []string {
+	values := make([]string, len(rule.By))
+	for _, label := range m.GetLabel() {
+		if i := slices.Index(rule.By, label.GetName()); i >= 0 {
+			values[i] = label.GetValue()
+		}
+	}
+	return values
+}
+
+// sum accumulates the samples of one aggregated series
+type sum struct {
+	labels  []string
+	value   float64
+	count   uint64
+	buckets map[float64]uint64 // histogram upper bound -> cumulative count
+}
+
+func (s *sum) add(metricType dto.MetricType, m *dto.Metric) {
+	switch metricType {
+	case dto.MetricType_COUNTER:
+		s.value += m.GetCounter().GetValue()
+	case dto.MetricType_GAUGE:
+		s.value += m.GetGauge().GetValue()
+	case dto.MetricType_UNTYPED:
+		s.value += m.GetUntyped().GetValue()
+	case dto.MetricType_HISTOGRAM:
+		h := m.GetHistogram()
+		s.value += h.GetSampleSum()
+		s.count += h.GetSampleCount()
+		if s.buckets == nil {
+			s.buckets = make(map[float64]uint64)
+		}
+		for _, b := range h.GetBucket() {
+			if !math.IsInf(b.GetUpperBound(), 1) {
+				s.buckets[b.GetUpperBound()] += b.GetCumulativeCount()
+			}
+		}
+	}
+}
+
+func (s *sum) metric(desc *prometheus.Desc, metricType dto.MetricType) (prometheus.Metric, error) {
+	switch metricType {
+	case dto.MetricType_COUNTER:
+		return prometheus.NewConstMetric(desc, prometheus.CounterValue, s.value, s.labels...)
+	case dto.MetricType_GAUGE:
+		return prometheus.NewConstMetric(desc, prometheus.GaugeValue, s.value, s.labels...)
+	case dto.MetricType_UNTYPED:
+		return prometheus.NewConstMetric(desc, prometheus.UntypedValue, s.value, s.labels...)
+	case dto.MetricType_HISTOGRAM:
+		return prometheus.NewConstHistogram(desc, s.count, s.value, s.buckets, s.labels...)
+	}
+	return nil, fmt.Errorf("unsupported metric type %s", metricType)
+}
@@ -0,0 +1,134 @@
+package federation
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const node1 = `# HELP ocserv_active_sessions Number of currently active VPN sessions
+# TYPE ocserv_active_sessions gauge
+ocserv_active_sessions{server="ocserv",username="alice"} 1
+ocserv_active_sessions{server="ocserv",username="bob"} 2
+# HELP ocserv_connections_by_country_total Total connections by country
+# TYPE ocserv_connections_by_country_total counter
+ocserv_connections_by_country_total{server="ocserv",username="alice",country="Germany",country_code="DE"} 5
+ocserv_connections_by_country_total{server="ocserv",username="bob",country="France",country_code="FR"} 1
+# HELP ocserv_session_duration_seconds Duration of VPN sessions
+# TYPE ocserv_session_duration_seconds histogram
+ocserv_session_duration_seconds_bucket{server="ocserv",le="60"} 1
+ocserv_session_duration_seconds_bucket{server="ocserv",le="+Inf"} 3
+ocserv_session_duration_seconds_sum{server="ocserv"} 400
+ocserv_session_duration_seconds_count{server="ocserv"} 3
+# HELP ocserv_unrelated Not aggregated
+# TYPE ocserv_unrelated gauge
+ocserv_unrelated 1
+`
+
+const node2 = `# HELP ocserv_active_sessions Number of currently active VPN sessions
+# TYPE ocserv_active_sessions gauge
+ocserv_active_sessions{server="ocserv",username="carol"} 4
+# HELP ocserv_connections_by_country_total Total connections by country
+# TYPE ocserv_connections_by_country_total counter
+ocserv_connections_by_country_total{server="ocserv",username="carol",country="Germany",country_code="DE"} 2
+# HELP ocserv_session_duration_seconds Duration of VPN sessions
+# TYPE ocserv_session_duration_seconds histogram
+ocserv_session_duration_seconds_bucket{server="ocserv",le="60"} 2
+ocserv_session_duration_seconds_bucket{server="ocserv",le="+Inf"} 2
+ocserv_session_duration_seconds_sum{server="ocserv"} 50
+ocserv_session_duration_seconds_count{server="ocserv"} 2
+`
+
+func serveText(body string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		_, _ = w.Write([]byte(body))
+	}))
+}
+
+func TestFederatorSumsTargets(t *testing.T) {
+	target1, target2 := serveText(node1), serveText(node2)
+	defer target1.Close()
+	defer target2.Close()
+	failing := httptest.NewServer(http.NotFoundHandler())
+	defer failing.Close()
+
+	f := New([]string{target1.URL, target2.URL, failing.URL}, DefaultRules, time.Second)
+	f.ScrapeAll(context.Background())
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(f)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]*dto.MetricFamily)
+	for _, family := range families {
+		got[family.GetName()] = family
+	}
+	if len(got) != 3 {
+		t.Fatalf("got %d families, want 3 (unrelated metrics are dropped)", len(got))
+	}
+
+	sessions := got["ocserv_active_sessions"].GetMetric()
+	if len(sessions) != 1 || len(sessions[0].GetLabel()) != 0 || sessions[0].GetGauge().GetValue() != 7 {
+		t.Errorf("ocserv_active_sessions = %v, want a single unlabeled 7", sessions)
+	}
+
+	byCountry := make(map[string]float64)
+	for _, m := range got["ocserv_connections_by_country_total"].GetMetric() {
+		if len(m.GetLabel()) != 2 {
+			t.Errorf("labels = %v, want country and country_code", m.GetLabel())
+		}
+		for _, label := range m.GetLabel() {
+			if label.GetName() == "country" {
+				byCountry[label.GetValue()] = m.GetCounter().GetValue()
+			}
+		}
+	}
+	if byCountry["Germany"] != 7 || byCountry["France"] != 1 {
+		t.Errorf("connections by country = %v, want Germany 7, France 1", byCountry)
+	}
+
+	h := got["ocserv_session_duration_seconds"].GetMetric()[0].GetHistogram()
+	if h.GetSampleCount() != 5 || h.GetSampleSum() != 450 || h.GetBucket()[0].GetCumulativeCount() != 3 {
+		t.Errorf("session duration histogram = %v", h)
+	}
+}
+
+func TestFederatorDropsStaleTargets(t *testing.T) {
+	target := serveText(node2)
+	defer target.Close()
+
+	f := New([]string{target.URL}, DefaultRules, time.Second)
+	f.ScrapeAll(context.Background())
+	f.targets[0].updated = time.Now().Add(-f.StaleAfter - time.Second)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(f)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(families) != 0 {
+		t.Errorf("got %d families from a stale target, want none", len(families))
+	}
+}
+
+func TestParseRule(t *testing.T) {
+	rule, err := ParseRule("ocserv_connections_total:server, country")
+	if err != nil || rule.Metric != "ocserv_connections_total" || len(rule.By) != 2 || rule.By[1] != "country" {
+		t.Errorf("ParseRule = %+v, %v", rule, err)
+	}
+	if rule, _ := ParseRule("ocserv_active_sessions"); len(rule.By) != 0 {
+		t.Errorf("ParseRule without labels = %+v", rule)
+	}
+	if _, err := ParseRule(":server"); err == nil {
+		t.Error("ParseRule without metric succeeded")
+	}
+}
@@ -0,0 +1,262 @@
+// Package firstseen remembers the countries, devices (client types) and client subnets each user
+// logged in from and reports logins from one not seen for the user before.
+package firstseen
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mogilevich/ocserv_exporter/internal/collector"
+)
+
+// Fingerprint kinds, the kind label of ocserv_first_seen_total
+const (
+	KindCountry = "country"
+	KindDevice  = "device"
+	KindSubnet  = "subnet"
+)
+
+// Defaults
+const (
+	DefaultRetention = 90 * 24 * time.Hour
+	DefaultTimeout   = 10 * time.Second
+
+	// Client addresses are grouped into subnets of these prefix lengths
+	ipv4Prefix = 24
+	ipv6Prefix = 48
+
+	stateVersion = 1
+)
+
+// Config configures the tracker
+type Config struct {
+	StateFile  string        // JSON file the fingerprints are kept in across restarts (empty: memory only)
+	Retention  time.Duration // fingerprints not seen for this long are forgotten
+	WebhookURL string        // POST {"kind": ..., "value": ..., "event": ...} for every first-seen login
+	Timeout    time.Duration // webhook timeout
+}
+
+// fingerprints maps a kind to the values seen for a user and when they were last seen
+type fingerprints map[string]map[string]time.Time
+
+type state struct {
+	Version int                     `json:"version"`
+	Users   map[string]fingerprints `json:"users"`
+}
+
+// Tracker checks login events against the fingerprints of their user. HandleEvents is a
+// sink.SendFunc; it is called from a single goroutine.
+type Tracker struct {
+	cfg    Config
+	client *http.Client
+	users  map[string]fingerprints // key: username (on any server, like geo-anomaly detection)
+	pruned time.Time
+}
+
+// New creates a tracker, loading the state file if it exists
+func New(cfg Config) (*Tracker, error) {
+	if cfg.Retention <= 0 {
+		cfg.Retention = DefaultRetention
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	t := &Tracker{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+		users:  make(map[string]fingerprints),
+	}
+	if cfg.StateFile == "" {
+		return t, nil
+	}
+
+	data, err := os.ReadFile(cfg.StateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s state
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", cfg.StateFile, err)
+	}
+	if s.Version != stateVersion {
+		return nil, fmt.Errorf("unsupported version %d of %s", s.Version, cfg.StateFile)
+	}
+	if s.Users != nil {
+		t.users = s.Users
+	}
+	return t, nil
+}
+
+// Users returns the number of users with fingerprints
+func (t *Tracker) Users() int {
+	return len(t.users)
+}
+
+// HandleEvents checks the logins of a batch (sink.SendFunc) and saves the state file when
+// fingerprints changed. Failed webhooks and saves are logged, so the returned error is always nil.
+func (t *Tracker) HandleEvents(ctx context.Context, batch []*collector.Event) error {
+	changed := false
+	for _, event := range batch {
+		if event.Type != "login" || event.Username == "" {
+			continue
+		}
+		if t.check(ctx, event) {
+			changed = true
+		}
+	}
+	if t.prune(time.Now()) {
+		changed = true
+	}
+	if changed && t.cfg.StateFile != "" {
+		if err := t.save(); err != nil {
+			log.Printf("Warning: Failed to save first-seen state: %v", err)
+		}
+	}
+	return nil
+}
+
+// check compares a login with the fingerprints of its user and records it. The first login
+// of a user (or the first with a kind, e.g. after GeoIP was enabled) only sets the baseline.
+func (t *Tracker) check(ctx context.Context, event *collector.Event) (changed bool) {
+	fp, known := t.users[event.Username]
+	if !known {
+		fp = make(fingerprints)
+		t.users[event.Username] = fp
+	}
+
+	for kind, value := range map[string]string{
+		KindCountry: country(event.CountryCode),
+		KindDevice:  event.ClientType,
+		KindSubnet:  subnet(event.ClientIP),
+	} {
+		if value == "" {
+			continue
+		}
+		seen, ok := fp[kind]
+		if !ok {
+			seen = make(map[string]time.Time)
+			fp[kind] = seen
+		}
+		if _, ok := seen[value]; !ok && len(seen) > 0 {
+			collector.FirstSeenTotal.WithLabelValues(event.Server, kind).Inc()
+			log.Printf("First login of user %q from %s %s on %s", event.Username, kind, value, event.Server)
+			if t.cfg.WebhookURL != "" {
+				if err := t.notify(ctx, kind, value, event); err != nil {
+					log.Printf("Warning: First-seen webhook failed: %v", err)
+				}
+			}
+		}
+		// A refreshed last-seen time is saved at most daily; that's precise enough for the retention
+		if last, ok := seen[value]; !ok || event.Time.Sub(last) > 24*time.Hour {
+			changed = true
+		}
+		seen[value] = event.Time
+	}
+	return changed
+}
+
+func (t *Tracker) notify(ctx context.Context, kind, value string, event *collector.Event) error {
+	body, err := json.Marshal(struct {
+		Kind  string           `json:"kind"`
+		Value string           `json:"value"`
+		Event *collector.Event `json:"event"`
+	}{kind, value, event})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.cfg.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// country returns the country code of a login, empty when GeoIP doesn't know it
+func country(code string) string {
+	if code == "XX" { // private address
+		return ""
+	}
+	return code
+}
+
+// subnet returns the subnet of a client address (/24 for IPv4, /48 for IPv6)
+func subnet(ip string) string {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return ""
+	}
+	if v4 := addr.To4(); v4 != nil {
+		return (&net.IPNet{IP: v4.Mask(net.CIDRMask(ipv4Prefix, 32)), Mask: net.CIDRMask(ipv4Prefix, 32)}).String()
+	}
+	return (&net.IPNet{IP: addr.Mask(net.CIDRMask(ipv6Prefix, 128)), Mask: net.CIDRMask(ipv6Prefix, 128)}).String()
+}
+
+// prune forgets fingerprints older than the retention, at most once an hour
+func (t *Tracker) prune(now time.Time) (changed bool) {
+	if now.Sub(t.pruned) < time.Hour {
+		return false
+	}
+	t.pruned = now
+
+	for username, fp := range t.users {
+		for kind, seen := range fp {
+			for value, last := range seen {
+				if now.Sub(last) > t.cfg.Retention {
+					delete(seen, value)
+					changed = true
+				}
+			}
+			if len(seen) == 0 {
+				delete(fp, kind)
+			}
+		}
+		if len(fp) == 0 {
+			delete(t.users, username)
+		}
+	}
+	return changed
+}
+
+// save writes the state file through a temporary file, so a crash never leaves a partial one
+func (t *Tracker) save() error {
+	data, err := json.Marshal(state{Version: stateVersion, Users: t.users})
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(t.cfg.StateFile)
+	f, err := os.CreateTemp(dir, "."+filepath.Base(t.cfg.StateFile)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), t.cfg.StateFile)
+}
@@ -0,0 +1,100 @@
+package firstseen
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/mogilevich/ocserv_exporter/internal/collector"
+)
+
+func login(ts time.Time, username, ip, countryCode, clientType string) *collector.Event {
+	return &collector.Event{Time: ts, Server: "s1", Type: "login", Username: username, ClientIP: ip,
+		CountryCode: countryCode, ClientType: clientType}
+}
+
+func TestFirstSeen(t *testing.T) {
+	collector.FirstSeenTotal.Reset()
+	var notified []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Kind  string `json:"kind"`
+			Value string `json:"value"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+		notified = append(notified, body.Kind+"="+body.Value)
+	}))
+	defer srv.Close()
+
+	state := filepath.Join(t.TempDir(), "firstseen.json")
+	tracker, err := New(Config{StateFile: state, WebhookURL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := time.Now().Add(-2 * time.Hour)
+	_ = tracker.HandleEvents(context.Background(), []*collector.Event{
+		login(ts, "alice", "198.51.100.7", "DE", "AnyConnect"), // baseline
+		login(ts, "alice", "198.51.100.200", "DE", "AnyConnect"),
+		login(ts, "alice", "10.0.0.1", "XX", ""), // new subnet, private address has no country
+		{Time: ts, Server: "s1", Type: "disconnect", Username: "alice", ClientIP: "203.0.113.1"},
+	})
+	if got := testutil.ToFloat64(collector.FirstSeenTotal.WithLabelValues("s1", KindSubnet)); got != 1 {
+		t.Errorf("subnet first-seen = %v, want 1", got)
+	}
+
+	// The state survives a restart
+	tracker, err = New(Config{StateFile: state, WebhookURL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tracker.Users() != 1 {
+		t.Fatalf("loaded %d users, want 1", tracker.Users())
+	}
+	_ = tracker.HandleEvents(context.Background(), []*collector.Event{
+		login(ts.Add(time.Hour), "alice", "198.51.100.9", "FR", "openconnect"),
+		login(ts.Add(time.Hour), "bob", "192.0.2.1", "FR", "openconnect"), // baseline
+	})
+	for kind, want := range map[string]float64{KindCountry: 1, KindDevice: 1, KindSubnet: 1} {
+		if got := testutil.ToFloat64(collector.FirstSeenTotal.WithLabelValues("s1", kind)); got != want {
+			t.Errorf("%s first-seen = %v, want %v", kind, got, want)
+		}
+	}
+	if len(notified) != 3 {
+		t.Errorf("webhook notifications %v, want 3", notified)
+	}
+}
+
+func TestRetention(t *testing.T) {
+	tracker, err := New(Config{Retention: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = tracker.HandleEvents(context.Background(), []*collector.Event{
+		login(time.Now().Add(-2*time.Hour), "alice", "198.51.100.7", "DE", "AnyConnect"),
+	})
+	if tracker.Users() != 0 {
+		t.Errorf("expired user kept")
+	}
+}
+
+func TestSubnet(t *testing.T) {
+	for ip, want := range map[string]string{
+		"198.51.100.7":         "198.51.100.0/24",
+		"2001:db8:1:2::1":      "2001:db8:1::/48",
+		"::ffff:198.51.100.77": "198.51.100.0/24",
+		"invalid":              "",
+	} {
+		if got := subnet(ip); got != want {
+			t.Errorf("subnet(%q) = %q, want %q", ip, got, want)
+		}
+	}
+}
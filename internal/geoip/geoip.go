@@ -3,23 +3,34 @@ package geoip
 import (
 	"log"
 	"net"
+	"strings"
+	"time"
 
 	"github.com/oschwald/geoip2-golang"
 )
 
 // Resolver provides GeoIP lookups using MaxMind GeoLite2 database
 type Resolver struct {
-	db *geoip2.Reader
+	db      *geoip2.Reader
+	hasCity bool // database has city-level location data (GeoLite2-City)
 }
 
 // NewResolver creates a new GeoIP resolver
-// dbPath should point to a GeoLite2-Country.mmdb file
+// dbPath should point to a GeoLite2-Country.mmdb or GeoLite2-City.mmdb file
 func NewResolver(dbPath string) (*Resolver, error) {
 	db, err := geoip2.Open(dbPath)
 	if err != nil {
 		return nil, err
 	}
-	return &Resolver{db: db}, nil
+	return &Resolver{
+		db:      db,
+		hasCity: strings.Contains(db.Metadata().DatabaseType, "City"),
+	}, nil
+}
+
+// BuildTime returns when the database was built (MaxMind updates GeoLite2 weekly)
+func (r *Resolver) BuildTime() time.Time {
+	return time.Unix(int64(r.db.Metadata().BuildEpoch), 0)
 }
 
 // Lookup returns country name and ISO code for an IP address
@@ -55,6 +66,30 @@ func (r *Resolver) Lookup(ipStr string) (country, countryCode string) {
 	return country, countryCode
 }
 
+// Locate returns approximate coordinates of an IP address
+// ok is false unless a City database is loaded and has a location for the address
+func (r *Resolver) Locate(ipStr string) (lat, lon float64, ok bool) {
+	if r.db == nil || !r.hasCity {
+		return 0, 0, false
+	}
+
+	ip := net.ParseIP(ipStr)
+	if ip == nil || ip.IsPrivate() || ip.IsLoopback() {
+		return 0, 0, false
+	}
+
+	record, err := r.db.City(ip)
+	if err != nil {
+		log.Printf("GeoIP city lookup error for %s: %v", ipStr, err)
+		return 0, 0, false
+	}
+	if record.Location.Latitude == 0 && record.Location.Longitude == 0 {
+		return 0, 0, false
+	}
+
+	return record.Location.Latitude, record.Location.Longitude, true
+}
+
 // Close closes the GeoIP database
 func (r *Resolver) Close() error {
 	if r.db != nil {
@@ -0,0 +1,161 @@
+package ha
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// consulSessionTTL is how long a Consul session lives without renewal; a crashed leader's lock
+// is released after it
+const consulSessionTTL = 15 * time.Second
+
+// ConsulConfig configures leader election with a Consul KV lock
+type ConsulConfig struct {
+	URL   string // Consul HTTP API, e.g. http://consul:8500
+	Key   string // KV key all instances lock
+	Token string // ACL token (optional)
+	Node  string // name stored as the key's value, shown in Consul
+}
+
+// Consul elects the instance holding a Consul KV lock: instances create a session with a TTL and
+// try to acquire the key with it. The leader renews its session; when it stops (crash, network
+// partition), Consul invalidates the session and releases the key after the TTL.
+type Consul struct {
+	role
+	cfg     ConsulConfig
+	client  *http.Client
+	session string
+}
+
+// NewConsul creates an elector using a Consul KV lock
+func NewConsul(cfg ConsulConfig) *Consul {
+	cfg.URL = strings.TrimSuffix(cfg.URL, "/")
+	return &Consul{
+		cfg:    cfg,
+		client: &http.Client{Timeout: retryInterval},
+	}
+}
+
+// Run campaigns until ctx is cancelled, then releases the lock and destroys the session
+func (c *Consul) Run(ctx context.Context) {
+	// Renew well within the TTL, and retry as fast as followers do
+	ticker := time.NewTicker(min(retryInterval, consulSessionTTL/3))
+	defer ticker.Stop()
+
+	failing := false
+	for {
+		leader, err := c.campaign(ctx)
+		if err != nil {
+			if !failing {
+				log.Printf("Warning: HA election via Consul failed: %v", err)
+			}
+			failing = true
+			// Without renewals Consul releases the lock after the TTL, and the other instance
+			// may take over; stop publishing before that
+			leader = false
+		} else {
+			failing = false
+		}
+		c.set(leader)
+
+		select {
+		case <-ctx.Done():
+			c.set(false)
+			c.release()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// campaign renews or creates the session and tries to acquire the lock with it
+func (c *Consul) campaign(ctx context.Context) (bool, error) {
+	if c.session != "" {
+		status, _, err := c.do(ctx, "/v1/session/renew/"+c.session, nil)
+		if err != nil {
+			return false, err
+		}
+		if status == http.StatusNotFound {
+			c.session = "" // expired, e.g. after a network partition
+		}
+	}
+	if c.session == "" {
+		var created struct{ ID string }
+		_, body, err := c.do(ctx, "/v1/session/create", map[string]string{
+			"Name":      "ocserv_exporter " + c.cfg.Node,
+			"TTL":       consulSessionTTL.String(),
+			"Behavior":  "release",
+			"LockDelay": "1s",
+		})
+		if err != nil {
+			return false, err
+		}
+		if err := json.Unmarshal(body, &created); err != nil || created.ID == "" {
+			return false, fmt.Errorf("unexpected session response %q", body)
+		}
+		c.session = created.ID
+	}
+
+	_, body, err := c.do(ctx, "/v1/kv/"+c.cfg.Key+"?acquire="+url.QueryEscape(c.session), c.cfg.Node)
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(string(body)) == "true", nil
+}
+
+// release hands the lock to the other instance right away instead of after the TTL
+func (c *Consul) release() {
+	if c.session == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), retryInterval)
+	defer cancel()
+	_, _, _ = c.do(ctx, "/v1/kv/"+c.cfg.Key+"?release="+url.QueryEscape(c.session), nil)
+	_, _, _ = c.do(ctx, "/v1/session/destroy/"+c.session, nil)
+	c.session = ""
+}
+
+// do sends a PUT request with a JSON (or, for strings, plain) body. Status codes other than
+// 200 and 404 are errors.
+func (c *Consul) do(ctx context.Context, path string, payload any) (int, []byte, error) {
+	var body io.Reader
+	switch p := payload.(type) {
+	case nil:
+	case string:
+		body = strings.NewReader(p)
+	default:
+		data, err := json.Marshal(p)
+		if err != nil {
+			return 0, nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.cfg.URL+path, body)
+	if err != nil {
+		return 0, nil, err
+	}
+	if c.cfg.Token != "" {
+		req.Header.Set("X-Consul-Token", c.cfg.Token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return 0, nil, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return resp.StatusCode, data, fmt.Errorf("%s: unexpected status %s: %s", path, resp.Status, strings.TrimSpace(string(data)))
+	}
+	return resp.StatusCode, data, nil
+}
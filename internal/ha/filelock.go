@@ -0,0 +1,56 @@
+package ha
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"time"
+)
+
+// errLocked is returned by tryLock when another instance holds the lock
+var errLocked = errors.New("locked by another instance")
+
+// FileLock elects the instance holding an exclusive lock on a file. The kernel releases the lock
+// when the leader exits or crashes, so failover takes at most retryInterval. The file must be on
+// a filesystem all instances share with working locks, e.g. a local disk for instances on one host.
+type FileLock struct {
+	role
+	path string
+}
+
+// NewFileLock creates an elector locking the file at path (created if missing)
+func NewFileLock(path string) *FileLock {
+	return &FileLock{path: path}
+}
+
+// Run tries to lock the file until it succeeds and holds the lock until ctx is cancelled
+func (l *FileLock) Run(ctx context.Context) {
+	ticker := time.NewTicker(retryInterval)
+	defer ticker.Stop()
+
+	warned := false
+	for {
+		file, err := os.OpenFile(l.path, os.O_RDWR|os.O_CREATE, 0o644)
+		if err == nil {
+			if err = tryLock(file); err == nil {
+				l.set(true)
+				<-ctx.Done()
+				l.set(false)
+				_ = file.Close() // releases the lock
+				return
+			}
+			_ = file.Close()
+		}
+		if !errors.Is(err, errLocked) && !warned {
+			log.Printf("Warning: Failed to lock HA lock file %s: %v", l.path, err)
+			warned = true
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
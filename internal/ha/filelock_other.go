@@ -0,0 +1,13 @@
+//go:build !unix
+
+package ha
+
+import (
+	"errors"
+	"os"
+)
+
+// tryLock is not available on non-Unix systems
+func tryLock(file *os.File) error {
+	return errors.New("file locks are only available on Unix systems")
+}
@@ -0,0 +1,90 @@
+// Package ha elects the leader of exporter instances reading the same ocserv sources. All
+// instances read the logs and poll occtl, so a follower has the same state when it takes over,
+// but only the leader publishes: its metrics, pushes and events.
+package ha
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/mogilevich/ocserv_exporter/internal/collector"
+)
+
+// retryInterval is the delay between attempts of a follower to become the leader
+const retryInterval = 5 * time.Second
+
+// Elector campaigns for the leadership of an HA group
+type Elector interface {
+	// Run campaigns until ctx is cancelled and releases the leadership on return
+	Run(ctx context.Context)
+	// IsLeader reports whether this instance currently is the leader
+	IsLeader() bool
+}
+
+// role tracks the leadership of an elector and reports changes
+type role struct {
+	leader atomic.Bool
+}
+
+func (r *role) IsLeader() bool {
+	return r.leader.Load()
+}
+
+func (r *role) set(leader bool) {
+	if r.leader.Swap(leader) == leader {
+		return
+	}
+	if leader {
+		log.Printf("Became HA leader, publishing metrics and events")
+		collector.HALeader.Set(1)
+	} else {
+		log.Printf("Lost HA leadership, no longer publishing metrics and events")
+		collector.HALeader.Set(0)
+	}
+	collector.HATransitionsTotal.Inc()
+}
+
+// Gatherer returns a gatherer handing out all metrics of g while isLeader reports true, else only
+// the exporter's own metrics (ocserv_exporter_*, go_*, process_*), so followers can be monitored
+// without their ocserv metrics being counted twice
+func Gatherer(g prometheus.Gatherer, isLeader func() bool) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		families, err := g.Gather()
+		if isLeader() {
+			return families, err
+		}
+		own := families[:0]
+		for _, family := range families {
+			if ownMetric(family.GetName()) {
+				own = append(own, family)
+			}
+		}
+		return own, err
+	})
+}
+
+func ownMetric(name string) bool {
+	return strings.HasPrefix(name, "ocserv_exporter_") || strings.HasPrefix(name, "go_") || strings.HasPrefix(name, "process_")
+}
+
+// Sink returns an event sink passing events to s only while isLeader reports true
+func Sink(s collector.EventSink, isLeader func() bool) collector.EventSink {
+	return leaderSink{sink: s, isLeader: isLeader}
+}
+
+type leaderSink struct {
+	sink     collector.EventSink
+	isLeader func() bool
+}
+
+func (s leaderSink) Send(event *collector.Event) {
+	if s.isLeader() {
+		s.sink.Send(event)
+	}
+}
@@ -0,0 +1,144 @@
+package ha
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// waitFor polls cond for up to a second
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestFileLockElectsOneLeader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "leader.lock")
+	first, second := NewFileLock(path), NewFileLock(path)
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	done1 := make(chan struct{})
+	go func() {
+		defer close(done1)
+		first.Run(ctx1)
+	}()
+	waitFor(t, "first leader", first.IsLeader)
+
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+	go second.Run(ctx2)
+	time.Sleep(50 * time.Millisecond)
+	if second.IsLeader() {
+		t.Fatal("second instance became leader while the first holds the lock")
+	}
+
+	cancel1()
+	<-done1
+	if first.IsLeader() {
+		t.Error("first instance still leader after shutdown")
+	}
+}
+
+func TestGathererFiltersFollowerMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		prometheus.NewGauge(prometheus.GaugeOpts{Name: "ocserv_active_sessions", Help: "h"}),
+		prometheus.NewGauge(prometheus.GaugeOpts{Name: "ocserv_exporter_ha_leader", Help: "h"}),
+	)
+	leader := false
+	g := Gatherer(reg, func() bool { return leader })
+
+	families, err := g.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(families) != 1 || families[0].GetName() != "ocserv_exporter_ha_leader" {
+		t.Errorf("follower gathered %v, want only ocserv_exporter_ha_leader", families)
+	}
+
+	leader = true
+	if families, _ := g.Gather(); len(families) != 2 {
+		t.Errorf("leader gathered %d families, want 2", len(families))
+	}
+}
+
+// fakeConsul grants the lock to the first session acquiring it
+type fakeConsul struct {
+	mu       sync.Mutex
+	sessions int
+	holder   string
+}
+
+func (f *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case r.URL.Path == "/v1/session/create":
+		f.sessions++
+		_, _ = io.WriteString(w, `{"ID":"session-`+strconv.Itoa(f.sessions)+`"}`)
+	case strings.HasPrefix(r.URL.Path, "/v1/session/"):
+	case r.URL.Query().Has("acquire"):
+		session := r.URL.Query().Get("acquire")
+		if f.holder == "" {
+			f.holder = session
+		}
+		_, _ = io.WriteString(w, map[bool]string{true: "true", false: "false"}[f.holder == session])
+	case r.URL.Query().Has("release"):
+		if f.holder == r.URL.Query().Get("release") {
+			f.holder = ""
+		}
+		_, _ = io.WriteString(w, "true")
+	}
+}
+
+func TestConsulElectsOneLeader(t *testing.T) {
+	consul := &fakeConsul{}
+	server := httptest.NewServer(consul)
+	defer server.Close()
+
+	cfg := ConsulConfig{URL: server.URL, Key: "ocserv_exporter/leader"}
+	first, second := NewConsul(cfg), NewConsul(cfg)
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	done1 := make(chan struct{})
+	go func() {
+		defer close(done1)
+		first.Run(ctx1)
+	}()
+	waitFor(t, "first leader", first.IsLeader)
+
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+	go second.Run(ctx2)
+	waitFor(t, "second session", func() bool {
+		consul.mu.Lock()
+		defer consul.mu.Unlock()
+		return consul.sessions == 2
+	})
+	if second.IsLeader() {
+		t.Fatal("second instance became leader while the first holds the lock")
+	}
+
+	cancel1()
+	<-done1
+	consul.mu.Lock()
+	defer consul.mu.Unlock()
+	if consul.holder != "" {
+		t.Errorf("lock still held by %s after shutdown", consul.holder)
+	}
+}
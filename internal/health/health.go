@@ -0,0 +1,190 @@
+// Package health tracks the status of the exporter's components for the /healthz endpoint.
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Component states
+const (
+	StatusOK      = "ok"
+	StatusFailing = "failing"
+)
+
+// Overall states
+const (
+	OverallOK       = "ok"
+	OverallDegraded = "degraded" // a non-critical component is failing
+	OverallFailing  = "failing"  // a critical component is failing (HTTP 503)
+)
+
+// Checker collects component states and serves them as JSON
+type Checker struct {
+	version string
+	start   time.Time
+	now     func() time.Time
+
+	mu         sync.Mutex
+	components map[string]*Component
+}
+
+// New creates a checker
+func New(version string) *Checker {
+	return &Checker{
+		version:    version,
+		start:      time.Now(),
+		now:        time.Now,
+		components: make(map[string]*Component),
+	}
+}
+
+// Component returns the named component, registering it on first use.
+// A failing critical component makes the whole exporter unhealthy (503).
+// With staleAfter > 0 the component also fails when it had no success for that long.
+func (c *Checker) Component(name string, critical bool, staleAfter time.Duration) *Component {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	comp, ok := c.components[name]
+	if !ok {
+		comp = &Component{critical: critical, staleAfter: staleAfter, details: make(map[string]any), now: c.now}
+		c.components[name] = comp
+	}
+	return comp
+}
+
+// Component is the state of one part of the exporter (journal reader, occtl server, ...)
+type Component struct {
+	critical   bool
+	staleAfter time.Duration
+	now        func() time.Time
+
+	mu          sync.Mutex
+	lastSuccess time.Time
+	lastError   string
+	lastErrorAt time.Time
+	failing     bool
+	details     map[string]any
+}
+
+// Success records a successful operation
+func (c *Component) Success() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastSuccess = c.now()
+	c.failing = false
+}
+
+// Failure records a failed operation
+func (c *Component) Failure(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastError = err.Error()
+	c.lastErrorAt = c.now()
+	c.failing = true
+}
+
+// SetDetail sets an informational value shown with the component.
+// A func() any value is evaluated on every report (e.g. ages).
+func (c *Component) SetDetail(key string, value any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.details[key] = value
+}
+
+// componentReport is the JSON form of a component
+type componentReport struct {
+	Status      string         `json:"status"`
+	Critical    bool           `json:"critical"`
+	LastSuccess *time.Time     `json:"last_success,omitempty"`
+	LastError   string         `json:"last_error,omitempty"`
+	LastErrorAt *time.Time     `json:"last_error_at,omitempty"`
+	Details     map[string]any `json:"details,omitempty"`
+}
+
+func (c *Component) report(now time.Time) componentReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	r := componentReport{Status: StatusOK, Critical: c.critical, LastError: c.lastError}
+	if !c.lastSuccess.IsZero() {
+		t := c.lastSuccess
+		r.LastSuccess = &t
+	}
+	if !c.lastErrorAt.IsZero() {
+		t := c.lastErrorAt
+		r.LastErrorAt = &t
+	}
+	if c.failing || (c.staleAfter > 0 && !c.lastSuccess.IsZero() && now.Sub(c.lastSuccess) > c.staleAfter) {
+		r.Status = StatusFailing
+	}
+	if len(c.details) > 0 {
+		r.Details = make(map[string]any, len(c.details))
+		for k, v := range c.details {
+			if f, ok := v.(func() any); ok {
+				v = f()
+			}
+			r.Details[k] = v
+		}
+	}
+	return r
+}
+
+// Report is the /healthz document
+type Report struct {
+	Status        string                     `json:"status"`
+	Version       string                     `json:"version"`
+	UptimeSeconds float64                    `json:"uptime_seconds"`
+	Components    map[string]componentReport `json:"components"`
+	Failing       []string                   `json:"failing,omitempty"`
+}
+
+// Report evaluates all components
+func (c *Checker) Report() Report {
+	now := c.now()
+
+	c.mu.Lock()
+	components := make(map[string]*Component, len(c.components))
+	for name, comp := range c.components {
+		components[name] = comp
+	}
+	c.mu.Unlock()
+
+	r := Report{
+		Status:        OverallOK,
+		Version:       c.version,
+		UptimeSeconds: now.Sub(c.start).Seconds(),
+		Components:    make(map[string]componentReport, len(components)),
+	}
+	for name, comp := range components {
+		cr := comp.report(now)
+		r.Components[name] = cr
+		if cr.Status != StatusFailing {
+			continue
+		}
+		r.Failing = append(r.Failing, name)
+		if cr.Critical {
+			r.Status = OverallFailing
+		} else if r.Status == OverallOK {
+			r.Status = OverallDegraded
+		}
+	}
+	sort.Strings(r.Failing)
+	return r
+}
+
+// ServeHTTP serves the report as JSON, with status 503 when a critical component is failing
+func (c *Checker) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	report := c.Report()
+	w.Header().Set("Content-Type", "application/json")
+	if report.Status == OverallFailing {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(report)
+}
@@ -0,0 +1,62 @@
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealthz(t *testing.T) {
+	now := time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC)
+	c := New("1.0.0")
+	c.now = func() time.Time { return now }
+
+	journal := c.Component("journal", true, 0)
+	occtl := c.Component("occtl/ocserv", false, time.Minute)
+	journal.Success()
+	occtl.Success()
+	occtl.SetDetail("age", func() any { return now.Year() })
+
+	get := func() (int, Report) {
+		rec := httptest.NewRecorder()
+		c.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		var r Report
+		if err := json.NewDecoder(rec.Body).Decode(&r); err != nil {
+			t.Fatal(err)
+		}
+		return rec.Code, r
+	}
+
+	if code, r := get(); code != http.StatusOK || r.Status != OverallOK {
+		t.Errorf("healthy: got %d %s", code, r.Status)
+	}
+	if _, r := get(); r.Components["occtl/ocserv"].Details["age"] != float64(2024) {
+		t.Errorf("detail func not evaluated: %+v", r.Components["occtl/ocserv"].Details)
+	}
+
+	// Stale non-critical component: degraded, still 200
+	now = now.Add(2 * time.Minute)
+	if code, r := get(); code != http.StatusOK || r.Status != OverallDegraded || r.Failing[0] != "occtl/ocserv" {
+		t.Errorf("stale occtl: got %d %+v", code, r)
+	}
+
+	// Failing critical component: 503
+	journal.Failure(errors.New("permission denied"))
+	code, r := get()
+	if code != http.StatusServiceUnavailable || r.Status != OverallFailing {
+		t.Errorf("failing journal: got %d %s", code, r.Status)
+	}
+	if r.Components["journal"].LastError != "permission denied" {
+		t.Errorf("last error not reported: %+v", r.Components["journal"])
+	}
+
+	// Recovery
+	journal.Success()
+	occtl.Success()
+	if code, r := get(); code != http.StatusOK || r.Status != OverallOK {
+		t.Errorf("recovered: got %d %s", code, r.Status)
+	}
+}
@@ -0,0 +1,81 @@
+package journal
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultContainerUnit is the server name of container log lines without a "program[pid]:" prefix
+const DefaultContainerUnit = "ocserv"
+
+// containerMessageRegex matches "program[pid]: message" as written by ocserv to stderr
+func containerMessageRegex(program string) *regexp.Regexp {
+	return regexp.MustCompile(`^(?P<program>` + program + `)\[\d+\]:\s+(?P<message>.+)$`)
+}
+
+// dockerLine is a line of the Docker json-file log driver
+type dockerLine struct {
+	Log  string    `json:"log"`
+	Time time.Time `json:"time"`
+}
+
+// parseDockerLine parses a Docker json-file line:
+// {"log":"ocserv[7]: main: ...\n","stream":"stderr","time":"2024-05-02T10:15:04.123456789Z"}
+// Lines longer than 16KB are split by Docker; parts without a trailing newline are joined.
+func (r *FileReader) parseDockerLine(line string) *Entry {
+	var dl dockerLine
+	if err := json.Unmarshal([]byte(line), &dl); err != nil {
+		return nil
+	}
+	message, complete := strings.CutSuffix(dl.Log, "\n")
+	return r.containerEntry(dl.Time, message, complete)
+}
+
+// parseCRILine parses a CRI (containerd, CRI-O) log line:
+// 2024-05-02T10:15:04.123456789Z stderr F ocserv[7]: main: ...
+// The tag is F for a full line or P for a part of a line split by the runtime.
+func (r *FileReader) parseCRILine(line string) *Entry {
+	fields := strings.SplitN(line, " ", 4)
+	if len(fields) < 3 {
+		return nil
+	}
+	ts, err := time.Parse(time.RFC3339Nano, fields[0])
+	if err != nil {
+		return nil
+	}
+	message := ""
+	if len(fields) == 4 {
+		message = fields[3]
+	}
+	return r.containerEntry(ts, message, !strings.HasPrefix(fields[2], "P"))
+}
+
+// containerEntry joins split container lines and extracts the ocserv message;
+// nil until a line is complete or if it is not an ocserv line
+func (r *FileReader) containerEntry(ts time.Time, message string, complete bool) *Entry {
+	if r.container.Len() == 0 {
+		r.containerTS = ts
+	}
+	r.container.WriteString(message)
+	if !complete {
+		return nil
+	}
+	message = strings.TrimRight(r.container.String(), "\r")
+	ts = r.containerTS
+	r.container.Reset()
+
+	if message == "" {
+		return nil
+	}
+	if m := r.reMessage.FindStringSubmatch(message); m != nil {
+		return &Entry{
+			Timestamp: ts,
+			Message:   m[r.reMessage.SubexpIndex("message")],
+			Unit:      m[r.reMessage.SubexpIndex("program")],
+		}
+	}
+	// ocserv without a program prefix (e.g. logging to stderr in foreground mode)
+	return &Entry{Timestamp: ts, Message: message, Unit: DefaultContainerUnit}
+}
@@ -3,63 +3,266 @@ package journal
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"regexp"
+	"slices"
+	"strings"
 	"time"
 )
 
-// FileReader reads log entries from a file (tail -f style)
+// Timestamp formats of FileOptions.TimestampFormat (anything else is a Go time layout)
+const (
+	TimestampAuto    = "auto"    // detect per line
+	TimestampSyslog  = "syslog"  // classic BSD syslog: "Feb  3 07:46:56" (no year)
+	TimestampRFC3339 = "rfc3339" // RFC3339 / ISO8601, optional fraction and zone (rsyslog high precision)
+)
+
+// isoLayouts are tried for single-field ISO8601 timestamps (RFC3339, rsyslog high precision)
+var isoLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999Z0700",
+	"2006-01-02T15:04:05.999999999",
+}
+
+// isoSpaceLayouts are tried for ISO8601 timestamps with a space between date and time
+var isoSpaceLayouts = []string{
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999Z0700",
+	"2006-01-02 15:04:05.999999999",
+}
+
+const syslogLayout = "Jan 2 15:04:05 2006"
+
+// DefaultProgramRegex matches the syslog program names of ocserv instances (ocserv, ocserv-ru, ...)
+const DefaultProgramRegex = `ocserv[^\[]*`
+
+// reSyslogLine matches a line after the timestamp: hostname ocserv[pid]: message
+// or: hostname ocserv-ru[pid]: message
+var reSyslogLine = syslogLineRegex(DefaultProgramRegex)
+
+// syslogLineRegex builds the line regex for a program name pattern
+func syslogLineRegex(program string) *regexp.Regexp {
+	return regexp.MustCompile(`^\S+\s+(?P<program>` + program + `)\[\d+\]:\s+(?P<message>.+)$`)
+}
+
+// Log line formats of FileOptions.Format
+const (
+	FormatSyslog = "syslog" // syslog text lines (default)
+	FormatDocker = "docker" // Docker json-file driver
+	FormatCRI    = "cri"    // containerd / CRI-O (Kubernetes /var/log/pods)
+	FormatStderr = "stderr" // ocserv's stderr redirected to a file, timestamped when read
+)
+
+// Formats are the supported values of FileOptions.Format
+var Formats = []string{FormatSyslog, FormatDocker, FormatCRI, FormatStderr}
+
+// FileOptions configures how log lines are parsed
+type FileOptions struct {
+	Format          string // syslog (default), docker, cri or stderr
+	TimestampFormat string // auto (default), syslog, rfc3339 or a Go time layout (syslog format only)
+	ProgramRegex    string // syslog program names to accept (default DefaultProgramRegex)
+	Once            bool   // read files to their end (io.EOF) instead of following them
+}
+
+// FileReader reads log entries from a file (tail -f style) or a stream such as stdin
 type FileReader struct {
-	file    *os.File
-	scanner *bufio.Scanner
-	reTime  *regexp.Regexp
+	file    io.Closer
+	reader  *bufio.Reader
+	follow  bool   // at EOF wait for appended lines (files) instead of ending (streams)
+	partial string // incomplete last line, completed by the next write
+	input   string // line format (one of Formats)
+	format  string // timestamp format of syslog lines
+	reLine  *regexp.Regexp
+	now     func() time.Time
+
+	// Container formats
+	reMessage   *regexp.Regexp  // "program[pid]: message" inside a container log line
+	containerTS time.Time       // timestamp of the first part of a split container line
+	container   strings.Builder // parts of a container line split by the runtime
 }
 
 // NewFileReader creates a new file reader
-// If follow is true, it will wait for new lines (like tail -f)
-func NewFileReader(path string) (*FileReader, error) {
+func NewFileReader(path string, opts FileOptions) (*FileReader, error) {
 	f, err := os.Open(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
+	r, err := newReader(f, opts)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	r.follow = !opts.Once
+	return r, nil
+}
+
+// NewStdinReader creates a reader for log lines piped to stdin (e.g. journalctl -f -u ocserv).
+// Read returns io.EOF when the writer closes the pipe.
+func NewStdinReader(opts FileOptions) (*FileReader, error) {
+	return newReader(os.Stdin, opts)
+}
+
+// newReader creates a reader for log lines from f
+func newReader(f io.ReadCloser, opts FileOptions) (*FileReader, error) {
+	if opts.Format == "" {
+		opts.Format = FormatSyslog
+	}
+	if !slices.Contains(Formats, opts.Format) {
+		return nil, fmt.Errorf("unsupported log format %q (%s)", opts.Format, strings.Join(Formats, ", "))
+	}
+	if opts.TimestampFormat == "" {
+		opts.TimestampFormat = TimestampAuto
+	}
+	if opts.ProgramRegex == "" {
+		opts.ProgramRegex = DefaultProgramRegex
+	}
+	reLine := reSyslogLine
+	if opts.ProgramRegex != DefaultProgramRegex {
+		if _, err := regexp.Compile(opts.ProgramRegex); err != nil {
+			return nil, fmt.Errorf("invalid program regex: %w", err)
+		}
+		reLine = syslogLineRegex(opts.ProgramRegex)
+	}
 
 	return &FileReader{
-		file:    f,
-		scanner: bufio.NewScanner(f),
-		// Match: Feb 03 07:46:56 hostname ocserv[pid]: message
-		// or:    Feb 03 07:46:56 hostname ocserv-ru[pid]: message
-		reTime: regexp.MustCompile(`^(\w{3}\s+\d{1,2}\s+\d{2}:\d{2}:\d{2})\s+\S+\s+(ocserv[^\[]*)\[\d+\]:\s+(.+)$`),
+		file:      f,
+		reader:    bufio.NewReader(f),
+		input:     opts.Format,
+		format:    opts.TimestampFormat,
+		reLine:    reLine,
+		reMessage: containerMessageRegex(opts.ProgramRegex),
+		now:       time.Now,
 	}, nil
 }
 
-// Read returns the next log entry
+// Read returns the next log entry, or nil at the end of a file (call again to follow appended lines).
+// Streams block until a line arrives and return io.EOF when closed.
 func (r *FileReader) Read() (*Entry, error) {
-	for r.scanner.Scan() {
-		line := r.scanner.Text()
+	for {
+		chunk, err := r.reader.ReadString('\n')
+		if err == io.EOF && r.follow {
+			r.partial += chunk
+			return nil, nil // EOF
+		}
+		if err == io.EOF && chunk != "" {
+			err = nil // last line without newline
+		}
+		if err != nil {
+			return nil, err
+		}
+		line := strings.TrimRight(r.partial+chunk, "\r\n")
+		r.partial = ""
 
-		matches := r.reTime.FindStringSubmatch(line)
-		if matches == nil {
-			continue
+		var entry *Entry
+		switch r.input {
+		case FormatDocker:
+			entry = r.parseDockerLine(line)
+		case FormatCRI:
+			entry = r.parseCRILine(line)
+		case FormatStderr:
+			// The lines carry no timestamp
+			entry = r.containerEntry(r.now(), line, true)
+		default:
+			entry = r.parseLine(line)
+		}
+		if entry != nil {
+			return entry, nil
 		}
+	}
+}
 
-		// Parse timestamp (use current year since syslog doesn't include it)
-		ts, err := time.Parse("Jan 02 15:04:05 2006", matches[1]+" "+fmt.Sprint(time.Now().Year()))
-		if err != nil {
-			ts = time.Now()
+// parseLine parses a syslog line, nil if it is not an ocserv line
+func (r *FileReader) parseLine(line string) *Entry {
+	ts, rest, ok := r.parseTimestamp(line)
+	if !ok {
+		return nil
+	}
+	matches := r.reLine.FindStringSubmatch(rest)
+	if matches == nil {
+		return nil
+	}
+	return &Entry{
+		Timestamp: ts,
+		Message:   matches[r.reLine.SubexpIndex("message")],
+		Unit:      matches[r.reLine.SubexpIndex("program")], // e.g., "ocserv" or "ocserv-ru"
+	}
+}
+
+// parseTimestamp parses the timestamp at the start of line and returns the rest of the line
+func (r *FileReader) parseTimestamp(line string) (time.Time, string, bool) {
+	switch r.format {
+	case TimestampAuto:
+		if line != "" && line[0] >= '0' && line[0] <= '9' {
+			return parseISO(line)
 		}
+		return r.parseSyslog(line)
+	case TimestampSyslog:
+		return r.parseSyslog(line)
+	case TimestampRFC3339:
+		return parseISO(line)
+	}
+	return parseFields(line, len(strings.Fields(r.format)), []string{r.format})
+}
 
-		return &Entry{
-			Timestamp: ts,
-			Message:   matches[3],
-			Unit:      matches[2], // e.g., "ocserv" or "ocserv-ru"
-		}, nil
+// parseISO parses an ISO8601 timestamp with T or a space between date and time
+func parseISO(line string) (time.Time, string, bool) {
+	if ts, rest, ok := parseFields(line, 1, isoLayouts); ok {
+		return ts, rest, true
 	}
+	return parseFields(line, 2, isoSpaceLayouts)
+}
 
-	if err := r.scanner.Err(); err != nil {
-		return nil, err
+// parseSyslog parses a classic syslog timestamp, which has no year: the current year is assumed,
+// or the previous one for timestamps in the future (lines from December read in January)
+func (r *FileReader) parseSyslog(line string) (time.Time, string, bool) {
+	now := r.now()
+	ts, rest, ok := parseFields(line, 3, nil)
+	if !ok {
+		return time.Time{}, "", false
+	}
+	parsed, err := time.ParseInLocation(syslogLayout, ts.Format("Jan 2 15:04:05")+" "+fmt.Sprint(now.Year()), time.Local)
+	if err != nil {
+		return time.Time{}, "", false
+	}
+	if parsed.After(now.Add(24 * time.Hour)) {
+		parsed = parsed.AddDate(-1, 0, 0)
+	}
+	return parsed, rest, true
+}
+
+// parseFields parses the first n whitespace-separated fields of line with the first matching layout
+// (zone-less layouts are local time) and returns the rest of the line.
+// Without layouts the fields are parsed as a yearless syslog timestamp.
+func parseFields(line string, n int, layouts []string) (time.Time, string, bool) {
+	fields := make([]string, 0, n)
+	rest := line
+	for i := 0; i < n; i++ {
+		rest = strings.TrimLeft(rest, " \t")
+		end := strings.IndexAny(rest, " \t")
+		if end <= 0 {
+			return time.Time{}, "", false
+		}
+		fields = append(fields, rest[:end])
+		rest = rest[end:]
 	}
+	value := strings.Join(fields, " ")
+	rest = strings.TrimLeft(rest, " \t")
 
-	return nil, nil // EOF
+	if layouts == nil {
+		// Year 0 placeholder; parseSyslog supplies the year
+		ts, err := time.Parse("Jan 2 15:04:05", value)
+		return ts, rest, err == nil
+	}
+
+	// rsyslog and some ISO8601 writers use a comma as decimal separator
+	value = strings.Replace(value, ",", ".", 1)
+	for _, layout := range layouts {
+		if ts, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return ts, rest, true
+		}
+	}
+	return time.Time{}, "", false
 }
 
 // Close closes the file reader
@@ -0,0 +1,153 @@
+package journal
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTimestampFormats(t *testing.T) {
+	jan2 := time.Date(2025, 1, 2, 12, 0, 0, 0, time.Local)
+	r := &FileReader{format: TimestampAuto, reLine: reSyslogLine, now: func() time.Time { return jan2 }}
+
+	tests := []struct {
+		line string
+		want time.Time
+	}{
+		{"Jan  2 07:46:56 vpn ocserv[123]: main: msg", time.Date(2025, 1, 2, 7, 46, 56, 0, time.Local)},
+		// Year rollover: December lines read in January belong to the previous year
+		{"Dec 31 23:59:59 vpn ocserv[123]: main: msg", time.Date(2024, 12, 31, 23, 59, 59, 0, time.Local)},
+		{"2025-01-02T07:46:56Z vpn ocserv[123]: main: msg", time.Date(2025, 1, 2, 7, 46, 56, 0, time.UTC)},
+		{"2025-01-02T07:46:56.123456+03:00 vpn ocserv[123]: main: msg", time.Date(2025, 1, 2, 4, 46, 56, 123456000, time.UTC)},
+		{"2025-01-02T07:46:56.123+0300 vpn ocserv[123]: main: msg", time.Date(2025, 1, 2, 4, 46, 56, 123000000, time.UTC)},
+		{"2025-01-02 07:46:56,5 vpn ocserv[123]: main: msg", time.Date(2025, 1, 2, 7, 46, 56, 500000000, time.Local)},
+	}
+	for _, tt := range tests {
+		entry := r.parseLine(tt.line)
+		if entry == nil {
+			t.Errorf("parseLine(%q) = nil", tt.line)
+			continue
+		}
+		if !entry.Timestamp.Equal(tt.want) || entry.Message != "main: msg" || entry.Unit != "ocserv" {
+			t.Errorf("parseLine(%q) = %v %q %q, want %v", tt.line, entry.Timestamp, entry.Unit, entry.Message, tt.want)
+		}
+	}
+
+	// Explicit formats only accept their own format
+	r.format = TimestampSyslog
+	if r.parseLine("2025-01-02T07:46:56Z vpn ocserv[123]: main: msg") != nil {
+		t.Error("syslog format accepted an RFC3339 line")
+	}
+	r.format = "02/01/2006 15:04:05"
+	if entry := r.parseLine("02/01/2025 07:46:56 vpn ocserv[1]: main: msg"); entry == nil || entry.Timestamp.Day() != 2 {
+		t.Errorf("custom layout: got %+v", entry)
+	}
+}
+
+func TestProgramRegex(t *testing.T) {
+	r := &FileReader{format: TimestampAuto, reLine: syslogLineRegex(`openconnect-server|oc-(corp|lab)`), now: time.Now}
+
+	for line, unit := range map[string]string{
+		"2025-01-02T07:46:56Z vpn openconnect-server[1]: main: msg": "openconnect-server",
+		"2025-01-02T07:46:56Z vpn oc-corp[1]: main: msg":            "oc-corp",
+		"2025-01-02T07:46:56Z vpn ocserv[1]: main: msg":             "",
+	} {
+		entry := r.parseLine(line)
+		switch {
+		case unit == "" && entry != nil:
+			t.Errorf("parseLine(%q) accepted a program outside the regex", line)
+		case unit != "" && (entry == nil || entry.Unit != unit || entry.Message != "main: msg"):
+			t.Errorf("parseLine(%q) = %+v, want unit %q", line, entry, unit)
+		}
+	}
+}
+
+func TestContainerFormats(t *testing.T) {
+	r := &FileReader{reMessage: containerMessageRegex(DefaultProgramRegex)}
+	want := time.Date(2024, 5, 2, 10, 15, 4, 123456789, time.UTC)
+
+	entry := r.parseDockerLine(`{"log":"ocserv[7]: main[bob]:203.0.113.7:51234 user logged in\n","stream":"stderr","time":"2024-05-02T10:15:04.123456789Z"}`)
+	if entry == nil || !entry.Timestamp.Equal(want) || entry.Unit != "ocserv" || entry.Message != "main[bob]:203.0.113.7:51234 user logged in" {
+		t.Errorf("docker: got %+v", entry)
+	}
+
+	// Split by the runtime: P parts are joined until the F part, with the first part's timestamp
+	if r.parseCRILine("2024-05-02T10:15:04.123456789Z stderr P main[bob]:203.0.113.7:51234 ") != nil {
+		t.Error("cri: partial line returned an entry")
+	}
+	entry = r.parseCRILine("2024-05-02T10:15:05Z stderr F user logged in")
+	if entry == nil || !entry.Timestamp.Equal(want) || entry.Unit != DefaultContainerUnit || entry.Message != "main[bob]:203.0.113.7:51234 user logged in" {
+		t.Errorf("cri: got %+v", entry)
+	}
+
+	if r.parseDockerLine("not json") != nil || r.parseCRILine("garbage") != nil {
+		t.Error("invalid lines returned entries")
+	}
+
+	// stderr lines are timestamped when read
+	stderr, err := newReader(io.NopCloser(strings.NewReader("ocserv[7]: main[bob]:203.0.113.7:51234 user logged in\n\n")), FileOptions{Format: FormatStderr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr.now = func() time.Time { return want }
+	entry, err = stderr.Read()
+	if err != nil || entry == nil || !entry.Timestamp.Equal(want) || entry.Unit != "ocserv" || entry.Message != "main[bob]:203.0.113.7:51234 user logged in" {
+		t.Errorf("stderr: got %+v, %v", entry, err)
+	}
+	if entry, err := stderr.Read(); err != io.EOF {
+		t.Errorf("stderr: empty line returned %+v, %v", entry, err)
+	}
+}
+
+func TestPipedInputEOF(t *testing.T) {
+	input := "2025-01-02T07:46:56Z vpn ocserv[1]: main: first\n2025-01-02T07:46:57Z vpn ocserv[1]: main: last"
+	r, err := newReader(io.NopCloser(strings.NewReader(input)), FileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The final line has no newline but must not be lost when the pipe closes
+	for _, want := range []string{"main: first", "main: last"} {
+		entry, err := r.Read()
+		if err != nil || entry == nil || entry.Message != want {
+			t.Fatalf("Read() = %+v, %v, want %q", entry, err, want)
+		}
+	}
+	if _, err := r.Read(); !errors.Is(err, io.EOF) {
+		t.Errorf("Read() after end of input = %v, want io.EOF", err)
+	}
+}
+
+func TestMultiFileReaderOnce(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.log", "b.log"} {
+		line := "2025-01-02T07:46:56Z vpn ocserv[1]: main: " + name + "\n"
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(line), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, err := NewMultiFileReader([]string{filepath.Join(dir, "*.log")}, nil, FileOptions{Once: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	seen := 0
+	for {
+		entry, err := m.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil || entry == nil {
+			t.Fatalf("Read() = %+v, %v", entry, err)
+		}
+		seen++
+	}
+	if seen != 2 {
+		t.Errorf("read %d entries before io.EOF, want 2", seen)
+	}
+}
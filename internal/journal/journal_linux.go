@@ -4,6 +4,9 @@ package journal
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -14,28 +17,44 @@ import (
 type JournalReader struct {
 	journal *sdjournal.Journal
 	units   []string
+	once    bool // end at the current end of the journal
 }
 
 // NewJournalReader creates a new journal reader for the specified units
-func NewJournalReader(units []string, since time.Duration) (*JournalReader, error) {
-	j, err := sdjournal.NewJournal()
+func NewJournalReader(units []string, since time.Duration, opts JournalOptions) (*JournalReader, error) {
+	matches, err := ParseMatches(opts.Matches)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open journal: %w", err)
+		return nil, err
 	}
 
 	// Filter by _SYSTEMD_UNIT (OR between units)
 	// Note: We use _SYSTEMD_UNIT instead of SYSLOG_IDENTIFIER because ocserv
 	// uses hardcoded "ocserv" as syslog identifier regardless of SyslogIdentifier= setting.
-	for i, unit := range units {
+	var groups [][]string
+	for _, unit := range units {
 		// Strip .service suffix if present (for backward compatibility)
 		unit = strings.TrimSuffix(unit, ".service")
-		match := "_SYSTEMD_UNIT=" + unit + ".service"
-		if err := j.AddMatch(match); err != nil {
-			_ = j.Close()
-			return nil, fmt.Errorf("failed to add match for %s: %w", unit, err)
+		groups = append(groups, []string{"_SYSTEMD_UNIT=" + unit + ".service"})
+	}
+	groups = append(groups, matches...)
+	if len(groups) == 0 {
+		return nil, fmt.Errorf("no journal units or matches configured")
+	}
+
+	j, err := openJournal(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal: %w", err)
+	}
+
+	for i, group := range groups {
+		for _, match := range group {
+			if err := j.AddMatch(match); err != nil {
+				_ = j.Close()
+				return nil, fmt.Errorf("failed to add match %s: %w", match, err)
+			}
 		}
-		// Add disjunction (OR) between units
-		if i < len(units)-1 {
+		// Add disjunction (OR) between units and match expressions
+		if i < len(groups)-1 {
 			if err := j.AddDisjunction(); err != nil {
 				_ = j.Close()
 				return nil, fmt.Errorf("failed to add disjunction: %w", err)
@@ -62,9 +81,48 @@ func NewJournalReader(units []string, since time.Duration) (*JournalReader, erro
 	return &JournalReader{
 		journal: j,
 		units:   units,
+		once:    opts.Once,
 	}, nil
 }
 
+// openJournal opens the system journal, a namespace or a directory
+func openJournal(opts JournalOptions) (*sdjournal.Journal, error) {
+	switch {
+	case opts.Namespace != "" && opts.Directory != "":
+		return nil, fmt.Errorf("namespace and directory are mutually exclusive")
+	case opts.Directory != "":
+		return sdjournal.NewJournalFromDir(opts.Directory)
+	case opts.Namespace != "":
+		// go-systemd has no binding for sd_journal_open_namespace, so open the
+		// namespace's directory directly
+		dir, err := namespaceDir(opts.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		return sdjournal.NewJournalFromDir(dir)
+	default:
+		return sdjournal.NewJournal()
+	}
+}
+
+// namespaceDir returns the directory journald writes a namespace to:
+// <machine-id>.<namespace> in /var/log/journal (persistent) or
+// /run/log/journal (volatile)
+func namespaceDir(namespace string) (string, error) {
+	id, err := os.ReadFile("/etc/machine-id")
+	if err != nil {
+		return "", fmt.Errorf("failed to read machine id: %w", err)
+	}
+	name := strings.TrimSpace(string(id)) + "." + namespace
+	for _, root := range []string{"/var/log/journal", "/run/log/journal"} {
+		dir := filepath.Join(root, name)
+		if _, err := os.Stat(dir); err == nil {
+			return dir, nil
+		}
+	}
+	return "", fmt.Errorf("no journal found for namespace %q", namespace)
+}
+
 // Read returns the next log entry
 func (r *JournalReader) Read() (*Entry, error) {
 	for {
@@ -75,6 +133,9 @@ func (r *JournalReader) Read() (*Entry, error) {
 		}
 
 		if n == 0 {
+			if r.once {
+				return nil, io.EOF
+			}
 			// No more entries, wait for new ones
 			r.journal.Wait(sdjournal.IndefiniteWait)
 			continue
@@ -94,6 +155,10 @@ func (r *JournalReader) Read() (*Entry, error) {
 		// Get systemd unit name (e.g., "ocserv.service" or "ocserv-ru.service")
 		// We use _SYSTEMD_UNIT because ocserv uses hardcoded "ocserv" as SYSLOG_IDENTIFIER
 		unit := strings.TrimSuffix(entry.Fields["_SYSTEMD_UNIT"], ".service")
+		if unit == "" {
+			// Entries selected by --journal.match need not come from a unit
+			unit = entry.Fields[sdjournal.SD_JOURNAL_FIELD_SYSLOG_IDENTIFIER]
+		}
 
 		timestamp := time.Unix(0, int64(entry.RealtimeTimestamp)*1000)
 
@@ -11,7 +11,7 @@ import (
 type JournalReader struct{}
 
 // NewJournalReader returns an error on non-Linux systems
-func NewJournalReader(units []string, since time.Duration) (*JournalReader, error) {
+func NewJournalReader(units []string, since time.Duration, opts JournalOptions) (*JournalReader, error) {
 	return nil, errors.New("journald is only available on Linux")
 }
 
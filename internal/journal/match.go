@@ -0,0 +1,40 @@
+package journal
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// reField matches valid journal field names
+var reField = regexp.MustCompile(`^[A-Z_][A-Z0-9_]*$`)
+
+// ParseMatches parses journalctl style match expressions into alternatives.
+// Terms within an expression are FIELD=value pairs separated by spaces and are
+// combined like journalctl does: terms on different fields must all match,
+// terms on the same field match any of the values. A "+" separates
+// alternatives, and every expression is an alternative of its own:
+//
+//	SYSLOG_IDENTIFIER=ocserv _COMM=ocserv-main + _SYSTEMD_UNIT=vpn.service
+func ParseMatches(exprs []string) ([][]string, error) {
+	var groups [][]string
+	for _, expr := range exprs {
+		var group []string
+		for _, term := range append(strings.Fields(expr), "+") {
+			if term == "+" {
+				if len(group) == 0 {
+					return nil, fmt.Errorf("empty alternative in journal match %q", expr)
+				}
+				groups = append(groups, group)
+				group = nil
+				continue
+			}
+			field, _, ok := strings.Cut(term, "=")
+			if !ok || !reField.MatchString(field) {
+				return nil, fmt.Errorf("invalid journal match term %q in %q, expected FIELD=value", term, expr)
+			}
+			group = append(group, term)
+		}
+	}
+	return groups, nil
+}
@@ -0,0 +1,30 @@
+package journal
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMatches(t *testing.T) {
+	got, err := ParseMatches([]string{
+		"SYSLOG_IDENTIFIER=ocserv _COMM=ocserv-main + _SYSTEMD_UNIT=vpn.service",
+		"_SYSTEMD_UNIT=ocserv@corp.service",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"SYSLOG_IDENTIFIER=ocserv", "_COMM=ocserv-main"},
+		{"_SYSTEMD_UNIT=vpn.service"},
+		{"_SYSTEMD_UNIT=ocserv@corp.service"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseMatches() = %q, want %q", got, want)
+	}
+
+	for _, expr := range []string{"", "ocserv", "unit=ocserv", "A=1 + + B=2", "+ A=1"} {
+		if _, err := ParseMatches([]string{expr}); err == nil {
+			t.Errorf("ParseMatches(%q) succeeded, want error", expr)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package journal
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// fileResult is an entry or error read from one of the files of a MultiFileReader
+type fileResult struct {
+	entry *Entry
+	err   error
+}
+
+// MultiFileReader reads several log files concurrently (e.g. logs of several nodes collected
+// on one log host) and merges their entries in arrival order
+type MultiFileReader struct {
+	readers  []*FileReader
+	results  chan fileResult
+	done     chan struct{}
+	finished chan struct{} // closed once all files are read to their end (FileOptions.Once)
+	wg       sync.WaitGroup
+	once     sync.Once
+}
+
+// ExpandLogFiles resolves file paths and glob patterns to a sorted, de-duplicated file list.
+// Every pattern must match at least one file.
+func ExpandLogFiles(patterns []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var paths []string
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no log file matches %q", pattern)
+		}
+		for _, m := range matches {
+			if !seen[m] {
+				seen[m] = true
+				paths = append(paths, m)
+			}
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// ServerFromPath extracts the server name from a file path with the first capture group of re,
+// e.g. `/var/log/remote/([^/]+)/` or `ocserv-(\w+)\.log$`. Returns "" if re is nil or does not match.
+func ServerFromPath(re *regexp.Regexp, path string) string {
+	if re == nil {
+		return ""
+	}
+	m := re.FindStringSubmatch(path)
+	if len(m) < 2 {
+		return ""
+	}
+	return m[1]
+}
+
+// NewMultiFileReader opens all files matching patterns (paths or globs). With serverRe, entries
+// are tagged with the server name extracted from their file path instead of the syslog program name.
+func NewMultiFileReader(patterns []string, serverRe *regexp.Regexp, opts FileOptions) (*MultiFileReader, error) {
+	paths, err := ExpandLogFiles(patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &MultiFileReader{
+		results:  make(chan fileResult, 100),
+		done:     make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+	for _, path := range paths {
+		r, err := NewFileReader(path, opts)
+		if err != nil {
+			_ = m.Close()
+			return nil, err
+		}
+		m.readers = append(m.readers, r)
+		m.wg.Add(1)
+		go m.follow(r, ServerFromPath(serverRe, path))
+	}
+	go func() {
+		m.wg.Wait()
+		close(m.finished)
+	}()
+	return m, nil
+}
+
+// Files returns the number of files being read
+func (m *MultiFileReader) Files() int {
+	return len(m.readers)
+}
+
+// follow reads one file until the reader is closed, or to its end with FileOptions.Once
+func (m *MultiFileReader) follow(r *FileReader, server string) {
+	defer m.wg.Done()
+	for {
+		entry, err := r.Read()
+		if err == io.EOF {
+			return
+		}
+		if err == nil && entry == nil {
+			// EOF: wait for more lines
+			select {
+			case <-m.done:
+				return
+			case <-time.After(100 * time.Millisecond):
+			}
+			continue
+		}
+		if entry != nil && server != "" {
+			entry.Unit = server
+		}
+		select {
+		case m.results <- fileResult{entry: entry, err: err}:
+		case <-m.done:
+			return
+		}
+		if err != nil {
+			return // read errors are not recoverable
+		}
+	}
+}
+
+// Read returns the next entry from any file, blocking until one is available.
+// Returns nil after Close, and io.EOF once all files are read to their end (FileOptions.Once).
+func (m *MultiFileReader) Read() (*Entry, error) {
+	select {
+	case res := <-m.results:
+		return res.entry, res.err
+	case <-m.done:
+		return nil, nil
+	case <-m.finished:
+		// Entries sent before the last file ended come first
+		select {
+		case res := <-m.results:
+			return res.entry, res.err
+		default:
+			return nil, io.EOF
+		}
+	}
+}
+
+// Close stops reading and closes all files
+func (m *MultiFileReader) Close() error {
+	var firstErr error
+	m.once.Do(func() {
+		close(m.done)
+		m.wg.Wait()
+		for _, r := range m.readers {
+			if err := r.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	})
+	return firstErr
+}
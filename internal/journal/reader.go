@@ -21,5 +21,21 @@ type Reader interface {
 	Close() error
 }
 
+// JournalOptions selects which journal to open. The zero value opens the
+// local system journal.
+type JournalOptions struct {
+	// Namespace is a journald namespace (systemd-journald@NAMESPACE.service)
+	Namespace string
+	// Directory is a journal directory, e.g. /var/log/journal/remote written
+	// by systemd-journal-remote or journals copied from another host
+	Directory string
+	// Matches are additional journalctl style match expressions, see
+	// ParseMatches. Entries matching any unit or any expression are read.
+	Matches []string
+	// Once reads to the current end of the journal (io.EOF) instead of
+	// waiting for new entries
+	Once bool
+}
+
 // Handler is called for each log entry
 type Handler func(entry *Entry)
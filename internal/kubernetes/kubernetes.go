@@ -0,0 +1,76 @@
+// Package kubernetes supports running the exporter next to containerized ocserv, as a sidecar or
+// a daemonset: it reads the pod's identity from the downward API and finds the servers of a node
+// in the pod log and socket directories mounted from the host.
+package kubernetes
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/mogilevich/ocserv_exporter/internal/discovery"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Environment variables the pod spec sets from the downward API
+const (
+	EnvNamespace = "POD_NAMESPACE" // fieldRef metadata.namespace
+	EnvPod       = "POD_NAME"      // fieldRef metadata.name
+	EnvNode      = "NODE_NAME"     // fieldRef spec.nodeName
+)
+
+// PodLogServerRegex captures the pod name from the path of a container log under /var/log/pods
+// (<namespace>_<pod>_<uid>/<container>/<n>.log), for use as --log.server-regex
+const PodLogServerRegex = `/pods/[^_/]+_([^_/]+)_[^/]+/`
+
+// Labels returns the kubernetes_namespace, kubernetes_pod and kubernetes_node labels of the
+// downward API variables that are set
+func Labels(getenv func(string) string) prometheus.Labels {
+	labels := prometheus.Labels{}
+	for name, env := range map[string]string{
+		"kubernetes_namespace": EnvNamespace,
+		"kubernetes_pod":       EnvPod,
+		"kubernetes_node":      EnvNode,
+	} {
+		if value := getenv(env); value != "" {
+			labels[name] = value
+		}
+	}
+	return labels
+}
+
+// PodSockets returns the occtl sockets in the subdirectories of dir, e.g. a hostPath each ocserv
+// pod of a node creates its subdirectory in. A socket is named after its subdirectory, usually
+// the pod name; a subdirectory with several sockets names them as discovery.ServerFromSocket
+// prefixed with the subdirectory, e.g. "pod-1/ocserv-ru".
+func PodSockets(dir string) ([]discovery.Socket, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var sockets []discovery.Socket
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		paths, err := filepath.Glob(filepath.Join(dir, entry.Name(), "*.socket"))
+		if err != nil {
+			return nil, err
+		}
+		var found []string
+		for _, path := range paths {
+			if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+				found = append(found, path)
+			}
+		}
+		sort.Strings(found)
+		for _, path := range found {
+			server := entry.Name()
+			if len(found) > 1 {
+				server += "/" + discovery.ServerFromSocket(path)
+			}
+			sockets = append(sockets, discovery.Socket{Server: server, Path: path})
+		}
+	}
+	return sockets, nil
+}
@@ -0,0 +1,70 @@
+package kubernetes
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/mogilevich/ocserv_exporter/internal/discovery"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestLabels(t *testing.T) {
+	env := map[string]string{EnvNamespace: "vpn", EnvPod: "ocserv-0"}
+	got := Labels(func(name string) string { return env[name] })
+	want := prometheus.Labels{"kubernetes_namespace": "vpn", "kubernetes_pod": "ocserv-0"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Labels() = %v, want %v", got, want)
+	}
+}
+
+func TestPodLogServerRegex(t *testing.T) {
+	re := regexp.MustCompile(PodLogServerRegex)
+	m := re.FindStringSubmatch("/var/log/pods/vpn_ocserv-0_0b9c2e1a-5f3d-4c55-9a7e-2d1e0c4f6a8b/ocserv/0.log")
+	if m == nil || m[1] != "ocserv-0" {
+		t.Errorf("match = %q, want pod ocserv-0", m)
+	}
+}
+
+func TestPodSockets(t *testing.T) {
+	// Unix socket paths are limited to about 100 bytes, shorter than some temporary directories
+	dir, err := os.MkdirTemp("/tmp", "k8s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, path := range []string{"ocserv-0/occtl.socket", "ocserv-1/occtl.socket", "ocserv-1/occtl-ru.socket"} {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		l, err := net.Listen("unix", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+	}
+	// Neither a regular file nor a file outside a subdirectory is a pod's socket
+	if err := os.WriteFile(filepath.Join(dir, "ocserv-0", "stale.socket"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "occtl.socket"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := PodSockets(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []discovery.Socket{
+		{Server: "ocserv-0", Path: filepath.Join(dir, "ocserv-0", "occtl.socket")},
+		{Server: "ocserv-1/ocserv-ru", Path: filepath.Join(dir, "ocserv-1", "occtl-ru.socket")},
+		{Server: "ocserv-1/ocserv", Path: filepath.Join(dir, "ocserv-1", "occtl.socket")},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("PodSockets() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,75 @@
+package ocservconf
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// NoGroup is the group name reported for ocpasswd users without a group ("*")
+const NoGroup = "none"
+
+// PasswdUser is an entry of an ocpasswd file
+type PasswdUser struct {
+	Username string
+	Groups   []string
+	Locked   bool // password hash prefixed with "!" (ocpasswd -l)
+}
+
+// LoadPasswd reads and parses an ocpasswd file
+func LoadPasswd(path string) ([]PasswdUser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ocpasswd file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	users, err := ParsePasswd(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return users, nil
+}
+
+// ParsePasswd parses ocpasswd content
+// Format: username:group1,group2:hash ("*" for no group, "!" hash prefix for locked accounts)
+func ParsePasswd(r io.Reader) ([]PasswdUser, error) {
+	var users []PasswdUser
+
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 || parts[0] == "" {
+			return nil, fmt.Errorf("line %d: expected 'username:groups:hash'", lineNo)
+		}
+
+		user := PasswdUser{
+			Username: parts[0],
+			Locked:   strings.HasPrefix(parts[2], "!"),
+		}
+		if parts[1] == "" || parts[1] == "*" {
+			user.Groups = []string{NoGroup}
+		} else {
+			for _, g := range strings.Split(parts[1], ",") {
+				if g = strings.TrimSpace(g); g != "" {
+					user.Groups = append(user.Groups, g)
+				}
+			}
+		}
+		users = append(users, user)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
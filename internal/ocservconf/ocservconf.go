@@ -0,0 +1,204 @@
+package ocservconf
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DefaultVHost is the name occtl uses for the global (non-vhost) section
+const DefaultVHost = "default"
+
+// File is a parsed ocserv.conf
+type File struct {
+	Path   string
+	Global *Section
+	VHosts []*Section // [vhost:name] sections, inheriting unset keys from Global
+}
+
+// Section holds the key/value pairs of the global config or a vhost section.
+// Keys may repeat (e.g. "auth", "route"), so every key maps to a list of values.
+type Section struct {
+	Name   string
+	values map[string][]string
+	parent *Section
+}
+
+// Settings are the capacity-relevant values of a section
+type Settings struct {
+	VHost          string
+	MaxClients     int // 0 means unlimited
+	MaxSameClients int // 0 means unlimited
+	Auth           []string
+	Device         string
+	IPv4Network    *net.IPNet
+	PoolSize       uint64 // assignable client addresses in IPv4Network
+	ServerCert     string // server-cert path (certificate file, not a PKCS#11 URL)
+}
+
+// Load reads and parses an ocserv.conf file
+func Load(path string) (*File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ocserv config: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	file, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	file.Path = path
+	return file, nil
+}
+
+// Parse parses ocserv.conf content
+// Format: "key = value" lines, "#" comments, "[vhost:name]" sections
+func Parse(r io.Reader) (*File, error) {
+	file := &File{
+		Global: newSection(DefaultVHost, nil),
+	}
+	current := file.Global
+
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// Section header: [vhost:www.example.com]
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			header := strings.TrimSpace(line[1 : len(line)-1])
+			name, ok := strings.CutPrefix(header, "vhost:")
+			if !ok || name == "" {
+				return nil, fmt.Errorf("line %d: unsupported section %q", lineNo, header)
+			}
+			current = newSection(name, file.Global)
+			file.VHosts = append(file.VHosts, current)
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected 'key = value'", lineNo)
+		}
+		key = strings.TrimSpace(key)
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+		current.values[key] = append(current.values[key], value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// Sections returns the global section followed by all vhost sections
+func (f *File) Sections() []*Section {
+	return append([]*Section{f.Global}, f.VHosts...)
+}
+
+func newSection(name string, parent *Section) *Section {
+	return &Section{
+		Name:   name,
+		values: make(map[string][]string),
+		parent: parent,
+	}
+}
+
+// GetAll returns all values for key, falling back to the global section
+func (s *Section) GetAll(key string) []string {
+	if v, ok := s.values[key]; ok {
+		return v
+	}
+	if s.parent != nil {
+		return s.parent.GetAll(key)
+	}
+	return nil
+}
+
+// Get returns the last value for key (later lines override earlier ones)
+func (s *Section) Get(key string) string {
+	v := s.GetAll(key)
+	if len(v) == 0 {
+		return ""
+	}
+	return v[len(v)-1]
+}
+
+// GetInt returns key as an integer
+func (s *Section) GetInt(key string) (int, bool) {
+	v := s.Get(key)
+	if v == "" {
+		return 0, false
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+// Settings extracts capacity-relevant settings from the section
+func (s *Section) Settings() Settings {
+	settings := Settings{
+		VHost:  s.Name,
+		Auth:   s.GetAll("auth"),
+		Device: s.Get("device"),
+	}
+	settings.MaxClients, _ = s.GetInt("max-clients")
+	settings.MaxSameClients, _ = s.GetInt("max-same-clients")
+	if cert := s.Get("server-cert"); cert != "" && !strings.Contains(cert, ":") {
+		settings.ServerCert = cert
+	}
+
+	if network := s.Get("ipv4-network"); network != "" {
+		if ipnet, err := parseIPv4Network(network, s.Get("ipv4-netmask")); err == nil {
+			settings.IPv4Network = ipnet
+			settings.PoolSize = poolSize(ipnet)
+		}
+	}
+
+	return settings
+}
+
+// parseIPv4Network parses "192.168.1.0/24" or "192.168.1.0" with a separate netmask
+func parseIPv4Network(network, netmask string) (*net.IPNet, error) {
+	if strings.Contains(network, "/") {
+		_, ipnet, err := net.ParseCIDR(network)
+		return ipnet, err
+	}
+
+	ip := net.ParseIP(network).To4()
+	if ip == nil {
+		return nil, fmt.Errorf("invalid ipv4-network %q", network)
+	}
+	mask := net.ParseIP(netmask).To4()
+	if mask == nil {
+		return nil, fmt.Errorf("invalid ipv4-netmask %q", netmask)
+	}
+	m := net.IPMask(mask)
+	return &net.IPNet{IP: ip.Mask(m), Mask: m}, nil
+}
+
+// poolSize returns the number of host addresses in the network
+// (excluding network and broadcast addresses)
+func poolSize(ipnet *net.IPNet) uint64 {
+	ones, bits := ipnet.Mask.Size()
+	hostBits := bits - ones
+	if hostBits <= 1 {
+		return 0
+	}
+	if hostBits >= 63 {
+		return math.MaxUint64
+	}
+	return (uint64(1) << hostBits) - 2
+}
@@ -0,0 +1,127 @@
+package ocservconf
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const sampleConfig = `
+# global settings
+auth = "plain[passwd=/etc/ocserv/ocpasswd]"
+max-clients = 128
+max-same-clients = 2
+device = vpns
+ipv4-network = 10.88.0.0
+ipv4-netmask = 255.255.252.0
+
+[vhost:www.example.com]
+auth = "certificate"
+ipv4-network = 10.99.0.0/24
+max-same-clients = 1
+`
+
+func TestParse(t *testing.T) {
+	f, err := Parse(strings.NewReader(sampleConfig))
+	if err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+
+	global := f.Global.Settings()
+	if global.VHost != DefaultVHost || global.MaxClients != 128 || global.MaxSameClients != 2 || global.Device != "vpns" {
+		t.Errorf("unexpected global settings: %+v", global)
+	}
+	if global.IPv4Network.String() != "10.88.0.0/22" || global.PoolSize != 1022 {
+		t.Errorf("global pool: got %v (%d), want 10.88.0.0/22 (1022)", global.IPv4Network, global.PoolSize)
+	}
+	if len(global.Auth) != 1 || global.Auth[0] != "plain[passwd=/etc/ocserv/ocpasswd]" {
+		t.Errorf("global auth: got %v", global.Auth)
+	}
+
+	if len(f.VHosts) != 1 {
+		t.Fatalf("got %d vhosts, want 1", len(f.VHosts))
+	}
+	vhost := f.VHosts[0].Settings()
+	if vhost.VHost != "www.example.com" || vhost.MaxClients != 128 || vhost.MaxSameClients != 1 || vhost.Device != "vpns" {
+		t.Errorf("unexpected vhost settings (should inherit unset keys): %+v", vhost)
+	}
+	if vhost.PoolSize != 254 || vhost.Auth[0] != "certificate" {
+		t.Errorf("unexpected vhost pool/auth: %+v", vhost)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, input := range []string{"no equals sign", "[group:foo]\n"} {
+		if _, err := Parse(strings.NewReader(input)); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", input)
+		}
+	}
+}
+
+func TestParsePasswd(t *testing.T) {
+	input := `alice:employees:$5$abc
+bob:*:!$5$def
+carol:employees,admins:$5$ghi
+`
+	users, err := ParsePasswd(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParsePasswd() error: %v", err)
+	}
+	if len(users) != 3 {
+		t.Fatalf("got %d users, want 3", len(users))
+	}
+	if users[0].Username != "alice" || users[0].Locked || users[0].Groups[0] != "employees" {
+		t.Errorf("unexpected user: %+v", users[0])
+	}
+	if !users[1].Locked || users[1].Groups[0] != NoGroup {
+		t.Errorf("unexpected user: %+v", users[1])
+	}
+	if len(users[2].Groups) != 2 || users[2].Groups[1] != "admins" {
+		t.Errorf("unexpected user: %+v", users[2])
+	}
+}
+
+func TestCertExpiry(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notAfter := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(1), NotBefore: notAfter.AddDate(-1, 0, 0), NotAfter: notAfter}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Chain files may start with other blocks; the first certificate counts
+	path := filepath.Join(t.TempDir(), "server-cert.pem")
+	data := append(pem.EncodeToMemory(&pem.Block{Type: "EC PARAMETERS", Bytes: []byte{6, 8}}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := CertExpiry(path)
+	if err != nil {
+		t.Fatalf("CertExpiry() error: %v", err)
+	}
+	if !got.Equal(notAfter) {
+		t.Errorf("CertExpiry() = %v, want %v", got, notAfter)
+	}
+
+	f, err := Parse(strings.NewReader("server-cert = " + path + "\n[vhost:hsm]\nserver-cert = pkcs11:object=vpn\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Global.Settings().ServerCert != path || f.VHosts[0].Settings().ServerCert != "" {
+		t.Errorf("server-cert: got %q / %q", f.Global.Settings().ServerCert, f.VHosts[0].Settings().ServerCert)
+	}
+}
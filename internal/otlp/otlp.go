@@ -0,0 +1,345 @@
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// ServerAttribute is the resource attribute holding the VPN server name.
+// Series with a "server" label are grouped into one resource per server.
+const ServerAttribute = "ocserv.server"
+
+// Config configures an OTLP exporter
+type Config struct {
+	Endpoint           string // OTLP/HTTP metrics endpoint, e.g. http://otel-collector:4318/v1/metrics
+	Timeout            time.Duration
+	Headers            map[string]string // extra request headers (e.g. authorization)
+	ResourceAttributes map[string]string // added to every resource
+	ServiceVersion     string
+	StartTime          time.Time // start of cumulative sums and histograms (exporter start)
+}
+
+// Exporter mirrors Prometheus metric families as OTLP metrics over HTTP (JSON encoding)
+type Exporter struct {
+	cfg    Config
+	client *http.Client
+}
+
+// NewExporter creates a new OTLP exporter
+func NewExporter(cfg Config) *Exporter {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.StartTime.IsZero() {
+		cfg.StartTime = time.Now()
+	}
+	return &Exporter{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+// Export converts metric families sampled at ts and sends them to the endpoint.
+// Returns the number of data points sent.
+func (e *Exporter) Export(ctx context.Context, families []*dto.MetricFamily, ts time.Time) (int, error) {
+	req, points := e.convert(families, ts)
+	if points == 0 {
+		return 0, nil
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return 0, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, e.cfg.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	for name, value := range e.cfg.Headers {
+		httpReq.Header.Set(name, value)
+	}
+
+	resp, err := e.client.Do(httpReq)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return 0, fmt.Errorf("OTLP endpoint returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	return points, nil
+}
+
+// OTLP JSON encoding of ExportMetricsServiceRequest (opentelemetry-proto metrics/v1).
+// 64-bit integers are encoded as strings as required by the protobuf JSON mapping.
+
+type exportRequest struct {
+	ResourceMetrics []*resourceMetrics `json:"resourceMetrics"`
+}
+
+type resourceMetrics struct {
+	Resource     resource        `json:"resource"`
+	ScopeMetrics []*scopeMetrics `json:"scopeMetrics"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scopeMetrics struct {
+	Scope   scope     `json:"scope"`
+	Metrics []*metric `json:"metrics"`
+}
+
+type scope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type metric struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Gauge       *gauge     `json:"gauge,omitempty"`
+	Sum         *sum       `json:"sum,omitempty"`
+	Histogram   *histogram `json:"histogram,omitempty"`
+	Summary     *summary   `json:"summary,omitempty"`
+}
+
+const aggregationTemporalityCumulative = 2
+
+type gauge struct {
+	DataPoints []numberDataPoint `json:"dataPoints"`
+}
+
+type sum struct {
+	DataPoints             []numberDataPoint `json:"dataPoints"`
+	AggregationTemporality int               `json:"aggregationTemporality"`
+	IsMonotonic            bool              `json:"isMonotonic"`
+}
+
+type numberDataPoint struct {
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string     `json:"timeUnixNano"`
+	AsDouble          float64    `json:"asDouble"`
+}
+
+type histogram struct {
+	DataPoints             []histogramDataPoint `json:"dataPoints"`
+	AggregationTemporality int                  `json:"aggregationTemporality"`
+}
+
+type histogramDataPoint struct {
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	TimeUnixNano      string     `json:"timeUnixNano"`
+	Count             string     `json:"count"`
+	Sum               float64    `json:"sum"`
+	BucketCounts      []string   `json:"bucketCounts"`
+	ExplicitBounds    []float64  `json:"explicitBounds"`
+}
+
+type summary struct {
+	DataPoints []summaryDataPoint `json:"dataPoints"`
+}
+
+type summaryDataPoint struct {
+	Attributes        []keyValue      `json:"attributes,omitempty"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	TimeUnixNano      string          `json:"timeUnixNano"`
+	Count             string          `json:"count"`
+	Sum               float64         `json:"sum"`
+	QuantileValues    []quantileValue `json:"quantileValues"`
+}
+
+type quantileValue struct {
+	Quantile float64 `json:"quantile"`
+	Value    float64 `json:"value"`
+}
+
+// convert maps metric families to an OTLP request: counters become monotonic cumulative sums,
+// gauges and untyped metrics gauges, histograms explicit-bucket histograms, summaries summaries.
+// Series are grouped into one resource per "server" label value (ServerAttribute).
+// Returns the request and the number of data points in it.
+func (e *Exporter) convert(families []*dto.MetricFamily, ts time.Time) (*exportRequest, int) {
+	now := strconv.FormatInt(ts.UnixNano(), 10)
+	start := strconv.FormatInt(e.cfg.StartTime.UnixNano(), 10)
+
+	resources := make(map[string]*resourceMetrics)
+	metrics := make(map[string]map[string]*metric) // server -> metric name -> metric
+	points := 0
+
+	metricFor := func(server string, mf *dto.MetricFamily) *metric {
+		if _, ok := resources[server]; !ok {
+			resources[server] = e.newResource(server)
+			metrics[server] = make(map[string]*metric)
+		}
+		m, ok := metrics[server][mf.GetName()]
+		if !ok {
+			m = &metric{Name: mf.GetName(), Description: mf.GetHelp()}
+			metrics[server][mf.GetName()] = m
+			sm := resources[server].ScopeMetrics[0]
+			sm.Metrics = append(sm.Metrics, m)
+		}
+		return m
+	}
+
+	for _, mf := range families {
+		for _, pm := range mf.GetMetric() {
+			server, attrs := splitLabels(pm.GetLabel())
+			m := metricFor(server, mf)
+
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				if m.Sum == nil {
+					m.Sum = &sum{AggregationTemporality: aggregationTemporalityCumulative, IsMonotonic: true}
+				}
+				m.Sum.DataPoints = append(m.Sum.DataPoints, numberDataPoint{
+					Attributes: attrs, StartTimeUnixNano: start, TimeUnixNano: now, AsDouble: pm.GetCounter().GetValue(),
+				})
+			case dto.MetricType_GAUGE, dto.MetricType_UNTYPED:
+				value := pm.GetGauge().GetValue()
+				if mf.GetType() == dto.MetricType_UNTYPED {
+					value = pm.GetUntyped().GetValue()
+				}
+				if m.Gauge == nil {
+					m.Gauge = &gauge{}
+				}
+				m.Gauge.DataPoints = append(m.Gauge.DataPoints, numberDataPoint{
+					Attributes: attrs, TimeUnixNano: now, AsDouble: value,
+				})
+			case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+				if m.Histogram == nil {
+					m.Histogram = &histogram{AggregationTemporality: aggregationTemporalityCumulative}
+				}
+				m.Histogram.DataPoints = append(m.Histogram.DataPoints, histogramPoint(pm.GetHistogram(), attrs, start, now))
+			case dto.MetricType_SUMMARY:
+				s := pm.GetSummary()
+				dp := summaryDataPoint{
+					Attributes:        attrs,
+					StartTimeUnixNano: start,
+					TimeUnixNano:      now,
+					Count:             strconv.FormatUint(s.GetSampleCount(), 10),
+					Sum:               s.GetSampleSum(),
+				}
+				for _, q := range s.GetQuantile() {
+					dp.QuantileValues = append(dp.QuantileValues, quantileValue{Quantile: q.GetQuantile(), Value: q.GetValue()})
+				}
+				if m.Summary == nil {
+					m.Summary = &summary{}
+				}
+				m.Summary.DataPoints = append(m.Summary.DataPoints, dp)
+			default:
+				continue
+			}
+			points++
+		}
+	}
+
+	servers := make([]string, 0, len(resources))
+	for server := range resources {
+		servers = append(servers, server)
+	}
+	sort.Strings(servers)
+
+	req := &exportRequest{}
+	for _, server := range servers {
+		req.ResourceMetrics = append(req.ResourceMetrics, resources[server])
+	}
+	return req, points
+}
+
+// newResource creates the resource for a server ("" for series without a server label)
+func (e *Exporter) newResource(server string) *resourceMetrics {
+	attrs := map[string]string{
+		"service.name": "ocserv_exporter",
+	}
+	if e.cfg.ServiceVersion != "" {
+		attrs["service.version"] = e.cfg.ServiceVersion
+	}
+	for k, v := range e.cfg.ResourceAttributes {
+		attrs[k] = v
+	}
+	if server != "" {
+		attrs[ServerAttribute] = server
+	}
+
+	return &resourceMetrics{
+		Resource: resource{Attributes: sortedKeyValues(attrs)},
+		ScopeMetrics: []*scopeMetrics{{
+			Scope: scope{Name: "github.com/mogilevich/ocserv_exporter", Version: e.cfg.ServiceVersion},
+		}},
+	}
+}
+
+// histogramPoint converts cumulative Prometheus buckets to OTLP per-bucket counts
+func histogramPoint(h *dto.Histogram, attrs []keyValue, start, now string) histogramDataPoint {
+	dp := histogramDataPoint{
+		Attributes:        attrs,
+		StartTimeUnixNano: start,
+		TimeUnixNano:      now,
+		Count:             strconv.FormatUint(h.GetSampleCount(), 10),
+		Sum:               h.GetSampleSum(),
+		ExplicitBounds:    []float64{},
+	}
+
+	var previous uint64
+	for _, b := range h.GetBucket() {
+		if math.IsInf(b.GetUpperBound(), 1) {
+			continue
+		}
+		dp.ExplicitBounds = append(dp.ExplicitBounds, b.GetUpperBound())
+		dp.BucketCounts = append(dp.BucketCounts, strconv.FormatUint(b.GetCumulativeCount()-previous, 10))
+		previous = b.GetCumulativeCount()
+	}
+	// Overflow bucket (+Inf)
+	dp.BucketCounts = append(dp.BucketCounts, strconv.FormatUint(h.GetSampleCount()-previous, 10))
+
+	return dp
+}
+
+// splitLabels separates the server label (moved to the resource) from data point attributes
+func splitLabels(pairs []*dto.LabelPair) (server string, attrs []keyValue) {
+	for _, p := range pairs {
+		if p.GetName() == "server" {
+			server = p.GetValue()
+			continue
+		}
+		attrs = append(attrs, keyValue{Key: p.GetName(), Value: anyValue{StringValue: p.GetValue()}})
+	}
+	return server, attrs
+}
+
+func sortedKeyValues(m map[string]string) []keyValue {
+	kvs := make([]keyValue, 0, len(m))
+	for k, v := range m {
+		kvs = append(kvs, keyValue{Key: k, Value: anyValue{StringValue: v}})
+	}
+	sort.Slice(kvs, func(i, j int) bool { return kvs[i].Key < kvs[j].Key })
+	return kvs
+}
@@ -0,0 +1,75 @@
+package otlp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestExport(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "conn_total", Help: "connections"}, []string{"server", "username"})
+	hist := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "dur_seconds", Help: "duration", Buckets: []float64{1, 10}})
+	reg.MustRegister(counter, hist)
+	counter.WithLabelValues("ocserv", "bob").Add(2)
+	counter.WithLabelValues("ocserv-ru", "bob").Inc()
+	hist.Observe(5)
+	hist.Observe(50)
+
+	var got map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" || r.Header.Get("X-Token") != "t" {
+			t.Errorf("unexpected headers: %v", r.Header)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+	}))
+	defer srv.Close()
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := NewExporter(Config{Endpoint: srv.URL, Headers: map[string]string{"X-Token": "t"}, StartTime: time.Unix(100, 0)})
+	n, err := exp.Export(context.Background(), families, time.Unix(200, 0))
+	if err != nil {
+		t.Fatalf("Export() error: %v", err)
+	}
+	if n != 3 {
+		t.Errorf("Export() sent %d points, want 3", n)
+	}
+
+	// One resource without server (histogram) and one per server
+	rms := got["resourceMetrics"].([]any)
+	if len(rms) != 3 {
+		t.Fatalf("got %d resources, want 3", len(rms))
+	}
+
+	var servers []string
+	for _, rm := range rms {
+		for _, a := range rm.(map[string]any)["resource"].(map[string]any)["attributes"].([]any) {
+			kv := a.(map[string]any)
+			if kv["key"] == ServerAttribute {
+				servers = append(servers, kv["value"].(map[string]any)["stringValue"].(string))
+			}
+		}
+	}
+	if len(servers) != 2 || servers[0] != "ocserv" || servers[1] != "ocserv-ru" {
+		t.Errorf("server resources = %v, want [ocserv ocserv-ru]", servers)
+	}
+
+	// Histogram buckets are per-bucket, not cumulative: (-inf,1]=0, (1,10]=1, (10,+inf)=1
+	m := rms[0].(map[string]any)["scopeMetrics"].([]any)[0].(map[string]any)["metrics"].([]any)[0].(map[string]any)
+	dp := m["histogram"].(map[string]any)["dataPoints"].([]any)[0].(map[string]any)
+	counts := dp["bucketCounts"].([]any)
+	if len(counts) != 3 || counts[0] != "0" || counts[1] != "1" || counts[2] != "1" || dp["count"] != "2" {
+		t.Errorf("histogram data point = %v", dp)
+	}
+}
@@ -0,0 +1,399 @@
+// Package policy runs automation hooks for events violating configured policies:
+// too many concurrent sessions, logins from blocked countries, exceeded traffic quotas
+// or repeated events (e.g. authentication failures) from one user or IP address.
+package policy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mogilevich/ocserv_exporter/internal/collector"
+	"github.com/mogilevich/ocserv_exporter/pkg/parser"
+)
+
+// Keys of the By field: what repeated events are counted by and cooldowns apply to
+const (
+	ByUser     = "user"
+	ByClientIP = "client_ip"
+)
+
+// Policy defaults
+const (
+	DefaultQuotaPeriod = 24 * time.Hour
+	DefaultCooldown    = time.Minute
+)
+
+// actionTimeout bounds webhooks, occtl and commands of one action
+const actionTimeout = 30 * time.Second
+
+// Policy is a set of conditions on events and the actions run when an event meets all of them
+type Policy struct {
+	Name   string
+	Events []string // event types checked (default login)
+
+	Groups    []string // only users of these groups (empty: all)
+	Countries []string // ISO country codes of the client IP that violate the policy
+
+	MaxSessions int // violated by a login exceeding this many concurrent sessions of the user
+
+	// Quota is the traffic (received + sent bytes) a user may use per QuotaPeriod (fixed windows).
+	// Traffic is counted from disconnect events, so a violation is seen at the next checked event.
+	Quota       uint64
+	QuotaPeriod time.Duration
+
+	Count  int           // violated by the Count-th event of a key ...
+	Window time.Duration // ... within this window
+
+	By       string        // key of counted events and cooldowns: user (default) or client_ip
+	Cooldown time.Duration // actions for a key are run at most once per cooldown
+
+	Actions []Action
+}
+
+// Action is run for a violation. Exactly one field is set.
+type Action struct {
+	Webhook    string   // POST {"policy": ..., "event": ...} to this URL
+	Disconnect bool     // disconnect all sessions of the user with occtl
+	Unban      bool     // unban the client IP with occtl
+	Command    []string // run a command, the event in OCSERV_* environment variables
+}
+
+// Name returns the action label of ocserv_policy_actions_total
+func (a Action) Name() string {
+	switch {
+	case a.Webhook != "":
+		return "webhook"
+	case a.Disconnect:
+		return "disconnect"
+	case a.Unban:
+		return "unban"
+	default:
+		return "command"
+	}
+}
+
+// New validates a policy and applies its defaults
+func New(p Policy) (*Policy, error) {
+	if strings.TrimSpace(p.Name) == "" || strings.Contains(p.Name, "|") {
+		return nil, fmt.Errorf("invalid policy name %q", p.Name)
+	}
+	if len(p.Events) == 0 {
+		p.Events = []string{parser.EventUserLogin.String()}
+	}
+	for _, name := range p.Events {
+		if parser.ParseEventType(name) == parser.EventUnknown {
+			return nil, fmt.Errorf("policy %s: unknown event type %q", p.Name, name)
+		}
+	}
+	for i, code := range p.Countries {
+		p.Countries[i] = strings.ToUpper(code)
+	}
+	if p.MaxSessions < 0 || p.Count < 0 {
+		return nil, fmt.Errorf("policy %s: negative max_sessions or count", p.Name)
+	}
+	if p.Count > 0 && p.Window <= 0 {
+		return nil, fmt.Errorf("policy %s: count needs a positive window", p.Name)
+	}
+	if p.Quota > 0 && p.QuotaPeriod <= 0 {
+		p.QuotaPeriod = DefaultQuotaPeriod
+	}
+	switch p.By {
+	case "":
+		p.By = ByUser
+	case ByUser, ByClientIP:
+	default:
+		return nil, fmt.Errorf("policy %s: by must be %s or %s, got %q", p.Name, ByUser, ByClientIP, p.By)
+	}
+	if p.Cooldown <= 0 {
+		p.Cooldown = DefaultCooldown
+	}
+	if len(p.Groups) == 0 && len(p.Countries) == 0 && p.MaxSessions == 0 && p.Quota == 0 && p.Count == 0 {
+		return nil, fmt.Errorf("policy %s: no condition (groups, countries, max_sessions, quota or count)", p.Name)
+	}
+	if len(p.Actions) == 0 {
+		return nil, fmt.Errorf("policy %s: no actions", p.Name)
+	}
+	for _, a := range p.Actions {
+		set := 0
+		if a.Webhook != "" {
+			if u, err := url.Parse(a.Webhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				return nil, fmt.Errorf("policy %s: invalid webhook URL %q", p.Name, a.Webhook)
+			}
+			set++
+		}
+		if a.Disconnect {
+			set++
+		}
+		if a.Unban {
+			set++
+		}
+		if len(a.Command) > 0 {
+			set++
+		}
+		if set != 1 {
+			return nil, fmt.Errorf("policy %s: an action needs exactly one of webhook, disconnect, unban or command", p.Name)
+		}
+	}
+	return &p, nil
+}
+
+// Occtl runs the occtl actions on the server of an event
+type Occtl interface {
+	DisconnectUser(server, username string) error
+	UnbanIP(server, ip string) error
+}
+
+// Engine checks events against policies and runs the actions of violations.
+// HandleEvents is a sink.SendFunc; it is called from a single goroutine.
+type Engine struct {
+	policies []*Policy
+	occtl    Occtl
+	client   *http.Client
+
+	usage    map[string]*quotaUsage // policy|server|user -> traffic in the current quota period
+	hits     map[string][]time.Time // policy|key -> times of counted events within the window
+	cooldown map[string]time.Time   // policy|key -> time of the last actions
+	pruned   time.Time
+}
+
+type quotaUsage struct {
+	period time.Time // start of the quota period
+	bytes  uint64
+}
+
+// NewEngine creates an engine for policies created by New. occtl may be nil when no policy disconnects or unbans.
+func NewEngine(policies []*Policy, occtl Occtl) *Engine {
+	return &Engine{
+		policies: policies,
+		occtl:    occtl,
+		client:   &http.Client{Timeout: actionTimeout},
+		usage:    make(map[string]*quotaUsage),
+		hits:     make(map[string][]time.Time),
+		cooldown: make(map[string]time.Time),
+	}
+}
+
+// Disconnects reports whether any of policies disconnects users, which occtl needs the real
+// username for
+func Disconnects(policies []*Policy) bool {
+	for _, p := range policies {
+		for _, a := range p.Actions {
+			if a.Disconnect {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HandleEvents checks a batch of events (sink.SendFunc). Failed actions are logged and counted,
+// never retried, so the returned error is always nil.
+func (e *Engine) HandleEvents(ctx context.Context, batch []*collector.Event) error {
+	for _, event := range batch {
+		now := event.Time
+		if now.IsZero() {
+			now = time.Now()
+		}
+		for _, p := range e.policies {
+			if e.violates(p, event, now) {
+				e.violation(ctx, p, event, now)
+			}
+		}
+		e.prune(now)
+	}
+	return nil
+}
+
+// violates checks the conditions of p (all of them must hold) and updates the quota usage and event counts
+func (e *Engine) violates(p *Policy, event *collector.Event, now time.Time) bool {
+	if p.Quota > 0 && event.Type == parser.EventUserDisconnect.String() && event.Username != "" &&
+		(len(p.Groups) == 0 || slices.Contains(p.Groups, event.Group)) {
+		e.addUsage(p, event, now)
+	}
+
+	if !slices.Contains(p.Events, event.Type) {
+		return false
+	}
+	if len(p.Groups) > 0 && !slices.Contains(p.Groups, event.Group) {
+		return false
+	}
+	if len(p.Countries) > 0 && !slices.Contains(p.Countries, event.CountryCode) {
+		return false
+	}
+	if p.MaxSessions > 0 && event.UserSessions <= p.MaxSessions {
+		return false
+	}
+	if p.Quota > 0 {
+		u := e.usage[p.Name+"|"+event.Server+"|"+event.Username]
+		if u == nil || !u.period.Equal(now.Truncate(p.QuotaPeriod)) || u.bytes <= p.Quota {
+			return false
+		}
+	}
+	if p.Count > 0 {
+		key := p.Name + "|" + e.key(p, event)
+		hits := append(e.hits[key], now)
+		hits = slices.DeleteFunc(hits, func(t time.Time) bool { return now.Sub(t) >= p.Window })
+		e.hits[key] = hits
+		if len(hits) < p.Count {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *Engine) addUsage(p *Policy, event *collector.Event, now time.Time) {
+	key := p.Name + "|" + event.Server + "|" + event.Username
+	period := now.Truncate(p.QuotaPeriod)
+	u, ok := e.usage[key]
+	if !ok || !u.period.Equal(period) {
+		u = &quotaUsage{period: period}
+		e.usage[key] = u
+	}
+	u.bytes += event.RxBytes + event.TxBytes
+}
+
+// key returns what the events of p are counted by
+func (e *Engine) key(p *Policy, event *collector.Event) string {
+	if p.By == ByClientIP {
+		return event.ClientIP
+	}
+	return event.Server + "|" + event.Username
+}
+
+// violation counts a violation and runs the actions of p unless the key is in its cooldown
+func (e *Engine) violation(ctx context.Context, p *Policy, event *collector.Event, now time.Time) {
+	collector.PolicyViolationsTotal.WithLabelValues(event.Server, p.Name).Inc()
+
+	key := p.Name + "|" + e.key(p, event)
+	if last, ok := e.cooldown[key]; ok && now.Sub(last) < p.Cooldown {
+		for _, a := range p.Actions {
+			collector.PolicyActionsTotal.WithLabelValues(p.Name, a.Name(), "suppressed").Inc()
+		}
+		return
+	}
+	e.cooldown[key] = now
+	// Counting starts over, so the next action needs Count new events
+	delete(e.hits, key)
+
+	log.Printf("Policy %s violated by %s event of user %q from %s on %s", p.Name, event.Type, event.Username, event.ClientIP, event.Server)
+	for _, a := range p.Actions {
+		result := "success"
+		if err := e.run(ctx, p, a, event); err != nil {
+			log.Printf("Policy %s: %s action failed: %v", p.Name, a.Name(), err)
+			result = "error"
+		}
+		collector.PolicyActionsTotal.WithLabelValues(p.Name, a.Name(), result).Inc()
+	}
+}
+
+func (e *Engine) run(ctx context.Context, p *Policy, a Action, event *collector.Event) error {
+	ctx, cancel := context.WithTimeout(ctx, actionTimeout)
+	defer cancel()
+
+	switch {
+	case a.Webhook != "":
+		return e.webhook(ctx, a.Webhook, p, event)
+	case a.Disconnect:
+		if event.Username == "" {
+			return fmt.Errorf("%s event without username", event.Type)
+		}
+		if e.occtl == nil {
+			return fmt.Errorf("occtl is not enabled")
+		}
+		return e.occtl.DisconnectUser(event.Server, event.Username)
+	case a.Unban:
+		if event.ClientIP == "" {
+			return fmt.Errorf("%s event without client IP", event.Type)
+		}
+		if e.occtl == nil {
+			return fmt.Errorf("occtl is not enabled")
+		}
+		return e.occtl.UnbanIP(event.Server, event.ClientIP)
+	default:
+		return command(ctx, a.Command, p, event)
+	}
+}
+
+func (e *Engine) webhook(ctx context.Context, target string, p *Policy, event *collector.Event) error {
+	body, err := json.Marshal(struct {
+		Policy string           `json:"policy"`
+		Event  *collector.Event `json:"event"`
+	}{p.Name, event})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// command runs args with the event in the environment (e.g. to ban the client IP in a firewall)
+func command(ctx context.Context, args []string, p *Policy, event *collector.Event) error {
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = append(os.Environ(),
+		"OCSERV_POLICY="+p.Name,
+		"OCSERV_EVENT="+event.Type,
+		"OCSERV_SERVER="+event.Server,
+		"OCSERV_USERNAME="+event.Username,
+		"OCSERV_CLIENT_IP="+event.ClientIP,
+		"OCSERV_COUNTRY_CODE="+event.CountryCode,
+	)
+	output, err := cmd.CombinedOutput()
+	if err != nil && len(output) > 0 {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return err
+}
+
+// prune drops expired event counts, quota usage and cooldowns, at most once a minute
+func (e *Engine) prune(now time.Time) {
+	if now.Sub(e.pruned) < time.Minute {
+		return
+	}
+	e.pruned = now
+
+	byName := make(map[string]*Policy, len(e.policies))
+	for _, p := range e.policies {
+		byName[p.Name] = p
+	}
+	policyOf := func(key string) *Policy {
+		name, _, _ := strings.Cut(key, "|")
+		return byName[name]
+	}
+	for key, hits := range e.hits {
+		if p := policyOf(key); p == nil || len(hits) == 0 || now.Sub(hits[len(hits)-1]) >= p.Window {
+			delete(e.hits, key)
+		}
+	}
+	for key, u := range e.usage {
+		if p := policyOf(key); p == nil || !u.period.Equal(now.Truncate(p.QuotaPeriod)) {
+			delete(e.usage, key)
+		}
+	}
+	for key, last := range e.cooldown {
+		if p := policyOf(key); p == nil || now.Sub(last) >= p.Cooldown {
+			delete(e.cooldown, key)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mogilevich/ocserv_exporter/internal/collector"
+)
+
+type fakeOcctl struct {
+	disconnected []string
+	unbanned     []string
+}
+
+func (f *fakeOcctl) DisconnectUser(server, username string) error {
+	f.disconnected = append(f.disconnected, server+"/"+username)
+	return nil
+}
+
+func (f *fakeOcctl) UnbanIP(server, ip string) error {
+	f.unbanned = append(f.unbanned, server+"/"+ip)
+	return nil
+}
+
+func mustNew(t *testing.T, p Policy) *Policy {
+	t.Helper()
+	policy, err := New(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return policy
+}
+
+func TestNew(t *testing.T) {
+	p := mustNew(t, Policy{Name: "sessions", MaxSessions: 3, Countries: []string{"ru"}, Actions: []Action{{Disconnect: true}}})
+	if len(p.Events) != 1 || p.Events[0] != "login" || p.By != ByUser || p.Cooldown != DefaultCooldown || p.Countries[0] != "RU" {
+		t.Errorf("defaults not applied: %+v", p)
+	}
+
+	for name, p := range map[string]Policy{
+		"no name":          {MaxSessions: 1, Actions: []Action{{Disconnect: true}}},
+		"no condition":     {Name: "x", Actions: []Action{{Disconnect: true}}},
+		"no actions":       {Name: "x", MaxSessions: 1},
+		"two in an action": {Name: "x", MaxSessions: 1, Actions: []Action{{Disconnect: true, Unban: true}}},
+		"unknown event":    {Name: "x", Events: []string{"nope"}, MaxSessions: 1, Actions: []Action{{Disconnect: true}}},
+		"count no window":  {Name: "x", Count: 3, Actions: []Action{{Disconnect: true}}},
+		"bad by":           {Name: "x", MaxSessions: 1, By: "vhost", Actions: []Action{{Disconnect: true}}},
+		"bad webhook":      {Name: "x", MaxSessions: 1, Actions: []Action{{Webhook: "ftp://example.com"}}},
+	} {
+		if _, err := New(p); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestMaxSessionsAndCountries(t *testing.T) {
+	occtl := &fakeOcctl{}
+	e := NewEngine([]*Policy{
+		mustNew(t, Policy{Name: "sessions", MaxSessions: 3, Actions: []Action{{Disconnect: true}}}),
+		mustNew(t, Policy{Name: "geo", Countries: []string{"KP"}, Actions: []Action{{Disconnect: true}}}),
+	}, occtl)
+
+	ts := time.Unix(1700000000, 0)
+	_ = e.HandleEvents(context.Background(), []*collector.Event{
+		{Time: ts, Server: "s1", Type: "login", Username: "alice", UserSessions: 3, CountryCode: "DE"},
+		{Time: ts, Server: "s1", Type: "login", Username: "bob", UserSessions: 4, CountryCode: "DE"},
+		{Time: ts, Server: "s1", Type: "disconnect", Username: "carol", CountryCode: "KP"},
+		{Time: ts, Server: "s2", Type: "login", Username: "carol", UserSessions: 1, CountryCode: "KP"},
+	})
+	if strings.Join(occtl.disconnected, ",") != "s1/bob,s2/carol" {
+		t.Errorf("disconnected %v, want s1/bob and s2/carol", occtl.disconnected)
+	}
+}
+
+func TestCountWindowCooldown(t *testing.T) {
+	occtl := &fakeOcctl{}
+	e := NewEngine([]*Policy{mustNew(t, Policy{
+		Name: "brute", Events: []string{"auth_failure"}, Count: 3, Window: time.Minute, By: ByClientIP,
+		Cooldown: 10 * time.Minute, Actions: []Action{{Unban: true}},
+	})}, occtl)
+
+	ts := time.Unix(1700000000, 0)
+	failure := func(offset time.Duration, ip string) *collector.Event {
+		return &collector.Event{Time: ts.Add(offset), Server: "s1", Type: "auth_failure", ClientIP: ip}
+	}
+	_ = e.HandleEvents(context.Background(), []*collector.Event{
+		failure(0, "192.0.2.1"),
+		failure(70*time.Second, "192.0.2.1"), // the first failure left the window
+		failure(80*time.Second, "192.0.2.1"),
+		failure(85*time.Second, "192.0.2.2"),
+	})
+	if len(occtl.unbanned) != 0 {
+		t.Fatalf("unexpected actions: %v", occtl.unbanned)
+	}
+	_ = e.HandleEvents(context.Background(), []*collector.Event{failure(100*time.Second, "192.0.2.1")})
+	if strings.Join(occtl.unbanned, ",") != "s1/192.0.2.1" {
+		t.Fatalf("unbanned %v, want s1/192.0.2.1", occtl.unbanned)
+	}
+
+	// Within the cooldown a new violation runs no actions
+	_ = e.HandleEvents(context.Background(), []*collector.Event{
+		failure(2*time.Minute, "192.0.2.1"), failure(2*time.Minute, "192.0.2.1"), failure(2*time.Minute, "192.0.2.1"),
+	})
+	if len(occtl.unbanned) != 1 {
+		t.Errorf("actions during the cooldown: %v", occtl.unbanned)
+	}
+}
+
+func TestQuota(t *testing.T) {
+	occtl := &fakeOcctl{}
+	e := NewEngine([]*Policy{mustNew(t, Policy{
+		Name: "quota", Quota: 1000, QuotaPeriod: time.Hour, Actions: []Action{{Disconnect: true}},
+	})}, occtl)
+
+	period := time.Unix(1700000000, 0).Truncate(time.Hour)
+	_ = e.HandleEvents(context.Background(), []*collector.Event{
+		{Time: period.Add(time.Minute), Server: "s1", Type: "disconnect", Username: "alice", RxBytes: 400, TxBytes: 400},
+		{Time: period.Add(2 * time.Minute), Server: "s1", Type: "login", Username: "alice"},
+		{Time: period.Add(3 * time.Minute), Server: "s1", Type: "disconnect", Username: "alice", RxBytes: 100, TxBytes: 200},
+		{Time: period.Add(4 * time.Minute), Server: "s1", Type: "login", Username: "alice"},
+		{Time: period.Add(4 * time.Minute), Server: "s2", Type: "login", Username: "alice"},
+		// The next period starts without usage
+		{Time: period.Add(time.Hour), Server: "s1", Type: "login", Username: "alice"},
+	})
+	if strings.Join(occtl.disconnected, ",") != "s1/alice" {
+		t.Errorf("disconnected %v, want s1/alice", occtl.disconnected)
+	}
+}
+
+func TestWebhookAndCommand(t *testing.T) {
+	var got struct {
+		Policy string          `json:"policy"`
+		Event  collector.Event `json:"event"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+	}))
+	defer srv.Close()
+
+	out := filepath.Join(t.TempDir(), "ban")
+	e := NewEngine([]*Policy{mustNew(t, Policy{
+		Name: "geo", Countries: []string{"KP"}, Actions: []Action{
+			{Webhook: srv.URL},
+			{Command: []string{"sh", "-c", `echo "$OCSERV_POLICY $OCSERV_USERNAME $OCSERV_CLIENT_IP" > ` + out}},
+		},
+	})}, nil)
+
+	_ = e.HandleEvents(context.Background(), []*collector.Event{
+		{Time: time.Unix(1700000000, 0), Server: "s1", Type: "login", Username: "bob", ClientIP: "192.0.2.1", CountryCode: "KP"},
+	})
+	if got.Policy != "geo" || got.Event.Username != "bob" {
+		t.Errorf("webhook got %+v", got)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(data)) != "geo bob 192.0.2.1" {
+		t.Errorf("command environment: %q", data)
+	}
+}
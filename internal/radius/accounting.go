@@ -0,0 +1,203 @@
+package radius
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mogilevich/ocserv_exporter/internal/collector"
+)
+
+// MaxSessionAge is how long a session without a Stop is kept before it is dropped
+const MaxSessionAge = 7 * 24 * time.Hour
+
+// Usage is a periodic traffic reading of an active session (from occtl)
+type Usage struct {
+	Username string
+	ClientIP string
+	VpnIP    string
+	RxBytes  uint64
+	TxBytes  uint64
+}
+
+// session is an accounted session (started with Accounting-Start)
+type session struct {
+	id       string
+	server   string
+	username string
+	clientIP string
+	vpnIP    string
+	start    time.Time
+}
+
+// Accountant derives RADIUS accounting from session lifecycle events:
+// Accounting-Start on login, Interim-Update from occtl traffic readings and Accounting-Stop on disconnect
+type Accountant struct {
+	client *Client
+
+	mu       sync.Mutex
+	sessions map[string]*session // key: server|username|client IP|port
+}
+
+// NewAccountant creates an accountant sending to client
+func NewAccountant(client *Client) *Accountant {
+	return &Accountant{client: client, sessions: make(map[string]*session)}
+}
+
+// HandleEvents accounts a batch of events (sink.SendFunc). Failed packets are not retried
+// beyond the client's retransmissions; the first error is returned after the whole batch was tried.
+func (a *Accountant) HandleEvents(ctx context.Context, batch []*collector.Event) error {
+	var firstErr error
+	for _, event := range batch {
+		if p := a.packetFor(event); p != nil {
+			if err := a.client.Send(ctx, p); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// packetFor builds the accounting packet for an event, nil for events that are not accounted
+func (a *Accountant) packetFor(event *collector.Event) *Packet {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	key := fmt.Sprintf("%s|%s|%s|%d", event.Server, event.Username, event.ClientIP, event.Port)
+
+	switch event.Type {
+	case "login":
+		s := &session{
+			id:       sessionID(key, event.Time),
+			server:   event.Server,
+			username: event.Username,
+			clientIP: event.ClientIP,
+			start:    event.Time,
+		}
+		a.sessions[key] = s
+		return s.packet(StatusStart, event.Time)
+
+	case "vpn_ip_assigned":
+		// Remember the VPN IP for interim and stop packets
+		for _, s := range a.sessions {
+			if s.server == event.Server && s.username == event.Username && s.vpnIP == "" {
+				s.vpnIP = event.VpnIP
+				break
+			}
+		}
+		return nil
+
+	case "disconnect":
+		s, ok := a.sessions[key]
+		if !ok {
+			// Login happened before we started: account the stop on its own
+			s = &session{
+				id:       sessionID(key, event.Time.Add(-time.Duration(event.DurationSeconds)*time.Second)),
+				server:   event.Server,
+				username: event.Username,
+				clientIP: event.ClientIP,
+				start:    event.Time.Add(-time.Duration(event.DurationSeconds) * time.Second),
+			}
+		}
+		delete(a.sessions, key)
+		if event.VpnIP != "" {
+			s.vpnIP = event.VpnIP
+		}
+
+		p := s.packet(StatusStop, event.Time)
+		p.AddOctets(AttrAcctInputOctets, AttrAcctInputGigawords, event.RxBytes)
+		p.AddOctets(AttrAcctOutputOctets, AttrAcctOutputGigawords, event.TxBytes)
+		p.AddInt(AttrAcctTerminateCause, terminateCause(event.Reason))
+		return p
+	}
+	return nil
+}
+
+// Interim sends Interim-Update packets for the active sessions of server with current traffic
+// readings (matched by username and client IP). Sessions without a reading are skipped.
+func (a *Accountant) Interim(ctx context.Context, server string, usage []Usage, now time.Time) error {
+	a.mu.Lock()
+	var packets []*Packet
+	for _, s := range a.sessions {
+		if s.server != server {
+			continue
+		}
+		for _, u := range usage {
+			if u.Username != s.username || u.ClientIP != s.clientIP {
+				continue
+			}
+			if s.vpnIP == "" {
+				s.vpnIP = u.VpnIP
+			}
+			p := s.packet(StatusInterimUpdate, now)
+			p.AddOctets(AttrAcctInputOctets, AttrAcctInputGigawords, u.RxBytes)
+			p.AddOctets(AttrAcctOutputOctets, AttrAcctOutputGigawords, u.TxBytes)
+			packets = append(packets, p)
+			break
+		}
+	}
+	// Drop sessions whose Stop was never seen
+	for key, s := range a.sessions {
+		if now.Sub(s.start) > MaxSessionAge {
+			delete(a.sessions, key)
+		}
+	}
+	a.mu.Unlock()
+
+	var firstErr error
+	for _, p := range packets {
+		if err := a.client.Send(ctx, p); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// packet creates an accounting packet with the attributes common to all status types
+func (s *session) packet(status uint32, now time.Time) *Packet {
+	p := &Packet{}
+	p.AddInt(AttrAcctStatusType, status)
+	p.AddString(AttrAcctSessionID, s.id)
+	p.AddString(AttrUserName, s.username)
+	p.AddString(AttrNASIdentifier, s.server)
+	p.AddString(AttrCallingStationID, s.clientIP)
+	p.AddIP(AttrFramedIPAddress, s.vpnIP)
+	p.AddInt(AttrNASPortType, NASPortTypeVirtual)
+	p.AddInt(AttrEventTimestamp, uint32(now.Unix()))
+	if status != StatusStart {
+		seconds := now.Sub(s.start).Seconds()
+		if seconds < 0 {
+			seconds = 0
+		}
+		p.AddInt(AttrAcctSessionTime, uint32(seconds))
+	}
+	return p
+}
+
+// sessionID derives a stable Acct-Session-Id from the session key and login time
+func sessionID(key string, start time.Time) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s|%d", key, start.Unix())))
+	return hex.EncodeToString(sum[:8])
+}
+
+// terminateCause maps an (enriched, normalized) ocserv disconnect reason to Acct-Terminate-Cause
+func terminateCause(reason string) uint32 {
+	reason = strings.ToLower(reason)
+	switch {
+	case reason == "user disconnected" || reason == "client bye":
+		return TerminateUserRequest
+	case strings.Contains(reason, "idle"):
+		return TerminateIdleTimeout
+	case strings.Contains(reason, "session timeout") || strings.Contains(reason, "expired"):
+		return TerminateSessionTimeout
+	case strings.Contains(reason, "dpd") || strings.Contains(reason, "mobile sleep") || strings.Contains(reason, "lost"):
+		return TerminateLostCarrier
+	case strings.Contains(reason, "admin") || strings.Contains(reason, "ban") || strings.Contains(reason, "disconnect request"):
+		return TerminateAdminReset
+	}
+	return TerminateNASRequest
+}
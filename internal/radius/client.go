@@ -0,0 +1,87 @@
+package radius
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// Client sends Accounting-Requests to a RADIUS accounting server over UDP
+type Client struct {
+	addr    string
+	secret  []byte
+	timeout time.Duration
+	retries int
+
+	mu     sync.Mutex
+	nextID byte
+}
+
+// NewClient creates a new accounting client
+// timeout applies to each attempt, retries is the number of retransmissions after the first attempt
+func NewClient(addr, secret string, timeout time.Duration, retries int) *Client {
+	if timeout <= 0 {
+		timeout = 3 * time.Second
+	}
+	if retries < 0 {
+		retries = 0
+	}
+	return &Client{addr: addr, secret: []byte(secret), timeout: timeout, retries: retries}
+}
+
+// Send transmits an Accounting-Request and waits for a valid Accounting-Response
+func (c *Client) Send(ctx context.Context, p *Packet) error {
+	c.mu.Lock()
+	p.Code = CodeAccountingRequest
+	p.Identifier = c.nextID
+	c.nextID++
+	c.mu.Unlock()
+
+	request, err := p.EncodeAccountingRequest(c.secret)
+	if err != nil {
+		return err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", c.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	buf := make([]byte, 4096)
+	var lastErr error
+	for attempt := 0; attempt <= c.retries; attempt++ {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if _, err := conn.Write(request); err != nil {
+			lastErr = err
+			continue
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(c.timeout))
+
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				lastErr = err
+				break
+			}
+			response := buf[:n]
+			if n < 20 || response[1] != p.Identifier {
+				continue // stale response to an earlier request
+			}
+			if response[0] != CodeAccountingResponse {
+				return fmt.Errorf("unexpected RADIUS response code %d", response[0])
+			}
+			if !VerifyResponse(response, p.Authenticator, c.secret) {
+				return errors.New("invalid RADIUS response authenticator (wrong shared secret?)")
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("no RADIUS accounting response from %s: %w", c.addr, lastErr)
+}
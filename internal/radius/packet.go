@@ -0,0 +1,201 @@
+package radius
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// Packet codes (RFC 2866)
+const (
+	CodeAccountingRequest  = 4
+	CodeAccountingResponse = 5
+)
+
+// Attribute types used for accounting (RFC 2865, RFC 2866, RFC 2869)
+const (
+	AttrUserName            = 1
+	AttrNASIPAddress        = 4
+	AttrFramedIPAddress     = 8
+	AttrCallingStationID    = 31
+	AttrNASIdentifier       = 32
+	AttrAcctStatusType      = 40
+	AttrAcctDelayTime       = 41
+	AttrAcctInputOctets     = 42
+	AttrAcctOutputOctets    = 43
+	AttrAcctSessionID       = 44
+	AttrAcctSessionTime     = 46
+	AttrAcctTerminateCause  = 49
+	AttrAcctInputGigawords  = 52
+	AttrAcctOutputGigawords = 53
+	AttrEventTimestamp      = 55
+	AttrNASPortType         = 61
+)
+
+// Acct-Status-Type values
+const (
+	StatusStart         = 1
+	StatusStop          = 2
+	StatusInterimUpdate = 3
+)
+
+// Acct-Terminate-Cause values
+const (
+	TerminateUserRequest    = 1
+	TerminateLostCarrier    = 2
+	TerminateIdleTimeout    = 4
+	TerminateSessionTimeout = 5
+	TerminateAdminReset     = 6
+	TerminateNASRequest     = 10
+)
+
+// NASPortTypeVirtual is the NAS-Port-Type of VPN sessions
+const NASPortTypeVirtual = 5
+
+// Attribute is a RADIUS attribute
+type Attribute struct {
+	Type  byte
+	Value []byte
+}
+
+// Packet is a RADIUS packet
+type Packet struct {
+	Code          byte
+	Identifier    byte
+	Authenticator [16]byte
+	Attributes    []Attribute
+}
+
+// AddString adds a text attribute
+func (p *Packet) AddString(t byte, s string) {
+	if s == "" {
+		return
+	}
+	if len(s) > 253 {
+		s = s[:253]
+	}
+	p.Attributes = append(p.Attributes, Attribute{Type: t, Value: []byte(s)})
+}
+
+// AddInt adds a 32-bit integer attribute
+func (p *Packet) AddInt(t byte, v uint32) {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	p.Attributes = append(p.Attributes, Attribute{Type: t, Value: b})
+}
+
+// AddIP adds an IPv4 address attribute (ignored for invalid or IPv6 addresses)
+func (p *Packet) AddIP(t byte, ip string) {
+	parsed := net.ParseIP(ip).To4()
+	if parsed == nil {
+		return
+	}
+	p.Attributes = append(p.Attributes, Attribute{Type: t, Value: []byte(parsed)})
+}
+
+// AddOctets adds a 64-bit byte count as an octets attribute plus its gigawords attribute
+func (p *Packet) AddOctets(octetsType, gigawordsType byte, n uint64) {
+	p.AddInt(octetsType, uint32(n))
+	if n>>32 > 0 {
+		p.AddInt(gigawordsType, uint32(n>>32))
+	}
+}
+
+// Attribute returns the first attribute of type t
+func (p *Packet) Attribute(t byte) ([]byte, bool) {
+	for _, a := range p.Attributes {
+		if a.Type == t {
+			return a.Value, true
+		}
+	}
+	return nil, false
+}
+
+// encode serializes the packet with the given authenticator
+func (p *Packet) encode(auth [16]byte) ([]byte, error) {
+	length := 20
+	for _, a := range p.Attributes {
+		if len(a.Value) > 253 {
+			return nil, fmt.Errorf("attribute %d too long", a.Type)
+		}
+		length += 2 + len(a.Value)
+	}
+	if length > 4096 {
+		return nil, errors.New("packet too long")
+	}
+
+	b := make([]byte, 20, length)
+	b[0] = p.Code
+	b[1] = p.Identifier
+	binary.BigEndian.PutUint16(b[2:4], uint16(length))
+	copy(b[4:20], auth[:])
+	for _, a := range p.Attributes {
+		b = append(b, a.Type, byte(2+len(a.Value)))
+		b = append(b, a.Value...)
+	}
+	return b, nil
+}
+
+// EncodeAccountingRequest serializes an Accounting-Request, computing its
+// Request Authenticator: MD5(Code+Identifier+Length+16 zero octets+Attributes+Secret)
+func (p *Packet) EncodeAccountingRequest(secret []byte) ([]byte, error) {
+	b, err := p.encode([16]byte{})
+	if err != nil {
+		return nil, err
+	}
+	h := md5.New()
+	h.Write(b)
+	h.Write(secret)
+	copy(b[4:20], h.Sum(nil))
+	copy(p.Authenticator[:], b[4:20])
+	return b, nil
+}
+
+// Decode parses a RADIUS packet
+func Decode(b []byte) (*Packet, error) {
+	if len(b) < 20 {
+		return nil, errors.New("packet too short")
+	}
+	length := int(binary.BigEndian.Uint16(b[2:4]))
+	if length < 20 || length > len(b) {
+		return nil, errors.New("invalid packet length")
+	}
+
+	p := &Packet{Code: b[0], Identifier: b[1]}
+	copy(p.Authenticator[:], b[4:20])
+	for rest := b[20:length]; len(rest) > 0; {
+		if len(rest) < 2 || int(rest[1]) < 2 || int(rest[1]) > len(rest) {
+			return nil, errors.New("invalid attribute")
+		}
+		p.Attributes = append(p.Attributes, Attribute{Type: rest[0], Value: append([]byte(nil), rest[2:rest[1]]...)})
+		rest = rest[rest[1]:]
+	}
+	return p, nil
+}
+
+// VerifyResponse checks a response authenticator:
+// MD5(Code+Identifier+Length+Request Authenticator+Attributes+Secret)
+func VerifyResponse(response []byte, requestAuth [16]byte, secret []byte) bool {
+	if len(response) < 20 {
+		return false
+	}
+	length := int(binary.BigEndian.Uint16(response[2:4]))
+	if length < 20 || length > len(response) {
+		return false
+	}
+
+	h := md5.New()
+	h.Write(response[:4])
+	h.Write(requestAuth[:])
+	h.Write(response[20:length])
+	h.Write(secret)
+	sum := h.Sum(nil)
+	for i := 0; i < 16; i++ {
+		if sum[i] != response[4+i] {
+			return false
+		}
+	}
+	return true
+}
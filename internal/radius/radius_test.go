@@ -0,0 +1,126 @@
+package radius
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mogilevich/ocserv_exporter/internal/collector"
+)
+
+// fakeServer answers Accounting-Requests with valid responses and records the requests
+func fakeServer(t *testing.T, secret string) (addr string, requests chan *Packet) {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	requests = make(chan *Packet, 10)
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			req := buf[:n]
+
+			// Drop requests with an invalid authenticator, like a real server would
+			check := append([]byte(nil), req...)
+			copy(check[4:20], make([]byte, 16))
+			sum := md5.Sum(append(check, secret...))
+			if string(sum[:]) != string(req[4:20]) {
+				continue
+			}
+
+			p, err := Decode(req)
+			if err != nil {
+				t.Errorf("decode: %v", err)
+				continue
+			}
+			requests <- p
+
+			resp := make([]byte, 20)
+			resp[0] = CodeAccountingResponse
+			resp[1] = req[1]
+			binary.BigEndian.PutUint16(resp[2:4], 20)
+			copy(resp[4:20], req[4:20])
+			respSum := md5.Sum(append(append([]byte(nil), resp...), secret...))
+			copy(resp[4:20], respSum[:])
+			conn.WriteTo(resp, from)
+		}
+	}()
+	return conn.LocalAddr().String(), requests
+}
+
+func attrInt(t *testing.T, p *Packet, attr byte) uint32 {
+	t.Helper()
+	v, ok := p.Attribute(attr)
+	if !ok || len(v) != 4 {
+		t.Fatalf("attribute %d missing", attr)
+	}
+	return binary.BigEndian.Uint32(v)
+}
+
+func TestAccountingLifecycle(t *testing.T) {
+	addr, requests := fakeServer(t, "s3cret")
+	acct := NewAccountant(NewClient(addr, "s3cret", time.Second, 1))
+	ctx := context.Background()
+	start := time.Unix(1700000000, 0)
+
+	login := &collector.Event{Time: start, Server: "ocserv", Type: "login", Username: "bob", ClientIP: "203.0.113.7", Port: 5000}
+	vpnIP := &collector.Event{Time: start, Server: "ocserv", Type: "vpn_ip_assigned", Username: "bob", VpnIP: "10.88.0.5"}
+	if err := acct.HandleEvents(ctx, []*collector.Event{login, vpnIP}); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	startPkt := <-requests
+	if attrInt(t, startPkt, AttrAcctStatusType) != StatusStart {
+		t.Errorf("first packet is not Accounting-Start")
+	}
+	sid, _ := startPkt.Attribute(AttrAcctSessionID)
+
+	usage := []Usage{{Username: "bob", ClientIP: "203.0.113.7", RxBytes: 5 << 32, TxBytes: 1000}}
+	if err := acct.Interim(ctx, "ocserv", usage, start.Add(time.Minute)); err != nil {
+		t.Fatalf("interim: %v", err)
+	}
+	interim := <-requests
+	if attrInt(t, interim, AttrAcctStatusType) != StatusInterimUpdate ||
+		attrInt(t, interim, AttrAcctInputGigawords) != 5 || attrInt(t, interim, AttrAcctSessionTime) != 60 {
+		t.Errorf("unexpected interim packet: %+v", interim)
+	}
+	if ip, _ := interim.Attribute(AttrFramedIPAddress); net.IP(ip).String() != "10.88.0.5" {
+		t.Errorf("Framed-IP-Address = %v", net.IP(ip))
+	}
+
+	disconnect := &collector.Event{Time: start.Add(time.Hour), Server: "ocserv", Type: "disconnect", Username: "bob",
+		ClientIP: "203.0.113.7", Port: 5000, Reason: "idle timeout", RxBytes: 2000, TxBytes: 3000}
+	if err := acct.HandleEvents(ctx, []*collector.Event{disconnect}); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	stop := <-requests
+	stopSid, _ := stop.Attribute(AttrAcctSessionID)
+	if attrInt(t, stop, AttrAcctStatusType) != StatusStop || string(stopSid) != string(sid) {
+		t.Errorf("stop packet status/session id mismatch")
+	}
+	if attrInt(t, stop, AttrAcctOutputOctets) != 3000 || attrInt(t, stop, AttrAcctTerminateCause) != TerminateIdleTimeout ||
+		attrInt(t, stop, AttrAcctSessionTime) != 3600 {
+		t.Errorf("unexpected stop packet: %+v", stop)
+	}
+}
+
+func TestWrongSecret(t *testing.T) {
+	addr, _ := fakeServer(t, "right")
+	client := NewClient(addr, "wrong", 200*time.Millisecond, 0)
+
+	p := &Packet{}
+	p.AddInt(AttrAcctStatusType, StatusStart)
+	if err := client.Send(context.Background(), p); err == nil {
+		t.Error("Send() with wrong secret succeeded")
+	}
+}
@@ -0,0 +1,172 @@
+package rdns
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Private is returned for private and loopback addresses (not looked up)
+	Private = "private"
+	// Unresolved is returned when an address has no PTR record or the lookup failed
+	Unresolved = "unresolved"
+
+	// maxCacheEntries bounds the cache; expired entries are dropped first when it is full
+	maxCacheEntries = 10000
+	// maxPending bounds the lookups running in the background (see CachedDomain)
+	maxPending = 64
+)
+
+type cacheEntry struct {
+	name    string
+	expires time.Time
+}
+
+// Resolver performs cached reverse DNS (PTR) lookups of client IPs
+type Resolver struct {
+	timeout time.Duration
+	ttl     time.Duration
+	lookup  func(ctx context.Context, addr string) ([]string, error)
+
+	mu      sync.Mutex
+	cache   map[string]cacheEntry
+	pending map[string]bool // addresses being looked up in the background
+}
+
+// NewResolver creates a new reverse DNS resolver
+// timeout bounds a single lookup, ttl is how long results (including failures) are cached
+func NewResolver(timeout, ttl time.Duration) *Resolver {
+	return &Resolver{
+		timeout: timeout,
+		ttl:     ttl,
+		lookup:  net.DefaultResolver.LookupAddr,
+		cache:   make(map[string]cacheEntry),
+		pending: make(map[string]bool),
+	}
+}
+
+// Lookup returns the PTR host name of an IP address (without trailing dot),
+// Private for private addresses or Unresolved if there is none
+func (r *Resolver) Lookup(ipStr string) string {
+	ip := net.ParseIP(ipStr)
+	if ip == nil {
+		return Unresolved
+	}
+	if ip.IsPrivate() || ip.IsLoopback() {
+		return Private
+	}
+
+	r.mu.Lock()
+	name, ok := r.cachedLocked(ipStr, time.Now())
+	r.mu.Unlock()
+	if ok {
+		return name
+	}
+	return r.resolve(ipStr)
+}
+
+// LookupDomain returns the domain of the PTR host name of an IP address,
+// e.g. "amazonaws.com" for "ec2-3-120-1-1.eu-central-1.compute.amazonaws.com".
+// It identifies the network operator (hosting provider, ISP) with low cardinality.
+func (r *Resolver) LookupDomain(ipStr string) string {
+	return Domain(r.Lookup(ipStr))
+}
+
+// CachedDomain is LookupDomain without waiting for DNS: an address not in the cache returns ""
+// and is looked up in the background, so later calls find it. Lookups beyond maxPending
+// running at once are skipped and tried again on a later call.
+func (r *Resolver) CachedDomain(ipStr string) string {
+	ip := net.ParseIP(ipStr)
+	if ip == nil {
+		return Unresolved
+	}
+	if ip.IsPrivate() || ip.IsLoopback() {
+		return Private
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if name, ok := r.cachedLocked(ipStr, time.Now()); ok {
+		return Domain(name)
+	}
+	if !r.pending[ipStr] && len(r.pending) < maxPending {
+		r.pending[ipStr] = true
+		go func() {
+			r.resolve(ipStr)
+			r.mu.Lock()
+			delete(r.pending, ipStr)
+			r.mu.Unlock()
+		}()
+	}
+	return ""
+}
+
+// cachedLocked returns the cached name of an address. Must be called with r.mu held.
+func (r *Resolver) cachedLocked(ipStr string, now time.Time) (string, bool) {
+	entry, ok := r.cache[ipStr]
+	if !ok || !now.Before(entry.expires) {
+		return "", false
+	}
+	return entry.name, true
+}
+
+// resolve looks up the PTR record of an address and caches the result
+func (r *Resolver) resolve(ipStr string) string {
+	name := Unresolved
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	names, err := r.lookup(ctx, ipStr)
+	cancel()
+	if err == nil && len(names) > 0 {
+		name = strings.TrimSuffix(strings.ToLower(names[0]), ".")
+	}
+
+	now := time.Now()
+	r.mu.Lock()
+	if len(r.cache) >= maxCacheEntries {
+		r.pruneLocked(now)
+	}
+	r.cache[ipStr] = cacheEntry{name: name, expires: now.Add(r.ttl)}
+	r.mu.Unlock()
+
+	return name
+}
+
+// pruneLocked drops expired entries, or the whole cache if none expired.
+// Must be called with r.mu held.
+func (r *Resolver) pruneLocked(now time.Time) {
+	for ip, entry := range r.cache {
+		if now.After(entry.expires) {
+			delete(r.cache, ip)
+		}
+	}
+	if len(r.cache) >= maxCacheEntries {
+		r.cache = make(map[string]cacheEntry)
+	}
+}
+
+// Domain returns the registered domain of a host name: the last two labels,
+// or three when the second-level label is a short public suffix such as "co.uk".
+// Private and Unresolved are returned unchanged.
+func Domain(host string) string {
+	if host == Private || host == Unresolved {
+		return host
+	}
+
+	labels := strings.Split(host, ".")
+	if len(labels) <= 2 {
+		return host
+	}
+
+	n := 2
+	tld, sld := labels[len(labels)-1], labels[len(labels)-2]
+	if len(tld) == 2 && (len(sld) <= 3 || sld == "com" || sld == "net" || sld == "org") {
+		n = 3
+	}
+	if n > len(labels) {
+		n = len(labels)
+	}
+	return strings.Join(labels[len(labels)-n:], ".")
+}
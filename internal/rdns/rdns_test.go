@@ -0,0 +1,84 @@
+package rdns
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDomain(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"ec2-3-120-1-1.eu-central-1.compute.amazonaws.com", "amazonaws.com"},
+		{"static.1.2.3.4.clients.your-server.de", "your-server.de"},
+		{"host-1-2-3-4.dynamic.bt.co.uk", "bt.co.uk"},
+		{"example.com", "example.com"},
+		{Unresolved, Unresolved},
+		{Private, Private},
+	}
+
+	for _, tt := range tests {
+		if got := Domain(tt.host); got != tt.want {
+			t.Errorf("Domain(%q) = %q, want %q", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestResolverCache(t *testing.T) {
+	calls := 0
+	r := NewResolver(time.Second, time.Hour)
+	r.lookup = func(ctx context.Context, addr string) ([]string, error) {
+		calls++
+		if addr == "203.0.113.9" {
+			return nil, errors.New("no such host")
+		}
+		return []string{"Scanner.Example.NET."}, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		if got := r.Lookup("198.51.100.7"); got != "scanner.example.net" {
+			t.Fatalf("Lookup() = %q, want scanner.example.net", got)
+		}
+	}
+	if got := r.Lookup("203.0.113.9"); got != Unresolved {
+		t.Errorf("Lookup() = %q, want %q", got, Unresolved)
+	}
+	r.Lookup("203.0.113.9")
+	if got := r.Lookup("10.1.2.3"); got != Private {
+		t.Errorf("Lookup() = %q, want %q", got, Private)
+	}
+	if calls != 2 {
+		t.Errorf("lookups = %d, want 2 (results must be cached)", calls)
+	}
+}
+
+func TestCachedDomain(t *testing.T) {
+	release := make(chan struct{})
+	r := NewResolver(time.Second, time.Hour)
+	r.lookup = func(ctx context.Context, addr string) ([]string, error) {
+		<-release
+		return []string{"ec2-3-120-1-1.eu-central-1.compute.amazonaws.com."}, nil
+	}
+
+	// A cache miss returns at once while the lookup runs in the background
+	for i := 0; i < 2; i++ {
+		if got := r.CachedDomain("3.120.1.1"); got != "" {
+			t.Fatalf("CachedDomain() = %q before the lookup finished, want empty", got)
+		}
+	}
+	if got := r.CachedDomain("10.1.2.3"); got != Private {
+		t.Errorf("CachedDomain() = %q, want %q", got, Private)
+	}
+	close(release)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for r.CachedDomain("3.120.1.1") != "amazonaws.com" {
+		if time.Now().After(deadline) {
+			t.Fatal("background lookup did not fill the cache")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
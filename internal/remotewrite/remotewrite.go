@@ -0,0 +1,217 @@
+package remotewrite
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/klauspost/compress/s2"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Config configures a remote write client
+type Config struct {
+	URL            string
+	Timeout        time.Duration
+	Username       string            // basic auth (optional)
+	Password       string            // basic auth (optional)
+	BearerToken    string            // bearer token auth (optional, takes precedence over basic auth)
+	ExternalLabels map[string]string // added to every series (don't override series labels)
+	UserAgent      string
+}
+
+// Client sends metric families to a Prometheus remote write endpoint
+// (Prometheus, Mimir, VictoriaMetrics, Thanos receive) using remote write protocol 1.0
+type Client struct {
+	cfg    Config
+	client *http.Client
+}
+
+// Label is a series label
+type Label struct {
+	Name  string
+	Value string
+}
+
+// TimeSeries is a single series with its samples
+type TimeSeries struct {
+	Labels []Label
+	Value  float64
+	Time   int64 // milliseconds since epoch
+}
+
+// NewClient creates a new remote write client
+func NewClient(cfg Config) *Client {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.UserAgent == "" {
+		cfg.UserAgent = "ocserv_exporter"
+	}
+	return &Client{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+// Send converts metric families to series sampled at ts and writes them to the endpoint.
+// Returns the number of series sent.
+func (c *Client) Send(ctx context.Context, families []*dto.MetricFamily, ts time.Time) (int, error) {
+	series := Convert(families, ts, c.cfg.ExternalLabels)
+	if len(series) == 0 {
+		return 0, nil
+	}
+
+	body := s2.EncodeSnappy(nil, Encode(series))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	req.Header.Set("User-Agent", c.cfg.UserAgent)
+	switch {
+	case c.cfg.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+c.cfg.BearerToken)
+	case c.cfg.Username != "":
+		req.SetBasicAuth(c.cfg.Username, c.cfg.Password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return 0, fmt.Errorf("remote write returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	return len(series), nil
+}
+
+// Convert flattens metric families into series the way Prometheus would store them after a scrape:
+// histograms become _bucket/_sum/_count, summaries become quantiles plus _sum/_count
+func Convert(families []*dto.MetricFamily, ts time.Time, external map[string]string) []TimeSeries {
+	ms := ts.UnixMilli()
+	var series []TimeSeries
+
+	for _, mf := range families {
+		name := mf.GetName()
+		for _, m := range mf.GetMetric() {
+			add := func(suffix string, value float64, extra ...Label) {
+				series = append(series, TimeSeries{
+					Labels: seriesLabels(name+suffix, m.GetLabel(), external, extra...),
+					Value:  value,
+					Time:   ms,
+				})
+			}
+
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				add("", m.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				add("", m.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				add("", m.GetUntyped().GetValue())
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				for _, q := range s.GetQuantile() {
+					add("", q.GetValue(), Label{"quantile", formatFloat(q.GetQuantile())})
+				}
+				add("_sum", s.GetSampleSum())
+				add("_count", float64(s.GetSampleCount()))
+			case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+				h := m.GetHistogram()
+				hasInf := false
+				for _, b := range h.GetBucket() {
+					if math.IsInf(b.GetUpperBound(), 1) {
+						hasInf = true
+					}
+					add("_bucket", float64(b.GetCumulativeCount()), Label{"le", formatFloat(b.GetUpperBound())})
+				}
+				if !hasInf {
+					add("_bucket", float64(h.GetSampleCount()), Label{"le", "+Inf"})
+				}
+				add("_sum", h.GetSampleSum())
+				add("_count", float64(h.GetSampleCount()))
+			}
+		}
+	}
+
+	return series
+}
+
+// seriesLabels builds the sorted label set of a series
+func seriesLabels(name string, pairs []*dto.LabelPair, external map[string]string, extra ...Label) []Label {
+	labels := make([]Label, 0, len(pairs)+len(external)+len(extra)+1)
+	labels = append(labels, Label{"__name__", name})
+	seen := make(map[string]bool, len(pairs)+len(extra))
+	for _, p := range pairs {
+		labels = append(labels, Label{p.GetName(), p.GetValue()})
+		seen[p.GetName()] = true
+	}
+	for _, l := range extra {
+		labels = append(labels, l)
+		seen[l.Name] = true
+	}
+	for name, value := range external {
+		if !seen[name] {
+			labels = append(labels, Label{name, value})
+		}
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+	return labels
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// Encode serializes series as a prometheus.WriteRequest protobuf message:
+//
+//	message WriteRequest { repeated TimeSeries timeseries = 1; }
+//	message TimeSeries   { repeated Label labels = 1; repeated Sample samples = 2; }
+//	message Label        { string name = 1; string value = 2; }
+//	message Sample       { double value = 1; int64 timestamp = 2; }
+func Encode(series []TimeSeries) []byte {
+	var buf, ts, sub []byte
+	for _, s := range series {
+		ts = ts[:0]
+		for _, l := range s.Labels {
+			sub = sub[:0]
+			sub = protowire.AppendTag(sub, 1, protowire.BytesType)
+			sub = protowire.AppendString(sub, l.Name)
+			sub = protowire.AppendTag(sub, 2, protowire.BytesType)
+			sub = protowire.AppendString(sub, l.Value)
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, sub)
+		}
+
+		sub = sub[:0]
+		sub = protowire.AppendTag(sub, 1, protowire.Fixed64Type)
+		sub = protowire.AppendFixed64(sub, math.Float64bits(s.Value))
+		sub = protowire.AppendTag(sub, 2, protowire.VarintType)
+		sub = protowire.AppendVarint(sub, uint64(s.Time))
+		ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, sub)
+
+		buf = protowire.AppendTag(buf, 1, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, ts)
+	}
+	return buf
+}
@@ -0,0 +1,137 @@
+package remotewrite
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// decode parses a WriteRequest produced by Encode back into series
+func decode(t *testing.T, b []byte) []TimeSeries {
+	t.Helper()
+
+	var series []TimeSeries
+	for len(b) > 0 {
+		_, _, n := protowire.ConsumeTag(b)
+		tsBytes, m := protowire.ConsumeBytes(b[n:])
+		if m < 0 {
+			t.Fatalf("bad timeseries")
+		}
+		b = b[n+m:]
+
+		var s TimeSeries
+		for len(tsBytes) > 0 {
+			num, _, n := protowire.ConsumeTag(tsBytes)
+			msg, m := protowire.ConsumeBytes(tsBytes[n:])
+			tsBytes = tsBytes[n+m:]
+			switch num {
+			case 1:
+				var l Label
+				for len(msg) > 0 {
+					f, _, n := protowire.ConsumeTag(msg)
+					v, m := protowire.ConsumeString(msg[n:])
+					msg = msg[n+m:]
+					if f == 1 {
+						l.Name = v
+					} else {
+						l.Value = v
+					}
+				}
+				s.Labels = append(s.Labels, l)
+			case 2:
+				_, _, n := protowire.ConsumeTag(msg)
+				v, m := protowire.ConsumeFixed64(msg[n:])
+				s.Value = math.Float64frombits(v)
+				msg = msg[n+m:]
+				_, _, n = protowire.ConsumeTag(msg)
+				tsv, _ := protowire.ConsumeVarint(msg[n:])
+				s.Time = int64(tsv)
+			}
+		}
+		series = append(series, s)
+	}
+	return series
+}
+
+func TestSend(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_total", Help: "test"}, []string{"server"})
+	hist := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test_seconds", Help: "test", Buckets: []float64{1, 10}})
+	reg.MustRegister(counter, hist)
+	counter.WithLabelValues("ocserv").Add(3)
+	hist.Observe(5)
+
+	var got []TimeSeries
+	var headers http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header
+		body, _ := io.ReadAll(r.Body)
+		raw, err := s2.Decode(nil, body)
+		if err != nil {
+			t.Errorf("snappy decode: %v", err)
+		}
+		got = decode(t, raw)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewClient(Config{URL: srv.URL, BearerToken: "secret", ExternalLabels: map[string]string{"cluster": "edge", "server": "default"}})
+	ts := time.UnixMilli(1700000000000)
+	n, err := client.Send(context.Background(), families, ts)
+	if err != nil {
+		t.Fatalf("Send() error: %v", err)
+	}
+
+	// counter + 3 buckets (1, 10, +Inf) + sum + count
+	if n != 6 || len(got) != 6 {
+		t.Fatalf("sent %d series, received %d, want 6", n, len(got))
+	}
+	if headers.Get("Authorization") != "Bearer secret" || headers.Get("Content-Encoding") != "snappy" {
+		t.Errorf("unexpected headers: %v", headers)
+	}
+
+	want := map[string]float64{
+		`test_total{cluster="edge",server="ocserv"}`:                     3,
+		`test_seconds_bucket{cluster="edge",le="1",server="default"}`:    0,
+		`test_seconds_bucket{cluster="edge",le="10",server="default"}`:   1,
+		`test_seconds_bucket{cluster="edge",le="+Inf",server="default"}`: 1,
+		`test_seconds_sum{cluster="edge",server="default"}`:              5,
+		`test_seconds_count{cluster="edge",server="default"}`:            1,
+	}
+	for _, s := range got {
+		key := ""
+		labels := ""
+		for _, l := range s.Labels {
+			if l.Name == "__name__" {
+				key = l.Value
+				continue
+			}
+			if labels != "" {
+				labels += ","
+			}
+			labels += l.Name + `="` + l.Value + `"`
+		}
+		key += "{" + labels + "}"
+		v, ok := want[key]
+		if !ok {
+			t.Errorf("unexpected series %s", key)
+			continue
+		}
+		if s.Value != v || s.Time != ts.UnixMilli() {
+			t.Errorf("%s = %v @%d, want %v @%d", key, s.Value, s.Time, v, ts.UnixMilli())
+		}
+	}
+}
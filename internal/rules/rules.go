@@ -0,0 +1,120 @@
+// Package rules generates Prometheus alerting rules for the exporter's metrics.
+package rules
+
+import (
+	"fmt"
+	"time"
+
+	"go.yaml.in/yaml/v2"
+)
+
+// Options selects and parameterizes the generated alerts
+type Options struct {
+	Job string // scrape job name of the exporter (for the up alert)
+
+	BruteForceAttempts int           // failed logins from one IP ...
+	BruteForceWindow   time.Duration // ... within this window
+	JournalLag         time.Duration // maximum time without a processed log event
+	CertExpiry         time.Duration // warn this long before the server certificate expires
+	PoolUsage          float64       // IP pool usage ratio (0-1)
+
+	Occtl      bool // occtl alerts (--occtl.enabled)
+	OcservConf bool // ocserv.conf alerts: certificate expiry, pool exhaustion (--ocserv.config)
+}
+
+// DefaultOptions are the thresholds used when generating rules without flags
+var DefaultOptions = Options{
+	Job:                "ocserv",
+	BruteForceAttempts: 20,
+	BruteForceWindow:   10 * time.Minute,
+	JournalLag:         time.Hour,
+	CertExpiry:         14 * 24 * time.Hour,
+	PoolUsage:          0.9,
+}
+
+type ruleFile struct {
+	Groups []group `yaml:"groups"`
+}
+
+type group struct {
+	Name  string `yaml:"name"`
+	Rules []rule `yaml:"rules"`
+}
+
+type rule struct {
+	Alert       string            `yaml:"alert"`
+	Expr        string            `yaml:"expr"`
+	For         string            `yaml:"for,omitempty"`
+	Labels      map[string]string `yaml:"labels"`
+	Annotations map[string]string `yaml:"annotations"`
+}
+
+func alert(name, expr string, wait time.Duration, severity, summary, description string) rule {
+	r := rule{
+		Alert:       name,
+		Expr:        expr,
+		Labels:      map[string]string{"severity": severity},
+		Annotations: map[string]string{"summary": summary, "description": description},
+	}
+	if wait > 0 {
+		r.For = promDuration(wait)
+	}
+	return r
+}
+
+// Generate returns a Prometheus rule file (YAML) for opts
+func Generate(opts Options) ([]byte, error) {
+	if opts.BruteForceAttempts <= 0 || opts.BruteForceWindow <= 0 {
+		return nil, fmt.Errorf("brute force threshold and window must be positive")
+	}
+	if opts.PoolUsage <= 0 || opts.PoolUsage > 1 {
+		return nil, fmt.Errorf("pool usage must be in (0, 1], got %g", opts.PoolUsage)
+	}
+
+	rules := []rule{
+		alert("OcservExporterDown",
+			fmt.Sprintf(`up{job=%q} == 0`, opts.Job), 5*time.Minute, "critical",
+			"ocserv exporter is down",
+			"ocserv-exporter instance {{ $labels.instance }} is not responding"),
+		alert("OcservJournalLag",
+			fmt.Sprintf("time() - ocserv_last_event_timestamp_seconds > %d", int64(opts.JournalLag.Seconds())), 5*time.Minute, "warning",
+			"ocserv exporter is not receiving log events",
+			fmt.Sprintf("No ocserv log event processed by {{ $labels.instance }} for over %s; check journald access", promDuration(opts.JournalLag))),
+		alert("OcservBruteForce",
+			fmt.Sprintf("sum by (server, client_ip) (increase(ocserv_auth_failed_total[%s])) > %d", promDuration(opts.BruteForceWindow), opts.BruteForceAttempts), 0, "warning",
+			"Possible VPN brute force attack",
+			fmt.Sprintf("{{ $value | printf \"%%.0f\" }} failed logins from {{ $labels.client_ip }} on {{ $labels.server }} within %s", promDuration(opts.BruteForceWindow))),
+	}
+	if opts.Occtl {
+		rules = append(rules, alert("OcservOcctlDown",
+			"ocserv_occtl_up == 0", 5*time.Minute, "warning",
+			"occtl polling fails",
+			"occtl polling of {{ $labels.server }} fails; server statistics are stale"))
+	}
+	if opts.OcservConf {
+		rules = append(rules,
+			alert("OcservCertExpiringSoon",
+				fmt.Sprintf("ocserv_config_server_cert_expiry_timestamp_seconds - time() < %d", int64(opts.CertExpiry.Seconds())), time.Hour, "warning",
+				"VPN server certificate expires soon",
+				"server-cert of {{ $labels.server }}/{{ $labels.vhost }} expires in {{ $value | humanizeDuration }}"),
+			alert("OcservIPPoolExhaustion",
+				fmt.Sprintf("ocserv_ip_pool_used / ocserv_ip_pool_size > %g", opts.PoolUsage), 10*time.Minute, "warning",
+				"VPN IP pool almost exhausted",
+				"IP pool of {{ $labels.server }}/{{ $labels.vhost }} is {{ $value | humanizePercentage }} used"))
+	}
+
+	return yaml.Marshal(ruleFile{Groups: []group{{Name: "ocserv", Rules: rules}}})
+}
+
+// promDuration formats d in Prometheus duration syntax using the largest exact unit
+func promDuration(d time.Duration) string {
+	switch {
+	case d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	}
+	return fmt.Sprintf("%ds", (d+time.Second-1)/time.Second)
+}
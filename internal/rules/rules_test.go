@@ -0,0 +1,62 @@
+package rules
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"go.yaml.in/yaml/v2"
+)
+
+func TestGenerate(t *testing.T) {
+	opts := DefaultOptions
+	opts.BruteForceAttempts = 50
+	opts.Occtl = true
+
+	data, err := Generate(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file ruleFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		t.Fatalf("invalid YAML: %v", err)
+	}
+
+	exprs := make(map[string]string)
+	for _, r := range file.Groups[0].Rules {
+		exprs[r.Alert] = r.Expr
+	}
+	if got := exprs["OcservBruteForce"]; got != "sum by (server, client_ip) (increase(ocserv_auth_failed_total[10m])) > 50" {
+		t.Errorf("brute force expr = %q", got)
+	}
+	if _, ok := exprs["OcservOcctlDown"]; !ok {
+		t.Error("occtl alert missing")
+	}
+	if _, ok := exprs["OcservCertExpiringSoon"]; ok {
+		t.Error("cert alert generated without ocserv.conf metrics")
+	}
+	if !strings.Contains(string(data), `up{job="ocserv"} == 0`) {
+		t.Error("up alert missing")
+	}
+}
+
+func TestGenerateInvalid(t *testing.T) {
+	opts := DefaultOptions
+	opts.PoolUsage = 90
+	if _, err := Generate(opts); err == nil {
+		t.Error("Generate() accepted pool usage > 1")
+	}
+}
+
+func TestPromDuration(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		336 * time.Hour:         "14d",
+		90 * time.Minute:        "90m",
+		time.Hour:               "1h",
+		1500 * time.Millisecond: "2s",
+	} {
+		if got := promDuration(d); got != want {
+			t.Errorf("promDuration(%s) = %q, want %q", d, got, want)
+		}
+	}
+}
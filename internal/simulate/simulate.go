@@ -0,0 +1,308 @@
+// Package simulate generates synthetic ocserv log streams for load tests of the exporter and of
+// dashboards: users connect at a configurable rate, some fail to authenticate, sessions last an
+// exponentially distributed time and some end with an error, after which the user reconnects.
+package simulate
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Defaults of Config
+const (
+	DefaultUsers           = 1000
+	DefaultRate            = 1.0
+	DefaultFailureRatio    = 0.05
+	DefaultErrorRatio      = 0.1
+	DefaultSessionDuration = 30 * time.Minute
+)
+
+// Config configures the simulated servers and their users
+type Config struct {
+	Servers         []string      // unit names of the simulated servers (default "ocserv")
+	Users           int           // distinct usernames
+	Rate            float64       // new connection attempts per second, over all servers
+	FailureRatio    float64       // share of attempts failing authentication (0-1)
+	ErrorRatio      float64       // share of sessions ending with an error and a reconnect (0-1)
+	SessionDuration time.Duration // mean session duration
+	Duration        time.Duration // simulated time to generate, 0 for no limit
+	Speed           float64       // simulated seconds per second of wall clock time, 0 for as fast as possible
+	Seed            uint64        // random seed, 0 for a random one
+	Start           time.Time     // timestamp of the first event (default now)
+}
+
+// Validate checks the configuration and fills in defaults
+func (c *Config) Validate() error {
+	if len(c.Servers) == 0 {
+		c.Servers = []string{"ocserv"}
+	}
+	if c.Users <= 0 {
+		return errors.New("users must be positive")
+	}
+	if c.Rate <= 0 {
+		return errors.New("rate must be positive")
+	}
+	if c.FailureRatio < 0 || c.FailureRatio > 1 || c.ErrorRatio < 0 || c.ErrorRatio > 1 {
+		return errors.New("failure and error ratios must be between 0 and 1")
+	}
+	if c.SessionDuration <= 0 {
+		return errors.New("session duration must be positive")
+	}
+	if c.Speed < 0 {
+		return errors.New("speed must not be negative")
+	}
+	if c.Seed == 0 {
+		c.Seed = rand.Uint64()
+	}
+	if c.Start.IsZero() {
+		c.Start = time.Now()
+	}
+	return nil
+}
+
+// Ends of a session that are not "user disconnected"
+var errorReasons = []string{"unspecified error", "DPD timeout", "idle timeout", "session timeout"}
+
+// User agents of the simulated clients
+var userAgents = []string{
+	"AnyConnect Windows 4.10.07061",
+	"AnyConnect Darwin_i386 4.10.05095",
+	"AnyConnect Android 4.10.05096",
+	"Open AnyConnect VPN Agent v9.12",
+	"OpenConnect-GUI 1.5.3 v8.10",
+}
+
+// Line is a log line of a simulated server
+type Line struct {
+	Timestamp time.Time
+	Unit      string // server, e.g. "ocserv"
+	Message   string
+}
+
+// session is a simulated session between its login and disconnect
+type session struct {
+	server   string
+	user     int
+	clientIP string
+	port     int
+	vpnIP    string
+	id       string
+	start    time.Time
+}
+
+// action is a scheduled connection attempt (session nil) or disconnect
+type action struct {
+	at      time.Time
+	seq     int // keeps actions at the same time in scheduling order
+	user    int
+	session *session
+}
+
+// schedule orders actions by time
+type schedule []*action
+
+func (s schedule) Len() int { return len(s) }
+func (s schedule) Less(i, j int) bool {
+	if s[i].at.Equal(s[j].at) {
+		return s[i].seq < s[j].seq
+	}
+	return s[i].at.Before(s[j].at)
+}
+func (s schedule) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s *schedule) Push(x any)   { *s = append(*s, x.(*action)) }
+func (s *schedule) Pop() any {
+	old := *s
+	a := old[len(old)-1]
+	*s = old[:len(old)-1]
+	return a
+}
+
+// Simulator generates the log lines of the simulated servers in timestamp order. Next returns
+// io.EOF after Config.Duration or once the simulator is closed.
+type Simulator struct {
+	cfg         Config
+	rng         *rand.Rand
+	actions     schedule
+	seq         int
+	nextAttempt time.Time
+	ready       []Line
+	sessions    int // sessions started, for ports, session IDs and VPN IPs
+	wallStart   time.Time
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// New creates a simulator; cfg must have been validated
+func New(cfg Config) *Simulator {
+	return &Simulator{
+		cfg:         cfg,
+		rng:         rand.New(rand.NewPCG(cfg.Seed, cfg.Seed>>1)),
+		nextAttempt: cfg.Start,
+		closed:      make(chan struct{}),
+	}
+}
+
+// Next returns the next log line, waiting until it is due when Config.Speed is set
+func (s *Simulator) Next() (*Line, error) {
+	for len(s.ready) == 0 {
+		if !s.step() {
+			return nil, io.EOF
+		}
+	}
+	line := s.ready[0]
+	s.ready = s.ready[1:]
+	if err := s.wait(line.Timestamp); err != nil {
+		return nil, err
+	}
+	return &line, nil
+}
+
+// Close stops the simulator; a blocked Next returns io.EOF
+func (s *Simulator) Close() error {
+	s.closeOnce.Do(func() { close(s.closed) })
+	return nil
+}
+
+// wait sleeps until the wall clock time of a simulated timestamp
+func (s *Simulator) wait(ts time.Time) error {
+	select {
+	case <-s.closed:
+		return io.EOF
+	default:
+	}
+	if s.cfg.Speed == 0 {
+		return nil
+	}
+	if s.wallStart.IsZero() {
+		s.wallStart = time.Now()
+	}
+	due := s.wallStart.Add(time.Duration(float64(ts.Sub(s.cfg.Start)) / s.cfg.Speed))
+	delay := time.Until(due)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-s.closed:
+		return io.EOF
+	case <-timer.C:
+		return nil
+	}
+}
+
+// step runs the next scheduled action or connection attempt; false once Config.Duration is over
+func (s *Simulator) step() bool {
+	next := s.nextAttempt
+	var a *action
+	if len(s.actions) > 0 && s.actions[0].at.Before(next) {
+		a = heap.Pop(&s.actions).(*action)
+		next = a.at
+	}
+	if s.cfg.Duration > 0 && next.Sub(s.cfg.Start) >= s.cfg.Duration {
+		return false
+	}
+
+	switch {
+	case a == nil:
+		// Attempts arrive as a Poisson process
+		s.nextAttempt = next.Add(time.Duration(s.rng.ExpFloat64() / s.cfg.Rate * float64(time.Second)))
+		s.attempt(next, s.rng.IntN(s.cfg.Users))
+	case a.session == nil:
+		s.attempt(next, a.user)
+	default:
+		s.disconnect(next, a.session)
+	}
+	return true
+}
+
+// schedule adds an action
+func (s *Simulator) schedule(a *action) {
+	s.seq++
+	a.seq = s.seq
+	heap.Push(&s.actions, a)
+}
+
+// emit adds a log line of a server, a millisecond after the previous line of the same step
+func (s *Simulator) emit(ts time.Time, server, message string) {
+	ts = ts.Add(time.Duration(len(s.ready)) * time.Millisecond)
+	s.ready = append(s.ready, Line{Timestamp: ts, Unit: server, Message: message})
+}
+
+// attempt simulates a connection attempt of a user: authentication, and on success the login
+func (s *Simulator) attempt(ts time.Time, user int) {
+	s.sessions++
+	sess := &session{
+		server:   s.cfg.Servers[user%len(s.cfg.Servers)],
+		user:     user,
+		clientIP: clientIP(user),
+		port:     1024 + s.sessions%64000,
+		vpnIP:    vpnIP(s.sessions),
+		id:       sessionID(s.sessions),
+		start:    ts,
+	}
+	name := username(user)
+	addr := sess.clientIP + ":" + strconv.Itoa(sess.port)
+
+	s.emit(ts, sess.server, "worker: "+sess.clientIP+" User-agent: '"+userAgents[user%len(userAgents)]+"'")
+	s.emit(ts, sess.server, "sec-mod: auth init for user '"+name+"' (session: "+sess.id+") from "+sess.clientIP)
+	if s.rng.Float64() < s.cfg.FailureRatio {
+		s.emit(ts, sess.server, "sec-mod: pam-auth: error authenticating user '"+name+"': Authentication failure")
+		s.emit(ts, sess.server, "main["+name+"]:"+addr+" failed authentication attempt for user '"+name+"'")
+		return
+	}
+	s.emit(ts, sess.server, "sec-mod: initiating session for user '"+name+"' (session: "+sess.id+")")
+	s.emit(ts, sess.server, "main["+name+"]:"+addr+" user logged in")
+	s.emit(ts, sess.server, "worker["+name+"]: "+sess.clientIP+" sending IPv4 "+sess.vpnIP)
+
+	duration := time.Duration(s.rng.ExpFloat64() * float64(s.cfg.SessionDuration))
+	s.schedule(&action{at: ts.Add(max(duration, time.Second)), session: sess})
+}
+
+// disconnect ends a session; after an error the user reconnects within seconds
+func (s *Simulator) disconnect(ts time.Time, sess *session) {
+	reason := "user disconnected"
+	if s.rng.Float64() < s.cfg.ErrorRatio {
+		reason = errorReasons[s.rng.IntN(len(errorReasons))]
+		s.schedule(&action{at: ts.Add(time.Second + time.Duration(s.rng.Int64N(int64(10*time.Second)))), user: sess.user})
+	}
+	// Up to 200 KB/s received, and a tenth of that sent
+	seconds := ts.Sub(sess.start).Seconds()
+	rx := uint64(seconds * s.rng.Float64() * 200e3)
+	tx := rx / 10
+	s.emit(ts, sess.server, fmt.Sprintf("main[%s]:%s:%d user disconnected (reason: %s, rx: %d, tx: %d)",
+		username(sess.user), sess.clientIP, sess.port, reason, rx, tx))
+}
+
+// username returns the name of a simulated user
+func username(user int) string {
+	return fmt.Sprintf("user%05d", user)
+}
+
+// clientIP returns the address of a user in the benchmarking range 198.18.0.0/15 (RFC 2544)
+func clientIP(user int) string {
+	return fmt.Sprintf("198.%d.%d.%d", 18+user>>16&1, user>>8&0xff, user&0xff)
+}
+
+// vpnIP returns the address assigned to a session from 10.0.0.0/8
+func vpnIP(n int) string {
+	return fmt.Sprintf("10.%d.%d.%d", n>>16&0xff, n>>8&0xff, n&0xff)
+}
+
+// sessionID returns an ocserv-like session ID
+func sessionID(n int) string {
+	return "sim" + strconv.FormatInt(int64(n), 36)
+}
+
+// String formats the line as a syslog line with an RFC 3339 timestamp, as read by --log.file
+// and --log.stdin
+func (l *Line) String() string {
+	return l.Timestamp.Format(time.RFC3339Nano) + " vpn " + l.Unit + "[1]: " + l.Message
+}
@@ -0,0 +1,108 @@
+package simulate
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mogilevich/ocserv_exporter/pkg/parser"
+)
+
+func TestSimulatorGeneratesParsableSessions(t *testing.T) {
+	cfg := Config{
+		Users:           50,
+		Rate:            2,
+		FailureRatio:    0.2,
+		ErrorRatio:      0.3,
+		SessionDuration: time.Minute,
+		Duration:        time.Hour,
+		Seed:            1,
+		Start:           time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	sim := New(cfg)
+	p := parser.New()
+
+	counts := make(map[parser.EventType]int)
+	var last time.Time
+	for {
+		entry, err := sim.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry.Timestamp.Sub(cfg.Start) >= cfg.Duration+time.Second {
+			t.Fatalf("entry at %s after the simulated duration", entry.Timestamp)
+		}
+		if entry.Timestamp.Before(last.Add(-time.Second)) {
+			t.Fatalf("entry at %s out of order after %s", entry.Timestamp, last)
+		}
+		last = entry.Timestamp
+		event := p.Parse(entry.Timestamp, entry.Message, entry.Unit)
+		if event == nil || event.Type == parser.EventUnknown {
+			t.Fatalf("unparsable line %q", entry.Message)
+		}
+		counts[event.Type]++
+	}
+
+	logins, disconnects := counts[parser.EventUserLogin], counts[parser.EventUserDisconnect]
+	if logins < 5000 || counts[parser.EventAuthFailed] == 0 {
+		t.Errorf("got %d logins and %d failures in an hour at 2 attempts/s", logins, counts[parser.EventAuthFailed])
+	}
+	if disconnects > logins || disconnects < logins*9/10 {
+		t.Errorf("got %d disconnects for %d one-minute sessions", disconnects, logins)
+	}
+}
+
+func TestSimulatorIsDeterministic(t *testing.T) {
+	read := func() []string {
+		cfg := Config{Users: 10, Rate: 1, SessionDuration: time.Minute, Duration: 10 * time.Minute, Seed: 7, Start: time.Unix(0, 0)}
+		if err := cfg.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		sim := New(cfg)
+		var lines []string
+		for entry, err := sim.Next(); err == nil; entry, err = sim.Next() {
+			lines = append(lines, entry.String())
+		}
+		return lines
+	}
+	first, second := read(), read()
+	if strings.Join(first, "") != strings.Join(second, "") || len(first) == 0 {
+		t.Error("same seed generated different streams")
+	}
+}
+
+func TestLineString(t *testing.T) {
+	line := &Line{Timestamp: time.Date(2025, 1, 2, 3, 4, 5, 6e6, time.UTC), Unit: "ocserv-ru", Message: "main: msg"}
+	if got, want := line.String(), "2025-01-02T03:04:05.006Z vpn ocserv-ru[1]: main: msg"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestSimulatorCloseStopsNext(t *testing.T) {
+	cfg := Config{Users: 1, Rate: 0.001, SessionDuration: time.Minute, Speed: 1, Seed: 1}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	sim := New(cfg)
+	// The first attempt is due right away, the next one in about 1000 seconds
+	for {
+		if _, err := sim.Next(); err != nil {
+			t.Fatal(err)
+		}
+		if len(sim.ready) == 0 {
+			break
+		}
+	}
+	time.AfterFunc(20*time.Millisecond, func() { _ = sim.Close() })
+	if _, err := sim.Next(); !errors.Is(err, io.EOF) {
+		t.Errorf("Next() after Close = %v, want io.EOF", err)
+	}
+}
@@ -0,0 +1,103 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mogilevich/ocserv_exporter/internal/collector"
+)
+
+// KafkaConfig configures the Kafka sink
+type KafkaConfig struct {
+	RESTURL  string // Kafka REST Proxy base URL (Confluent REST Proxy v2 API)
+	Topic    string
+	Username string // basic auth (optional)
+	Password string // basic auth (optional)
+	Timeout  time.Duration
+}
+
+// Kafka produces events as JSON records to a Kafka topic through a Kafka REST Proxy.
+// Records are keyed by server and username so events of one user stay ordered within a partition.
+type Kafka struct {
+	cfg    KafkaConfig
+	url    string
+	client *http.Client
+}
+
+// NewKafka creates a Kafka sink
+func NewKafka(cfg KafkaConfig) (*Kafka, error) {
+	if cfg.Topic == "" {
+		return nil, fmt.Errorf("kafka topic is required")
+	}
+	if _, err := url.Parse(cfg.RESTURL); err != nil {
+		return nil, err
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	return &Kafka{
+		cfg:    cfg,
+		url:    strings.TrimSuffix(cfg.RESTURL, "/") + "/topics/" + url.PathEscape(cfg.Topic),
+		client: &http.Client{Timeout: cfg.Timeout},
+	}, nil
+}
+
+type kafkaRecord struct {
+	Key   string           `json:"key"`
+	Value *collector.Event `json:"value"`
+}
+
+// Produce sends a batch of events (SendFunc)
+func (k *Kafka) Produce(ctx context.Context, batch []*collector.Event) error {
+	records := make([]kafkaRecord, 0, len(batch))
+	for _, event := range batch {
+		records = append(records, kafkaRecord{Key: event.Server + ":" + event.Username, Value: event})
+	}
+	body, err := json.Marshal(map[string]any{"records": records})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, k.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	if k.cfg.Username != "" {
+		req.SetBasicAuth(k.cfg.Username, k.cfg.Password)
+	}
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("kafka REST proxy returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+
+	// The proxy reports per-record errors with a 200 status
+	var result struct {
+		Offsets []struct {
+			Error string `json:"error"`
+		} `json:"offsets"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err == nil {
+		for _, o := range result.Offsets {
+			if o.Error != "" {
+				return fmt.Errorf("kafka REST proxy: %s", o.Error)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/mogilevich/ocserv_exporter/internal/collector"
+)
+
+// LokiConfig configures the Loki sink
+type LokiConfig struct {
+	URL      string            // Loki base URL or full push URL (…/loki/api/v1/push)
+	TenantID string            // X-Scope-OrgID header (multi-tenant Loki, optional)
+	Username string            // basic auth (optional)
+	Password string            // basic auth (optional)
+	Labels   map[string]string // extra stream labels
+	Timeout  time.Duration
+}
+
+// Loki pushes events as JSON log lines to Loki's push API.
+// Streams are labeled with job, server and event type.
+type Loki struct {
+	cfg    LokiConfig
+	url    string
+	client *http.Client
+}
+
+// NewLoki creates a Loki sink
+func NewLoki(cfg LokiConfig) (*Loki, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/loki/api/v1/push"
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	return &Loki{
+		cfg:    cfg,
+		url:    u.String(),
+		client: &http.Client{Timeout: cfg.Timeout},
+	}, nil
+}
+
+type lokiPush struct {
+	Streams []lokiStream `json:"streams"`
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// Push sends a batch of events (SendFunc)
+func (l *Loki) Push(ctx context.Context, batch []*collector.Event) error {
+	body, err := json.Marshal(l.buildPush(batch))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, l.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if l.cfg.TenantID != "" {
+		req.Header.Set("X-Scope-OrgID", l.cfg.TenantID)
+	}
+	if l.cfg.Username != "" {
+		req.SetBasicAuth(l.cfg.Username, l.cfg.Password)
+	}
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("loki returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// buildPush groups events into streams by server and type; lines are the events as JSON
+func (l *Loki) buildPush(batch []*collector.Event) *lokiPush {
+	streams := make(map[string]*lokiStream)
+	var keys []string
+
+	for _, event := range batch {
+		key := event.Server + "\x00" + event.Type
+		stream, ok := streams[key]
+		if !ok {
+			labels := map[string]string{"job": "ocserv_exporter"}
+			for k, v := range l.cfg.Labels {
+				labels[k] = v
+			}
+			labels["server"] = event.Server
+			labels["event"] = event.Type
+			stream = &lokiStream{Stream: labels}
+			streams[key] = stream
+			keys = append(keys, key)
+		}
+
+		line, err := json.Marshal(event)
+		if err != nil {
+			continue
+		}
+		stream.Values = append(stream.Values, [2]string{strconv.FormatInt(event.Time.UnixNano(), 10), string(line)})
+	}
+
+	sort.Strings(keys)
+	push := &lokiPush{Streams: make([]lokiStream, 0, len(keys))}
+	for _, key := range keys {
+		push.Streams = append(push.Streams, *streams[key])
+	}
+	return push
+}
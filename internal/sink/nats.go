@@ -0,0 +1,223 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mogilevich/ocserv_exporter/internal/collector"
+)
+
+// NATSConfig configures the NATS sink
+type NATSConfig struct {
+	URL           string // nats://host:4222 or tls://host:4222, may contain user:pass@
+	SubjectPrefix string // events are published to <prefix>.<server>.<type>
+	Token         string // auth token (optional)
+	Timeout       time.Duration
+	Version       string
+}
+
+// NATS publishes events as JSON to NATS subjects using the plain NATS client protocol.
+// The connection is opened lazily and re-established after errors.
+type NATS struct {
+	cfg  NATSConfig
+	addr string
+	tls  bool
+	user string
+	pass string
+
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// NewNATS creates a NATS sink
+func NewNATS(cfg NATSConfig) (*NATS, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("missing host in NATS URL %q", cfg.URL)
+	}
+	if cfg.SubjectPrefix == "" {
+		cfg.SubjectPrefix = "ocserv.events"
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	n := &NATS{cfg: cfg, addr: u.Host, tls: u.Scheme == "tls"}
+	if u.Port() == "" {
+		n.addr = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	if u.User != nil {
+		n.user = u.User.Username()
+		n.pass, _ = u.User.Password()
+	}
+	return n, nil
+}
+
+// Subject returns the subject an event is published to
+func (n *NATS) Subject(event *collector.Event) string {
+	return n.cfg.SubjectPrefix + "." + subjectToken(event.Server) + "." + subjectToken(event.Type)
+}
+
+// Publish sends a batch of events (SendFunc) and waits until the server has processed them
+func (n *NATS) Publish(ctx context.Context, batch []*collector.Event) error {
+	if err := n.connect(ctx); err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(n.cfg.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = n.conn.SetDeadline(deadline)
+
+	w := bufio.NewWriter(n.conn)
+	for _, event := range batch {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(w, "PUB %s %d\r\n", n.Subject(event), len(payload))
+		w.Write(payload)
+		w.WriteString("\r\n")
+	}
+	// PING after the batch: the PONG confirms the server processed every PUB before it
+	w.WriteString("PING\r\n")
+
+	if err := w.Flush(); err != nil {
+		n.close()
+		return err
+	}
+	if err := n.waitPong(); err != nil {
+		n.close()
+		return err
+	}
+	return nil
+}
+
+// connect opens the connection and performs the CONNECT handshake if not connected
+func (n *NATS) connect(ctx context.Context) error {
+	if n.conn != nil {
+		return nil
+	}
+
+	dialer := &net.Dialer{Timeout: n.cfg.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", n.addr)
+	if err != nil {
+		return err
+	}
+	_ = conn.SetDeadline(time.Now().Add(n.cfg.Timeout))
+
+	r := bufio.NewReader(conn)
+	line, err := r.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("reading NATS INFO: %w", err)
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		conn.Close()
+		return fmt.Errorf("unexpected NATS greeting: %q", strings.TrimSpace(line))
+	}
+
+	var info struct {
+		TLSRequired bool `json:"tls_required"`
+	}
+	_ = json.Unmarshal([]byte(strings.TrimPrefix(line, "INFO ")), &info)
+	if n.tls || info.TLSRequired {
+		host, _, _ := net.SplitHostPort(n.addr)
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: host})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return fmt.Errorf("NATS TLS handshake: %w", err)
+		}
+		conn = tlsConn
+		r = bufio.NewReader(conn)
+	}
+
+	opts := map[string]any{
+		"verbose":  false,
+		"pedantic": false,
+		"name":     "ocserv_exporter",
+		"lang":     "go",
+		"version":  n.cfg.Version,
+		"protocol": 0,
+	}
+	if n.user != "" {
+		opts["user"] = n.user
+		opts["pass"] = n.pass
+	}
+	if n.cfg.Token != "" {
+		opts["auth_token"] = n.cfg.Token
+	}
+	connectJSON, _ := json.Marshal(opts)
+
+	n.conn, n.r = conn, r
+	if _, err := fmt.Fprintf(conn, "CONNECT %s\r\nPING\r\n", connectJSON); err != nil {
+		n.close()
+		return err
+	}
+	if err := n.waitPong(); err != nil {
+		n.close()
+		return fmt.Errorf("NATS handshake: %w", err)
+	}
+	return nil
+}
+
+// waitPong reads server messages until PONG, answering server PINGs
+func (n *NATS) waitPong() error {
+	for {
+		line, err := n.r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := n.conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return errors.New("NATS server error: " + strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+		// +OK and INFO updates are ignored
+	}
+}
+
+func (n *NATS) close() {
+	if n.conn != nil {
+		n.conn.Close()
+		n.conn, n.r = nil, nil
+	}
+}
+
+// Close closes the connection
+func (n *NATS) Close() error {
+	n.close()
+	return nil
+}
+
+// subjectToken makes a value safe to use as a single NATS subject token
+func subjectToken(s string) string {
+	if s == "" {
+		return "_"
+	}
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', '*', '>', ' ', '\t', '\r', '\n':
+			return '_'
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,107 @@
+package sink
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/mogilevich/ocserv_exporter/internal/collector"
+)
+
+// Default queue settings
+const (
+	DefaultQueueSize     = 10000
+	DefaultBatchSize     = 500
+	DefaultFlushInterval = 5 * time.Second
+)
+
+// SendFunc delivers a batch of events to a destination
+type SendFunc func(ctx context.Context, batch []*collector.Event) error
+
+// Queue buffers events from the collector and delivers them in batches from its own goroutine,
+// so slow destinations never block log processing. Events are dropped when the buffer is full.
+// Queue implements collector.EventSink.
+type Queue struct {
+	name          string
+	events        chan *collector.Event
+	batchSize     int
+	flushInterval time.Duration
+	send          SendFunc
+}
+
+// NewQueue creates a queue for the sink name (used as the sink label of sink metrics)
+func NewQueue(name string, size, batchSize int, flushInterval time.Duration, send SendFunc) *Queue {
+	if size <= 0 {
+		size = DefaultQueueSize
+	}
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	if flushInterval <= 0 {
+		flushInterval = DefaultFlushInterval
+	}
+	return &Queue{
+		name:          name,
+		events:        make(chan *collector.Event, size),
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		send:          send,
+	}
+}
+
+// Send queues an event without blocking
+func (q *Queue) Send(event *collector.Event) {
+	select {
+	case q.events <- event:
+	default:
+		collector.EventsDroppedTotal.WithLabelValues(q.name).Inc()
+	}
+}
+
+// Run delivers queued events until ctx is cancelled, then flushes what is left
+func (q *Queue) Run(ctx context.Context) {
+	ticker := time.NewTicker(q.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*collector.Event, 0, q.batchSize)
+	flush := func(ctx context.Context) {
+		if len(batch) == 0 {
+			return
+		}
+		if err := q.send(ctx, batch); err != nil {
+			collector.EventSinkErrorsTotal.WithLabelValues(q.name).Inc()
+			collector.EventsDroppedTotal.WithLabelValues(q.name).Add(float64(len(batch)))
+			log.Printf("Warning: Failed to send %d event(s) to %s: %v", len(batch), q.name, err)
+		} else {
+			collector.EventsSentTotal.WithLabelValues(q.name).Add(float64(len(batch)))
+		}
+		batch = make([]*collector.Event, 0, q.batchSize)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			// Final flush with a short deadline of its own
+		drain:
+			for {
+				select {
+				case event := <-q.events:
+					batch = append(batch, event)
+				default:
+					break drain
+				}
+			}
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			flush(flushCtx)
+			cancel()
+			return
+		case event := <-q.events:
+			batch = append(batch, event)
+			if len(batch) >= q.batchSize {
+				flush(ctx)
+			}
+		case <-ticker.C:
+			flush(ctx)
+		}
+	}
+}
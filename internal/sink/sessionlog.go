@@ -0,0 +1,180 @@
+package sink
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mogilevich/ocserv_exporter/internal/collector"
+)
+
+// Session log file naming: <prefix>-<UTC creation time>.csv
+const sessionLogTimeFormat = "20060102T150405Z"
+
+// sessionLogHeader lists the CSV columns of completed-session records
+var sessionLogHeader = []string{
+	"start_time", "end_time", "server", "username", "group", "vhost", "client_ip", "vpn_ip",
+	"country_code", "country", "client_type", "auth_method", "duration_seconds", "rx_bytes", "tx_bytes", "reason",
+}
+
+// SessionLogConfig configures the session log sink
+type SessionLogConfig struct {
+	Dir       string        // directory for the CSV files
+	Prefix    string        // file name prefix (default "sessions")
+	Rotation  time.Duration // start a new file after this long (0: never by age)
+	MaxSize   int64         // start a new file once it reaches this many bytes (0: no limit)
+	Retention time.Duration // delete rotated files older than this (0: keep forever)
+}
+
+// SessionLog appends one CSV record per completed session (disconnect event) to rotating files
+// for billing and accounting ingestion. Other event types are skipped.
+// Files are opened per batch, so external tools may move rotated files at any time.
+type SessionLog struct {
+	cfg     SessionLogConfig
+	current string    // path of the file being written
+	created time.Time // creation time of the current file
+	now     func() time.Time
+}
+
+// NewSessionLog creates a session log sink, creating the directory if needed
+func NewSessionLog(cfg SessionLogConfig) (*SessionLog, error) {
+	if cfg.Dir == "" {
+		return nil, fmt.Errorf("directory is required")
+	}
+	if cfg.Prefix == "" {
+		cfg.Prefix = "sessions"
+	}
+	if strings.ContainsAny(cfg.Prefix, `/\`) {
+		return nil, fmt.Errorf("invalid prefix %q", cfg.Prefix)
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o750); err != nil {
+		return nil, err
+	}
+	return &SessionLog{cfg: cfg, now: time.Now}, nil
+}
+
+// Write appends the completed sessions of a batch (SendFunc)
+func (s *SessionLog) Write(_ context.Context, batch []*collector.Event) error {
+	var records [][]string
+	for _, event := range batch {
+		if event.Type == "disconnect" {
+			records = append(records, sessionRecord(event))
+		}
+	}
+	if len(records) == 0 {
+		return nil
+	}
+
+	if err := s.rotate(); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(s.current, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	w := csv.NewWriter(f)
+	if info.Size() == 0 {
+		if err := w.Write(sessionLogHeader); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.WriteAll(records); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// rotate switches to a new file when the current one is too old or too large, then applies retention
+func (s *SessionLog) rotate() error {
+	now := s.now().UTC()
+
+	if s.current != "" {
+		expired := s.cfg.Rotation > 0 && now.Sub(s.created) >= s.cfg.Rotation
+		full := false
+		if s.cfg.MaxSize > 0 {
+			if info, err := os.Stat(s.current); err == nil && info.Size() >= s.cfg.MaxSize {
+				full = true
+			}
+		}
+		if !expired && !full {
+			return nil
+		}
+	}
+
+	name := fmt.Sprintf("%s-%s.csv", s.cfg.Prefix, now.Format(sessionLogTimeFormat))
+	path := filepath.Join(s.cfg.Dir, name)
+	if path == s.current {
+		// Rotated twice within a second (tiny MaxSize): keep appending
+		return nil
+	}
+	s.current = path
+	s.created = now
+
+	return s.prune(now)
+}
+
+// prune deletes files older than the retention period, never the current one
+func (s *SessionLog) prune(now time.Time) error {
+	if s.cfg.Retention <= 0 {
+		return nil
+	}
+	matches, err := filepath.Glob(filepath.Join(s.cfg.Dir, s.cfg.Prefix+"-*.csv"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(matches)
+	for _, path := range matches {
+		if path == s.current {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), s.cfg.Prefix+"-"), ".csv")
+		created, err := time.Parse(sessionLogTimeFormat, stamp)
+		if err != nil {
+			continue // not ours
+		}
+		if now.Sub(created) > s.cfg.Retention {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// sessionRecord formats a disconnect event as a CSV record (columns of sessionLogHeader)
+func sessionRecord(event *collector.Event) []string {
+	start := event.Time.Add(-time.Duration(event.DurationSeconds * float64(time.Second)))
+	return []string{
+		start.UTC().Format(time.RFC3339),
+		event.Time.UTC().Format(time.RFC3339),
+		event.Server,
+		event.Username,
+		event.Group,
+		event.VHost,
+		event.ClientIP,
+		event.VpnIP,
+		event.CountryCode,
+		event.Country,
+		event.ClientType,
+		event.AuthMethod,
+		strconv.FormatFloat(event.DurationSeconds, 'f', 0, 64),
+		strconv.FormatUint(event.RxBytes, 10),
+		strconv.FormatUint(event.TxBytes, 10),
+		event.Reason,
+	}
+}
@@ -0,0 +1,221 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mogilevich/ocserv_exporter/internal/collector"
+)
+
+// SIEM output formats
+const (
+	FormatCEF  = "cef"
+	FormatLEEF = "leef"
+)
+
+// SIEMConfig configures the SIEM sink
+type SIEMConfig struct {
+	Address  string // syslog receiver host:port
+	Protocol string // tcp or udp
+	Format   string // cef or leef
+	Version  string // product version in the CEF/LEEF header
+	Timeout  time.Duration
+}
+
+// SIEM sends logins, disconnects and authentication failures as CEF or LEEF messages
+// over syslog (RFC 5424, newline-framed on TCP). Other event types are skipped.
+type SIEM struct {
+	cfg      SIEMConfig
+	hostname string
+	conn     net.Conn
+}
+
+// siemEvent describes how an event type is reported to the SIEM
+type siemEvent struct {
+	id       string
+	name     string
+	severity int // CEF severity 0-10
+	outcome  string
+}
+
+var siemEvents = map[string]siemEvent{
+	"login":        {id: "100", name: "VPN login", severity: 3, outcome: "success"},
+	"disconnect":   {id: "101", name: "VPN disconnect", severity: 2, outcome: "success"},
+	"auth_failure": {id: "200", name: "VPN authentication failure", severity: 6, outcome: "failure"},
+}
+
+// NewSIEM creates a SIEM sink
+func NewSIEM(cfg SIEMConfig) (*SIEM, error) {
+	if cfg.Protocol == "" {
+		cfg.Protocol = "tcp"
+	}
+	if cfg.Protocol != "tcp" && cfg.Protocol != "udp" {
+		return nil, fmt.Errorf("unsupported protocol %q (tcp, udp)", cfg.Protocol)
+	}
+	if cfg.Format == "" {
+		cfg.Format = FormatCEF
+	}
+	if cfg.Format != FormatCEF && cfg.Format != FormatLEEF {
+		return nil, fmt.Errorf("unsupported format %q (cef, leef)", cfg.Format)
+	}
+	if _, _, err := net.SplitHostPort(cfg.Address); err != nil {
+		return nil, err
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	return &SIEM{cfg: cfg, hostname: hostname}, nil
+}
+
+// Send delivers a batch of events (SendFunc)
+func (s *SIEM) Send(ctx context.Context, batch []*collector.Event) error {
+	if s.conn == nil {
+		dialer := &net.Dialer{Timeout: s.cfg.Timeout}
+		conn, err := dialer.DialContext(ctx, s.cfg.Protocol, s.cfg.Address)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	_ = s.conn.SetWriteDeadline(time.Now().Add(s.cfg.Timeout))
+
+	for _, event := range batch {
+		msg, ok := s.Format(event)
+		if !ok {
+			continue
+		}
+		line := s.syslog(event, msg)
+		if s.cfg.Protocol == "tcp" {
+			line += "\n"
+		}
+		if _, err := s.conn.Write([]byte(line)); err != nil {
+			s.conn.Close()
+			s.conn = nil
+			return err
+		}
+	}
+	return nil
+}
+
+// syslog wraps a message in an RFC 5424 header (facility local0, severity from the event)
+func (s *SIEM) syslog(event *collector.Event, msg string) string {
+	severity := 6 // informational
+	if siemEvents[event.Type].outcome == "failure" {
+		severity = 4 // warning
+	}
+	pri := 16*8 + severity
+	return fmt.Sprintf("<%d>1 %s %s ocserv_exporter - %s - %s",
+		pri, event.Time.UTC().Format(time.RFC3339Nano), s.hostname, siemEvents[event.Type].id, msg)
+}
+
+// Format renders an event as a CEF or LEEF message. ok is false for event types not sent to the SIEM.
+func (s *SIEM) Format(event *collector.Event) (msg string, ok bool) {
+	def, ok := siemEvents[event.Type]
+	if !ok {
+		return "", false
+	}
+
+	// Normalized fields, in CEF dictionary names; LEEF names are mapped below
+	fields := []struct{ cef, leef, value string }{
+		{"rt", "devTime", strconv.FormatInt(event.Time.UnixMilli(), 10)},
+		{"dvchost", "identHostName", event.Server},
+		{"suser", "usrName", event.Username},
+		{"src", "src", event.ClientIP},
+		{"spt", "srcPort", portString(event.Port)},
+		{"sourceTranslatedAddress", "srcPostNAT", event.VpnIP},
+		{"outcome", "outcome", def.outcome},
+		{"reason", "reason", event.Reason},
+		{"in", "srcBytes", bytesString(event.RxBytes)},  // received from the client
+		{"out", "dstBytes", bytesString(event.TxBytes)}, // sent to the client
+		{"cs1", "country", event.Country},
+		{"cs2", "clientType", event.ClientType},
+		{"cs3", "vpnGroup", event.Group},
+		{"cs4", "authMethod", event.AuthMethod},
+		{"cn1", "sessionDuration", durationString(event.DurationSeconds)},
+	}
+	labels := map[string]string{
+		"cs1": "country", "cs2": "clientType", "cs3": "vpnGroup", "cs4": "authMethod", "cn1": "sessionDurationSeconds",
+	}
+
+	var b strings.Builder
+	switch s.cfg.Format {
+	case FormatLEEF:
+		fmt.Fprintf(&b, "LEEF:1.0|%s|%s|%s|%s|", leefHeader("ocserv_exporter"), leefHeader("ocserv"),
+			leefHeader(s.cfg.Version), leefHeader(def.id))
+		fmt.Fprintf(&b, "cat=%s\tsev=%d\tdevTimeFormat=epoch", def.name, def.severity)
+		for _, f := range fields {
+			if f.value != "" {
+				fmt.Fprintf(&b, "\t%s=%s", f.leef, leefValue(f.value))
+			}
+		}
+	default:
+		fmt.Fprintf(&b, "CEF:0|%s|%s|%s|%s|%s|%d|", cefHeader("ocserv_exporter"), cefHeader("ocserv"),
+			cefHeader(s.cfg.Version), cefHeader(def.id), cefHeader(def.name), def.severity)
+		first := true
+		for _, f := range fields {
+			if f.value == "" {
+				continue
+			}
+			if !first {
+				b.WriteByte(' ')
+			}
+			first = false
+			fmt.Fprintf(&b, "%s=%s", f.cef, cefValue(f.value))
+			if label, ok := labels[f.cef]; ok {
+				fmt.Fprintf(&b, " %sLabel=%s", f.cef, label)
+			}
+		}
+	}
+	return b.String(), true
+}
+
+func portString(port int) string {
+	if port == 0 {
+		return ""
+	}
+	return strconv.Itoa(port)
+}
+
+func bytesString(n uint64) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.FormatUint(n, 10)
+}
+
+func durationString(seconds float64) string {
+	if seconds <= 0 {
+		return ""
+	}
+	return strconv.FormatInt(int64(seconds), 10)
+}
+
+// cefHeader escapes a CEF header field (pipes and backslashes)
+func cefHeader(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ", "\r", " ").Replace(s)
+}
+
+// cefValue escapes a CEF extension value (equals signs, backslashes, newlines)
+func cefValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`).Replace(s)
+}
+
+// leefHeader escapes a LEEF header field
+func leefHeader(s string) string {
+	return strings.NewReplacer(`|`, `\|`, "\n", " ", "\r", " ").Replace(s)
+}
+
+// leefValue removes the attribute delimiter (tab) and newlines from a LEEF value
+func leefValue(s string) string {
+	return strings.NewReplacer("\t", " ", "\n", " ", "\r", " ").Replace(s)
+}
@@ -0,0 +1,295 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mogilevich/ocserv_exporter/internal/collector"
+	"github.com/mogilevich/ocserv_exporter/pkg/parser"
+)
+
+func TestLokiPush(t *testing.T) {
+	var got lokiPush
+	var path, tenant string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		tenant = r.Header.Get("X-Scope-OrgID")
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	loki, err := NewLoki(LokiConfig{URL: srv.URL, TenantID: "vpn", Labels: map[string]string{"env": "prod"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := time.Unix(1700000000, 0)
+	batch := []*collector.Event{
+		{Time: ts, Server: "ocserv", Type: "login", Username: "bob", Country: "Germany", ClientType: "AnyConnect"},
+		{Time: ts.Add(time.Second), Server: "ocserv", Type: "auth_failure", ClientIP: "203.0.113.7", Reason: "wrong password"},
+		{Time: ts.Add(2 * time.Second), Server: "ocserv", Type: "login", Username: "alice"},
+	}
+	if err := loki.Push(context.Background(), batch); err != nil {
+		t.Fatalf("Push() error: %v", err)
+	}
+
+	if path != "/loki/api/v1/push" || tenant != "vpn" {
+		t.Errorf("path = %q, tenant = %q", path, tenant)
+	}
+	if len(got.Streams) != 2 {
+		t.Fatalf("got %d streams, want 2 (auth_failure, login)", len(got.Streams))
+	}
+
+	login := got.Streams[1]
+	if login.Stream["event"] != "login" || login.Stream["server"] != "ocserv" || login.Stream["env"] != "prod" {
+		t.Errorf("login stream labels = %v", login.Stream)
+	}
+	if len(login.Values) != 2 || login.Values[0][0] != "1700000000000000000" {
+		t.Fatalf("login stream values = %v", login.Values)
+	}
+
+	var line collector.Event
+	if err := json.Unmarshal([]byte(login.Values[0][1]), &line); err != nil {
+		t.Fatal(err)
+	}
+	if line.Username != "bob" || line.Country != "Germany" || line.ClientType != "AnyConnect" {
+		t.Errorf("login line = %+v", line)
+	}
+}
+
+func TestQueueDropsWhenFull(t *testing.T) {
+	q := NewQueue("test", 1, 10, time.Hour, func(ctx context.Context, batch []*collector.Event) error { return nil })
+	q.Send(&collector.Event{Type: "login"})
+	q.Send(&collector.Event{Type: "login"})
+
+	if len(q.events) != 1 {
+		t.Errorf("queued %d events, want 1", len(q.events))
+	}
+
+	delivered := 0
+	q.send = func(ctx context.Context, batch []*collector.Event) error {
+		delivered += len(batch)
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	q.Run(ctx)
+	if delivered != 1 {
+		t.Errorf("delivered %d events on shutdown, want 1", delivered)
+	}
+}
+
+func TestNATSPublish(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		conn.Write([]byte("INFO {\"server_id\":\"test\"}\r\n"))
+		r := bufio.NewReader(conn)
+		var lines []string
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimSpace(line)
+			lines = append(lines, line)
+			if line == "PING" {
+				conn.Write([]byte("PONG\r\n"))
+				if len(lines) > 2 {
+					received <- lines
+					return
+				}
+			}
+		}
+	}()
+
+	n, err := NewNATS(NATSConfig{URL: "nats://user:pw@" + ln.Addr().String(), SubjectPrefix: "vpn"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	batch := []*collector.Event{{Server: "ocserv.ru", Type: "login", Username: "bob"}}
+	if err := n.Publish(context.Background(), batch); err != nil {
+		t.Fatalf("Publish() error: %v", err)
+	}
+
+	lines := <-received
+	if !strings.HasPrefix(lines[0], "CONNECT ") || !strings.Contains(lines[0], `"user":"user"`) {
+		t.Errorf("CONNECT line = %q", lines[0])
+	}
+	if !strings.HasPrefix(lines[2], "PUB vpn.ocserv_ru.login ") {
+		t.Errorf("PUB line = %q", lines[2])
+	}
+	if !strings.Contains(lines[3], `"username":"bob"`) {
+		t.Errorf("payload = %q", lines[3])
+	}
+}
+
+func TestSIEMFormat(t *testing.T) {
+	event := &collector.Event{
+		Time:     time.UnixMilli(1700000000123),
+		Server:   "ocserv",
+		Type:     "auth_failure",
+		Username: "bob",
+		ClientIP: "203.0.113.7",
+		Port:     51234,
+		Reason:   "wrong password",
+		Country:  "Germany",
+	}
+
+	cef, _ := NewSIEM(SIEMConfig{Address: "127.0.0.1:514", Format: FormatCEF, Version: "1.0"})
+	msg, ok := cef.Format(event)
+	want := "CEF:0|ocserv_exporter|ocserv|1.0|200|VPN authentication failure|6|rt=1700000000123 dvchost=ocserv suser=bob " +
+		"src=203.0.113.7 spt=51234 outcome=failure reason=wrong password cs1=Germany cs1Label=country"
+	if !ok || msg != want {
+		t.Errorf("CEF =\n%s\nwant\n%s", msg, want)
+	}
+
+	leef, _ := NewSIEM(SIEMConfig{Address: "127.0.0.1:514", Format: FormatLEEF, Version: "1.0"})
+	msg, _ = leef.Format(event)
+	if !strings.HasPrefix(msg, "LEEF:1.0|ocserv_exporter|ocserv|1.0|200|cat=VPN authentication failure\tsev=6") ||
+		!strings.Contains(msg, "\tusrName=bob\tsrc=203.0.113.7\tsrcPort=51234") {
+		t.Errorf("LEEF = %q", msg)
+	}
+
+	if _, ok := cef.Format(&collector.Event{Type: "dpd_warning"}); ok {
+		t.Error("dpd_warning should not be sent to the SIEM")
+	}
+
+	// Extension values escape '=' and '\'
+	if got := cefValue(`a=b\c`); got != `a\=b\\c` {
+		t.Errorf("cefValue() = %q", got)
+	}
+}
+
+func TestSessionLogRotation(t *testing.T) {
+	dir := t.TempDir()
+	sessions, err := NewSessionLog(SessionLogConfig{Dir: dir, Rotation: time.Hour, Retention: 48 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC)
+	sessions.now = func() time.Time { return now }
+
+	// A file from before the retention period
+	old := filepath.Join(dir, "sessions-20240429T100000Z.csv")
+	if err := os.WriteFile(old, []byte("x\n"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	disconnect := &collector.Event{Time: now, Server: "ocserv", Type: "disconnect", Username: "bob", ClientIP: "203.0.113.7",
+		Reason: "user disconnected, with comma", RxBytes: 2000, TxBytes: 3000, DurationSeconds: 600}
+	login := &collector.Event{Time: now, Server: "ocserv", Type: "login", Username: "bob"}
+	ctx := context.Background()
+
+	if err := sessions.Write(ctx, []*collector.Event{login, disconnect}); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(30 * time.Minute)
+	if err := sessions.Write(ctx, []*collector.Event{disconnect}); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(time.Hour)
+	if err := sessions.Write(ctx, []*collector.Event{disconnect}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Errorf("file beyond retention was not deleted")
+	}
+
+	f, err := os.Open(filepath.Join(dir, "sessions-20240502T100000Z.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("got %d records in first file, want header + 2", len(records))
+	}
+	want := []string{"2024-05-02T09:50:00Z", "2024-05-02T10:00:00Z", "ocserv", "bob", "", "", "203.0.113.7", "",
+		"", "", "", "", "600", "2000", "3000", "user disconnected, with comma"}
+	if strings.Join(records[1], "|") != strings.Join(want, "|") {
+		t.Errorf("record = %q, want %q", records[1], want)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "sessions-20240502T113000Z.csv")); err != nil {
+		t.Errorf("rotated file missing: %v", err)
+	}
+}
+
+// With --labels.hash-usernames sinks get the pseudonym, unless registered for clear usernames
+func TestSinkUsernamesHashed(t *testing.T) {
+	collector.ConfigureLabels(collector.LabelConfig{HashUsernames: true, HashSalt: "salt"})
+	defer collector.ConfigureLabels(collector.LabelConfig{})
+
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var b strings.Builder
+		if _, err := io.Copy(&b, r.Body); err != nil {
+			t.Errorf("read: %v", err)
+		}
+		body = b.String()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	loki, err := NewLoki(LokiConfig{URL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var billed []*collector.Event
+	lokiQueue := NewQueue("loki", 10, 10, time.Hour, loki.Push)
+	billingQueue := NewQueue("billing", 10, 10, time.Hour, func(ctx context.Context, batch []*collector.Event) error {
+		billed = append(billed, batch...)
+		return nil
+	})
+
+	c := collector.New()
+	c.AddEventSink(lokiQueue, false)
+	c.AddEventSink(billingQueue, true)
+	c.ProcessEvent(&parser.Event{Type: parser.EventUserLogin, Timestamp: time.Now(), Server: "ocserv",
+		Username: "alice", ClientIP: "203.0.113.7", Port: 40000})
+
+	// Cancelled queues flush what they hold and return
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	lokiQueue.Run(ctx)
+	billingQueue.Run(ctx)
+
+	pseudonym := collector.Username("alice")
+	if strings.Contains(body, "alice") || !strings.Contains(body, pseudonym) {
+		t.Errorf("Loki payload = %s, want the pseudonym %s instead of the username", body, pseudonym)
+	}
+	if len(billed) != 1 || billed[0].Username != "alice" {
+		t.Errorf("billing sink got %+v, want the login of alice", billed)
+	}
+}
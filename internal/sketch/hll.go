@@ -0,0 +1,101 @@
+package sketch
+
+import (
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+// DefaultPrecision gives 1024 registers (1 KiB per sketch, ~3.25% standard error)
+const DefaultPrecision = 10
+
+// HyperLogLog is a cardinality estimator with bounded memory
+type HyperLogLog struct {
+	p         uint8
+	registers []uint8
+}
+
+// NewHyperLogLog creates a new sketch with 2^precision registers (4..16)
+func NewHyperLogLog(precision uint8) *HyperLogLog {
+	if precision < 4 {
+		precision = 4
+	}
+	if precision > 16 {
+		precision = 16
+	}
+	return &HyperLogLog{
+		p:         precision,
+		registers: make([]uint8, 1<<precision),
+	}
+}
+
+// Add adds a value to the sketch
+func (h *HyperLogLog) Add(value string) {
+	x := hash64(value)
+	idx := x >> (64 - h.p)
+	rank := uint8(bits.LeadingZeros64(x<<h.p|1<<(h.p-1))) + 1
+	if rank > h.registers[idx] {
+		h.registers[idx] = rank
+	}
+}
+
+// Merge folds other into h; both sketches must have the same precision
+func (h *HyperLogLog) Merge(other *HyperLogLog) {
+	if other == nil || other.p != h.p {
+		return
+	}
+	for i, r := range other.registers {
+		if r > h.registers[i] {
+			h.registers[i] = r
+		}
+	}
+}
+
+// Estimate returns the estimated number of distinct values added
+func (h *HyperLogLog) Estimate() uint64 {
+	m := float64(len(h.registers))
+
+	var sum float64
+	zeros := 0
+	for _, r := range h.registers {
+		sum += 1.0 / float64(uint64(1)<<r)
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	estimate := alpha(len(h.registers)) * m * m / sum
+
+	// Small range correction (linear counting)
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+
+	return uint64(estimate + 0.5)
+}
+
+func alpha(m int) float64 {
+	switch m {
+	case 16:
+		return 0.673
+	case 32:
+		return 0.697
+	case 64:
+		return 0.709
+	default:
+		return 0.7213 / (1 + 1.079/float64(m))
+	}
+}
+
+// hash64 hashes a string with FNV-1a and a splitmix64 finalizer for better bit dispersion
+func hash64(s string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s))
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,49 @@
+package sketch
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestHyperLogLogEstimate(t *testing.T) {
+	tests := []int{0, 1, 10, 100, 1000, 50000}
+
+	for _, n := range tests {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			h := NewHyperLogLog(DefaultPrecision)
+			for i := 0; i < n; i++ {
+				// Add every value twice, duplicates must not be counted
+				h.Add(fmt.Sprintf("user-%d", i))
+				h.Add(fmt.Sprintf("user-%d", i))
+			}
+			got := float64(h.Estimate())
+			tolerance := 0.1*float64(n) + 1
+			if got < float64(n)-tolerance || got > float64(n)+tolerance {
+				t.Errorf("estimate %v, want %d ± %v", got, n, tolerance)
+			}
+		})
+	}
+}
+
+func TestWindow(t *testing.T) {
+	w := NewWindow(time.Hour, 7*24*time.Hour, DefaultPrecision)
+	now := time.Date(2024, 2, 10, 12, 0, 0, 0, time.UTC)
+
+	w.Add(now.Add(-3*24*time.Hour), "old")
+	w.Add(now.Add(-2*time.Hour), "alice")
+	w.Add(now.Add(-1*time.Hour), "bob")
+	w.Add(now, "alice")
+
+	if got := w.Estimate(now, 24*time.Hour); got != 2 {
+		t.Errorf("24h estimate = %d, want 2", got)
+	}
+	if got := w.Estimate(now, 7*24*time.Hour); got != 3 {
+		t.Errorf("7d estimate = %d, want 3", got)
+	}
+
+	w.Prune(now.Add(5 * 24 * time.Hour))
+	if got := w.Estimate(now, 7*24*time.Hour); got != 2 {
+		t.Errorf("7d estimate after prune = %d, want 2", got)
+	}
+}
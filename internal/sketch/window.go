@@ -0,0 +1,59 @@
+package sketch
+
+import (
+	"time"
+)
+
+// Window counts distinct values over a sliding time window using one
+// HyperLogLog per time bucket, so memory is bounded by window/resolution
+type Window struct {
+	resolution time.Duration
+	retention  time.Duration
+	precision  uint8
+	buckets    map[int64]*HyperLogLog // key: bucket start (unix seconds)
+}
+
+// NewWindow creates a sliding window keeping buckets of the given resolution
+// for up to retention
+func NewWindow(resolution, retention time.Duration, precision uint8) *Window {
+	return &Window{
+		resolution: resolution,
+		retention:  retention,
+		precision:  precision,
+		buckets:    make(map[int64]*HyperLogLog),
+	}
+}
+
+// Add records value as seen at ts
+func (w *Window) Add(ts time.Time, value string) {
+	key := ts.Truncate(w.resolution).Unix()
+	b, ok := w.buckets[key]
+	if !ok {
+		b = NewHyperLogLog(w.precision)
+		w.buckets[key] = b
+	}
+	b.Add(value)
+}
+
+// Estimate returns the approximate number of distinct values seen within
+// the period ending at now
+func (w *Window) Estimate(now time.Time, period time.Duration) uint64 {
+	merged := NewHyperLogLog(w.precision)
+	since := now.Add(-period).Truncate(w.resolution).Unix()
+	for key, b := range w.buckets {
+		if key >= since {
+			merged.Merge(b)
+		}
+	}
+	return merged.Estimate()
+}
+
+// Prune drops buckets older than the retention period
+func (w *Window) Prune(now time.Time) {
+	cutoff := now.Add(-w.retention).Truncate(w.resolution).Unix()
+	for key := range w.buckets {
+		if key < cutoff {
+			delete(w.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+// Package workerpool runs jobs on a fixed number of goroutines while keeping
+// the jobs for one key in order.
+package workerpool
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// Pool runs jobs on several workers. Jobs with the same key always run on the
+// same worker, in the order they were submitted.
+type Pool struct {
+	queues []chan func()
+	wg     sync.WaitGroup
+}
+
+// New starts workers goroutines sharing a queue of queueSize jobs
+func New(workers, queueSize int) *Pool {
+	if workers < 1 {
+		workers = 1
+	}
+	perWorker := max(queueSize/workers, 1)
+
+	p := &Pool{queues: make([]chan func(), workers)}
+	for i := range p.queues {
+		queue := make(chan func(), perWorker)
+		p.queues[i] = queue
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for job := range queue {
+				job()
+			}
+		}()
+	}
+	return p
+}
+
+// Submit queues job on the worker for key, blocking while its queue is full
+func (p *Pool) Submit(key string, job func()) {
+	p.queues[p.worker(key)] <- job
+}
+
+// Close runs the queued jobs and stops the workers. Submit must not be called
+// afterwards.
+func (p *Pool) Close() {
+	for _, queue := range p.queues {
+		close(queue)
+	}
+	p.wg.Wait()
+}
+
+func (p *Pool) worker(key string) int {
+	if len(p.queues) == 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(len(p.queues)))
+}
@@ -0,0 +1,36 @@
+package workerpool
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestPoolKeepsOrderPerKey(t *testing.T) {
+	p := New(4, 16)
+
+	var mu sync.Mutex
+	got := make(map[string][]int)
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("user%d", i%10)
+		p.Submit(key, func() {
+			mu.Lock()
+			got[key] = append(got[key], i)
+			mu.Unlock()
+		})
+	}
+	p.Close()
+
+	total := 0
+	for key, seq := range got {
+		total += len(seq)
+		for j := 1; j < len(seq); j++ {
+			if seq[j] < seq[j-1] {
+				t.Fatalf("jobs for %s ran out of order: %v", key, seq)
+			}
+		}
+	}
+	if total != 1000 {
+		t.Errorf("ran %d jobs, want 1000", total)
+	}
+}
@@ -1,24 +1,62 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"math"
+	"net"
 	"net/http"
+	"net/http/pprof"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"regexp"
 	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/alecthomas/kingpin/v2"
+	"github.com/coreos/go-systemd/v22/activation"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
 
+	"github.com/mogilevich/ocserv_exporter/internal/agent"
+	"github.com/mogilevich/ocserv_exporter/internal/audit"
 	"github.com/mogilevich/ocserv_exporter/internal/collector"
+	"github.com/mogilevich/ocserv_exporter/internal/config"
+	"github.com/mogilevich/ocserv_exporter/internal/dashboard"
+	"github.com/mogilevich/ocserv_exporter/internal/discovery"
+	"github.com/mogilevich/ocserv_exporter/internal/eventbus"
+	"github.com/mogilevich/ocserv_exporter/internal/federation"
+	"github.com/mogilevich/ocserv_exporter/internal/firstseen"
 	"github.com/mogilevich/ocserv_exporter/internal/geoip"
+	"github.com/mogilevich/ocserv_exporter/internal/ha"
+	"github.com/mogilevich/ocserv_exporter/internal/health"
 	"github.com/mogilevich/ocserv_exporter/internal/journal"
-	"github.com/mogilevich/ocserv_exporter/internal/occtl"
+	"github.com/mogilevich/ocserv_exporter/internal/kubernetes"
+	"github.com/mogilevich/ocserv_exporter/internal/ocservconf"
+	"github.com/mogilevich/ocserv_exporter/internal/otlp"
+	"github.com/mogilevich/ocserv_exporter/internal/policy"
+	"github.com/mogilevich/ocserv_exporter/internal/radius"
+	"github.com/mogilevich/ocserv_exporter/internal/rdns"
+	"github.com/mogilevich/ocserv_exporter/internal/remotewrite"
+	"github.com/mogilevich/ocserv_exporter/internal/rules"
+	"github.com/mogilevich/ocserv_exporter/internal/simulate"
+	"github.com/mogilevich/ocserv_exporter/internal/sink"
+	"github.com/mogilevich/ocserv_exporter/internal/workerpool"
+	"github.com/mogilevich/ocserv_exporter/pkg/occtl"
+	"github.com/mogilevich/ocserv_exporter/pkg/parser"
 )
 
 var (
@@ -26,62 +64,864 @@ var (
 )
 
 func main() {
+	var journalUnitsSet, journalBackfillSet bool
 	var (
-		listenAddress = kingpin.Flag("web.listen-address", "Address to listen on for web interface and telemetry.").
-				Default(":9617").String()
+		configFile = kingpin.Flag("config.file", "Path to YAML configuration file (optional).").
+				String()
+		listenAddresses = kingpin.Flag("web.listen-address", "Address to listen on for web interface and telemetry, or unix:<path> for a unix socket (can be specified multiple times).").
+				Default(":9617").Strings()
 		metricsPath = kingpin.Flag("web.telemetry-path", "Path under which to expose metrics.").
 				Default("/metrics").String()
+		maxRequests = kingpin.Flag("web.max-requests", "Maximum number of metrics requests served in parallel; more get 503 (0 for no limit).").
+				Default("40").Int()
+		enablePprof = kingpin.Flag("web.enable-pprof", "Serve Go profiling (net/http/pprof) handlers under /debug/pprof/.").
+				Default("false").Bool()
+		pprofListenAddress = kingpin.Flag("web.pprof-listen-address", "Separate address to serve /debug/pprof/ on instead of --web.listen-address, or unix:<path> for a unix socket (requires --web.enable-pprof).").
+					String()
 		journalUnits = kingpin.Flag("journal.unit", "Systemd unit name to read logs from (can be specified multiple times).").
-				Default("ocserv").Strings()
+				Default("ocserv").IsSetByUser(&journalUnitsSet).Strings()
+		journalMatches = kingpin.Flag("journal.match", "journalctl style match expression, e.g. 'SYSLOG_IDENTIFIER=ocserv _COMM=ocserv-main' (can be specified multiple times). Entries matching any unit or expression are read.").
+				Strings()
 		journalSince = kingpin.Flag("journal.since", "How far back to read logs on startup.").
 				Default("1h").Duration()
-		logFile = kingpin.Flag("log.file", "Read logs from file instead of journald (for testing).").
-			String()
+		journalBackfill = kingpin.Flag("journal.backfill", "Replay logs read via --journal.since only to rebuild active sessions, without counting connections, disconnections and traffic again.").
+				Default("true").IsSetByUser(&journalBackfillSet).Bool()
+		journalNamespace = kingpin.Flag("journal.namespace", "journald namespace to read from instead of the default journal.").
+					String()
+		journalDirectory = kingpin.Flag("journal.directory", "Journal directory to read from instead of the default journal (e.g. /var/log/journal/remote).").
+					String()
+		parserWorkers = kingpin.Flag("parser.workers", "Number of goroutines parsing log lines; lines of one user are processed in order by the same worker (1 = parse in the reading goroutine).").
+				Default("1").Int()
+		parserQueueSize = kingpin.Flag("parser.queue-size", "Log lines buffered between reading and parsing when --parser.workers > 1.").
+				Default("10000").Int()
+		parserRateLimit = kingpin.Flag("parser.rate-limit", "Maximum log lines processed per second; more are dropped and counted in ocserv_events_dropped_total{sink=\"rate_limit\"} (0 for no limit).").
+				Default("0").Float64()
+		parserRateBurst = kingpin.Flag("parser.rate-burst", "Log lines processed at once beyond --parser.rate-limit (default: one second worth).").
+				Int()
+		parserDropUnknownFirst = kingpin.Flag("parser.drop-unknown-first", "Under the rate limit, drop lines without a recognized event first (lines are parsed before the limit applies).").
+					Bool()
+		logStdin = kingpin.Flag("log.stdin", "Read logs piped to stdin (e.g. journalctl -f -u ocserv | ocserv_exporter --log.stdin) instead of journald.").
+				Bool()
+		logFiles = kingpin.Flag("log.file", "Read logs from syslog files instead of journald; accepts globs (can be specified multiple times).").
+				Strings()
+		logFormat = kingpin.Flag("log.format", "Format of --log.file lines: syslog, docker (json-file driver), cri (containerd, CRI-O) or stderr (ocserv's stderr redirected to a file).").
+				Default(journal.FormatSyslog).Enum(journal.Formats...)
+		logTimestampFormat = kingpin.Flag("log.timestamp-format", "Timestamp format of --log.file lines: auto, syslog (classic, no year), rfc3339 (also ISO8601 and rsyslog high precision) or a Go time layout.").
+					Default("auto").String()
+		logProgramRegex = kingpin.Flag("log.program-regex", "Regex for the syslog program names of --log.file lines to accept (renamed services, e.g. 'openconnect-server|oc-corp').").
+				Default(journal.DefaultProgramRegex).String()
+		logServerRegex = kingpin.Flag("log.server-regex", "Regex applied to each --log.file path; its first capture group is used as server name instead of the syslog program name.").
+				String()
+		oneshotTextfile = kingpin.Flag("oneshot.textfile", "Process the logs to their end (--log.file, --log.stdin, or the journal since --journal.since), write the metrics to this file for the node_exporter textfile collector and exit.").
+				String()
+		proxyNetworks = kingpin.Flag("proxy.networks", "Network (CIDR) of load balancers connecting with the proxy protocol; their logins are attributed to the real client address (can be specified multiple times).").
+				Strings()
+		flapThreshold = kingpin.Flag("reconnect.flap-threshold", "Number of reconnects within --reconnect.flap-window that marks a user as flapping.").
+				Default("10").Int()
+		flapWindow = kingpin.Flag("reconnect.flap-window", "Sliding window reconnects are counted in for flapping detection.").
+				Default("10m").Duration()
+		maxSessions = kingpin.Flag("tracking.max-sessions", "Maximum number of tracked sessions; the least recently seen are evicted beyond it.").
+				Default(strconv.Itoa(collector.DefaultMaxSessions)).Int()
+		maxDisconnects = kingpin.Flag("tracking.max-disconnects", "Maximum number of users remembered for reconnect detection; the oldest are evicted beyond it.").
+				Default(strconv.Itoa(collector.DefaultMaxDisconnects)).Int()
+		maxWorkerContexts = kingpin.Flag("tracking.max-worker-contexts", "Maximum number of worker contexts kept for disconnect reasons; the least recently updated are evicted beyond it.").
+					Default(strconv.Itoa(collector.DefaultMaxWorkerContexts)).Int()
+		maxAuthStates = kingpin.Flag("tracking.max-auth-states", "Maximum number of pending auth and login starts, failure reasons and client infos each; the oldest are evicted beyond it.").
+				Default(strconv.Itoa(collector.DefaultMaxAuthStates)).Int()
+		cleanupInterval = kingpin.Flag("tracking.cleanup-interval", "Interval of the cleanup of stale sessions and expired tracking entries.").
+				Default("10m").Duration()
 		geoipDB = kingpin.Flag("geoip.db", "Path to GeoLite2-Country.mmdb file for GeoIP lookups.").
 			String()
+		geoMaxTravelSpeed = kingpin.Flag("geoip.max-travel-speed", "Fastest plausible travel speed (km/h) between two logins of a user; faster counts as impossible travel (needs a City database).").
+					Default("1000").Float64()
+		geoCountryChangeWindow = kingpin.Flag("geoip.country-change-window", "Logins from different countries closer than this count as impossible travel when coordinates are unknown.").
+					Default("1h").Duration()
+		firstSeenEnabled = kingpin.Flag("firstseen.enabled", "Count logins of users from a country, device (client type) or client subnet not seen for them before.").
+					Default("false").Bool()
+		firstSeenStateFile = kingpin.Flag("firstseen.state-file", "File the first-seen fingerprints of users are kept in across restarts (empty: memory only).").
+					String()
+		firstSeenRetention = kingpin.Flag("firstseen.retention", "Forget a user's country, device or subnet after this long without a login from it.").
+					Default("2160h").Duration()
+		firstSeenWebhook = kingpin.Flag("firstseen.webhook-url", "POST first-seen logins as JSON to this URL.").
+					String()
+		hashUsernames = kingpin.Flag("labels.hash-usernames", "Replace usernames in all metric labels with stable pseudonymous hashes.").
+				Default("false").Bool()
+		hashSalt = kingpin.Flag("labels.hash-salt", "Secret salt for --labels.hash-usernames (keeps hashes from being reversed by guessing usernames).").
+				Envar("OCSERV_EXPORTER_HASH_SALT").String()
+		anonymizeIPs = kingpin.Flag("labels.anonymize-ips", "Mask client_ip labels (last octet for IPv4, last 80 bits for IPv6); GeoIP still uses the full address.").
+				Default("false").Bool()
+		rdnsEnabled = kingpin.Flag("rdns.enabled", "Resolve client IPs of failed authentication attempts to their PTR domain (rdns label).").
+				Default("false").Bool()
+		rdnsTimeout = kingpin.Flag("rdns.timeout", "Timeout of a single reverse DNS lookup.").
+				Default("500ms").Duration()
+		rdnsCacheTTL = kingpin.Flag("rdns.cache-ttl", "How long reverse DNS results are cached.").
+				Default("1h").Duration()
+		sessionDurationBuckets = kingpin.Flag("metrics.session-duration-buckets", "Comma-separated histogram buckets (seconds) for session duration.").
+					String()
+		sessionTrafficBuckets = kingpin.Flag("metrics.session-traffic-buckets", "Comma-separated histogram buckets (bytes) for per-session rx/tx traffic.").
+					String()
+		nativeHistograms = kingpin.Flag("metrics.native-histograms", "Also expose histograms as Prometheus native histograms.").
+					Default("false").Bool()
+		authMethodLabel = kingpin.Flag("metrics.auth-method-label", "Add auth_method label (password, certificate, certificate+password, oidc) to ocserv_connections_total and ocserv_auth_failed_total.").
+				Default("false").Bool()
+		clientIPTopN = kingpin.Flag("metrics.client-ip-top-n", "Drop the client_ip label of ocserv_connections_total and export the top N client IPs per server as ocserv_client_ip_connections instead (0 keeps the label).").
+				Default("0").Int()
+		clientIPWindow = kingpin.Flag("metrics.client-ip-window", "Window of the connections counted for --metrics.client-ip-top-n.").
+				Default("1h").Duration()
+		groupLabel = kingpin.Flag("metrics.group-label", "Add group label (ocserv group) to connections, active sessions and traffic metrics.").
+				Default("false").Bool()
+		vhostLabel = kingpin.Flag("metrics.vhost-label", "Add vhost label (ocserv virtual host) to connections, sessions and traffic metrics.").
+				Default("false").Bool()
+		clientTypeLabel = kingpin.Flag("metrics.client-type-label", "Add client_type label (VPN client type from the user agent) to the session duration histogram.").
+				Default("false").Bool()
+		sessionInfoSource = kingpin.Flag("metrics.session-info-source", "Source of ocserv_session_info: journal (log tracking), occtl (polling) or merged (log tracking reconciled with occtl).").
+					Default(collector.SessionInfoMerged).Enum(collector.SessionInfoMerged, collector.SessionInfoJournal, collector.SessionInfoOcctl)
+		nativeBucketFactor = kingpin.Flag("metrics.native-histogram-bucket-factor", "Growth factor between native histogram buckets.").
+					Default("1.1").Float64()
+
+		// ocserv.conf flags
+		ocservConfigs = kingpin.Flag("ocserv.config", "ocserv.conf to export configuration metrics from, in format 'name:path' (can be specified multiple times). Also needed for the max-same-clients limits of ocserv_users_at_session_limit and ocserv_session_limit_hits_total from occtl.").
+				Strings()
+		ocservConfigInterval = kingpin.Flag("ocserv.config-interval", "Interval between ocserv.conf reloads.").
+					Default("5m").Duration()
+
+		// ocpasswd flags
+		ocpasswdFiles = kingpin.Flag("ocpasswd.file", "ocpasswd file to export account inventory from, in format 'name:path' (can be specified multiple times).").
+				Strings()
+		ocpasswdInterval = kingpin.Flag("ocpasswd.interval", "Interval between ocpasswd change checks.").
+					Default("1m").Duration()
+
+		// Pushgateway flags
+		pushGatewayURL = kingpin.Flag("push.gateway-url", "Pushgateway URL to periodically push all metrics to (push mode, e.g. http://pushgateway:9091).").
+				String()
+		pushJob = kingpin.Flag("push.job", "Job name used when pushing to the Pushgateway.").
+			Default("ocserv_exporter").String()
+		pushGrouping = kingpin.Flag("push.grouping", "Grouping label for pushed metrics in format 'name=value' (can be specified multiple times).").
+				Strings()
+		pushInterval = kingpin.Flag("push.interval", "Interval between pushes to the Pushgateway.").
+				Default("30s").Duration()
+
+		// Remote write flags
+		remoteWriteURL = kingpin.Flag("remote-write.url", "Prometheus remote write endpoint to send all metrics to (e.g. https://mimir/api/v1/push).").
+				String()
+		remoteWriteInterval = kingpin.Flag("remote-write.interval", "Interval between remote write requests.").
+					Default("30s").Duration()
+		remoteWriteTimeout = kingpin.Flag("remote-write.timeout", "Timeout of a remote write request.").
+					Default("10s").Duration()
+		remoteWriteUsername = kingpin.Flag("remote-write.username", "Basic auth username for remote write.").
+					String()
+		remoteWritePassword = kingpin.Flag("remote-write.password", "Basic auth password for remote write.").
+					Envar("OCSERV_EXPORTER_REMOTE_WRITE_PASSWORD").String()
+		remoteWriteBearerToken = kingpin.Flag("remote-write.bearer-token", "Bearer token for remote write.").
+					Envar("OCSERV_EXPORTER_REMOTE_WRITE_BEARER_TOKEN").String()
+		remoteWriteLabels = kingpin.Flag("remote-write.external-label", "External label added to all remote written series in format 'name=value' (can be specified multiple times).").
+					Strings()
+
+		// OTLP flags
+		otlpEndpoint = kingpin.Flag("otlp.endpoint", "OTLP/HTTP metrics endpoint to export all metrics to (e.g. http://otel-collector:4318/v1/metrics).").
+				String()
+		otlpInterval = kingpin.Flag("otlp.interval", "Interval between OTLP exports.").
+				Default("30s").Duration()
+		otlpTimeout = kingpin.Flag("otlp.timeout", "Timeout of an OTLP export request.").
+				Default("10s").Duration()
+		otlpHeaders = kingpin.Flag("otlp.header", "Header sent with OTLP requests in format 'name=value' (can be specified multiple times).").
+				Strings()
+		otlpResourceAttrs = kingpin.Flag("otlp.resource-attribute", "Resource attribute added to exported metrics in format 'name=value' (can be specified multiple times).").
+					Strings()
+
+		// Loki flags
+		lokiURL = kingpin.Flag("loki.url", "Loki URL to push enriched events to (e.g. http://loki:3100).").
+			String()
+		lokiTenantID = kingpin.Flag("loki.tenant-id", "Loki tenant (X-Scope-OrgID header).").
+				String()
+		lokiUsername = kingpin.Flag("loki.username", "Basic auth username for Loki.").
+				String()
+		lokiPassword = kingpin.Flag("loki.password", "Basic auth password for Loki.").
+				Envar("OCSERV_EXPORTER_LOKI_PASSWORD").String()
+		lokiLabels = kingpin.Flag("loki.label", "Extra stream label for Loki in format 'name=value' (can be specified multiple times).").
+				Strings()
+		lokiFlushInterval = kingpin.Flag("loki.flush-interval", "Maximum time events wait before being pushed to Loki.").
+					Default("5s").Duration()
+
+		// Event bus flags
+		natsURL = kingpin.Flag("nats.url", "NATS server to publish events to (nats://[user:pass@]host:4222 or tls://...).").
+			String()
+		natsSubjectPrefix = kingpin.Flag("nats.subject-prefix", "NATS subject prefix; events are published to <prefix>.<server>.<event type>.").
+					Default("ocserv.events").String()
+		natsToken = kingpin.Flag("nats.token", "NATS auth token.").
+				Envar("OCSERV_EXPORTER_NATS_TOKEN").String()
+		kafkaRESTURL = kingpin.Flag("kafka.rest-url", "Kafka REST Proxy URL to produce events through (e.g. http://kafka-rest:8082).").
+				String()
+		kafkaTopic = kingpin.Flag("kafka.topic", "Kafka topic for events.").
+				Default("ocserv-events").String()
+		kafkaUsername = kingpin.Flag("kafka.username", "Basic auth username for the Kafka REST Proxy.").
+				String()
+		kafkaPassword = kingpin.Flag("kafka.password", "Basic auth password for the Kafka REST Proxy.").
+				Envar("OCSERV_EXPORTER_KAFKA_PASSWORD").String()
+
+		// SIEM flags
+		siemAddress = kingpin.Flag("siem.address", "Syslog receiver (host:port) to send logins, disconnects and auth failures to as CEF/LEEF.").
+				String()
+		siemProtocol = kingpin.Flag("siem.protocol", "Syslog transport: tcp or udp.").
+				Default("tcp").Enum("tcp", "udp")
+		siemFormat = kingpin.Flag("siem.format", "SIEM message format: cef (ArcSight) or leef (QRadar).").
+				Default("cef").Enum("cef", "leef")
+
+		// Session log flags
+		sessionsDir = kingpin.Flag("sessions.csv-dir", "Directory to write completed-session records (CSV) to for billing ingestion.").
+				String()
+		sessionsRotation = kingpin.Flag("sessions.rotation", "Start a new session file after this long (0 to disable).").
+					Default("24h").Duration()
+		sessionsMaxSize = kingpin.Flag("sessions.max-size", "Start a new session file once it reaches this size (e.g. 100MB, 0 to disable).").
+				Default("0").Bytes()
+		sessionsRetention = kingpin.Flag("sessions.retention", "Delete session files older than this (0 to keep forever).").
+					Default("0").Duration()
+		sessionsClearUsernames = kingpin.Flag("sessions.clear-usernames", "Write real usernames to session records also with --labels.hash-usernames.").
+					Bool()
+
+		// RADIUS accounting flags
+		radiusAcctServer = kingpin.Flag("radius.acct-server", "RADIUS accounting server (host:port) to send Accounting-Start/Interim-Update/Stop to.").
+					String()
+		radiusSecret = kingpin.Flag("radius.secret", "RADIUS shared secret.").
+				Envar("OCSERV_EXPORTER_RADIUS_SECRET").String()
+		radiusTimeout = kingpin.Flag("radius.timeout", "Timeout for each RADIUS request attempt.").
+				Default("3s").Duration()
+		radiusRetries = kingpin.Flag("radius.retries", "Number of RADIUS retransmissions before giving up.").
+				Default("2").Int()
+		radiusInterimInterval = kingpin.Flag("radius.interim-interval", "Interval for Interim-Update packets from occtl traffic readings (requires --occtl.enabled, 0 to disable).").
+					Default("5m").Duration()
+		radiusClearUsernames = kingpin.Flag("radius.clear-usernames", "Send real usernames as User-Name also with --labels.hash-usernames.").
+					Bool()
 
 		// occtl flags
 		occtlEnabled = kingpin.Flag("occtl.enabled", "Enable occtl polling for additional metrics.").
 				Default("false").Bool()
-		occtlSockets = kingpin.Flag("occtl.socket", "occtl socket path in format 'name:path' or just 'name' for default socket (can be specified multiple times).").
+		occtlSockets = kingpin.Flag("occtl.socket", "occtl socket path in format 'name:path', 'name:ssh://[user@]host[:port][/path]' for a remote host or just 'name' for default socket (can be specified multiple times).").
 				Strings()
+		occtlExec = kingpin.Flag("occtl.exec", "How occtl is run: auto (directly when the socket is writable, else with sudo), direct (socket group permissions) or sudo.").
+				Default(occtl.ExecAuto).Enum(occtl.ExecAuto, occtl.ExecDirect, occtl.ExecSudo)
+		occtlCommand = kingpin.Flag("occtl.command", "Command to run occtl with instead of --occtl.exec, e.g. 'docker exec ocserv occtl' (occtl arguments are appended).").
+				String()
+		occtlRecordDir = kingpin.Flag("occtl.record-dir", "Save the raw output of every occtl command to <dir>/<server>/ for replays with --occtl.mock-dir and parser tests.").
+				String()
+		occtlMockDir = kingpin.Flag("occtl.mock-dir", "Read occtl output from fixture files in this directory instead of running occtl (development and tests, see pkg/occtl/testdata).").
+				String()
 		occtlInterval = kingpin.Flag("occtl.interval", "Interval between occtl polls.").
 				Default("30s").Duration()
+		occtlServerIntervals = kingpin.Flag("occtl.server-interval", "Polling interval of one server in format 'name:interval', overriding --occtl.interval (can be specified multiple times).").
+					Strings()
+		occtlMaxBackoff = kingpin.Flag("occtl.max-backoff", "Longest delay between probes of an occtl server that keeps failing (the interval doubles per failure).").
+				Default("10m").Duration()
+		occtlDisabledQueries = kingpin.Flag("occtl.disable-query", "occtl query not to run on polls (can be specified multiple times): "+strings.Join(collector.OcctlQueryNames(), ", ")+".").
+					Enums(collector.OcctlQueryNames()...)
+		occtlJitter = kingpin.Flag("occtl.jitter", "Random delay of up to this duration added to each occtl poll, spreading the polls of many servers.").
+				Default("5s").Duration()
+		occtlSessionTraffic = kingpin.Flag("occtl.session-traffic", "Advance per-user traffic counters from occtl session readings on every poll instead of only at disconnect.").
+					Default("true").Bool()
+		occtlTopUsers = kingpin.Flag("occtl.top-users", "Export the N users of each server that transferred the most bytes between occtl polls as ocserv_top_user_bytes (0 disables).").
+				Default("0").Int()
+
+		// Discovery flags
+		discoveryEnabled = kingpin.Flag("discovery.enabled", "Discover running ocserv units via systemd D-Bus and occtl sockets on startup.").
+					Default("false").Bool()
+		discoveryUnitPattern = kingpin.Flag("discovery.unit-pattern", "systemd unit pattern of ocserv instances.").
+					Default(discovery.DefaultUnitPattern).String()
+		discoverySocketGlobs = kingpin.Flag("discovery.socket-glob", "Glob of occtl sockets to discover (can be specified multiple times).").
+					Default(discovery.DefaultSocketGlobs...).Strings()
+
+		// Kubernetes (sidecar or daemonset next to containerized ocserv)
+		kubernetesEnabled = kingpin.Flag("kubernetes.enabled", "Label all metrics with the namespace, pod and node from the downward API (POD_NAMESPACE, POD_NAME, NODE_NAME) and name the servers of --log.format=cri pod logs after their pods.").
+					Default("false").Bool()
+		kubernetesSocketDir = kingpin.Flag("kubernetes.socket-dir", "Directory (hostPath) with a subdirectory per ocserv pod holding its occtl socket; the sockets are added to the occtl servers on startup.").
+					String()
+
+		// Aggregator (events streamed by agents)
+		aggregatorListenAddress = kingpin.Flag("aggregator.listen-address", "Address to receive events from agents on (gRPC with mutual TLS, e.g. :9618).").
+					String()
+		aggregatorTLSCert = kingpin.Flag("aggregator.tls-cert", "Server certificate (PEM) of the aggregator.").
+					String()
+		aggregatorTLSKey = kingpin.Flag("aggregator.tls-key", "Private key (PEM) of --aggregator.tls-cert.").
+					String()
+		aggregatorTLSClientCA = kingpin.Flag("aggregator.tls-client-ca", "CA (PEM) that signed the agent certificates.").
+					String()
+
+		// Federation (fleet-level metrics from other exporters)
+		federationTargets = kingpin.Flag("federation.target", "Metrics URL of an exporter to scrape and aggregate, e.g. http://vpn1:9617/metrics (can be specified multiple times).").
+					Strings()
+		federationRules = kingpin.Flag("federation.rule", "Metric to aggregate in format 'metric' or 'metric:label,label', summed by the given labels (can be specified multiple times, replaces the default rules).").
+				Strings()
+		federationPath = kingpin.Flag("federation.path", "Path under which to expose the aggregated metrics.").
+				Default("/federate").String()
+		federationInterval = kingpin.Flag("federation.interval", "Interval between scrapes of the federated exporters.").
+					Default("30s").Duration()
+		federationTimeout = kingpin.Flag("federation.timeout", "Timeout of a scrape of a federated exporter.").
+					Default("10s").Duration()
+		federationStaleAfter = kingpin.Flag("federation.stale-after", "How long the last values of a failing exporter are still aggregated.").
+					Default("5m").Duration()
+
+		// Cardinality shedding (memory protection)
+		shedMaxHeap = kingpin.Flag("shedding.max-heap", "Heap size (e.g. 512MB) past which username and client_ip labels are dropped, keeping server-level series (0 to disable).").
+				Default("0").Bytes()
+		shedMaxSeries = kingpin.Flag("shedding.max-series", "Number of exposed series past which username and client_ip labels are dropped (0 to disable).").
+				Default("0").Int()
+		shedHoldTime = kingpin.Flag("shedding.hold-time", "Minimum duration of shedding; labels return once heap and series are below half their limits.").
+				Default("10m").Duration()
+
+		// High availability (leader election between instances reading the same sources)
+		haLockFile = kingpin.Flag("ha.lock-file", "Elect the leader of an HA pair by an exclusive lock on this file; only the leader publishes metrics and events.").
+				String()
+		haConsulURL = kingpin.Flag("ha.consul-url", "Elect the leader of an HA pair by a Consul KV lock via this Consul HTTP API (e.g. http://consul:8500).").
+				String()
+		haConsulKey = kingpin.Flag("ha.consul-key", "Consul KV key of the leader lock, the same for all instances of the pair.").
+				Default("ocserv_exporter/leader").String()
+		haConsulToken = kingpin.Flag("ha.consul-token", "Consul ACL token.").
+				Envar("OCSERV_EXPORTER_HA_CONSUL_TOKEN").String()
+
+		// Subcommands. The flags above are global: run, agent and simulate read and process logs with
+		// them, parse and check-config apply the same configuration, and dashboard and gen-rules
+		// generate files matching it. run has none of its own, simulate runs the same exporter.
+		runCmd         = kingpin.Command("run", "Run the exporter (default).").Default().Alias("serve")
+		versionCmd     = kingpin.Command("version", "Print the version and exit.")
+		checkConfigCmd = kingpin.Command("check-config", "Validate the configuration file and flags and exit.")
+
+		dashboardCmd     = kingpin.Command("dashboard", "Print a Grafana dashboard (JSON) for the metrics enabled by the given flags.")
+		dashboardPerUser = dashboardCmd.Flag("per-user", "Include per-user panels and the username variable.").
+					Default("true").Bool()
+		dashboardTitle = dashboardCmd.Flag("title", "Dashboard title.").
+				Default("ocserv VPN").String()
+
+		genRulesCmd = kingpin.Command("gen-rules", "Print Prometheus alerting rules (YAML) for the metrics enabled by the given flags.")
+		rulesJob    = genRulesCmd.Flag("job", "Scrape job name of the exporter.").
+				Default("ocserv").String()
+		rulesBruteForceAttempts = genRulesCmd.Flag("brute-force-attempts", "Failed logins from one IP that trigger the brute force alert.").
+					Default("20").Int()
+		rulesBruteForceWindow = genRulesCmd.Flag("brute-force-window", "Window for counting failed logins.").
+					Default("10m").Duration()
+		rulesJournalLag = genRulesCmd.Flag("journal-lag", "Maximum time without a processed log event.").
+				Default("1h").Duration()
+		rulesCertExpiry = genRulesCmd.Flag("cert-expiry", "Alert this long before the server certificate expires.").
+				Default("336h").Duration()
+		rulesPoolUsage = genRulesCmd.Flag("pool-usage", "IP pool usage ratio (0-1) that triggers the exhaustion alert.").
+				Default("0.9").Float64()
+
+		agentCmd        = kingpin.Command("agent", "Read and parse logs, streaming the events to an aggregator instead of exposing metrics.")
+		agentAggregator = agentCmd.Flag("aggregator", "Address (host:port) of the aggregator's --aggregator.listen-address.").
+				Required().String()
+		agentNode = agentCmd.Flag("node", "Node name reported to the aggregator (default: hostname); the aggregator uses the certificate's common name instead.").
+				String()
+		agentTLSCert = agentCmd.Flag("tls-cert", "Client certificate (PEM) of the agent.").
+				String()
+		agentTLSKey = agentCmd.Flag("tls-key", "Private key (PEM) of --tls-cert.").
+				String()
+		agentTLSCA = agentCmd.Flag("tls-ca", "CA (PEM) that signed the aggregator certificate.").
+				String()
+		agentQueueSize = agentCmd.Flag("queue-size", "Events buffered while the aggregator is unreachable; more are dropped.").
+				Default(strconv.Itoa(agent.DefaultQueueSize)).Int()
+
+		simulateCmd    = kingpin.Command("simulate", "Generate synthetic ocserv logs for load tests, processed by the exporter instead of real logs or written to --output.")
+		simulateOutput = simulateCmd.Flag("output", "Write the log lines to this file or named pipe (- for stdout) instead of processing them.").
+				String()
+		simulateServers = simulateCmd.Flag("server", "Simulated server (unit name); repeat for several servers.").
+				Default("ocserv").Strings()
+		simulateUsers = simulateCmd.Flag("users", "Distinct simulated users.").
+				Default(strconv.Itoa(simulate.DefaultUsers)).Int()
+		simulateRate = simulateCmd.Flag("rate", "New connection attempts per second.").
+				Default(strconv.FormatFloat(simulate.DefaultRate, 'g', -1, 64)).Float64()
+		simulateFailureRatio = simulateCmd.Flag("failure-ratio", "Share of connection attempts failing authentication (0-1).").
+					Default(strconv.FormatFloat(simulate.DefaultFailureRatio, 'g', -1, 64)).Float64()
+		simulateErrorRatio = simulateCmd.Flag("error-ratio", "Share of sessions ending with an error, after which the user reconnects (0-1).").
+					Default(strconv.FormatFloat(simulate.DefaultErrorRatio, 'g', -1, 64)).Float64()
+		simulateSessionDuration = simulateCmd.Flag("session-duration", "Mean session duration.").
+					Default(simulate.DefaultSessionDuration.String()).Duration()
+		simulateDuration = simulateCmd.Flag("duration", "Simulated time to generate; 0 runs until interrupted.").
+					Default("0s").Duration()
+		simulateSpeed = simulateCmd.Flag("speed", "Simulated seconds per second; 0 generates as fast as possible.").
+				Default("1").Float64()
+		simulateSeed = simulateCmd.Flag("seed", "Random seed of a reproducible stream; 0 picks a random one.").
+				Default("0").Uint64()
+
+		parseCmd  = kingpin.Command("parse", "Run the parser over a log file and report the events by type, unmatched lines grouped by similarity and the resulting metrics.")
+		parseFile = parseCmd.Flag("file", "Log file to parse (- for stdin), in the --log.format.").
+				Required().String()
+		parseSamples = parseCmd.Flag("samples", "Groups of similar unmatched lines to show.").
+				Default("20").Int()
+		parseMetrics = parseCmd.Flag("metrics", "Print the metrics the parsed lines result in.").
+				Bool()
+		parseTextfile = parseCmd.Flag("textfile", "Write the resulting metrics to this file for the node_exporter textfile collector (.prom).").
+				String()
 	)
 
 	kingpin.Version(version)
 	kingpin.HelpFlag.Short('h')
-	kingpin.Parse()
+	// Every flag can also be set by an environment variable (see flagEnvar), e.g.
+	// OCSERV_EXPORTER_OCCTL_ENABLED=true; flags given on the command line take precedence
+	kingpin.CommandLine.Name = "ocserv_exporter"
+	kingpin.CommandLine.DefaultEnvars()
+	kingpin.HelpFlag.NoEnvar()
+	kingpin.CommandLine.VersionFlag.NoEnvar()
+	command := kingpin.Parse()
+	if os.Getenv(flagEnvar("journal.unit")) != "" {
+		// IsSetByUser only sees the command line
+		journalUnitsSet = true
+	}
+	if os.Getenv(flagEnvar("journal.backfill")) != "" {
+		journalBackfillSet = true
+	}
+	switch command {
+	case versionCmd.FullCommand():
+		fmt.Printf("ocserv_exporter %s (%s %s/%s)\n", version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+		return
+	case checkConfigCmd.FullCommand():
+		var serverAliases map[string]string
+		var checks []preflight
+		if *configFile != "" {
+			checks = append(checks, preflight{name: "config file " + *configFile, run: func() (string, error) {
+				cfg, err := config.Load(*configFile)
+				if err != nil {
+					return "", err
+				}
+				serverAliases = cfg.ServerAliases
+				return fmt.Sprintf("%d pattern(s), %d server alias(es)", len(cfg.Patterns), len(cfg.ServerAliases)), nil
+			}, hint: "Fix the file; the error names the offending setting."})
+		}
+		switch {
+		case *logStdin:
+		case len(*logFiles) > 0:
+			for _, pattern := range *logFiles {
+				checks = append(checks, preflight{name: "log file " + pattern, run: func() (string, error) {
+					return checkLogFiles(pattern)
+				}, hint: "Check the path, and that the exporter's user can read the files (e.g. member of the adm group)."})
+			}
+		default:
+			units := *journalUnits
+			if len(*journalMatches) > 0 && !journalUnitsSet {
+				units = nil
+			}
+			opts := journal.JournalOptions{
+				Namespace: *journalNamespace,
+				Directory: *journalDirectory,
+				Matches:   *journalMatches,
+			}
+			checks = append(checks, preflight{name: "journal", run: func() (string, error) {
+				return checkJournal(units, *journalSince, opts)
+			}, hint: "Add the exporter's user to the systemd-journal group, or read logs with --log.file."})
+		}
+		for _, cfg := range *ocservConfigs {
+			checks = append(checks, preflight{name: "ocserv config " + cfg, run: func() (string, error) {
+				_, path, ok := strings.Cut(cfg, ":")
+				if !ok || path == "" {
+					return "", errors.New("expected 'name:path'")
+				}
+				file, err := ocservconf.Load(path)
+				if err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("%d section(s)", len(file.Sections())), nil
+			}, hint: "Check the path, and that the exporter's user can read the file."})
+		}
+		if *geoipDB != "" {
+			checks = append(checks, preflight{name: "GeoIP database " + *geoipDB, run: func() (string, error) {
+				return checkGeoIP(*geoipDB)
+			}, hint: "Download GeoLite2-Country.mmdb or GeoLite2-City.mmdb from MaxMind, e.g. with geoipupdate."})
+		}
+		if *firstSeenEnabled && *firstSeenStateFile != "" {
+			checks = append(checks, preflight{name: "first-seen state " + *firstSeenStateFile, run: func() (string, error) {
+				tracker, err := firstseen.New(firstseen.Config{StateFile: *firstSeenStateFile})
+				if err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("%d user(s)", tracker.Users()), nil
+			}, hint: "Check that the file is readable and valid JSON, or remove it to start over."})
+		}
+		if *occtlEnabled {
+			// After the config file, whose aliases name the servers
+			checks = append(checks, preflight{name: "occtl", run: func() (string, error) {
+				clients := newOcctlClients(*occtlSockets, serverAliases)
+				for _, client := range clients {
+					if *occtlMockDir != "" {
+						client.SetMockDir(*occtlMockDir)
+					} else {
+						setOcctlCommand(client, *occtlCommand, *occtlExec)
+					}
+				}
+				failed := 0
+				for _, client := range clients {
+					detail, err := checkOcctl(client, *occtlCommand == "" && *occtlMockDir == "")
+					if err != nil {
+						failed++
+						fmt.Printf("      %s: %v\n", client.ServerName(), err)
+					} else {
+						fmt.Printf("      %s: %s\n", client.ServerName(), detail)
+					}
+				}
+				if failed > 0 {
+					return "", fmt.Errorf("%d of %d server(s) failed", failed, len(clients))
+				}
+				return fmt.Sprintf("%d server(s)", len(clients)), nil
+			}, hint: "Check that ocserv runs with the socket given in --occtl.socket (occtl-socket-file in ocserv.conf) and that the exporter's user may run occtl (see Permissions setup in the README)."})
+		}
+		if !runPreflights(checks) {
+			os.Exit(1)
+		}
+		return
+	case dashboardCmd.FullCommand():
+		data, err := dashboard.Generate(dashboard.Options{
+			Title:   *dashboardTitle,
+			Occtl:   *occtlEnabled,
+			GeoIP:   *geoipDB != "",
+			PerUser: *dashboardPerUser,
+			Group:   *groupLabel,
+			VHost:   *vhostLabel,
+		})
+		if err != nil {
+			log.Fatalf("Failed to generate dashboard: %v", err)
+		}
+		fmt.Println(string(data))
+		return
+	case genRulesCmd.FullCommand():
+		data, err := rules.Generate(rules.Options{
+			Job:                *rulesJob,
+			BruteForceAttempts: *rulesBruteForceAttempts,
+			BruteForceWindow:   *rulesBruteForceWindow,
+			JournalLag:         *rulesJournalLag,
+			CertExpiry:         *rulesCertExpiry,
+			PoolUsage:          *rulesPoolUsage,
+			Occtl:              *occtlEnabled,
+			OcservConf:         len(*ocservConfigs) > 0,
+		})
+		if err != nil {
+			log.Fatalf("Failed to generate rules: %v", err)
+		}
+		fmt.Print(string(data))
+		return
+	}
+
+	var simulator *simulate.Simulator
+	if command == simulateCmd.FullCommand() {
+		cfg := simulate.Config{
+			Servers:         *simulateServers,
+			Users:           *simulateUsers,
+			Rate:            *simulateRate,
+			FailureRatio:    *simulateFailureRatio,
+			ErrorRatio:      *simulateErrorRatio,
+			SessionDuration: *simulateSessionDuration,
+			Duration:        *simulateDuration,
+			Speed:           *simulateSpeed,
+			Seed:            *simulateSeed,
+		}
+		if err := cfg.Validate(); err != nil {
+			log.Fatalf("Invalid simulation: %v", err)
+		}
+		simulator = simulate.New(cfg)
+		log.Printf("Simulating %d users of %v, %g connection attempts per second (seed %d)", cfg.Users, cfg.Servers, cfg.Rate, cfg.Seed)
+		if *simulateOutput != "" {
+			if err := writeSimulation(simulator, *simulateOutput, cfg.Speed > 0); err != nil {
+				log.Fatalf("Simulation failed: %v", err)
+			}
+			return
+		}
+	}
+
+	agentMode := command == agentCmd.FullCommand()
+	if agentMode {
+		log.Printf("Starting ocserv_exporter %s in agent mode", version)
+		if err := checkAgentFlags(*occtlEnabled, *journalBackfill, journalBackfillSet); err != nil {
+			log.Fatal(err)
+		}
+		// Backfill is on by default for the exporter; agents leave counting to the aggregator
+		*journalBackfill = false
+	} else if command == runCmd.FullCommand() || simulator != nil {
+		log.Printf("Starting ocserv_exporter %s", version)
+	}
+	if *oneshotTextfile != "" {
+		if agentMode {
+			log.Fatalf("--oneshot.textfile is not supported in agent mode")
+		}
+		if *occtlEnabled {
+			log.Fatalf("--oneshot.textfile only processes logs, disable --occtl.enabled")
+		}
+		if !*logStdin && len(*logFiles) == 0 && simulator == nil && *journalSince <= 0 {
+			log.Fatalf("--oneshot.textfile reads the journal since --journal.since, which must be positive")
+		}
+	}
+
+	// Configure histograms before registering metrics
+	histCfg := collector.HistogramConfig{
+		NativeHistograms:   *nativeHistograms,
+		NativeBucketFactor: *nativeBucketFactor,
+	}
+	if *sessionDurationBuckets != "" {
+		buckets, err := parseBuckets(*sessionDurationBuckets)
+		if err != nil {
+			log.Fatalf("Invalid --metrics.session-duration-buckets: %v", err)
+		}
+		histCfg.SessionDurationBuckets = buckets
+	}
+	if *sessionTrafficBuckets != "" {
+		buckets, err := parseBuckets(*sessionTrafficBuckets)
+		if err != nil {
+			log.Fatalf("Invalid --metrics.session-traffic-buckets: %v", err)
+		}
+		histCfg.SessionTrafficBuckets = buckets
+	}
+	collector.ConfigureHistograms(histCfg)
+	if *clientIPTopN < 0 {
+		log.Fatalf("Invalid --metrics.client-ip-top-n %d, must not be negative", *clientIPTopN)
+	}
+	collector.ConfigureLabels(collector.LabelConfig{
+		AuthMethod:    *authMethodLabel,
+		Group:         *groupLabel,
+		VHost:         *vhostLabel,
+		ClientType:    *clientTypeLabel,
+		RDNS:          *rdnsEnabled,
+		HashUsernames: *hashUsernames,
+		HashSalt:      *hashSalt,
+		AnonymizeIPs:  *anonymizeIPs,
+		ClientIPTopN:  *clientIPTopN,
+	})
+	if *hashUsernames && *hashSalt == "" {
+		log.Printf("Warning: --labels.hash-usernames without --labels.hash-salt; hashes of known usernames can be recomputed")
+	}
+
+	if command == parseCmd.FullCommand() {
+		// The metrics of the parsed lines only, without the exporter's own
+		reg := prometheus.NewRegistry()
+		collector.RegisterMetrics(reg)
+		coll := collector.New()
+		bus := eventbus.New()
+		bus.Subscribe(coll)
+		applyConfig(*configFile, coll, bus, reg)
 
-	log.Printf("Starting ocserv_exporter %s", version)
+		report := audit.New(bus)
+		fileOpts := journal.FileOptions{
+			Format:          *logFormat,
+			TimestampFormat: *logTimestampFormat,
+			ProgramRegex:    *logProgramRegex,
+		}
+		if err := auditLog(report, *parseFile, fileOpts); err != nil {
+			log.Fatalf("Failed to read %s: %v", *parseFile, err)
+		}
+		if err := report.WriteReport(os.Stdout, *parseSamples); err != nil {
+			log.Fatalf("Failed to write report: %v", err)
+		}
+		if *parseMetrics {
+			fmt.Println("\nResulting metrics:")
+			if err := audit.WriteMetrics(os.Stdout, reg); err != nil {
+				log.Fatalf("Failed to write metrics: %v", err)
+			}
+		}
+		if *parseTextfile != "" {
+			if err := prometheus.WriteToTextfile(*parseTextfile, reg); err != nil {
+				log.Fatalf("Failed to write %s: %v", *parseTextfile, err)
+			}
+		}
+		return
+	}
 
 	// Register metrics
-	reg := prometheus.DefaultRegisterer
+	reg, gatherer := prometheus.DefaultRegisterer, prometheus.DefaultGatherer
+	if *kubernetesEnabled {
+		labels := kubernetes.Labels(os.Getenv)
+		if len(labels) == 0 {
+			log.Printf("Warning: --kubernetes.enabled without %s, %s or %s set from the downward API", kubernetes.EnvNamespace, kubernetes.EnvPod, kubernetes.EnvNode)
+		}
+		// A registry of its own: the go_ and process_ metrics of the default one can't get labels
+		registry := prometheus.NewRegistry()
+		reg, gatherer = prometheus.WrapRegistererWith(labels, registry), registry
+		reg.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+		log.Printf("Labeling metrics with %v", labels)
+	}
 	collector.RegisterMetrics(reg)
 	collector.Info.WithLabelValues(version).Set(1)
 
 	// Create collector
 	coll := collector.New()
+	coll.SetFlapConfig(collector.FlapConfig{
+		Threshold: *flapThreshold,
+		Window:    *flapWindow,
+	})
+	coll.SetTrackingLimits(collector.TrackingLimits{
+		Sessions:       *maxSessions,
+		Disconnects:    *maxDisconnects,
+		WorkerContexts: *maxWorkerContexts,
+		AuthStates:     *maxAuthStates,
+	})
+	coll.SetSessionInfoSource(*sessionInfoSource)
+
+	// With HA, instances read the same sources but only the leader publishes
+	var elector ha.Elector
+	switch {
+	case *haLockFile != "" && *haConsulURL != "":
+		log.Fatalf("--ha.lock-file and --ha.consul-url are mutually exclusive")
+	case *haLockFile != "":
+		elector = ha.NewFileLock(*haLockFile)
+		log.Printf("HA leader election by lock file %s", *haLockFile)
+	case *haConsulURL != "":
+		node, _ := os.Hostname()
+		elector = ha.NewConsul(ha.ConsulConfig{URL: *haConsulURL, Key: *haConsulKey, Token: *haConsulToken, Node: node})
+		log.Printf("HA leader election by Consul lock %s at %s", *haConsulKey, *haConsulURL)
+	}
+	isLeader := func() bool { return true }
+	if elector != nil {
+		isLeader = elector.IsLeader
+		collector.RegisterHAMetrics(reg)
+	}
+
+	// Parsed log events go to the collector and any other consumer subscribed to the bus;
+	// agents forward them to the aggregator instead
+	bus := eventbus.New()
+	if *parserRateLimit > 0 {
+		burst := *parserRateBurst
+		if burst <= 0 {
+			burst = int(math.Ceil(*parserRateLimit))
+		}
+		bus.SetRateLimit(*parserRateLimit, burst, *parserDropUnknownFirst)
+		log.Printf("Processing at most %g log lines per second (burst %d)", *parserRateLimit, burst)
+	}
+	var forwarder *agent.Forwarder
+	if agentMode {
+		tlsConfig, err := agent.TLSConfig{CertFile: *agentTLSCert, KeyFile: *agentTLSKey, CAFile: *agentTLSCA}.ClientTLS()
+		if err != nil {
+			log.Fatalf("Invalid agent TLS configuration: %v", err)
+		}
+		node := *agentNode
+		if node == "" {
+			if node, err = os.Hostname(); err != nil {
+				log.Fatalf("Failed to get hostname, set --node: %v", err)
+			}
+		}
+		forwarder = agent.NewForwarder(*agentAggregator, node, tlsConfig, *agentQueueSize)
+		bus.Subscribe(eventbus.ConsumerFunc(func(event *parser.Event) {
+			if isLeader() {
+				forwarder.ProcessEvent(event)
+			}
+		}))
+		log.Printf("Streaming events of node %s to aggregator %s", node, *agentAggregator)
+	} else {
+		bus.Subscribe(coll)
+	}
+
+	// Component health for /healthz
+	checks := health.New(version)
+
+	// Load optional configuration file
+	var serverAliases map[string]string
+	cfg := applyConfig(*configFile, coll, bus, reg)
+	if cfg != nil {
+		serverAliases = cfg.ServerAliases
+		log.Printf("Configuration loaded: %s", *configFile)
+		if len(cfg.CountryPolicies) > 0 && *geoipDB == "" {
+			log.Printf("Warning: country_policies have no effect without --geoip.db")
+		}
+	}
+
+	// Discover ocserv instances, adding to the configured units and sockets
+	if *discoveryEnabled {
+		units, err := discovery.Units(context.Background(), *discoveryUnitPattern)
+		if err != nil {
+			log.Printf("Warning: unit discovery failed: %v", err)
+		} else if len(units) > 0 {
+			if !journalUnitsSet {
+				*journalUnits = nil
+			}
+			*journalUnits = appendMissing(*journalUnits, units...)
+			journalUnitsSet = true
+			log.Printf("Discovered ocserv units: %v", units)
+		}
+
+		sockets, err := discovery.Sockets(*discoverySocketGlobs)
+		if err != nil {
+			log.Printf("Warning: occtl socket discovery failed: %v", err)
+		}
+		for _, socket := range sockets {
+			*occtlSockets = appendMissing(*occtlSockets, socket.Server+":"+socket.Path)
+			log.Printf("Discovered occtl socket %s for server %s", socket.Path, socket.Server)
+		}
+	}
+
+	// Add the sockets of the node's ocserv pods
+	if *kubernetesSocketDir != "" {
+		sockets, err := kubernetes.PodSockets(*kubernetesSocketDir)
+		if err != nil {
+			log.Printf("Warning: occtl socket discovery in %s failed: %v", *kubernetesSocketDir, err)
+		}
+		for _, socket := range sockets {
+			*occtlSockets = appendMissing(*occtlSockets, socket.Server+":"+socket.Path)
+			log.Printf("Discovered occtl socket %s for pod server %s", socket.Path, socket.Server)
+		}
+	}
 
 	// Initialize GeoIP if database path provided
 	var resolver *geoip.Resolver
 	if *geoipDB != "" {
 		var err error
+		geoipHealth := checks.Component("geoip", false, 0)
+		geoipHealth.SetDetail("database", *geoipDB)
 		resolver, err = geoip.NewResolver(*geoipDB)
 		if err != nil {
 			log.Printf("Warning: Failed to load GeoIP database: %v", err)
+			geoipHealth.Failure(err)
 		} else {
+			geoipHealth.Success()
+			buildTime := resolver.BuildTime()
+			geoipHealth.SetDetail("build_time", buildTime)
+			geoipHealth.SetDetail("age_days", func() any { return int(time.Since(buildTime).Hours() / 24) })
 			coll.SetGeoIPResolver(resolver)
+			coll.SetGeoAnomalyConfig(collector.GeoAnomalyConfig{
+				MaxTravelSpeed:      *geoMaxTravelSpeed,
+				CountryChangeWindow: *geoCountryChangeWindow,
+			})
 			log.Printf("GeoIP database loaded: %s", *geoipDB)
 		}
 	}
 
+	// Attribute connections from proxy protocol load balancers to the real client
+	if len(*proxyNetworks) > 0 {
+		var networks []*net.IPNet
+		for _, cidr := range *proxyNetworks {
+			if !strings.Contains(cidr, "/") {
+				if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+					cidr += "/32"
+				} else {
+					cidr += "/128"
+				}
+			}
+			_, network, err := net.ParseCIDR(cidr)
+			if err != nil {
+				log.Fatalf("Invalid --proxy.networks %q: %v", cidr, err)
+			}
+			networks = append(networks, network)
+		}
+		coll.SetProxyNetworks(networks)
+		log.Printf("Proxy protocol load balancers: %v", networks)
+	}
+
+	// Initialize reverse DNS if enabled
+	if *rdnsEnabled {
+		coll.SetReverseDNSResolver(rdns.NewResolver(*rdnsTimeout, *rdnsCacheTTL))
+		log.Printf("Reverse DNS enabled (timeout %s, cache TTL %s)", *rdnsTimeout, *rdnsCacheTTL)
+	}
+
 	// Start log reader
 	ctx, cancel := context.WithCancel(context.Background())
 
+	electorDone := make(chan struct{})
+	if elector != nil {
+		checks.Component("ha", false, 0).SetDetail("leader", func() any { return elector.IsLeader() })
+		go func() {
+			defer close(electorDone)
+			elector.Run(ctx)
+		}()
+	} else {
+		close(electorDone)
+	}
+
 	// Start periodic cleanup goroutine
+	if *cleanupInterval <= 0 {
+		log.Fatalf("Invalid --tracking.cleanup-interval %s, must be positive", *cleanupInterval)
+	}
 	go func() {
-		ticker := time.NewTicker(10 * time.Minute)
+		ticker := time.NewTicker(*cleanupInterval)
 		defer ticker.Stop()
 
 		for {
@@ -94,72 +934,507 @@ func main() {
 		}
 	}()
 
+	// Export the top client IPs instead of the client_ip label of connections_total
+	if *clientIPTopN > 0 {
+		collector.RegisterClientIPMetrics(reg)
+		coll.SetClientIPConfig(collector.ClientIPConfig{TopN: *clientIPTopN, Window: *clientIPWindow})
+		go coll.RunClientIPs(ctx)
+		log.Printf("Exporting the top %d client IPs by connections in the last %s", *clientIPTopN, *clientIPWindow)
+	}
+
+	// Drop per-user labels rather than run out of memory
+	if *shedMaxHeap > 0 || *shedMaxSeries > 0 {
+		collector.RegisterSheddingMetrics(reg)
+		go coll.RunShedder(ctx, collector.ShedConfig{
+			MaxHeapBytes: uint64(*shedMaxHeap),
+			MaxSeries:    *shedMaxSeries,
+			Interval:     15 * time.Second,
+			HoldTime:     *shedHoldTime,
+		}, gatherer)
+		log.Printf("Shedding username and client_ip labels past %s heap or %d series (0 = no limit)", *shedMaxHeap, *shedMaxSeries)
+	}
+
+	// Load ocserv.conf files and reload them periodically
+	if len(*ocservConfigs) > 0 {
+		collector.RegisterConfigMetrics(reg)
+
+		configPaths := make(map[string]string)
+		for _, cfg := range *ocservConfigs {
+			name, path, ok := strings.Cut(cfg, ":")
+			if !ok || name == "" || path == "" {
+				log.Fatalf("Invalid --ocserv.config %q, expected 'name:path'", cfg)
+			}
+			configPaths[serverAlias(serverAliases, name)] = path
+		}
+
+		loadOcservConfigs(configPaths, coll)
+		log.Printf("Loaded %d ocserv config file(s), reload interval: %s", len(configPaths), *ocservConfigInterval)
+
+		go func() {
+			ticker := time.NewTicker(*ocservConfigInterval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					loadOcservConfigs(configPaths, coll)
+				}
+			}
+		}()
+	}
+
+	// Watch ocpasswd files for changes
+	if len(*ocpasswdFiles) > 0 {
+		collector.RegisterPasswdMetrics(reg)
+
+		watchers := make(map[string]*fileWatcher)
+		for _, cfg := range *ocpasswdFiles {
+			name, path, ok := strings.Cut(cfg, ":")
+			if !ok || name == "" || path == "" {
+				log.Fatalf("Invalid --ocpasswd.file %q, expected 'name:path'", cfg)
+			}
+			watchers[serverAlias(serverAliases, name)] = &fileWatcher{path: path}
+		}
+
+		checkPasswdFiles(watchers, coll)
+		log.Printf("Watching %d ocpasswd file(s), check interval: %s", len(watchers), *ocpasswdInterval)
+
+		go func() {
+			ticker := time.NewTicker(*ocpasswdInterval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					checkPasswdFiles(watchers, coll)
+				}
+			}
+		}()
+	}
+
+	if *occtlMockDir != "" && !*occtlEnabled {
+		log.Printf("Warning: --occtl.mock-dir without --occtl.enabled has no effect")
+	}
+	if *occtlRecordDir != "" && (!*occtlEnabled || *occtlMockDir != "") {
+		log.Printf("Warning: --occtl.record-dir has no effect without --occtl.enabled or with --occtl.mock-dir")
+	}
+
 	// Initialize occtl polling if enabled
+	var clients []*occtl.Client
 	if *occtlEnabled {
 		collector.RegisterOcctlMetrics(reg)
 
-		// Parse socket configurations
-		var clients []*occtl.Client
-		if len(*occtlSockets) == 0 {
-			// Default: use "ocserv" with default socket
-			clients = append(clients, occtl.NewClient("", "ocserv"))
+		clients = newOcctlClients(*occtlSockets, serverAliases)
+		for _, client := range clients {
+			if *occtlMockDir != "" {
+				client.SetMockDir(*occtlMockDir)
+				log.Printf("Reading occtl output of server %s from fixtures in %s", client.ServerName(), *occtlMockDir)
+				continue
+			}
+			setOcctlCommand(client, *occtlCommand, *occtlExec)
+			log.Printf("Running occtl for server %s as '%s'", client.ServerName(), strings.Join(client.Command(), " "))
+			if *occtlRecordDir != "" {
+				serverName := client.ServerName()
+				client.SetRecordDir(*occtlRecordDir, func(err error) {
+					log.Printf("Warning: Failed to record occtl output of %s: %v", serverName, err)
+				})
+				log.Printf("Recording occtl output of server %s to %s", serverName, filepath.Join(*occtlRecordDir, serverName))
+			}
+		}
+		serverIntervals := make(map[string]time.Duration)
+		for _, cfg := range *occtlServerIntervals {
+			name, value, ok := strings.Cut(cfg, ":")
+			interval, err := time.ParseDuration(value)
+			if !ok || err != nil || interval <= 0 {
+				log.Fatalf("Invalid --occtl.server-interval %q, expected 'name:interval'", cfg)
+			}
+			serverIntervals[serverAlias(serverAliases, name)] = interval
+		}
+		log.Printf("occtl polling enabled with %d server(s), interval: %s, jitter: %s", len(clients), *occtlInterval, *occtlJitter)
+
+		// Queries that depend on other settings are disabled without them
+		disabledQueries := *occtlDisabledQueries
+		if !*occtlSessionTraffic {
+			disabledQueries = append(disabledQueries, collector.OcctlQuerySessionTraffic)
+		}
+		if !collector.GroupLabelEnabled() {
+			disabledQueries = append(disabledQueries, collector.OcctlQueryGroups)
+		}
+		if *radiusAcctServer == "" || *radiusInterimInterval <= 0 {
+			disabledQueries = append(disabledQueries, collector.OcctlQueryInterim)
+		}
+		if *occtlTopUsers > 0 {
+			collector.RegisterTopUserMetrics(reg)
+			coll.SetTopUsers(*occtlTopUsers)
+			log.Printf("Exporting the top %d users by traffic between occtl polls", *occtlTopUsers)
 		} else {
-			for _, socketCfg := range *occtlSockets {
-				// Format: "name:path" or just "name" for default socket
-				parts := strings.SplitN(socketCfg, ":", 2)
-				name := parts[0]
-				socketPath := ""
-				if len(parts) > 1 {
-					socketPath = parts[1]
-				}
-				clients = append(clients, occtl.NewClient(socketPath, name))
+			disabledQueries = append(disabledQueries, collector.OcctlQueryTopUsers)
+		}
+		queries := collector.OcctlQueries(disabledQueries)
+
+		// Start an occtl polling goroutine per server
+		for _, client := range clients {
+			poller := collector.NewOcctlPoller(client, coll, checks, queries)
+			poller.Interval = *occtlInterval
+			poller.Jitter = *occtlJitter
+			poller.MaxBackoff = *occtlMaxBackoff
+			if custom, ok := serverIntervals[client.ServerName()]; ok {
+				poller.Interval = custom
+				log.Printf("Polling occtl of server %s every %s", client.ServerName(), custom)
+			}
+			go poller.Run(ctx)
+		}
+	} else {
+		if *sessionInfoSource == collector.SessionInfoOcctl {
+			log.Printf("Warning: --metrics.session-info-source=occtl requires --occtl.enabled, ocserv_session_info will be empty")
+		}
+
+		// Without occtl, client types come from the user agents workers log
+		collector.RegisterClientTypeMetrics(reg)
+		coll.SetClientTypesFromLogs(true)
+	}
+	collector.RegisterRuntimeMetrics(reg, len(clients), checks)
+
+	// Push metrics to a Pushgateway if configured
+	if *pushGatewayURL != "" {
+		collector.RegisterPushMetrics(reg)
+
+		pusher := push.New(*pushGatewayURL, *pushJob).Gatherer(gatherer)
+		for _, g := range *pushGrouping {
+			name, value, ok := strings.Cut(g, "=")
+			if !ok || name == "" {
+				log.Fatalf("Invalid --push.grouping %q, expected 'name=value'", g)
 			}
+			pusher = pusher.Grouping(name, value)
 		}
 
-		log.Printf("occtl polling enabled with %d server(s), interval: %s", len(clients), *occtlInterval)
+		log.Printf("Pushing metrics to %s (job %q), interval: %s", *pushGatewayURL, *pushJob, *pushInterval)
 
-		// Start occtl polling goroutine
 		go func() {
-			ticker := time.NewTicker(*occtlInterval)
+			ticker := time.NewTicker(*pushInterval)
 			defer ticker.Stop()
 
-			// Initial poll
-			pollOcctl(clients, coll)
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					if isLeader() {
+						pushMetrics(pusher)
+					}
+				}
+			}
+		}()
+	}
+
+	// Send metrics via remote write if configured
+	if *remoteWriteURL != "" {
+		collector.RegisterRemoteWriteMetrics(reg)
+
+		rwClient := remotewrite.NewClient(remotewrite.Config{
+			URL:            *remoteWriteURL,
+			Timeout:        *remoteWriteTimeout,
+			Username:       *remoteWriteUsername,
+			Password:       *remoteWritePassword,
+			BearerToken:    *remoteWriteBearerToken,
+			ExternalLabels: parseKeyValues("--remote-write.external-label", *remoteWriteLabels),
+			UserAgent:      "ocserv_exporter/" + version,
+		})
+
+		log.Printf("Remote write enabled to %s, interval: %s", *remoteWriteURL, *remoteWriteInterval)
+
+		go func() {
+			ticker := time.NewTicker(*remoteWriteInterval)
+			defer ticker.Stop()
 
 			for {
 				select {
 				case <-ctx.Done():
 					return
 				case <-ticker.C:
-					pollOcctl(clients, coll)
+					if isLeader() {
+						remoteWrite(ctx, gatherer, rwClient)
+					}
+				}
+			}
+		}()
+	}
+
+	// Export metrics via OTLP if configured
+	if *otlpEndpoint != "" {
+		collector.RegisterOTLPMetrics(reg)
+
+		exporter := otlp.NewExporter(otlp.Config{
+			Endpoint:           *otlpEndpoint,
+			Timeout:            *otlpTimeout,
+			Headers:            parseKeyValues("--otlp.header", *otlpHeaders),
+			ResourceAttributes: parseKeyValues("--otlp.resource-attribute", *otlpResourceAttrs),
+			ServiceVersion:     version,
+			StartTime:          time.Now(),
+		})
+
+		log.Printf("OTLP export enabled to %s, interval: %s", *otlpEndpoint, *otlpInterval)
+
+		go func() {
+			ticker := time.NewTicker(*otlpInterval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					if isLeader() {
+						exportOTLP(ctx, gatherer, exporter)
+					}
+				}
+			}
+		}()
+	}
+
+	// Ship enriched events to Loki if configured
+	if *lokiURL != "" {
+		loki, err := sink.NewLoki(sink.LokiConfig{
+			URL:      *lokiURL,
+			TenantID: *lokiTenantID,
+			Username: *lokiUsername,
+			Password: *lokiPassword,
+			Labels:   parseKeyValues("--loki.label", *lokiLabels),
+		})
+		if err != nil {
+			log.Fatalf("Invalid --loki.url: %v", err)
+		}
+		startEventSink(ctx, coll, isLeader, "loki", *lokiFlushInterval, loki.Push, false)
+		log.Printf("Shipping events to Loki at %s", *lokiURL)
+	}
+
+	// Publish events to NATS and/or Kafka if configured
+	if *natsURL != "" {
+		nats, err := sink.NewNATS(sink.NATSConfig{
+			URL:           *natsURL,
+			SubjectPrefix: *natsSubjectPrefix,
+			Token:         *natsToken,
+			Version:       version,
+		})
+		if err != nil {
+			log.Fatalf("Invalid --nats.url: %v", err)
+		}
+		startEventSink(ctx, coll, isLeader, "nats", time.Second, nats.Publish, false)
+		log.Printf("Publishing events to NATS at %s (subjects %s.>)", *natsURL, *natsSubjectPrefix)
+	}
+	if *kafkaRESTURL != "" {
+		kafka, err := sink.NewKafka(sink.KafkaConfig{
+			RESTURL:  *kafkaRESTURL,
+			Topic:    *kafkaTopic,
+			Username: *kafkaUsername,
+			Password: *kafkaPassword,
+		})
+		if err != nil {
+			log.Fatalf("Invalid Kafka configuration: %v", err)
+		}
+		startEventSink(ctx, coll, isLeader, "kafka", time.Second, kafka.Produce, false)
+		log.Printf("Producing events to Kafka topic %s via %s", *kafkaTopic, *kafkaRESTURL)
+	}
+	// Send security events to a SIEM if configured
+	if *siemAddress != "" {
+		siem, err := sink.NewSIEM(sink.SIEMConfig{
+			Address:  *siemAddress,
+			Protocol: *siemProtocol,
+			Format:   *siemFormat,
+			Version:  version,
+		})
+		if err != nil {
+			log.Fatalf("Invalid SIEM configuration: %v", err)
+		}
+		startEventSink(ctx, coll, isLeader, "siem", time.Second, siem.Send, false)
+		log.Printf("Sending %s events to SIEM at %s/%s", strings.ToUpper(*siemFormat), *siemAddress, *siemProtocol)
+	}
+	// Write completed-session records if configured
+	if *sessionsDir != "" {
+		sessions, err := sink.NewSessionLog(sink.SessionLogConfig{
+			Dir:       *sessionsDir,
+			Rotation:  *sessionsRotation,
+			MaxSize:   int64(*sessionsMaxSize),
+			Retention: *sessionsRetention,
+		})
+		if err != nil {
+			log.Fatalf("Invalid session log configuration: %v", err)
+		}
+		startEventSink(ctx, coll, isLeader, "sessions", sink.DefaultFlushInterval, sessions.Write, *sessionsClearUsernames)
+		log.Printf("Writing completed sessions to %s", *sessionsDir)
+	}
+	// Send RADIUS accounting if configured
+	if *radiusAcctServer != "" {
+		if *radiusSecret == "" {
+			log.Fatalf("--radius.secret is required with --radius.acct-server")
+		}
+		acct := radius.NewAccountant(radius.NewClient(*radiusAcctServer, *radiusSecret, *radiusTimeout, *radiusRetries))
+		startEventSink(ctx, coll, isLeader, "radius", time.Second, acct.HandleEvents, *radiusClearUsernames)
+		if *radiusInterimInterval > 0 && len(clients) > 0 {
+			go func() {
+				ticker := time.NewTicker(*radiusInterimInterval)
+				defer ticker.Stop()
+
+				for {
+					select {
+					case <-ctx.Done():
+						return
+					case <-ticker.C:
+						if isLeader() {
+							sendInterimUpdates(ctx, coll, acct, *radiusClearUsernames)
+						}
+					}
 				}
+			}()
+		} else if *radiusInterimInterval > 0 {
+			log.Printf("Warning: RADIUS Interim-Update requires --occtl.enabled, only Start/Stop will be sent")
+		}
+		log.Printf("Sending RADIUS accounting to %s", *radiusAcctServer)
+	}
+	// Count logins from new countries, devices and subnets
+	if *firstSeenEnabled {
+		tracker, err := firstseen.New(firstseen.Config{
+			StateFile:  *firstSeenStateFile,
+			Retention:  *firstSeenRetention,
+			WebhookURL: *firstSeenWebhook,
+		})
+		if err != nil {
+			log.Fatalf("Failed to load first-seen state: %v", err)
+		}
+		collector.RegisterFirstSeenMetrics(reg)
+		startEventSink(ctx, coll, isLeader, "firstseen", time.Second, tracker.HandleEvents, false)
+		log.Printf("Tracking first-seen countries, devices and subnets of %d known user(s)", tracker.Users())
+	}
+	// Run the actions of violated policies
+	if cfg != nil && len(cfg.Policies) > 0 {
+		policies, err := cfg.PolicyRules()
+		if err != nil {
+			log.Fatalf("Invalid policies: %v", err)
+		}
+		var actions policy.Occtl
+		if len(clients) > 0 {
+			actions = newOcctlActions(clients)
+		}
+		collector.RegisterPolicyMetrics(reg)
+		startEventSink(ctx, coll, isLeader, "policy", 200*time.Millisecond, policy.NewEngine(policies, actions).HandleEvents, policy.Disconnects(policies))
+		log.Printf("Loaded %d policies", len(policies))
+	}
+	if coll.HasEventSinks() || *parserRateLimit > 0 {
+		collector.RegisterEventSinkMetrics(reg)
+	}
+
+	forwarderDone := make(chan struct{})
+	if forwarder != nil {
+		go func() {
+			defer close(forwarderDone)
+			if err := forwarder.Run(ctx); err != nil {
+				log.Printf("Error streaming to aggregator: %v", err)
+			}
+		}()
+	} else {
+		close(forwarderDone)
+	}
+
+	// Receive the events of agents, published like the events of the own logs
+	var aggregator *agent.Server
+	if *aggregatorListenAddress != "" && !agentMode {
+		tlsConfig, err := agent.TLSConfig{CertFile: *aggregatorTLSCert, KeyFile: *aggregatorTLSKey, CAFile: *aggregatorTLSClientCA}.ServerTLS()
+		if err != nil {
+			log.Fatalf("Invalid aggregator TLS configuration: %v", err)
+		}
+		listener, err := net.Listen("tcp", *aggregatorListenAddress)
+		if err != nil {
+			log.Fatalf("Error listening on %s: %v", *aggregatorListenAddress, err)
+		}
+		collector.RegisterAggregatorMetrics(reg)
+		aggregator = agent.NewServer(tlsConfig, bus.Publish)
+		go func() {
+			log.Printf("Receiving agent events on %s", listener.Addr())
+			if err := aggregator.Serve(listener); err != nil {
+				log.Printf("Aggregator server error: %v", err)
 			}
 		}()
 	}
 
+	var logServerRe *regexp.Regexp
+	if *logServerRegex == "" && *kubernetesEnabled && *logFormat == journal.FormatCRI {
+		*logServerRegex = kubernetes.PodLogServerRegex
+	}
+	if *logServerRegex != "" {
+		var err error
+		logServerRe, err = regexp.Compile(*logServerRegex)
+		if err != nil || logServerRe.NumSubexp() < 1 {
+			log.Fatalf("Invalid --log.server-regex %q: needs a valid regex with a capture group", *logServerRegex)
+		}
+	}
+
 	// Start log reader goroutine
+	logDone := make(chan struct{})
 	go func() {
+		defer close(logDone)
 		var reader journal.Reader
 		var err error
 
-		if *logFile != "" {
-			reader, err = journal.NewFileReader(*logFile)
+		fileOpts := journal.FileOptions{
+			Format:          *logFormat,
+			TimestampFormat: *logTimestampFormat,
+			ProgramRegex:    *logProgramRegex,
+			Once:            *oneshotTextfile != "",
+		}
+		if simulator != nil {
+			reader = simulatorReader{simulator}
+			log.Printf("Reading logs from the simulator")
+		} else if *logStdin {
+			reader, err = journal.NewStdinReader(fileOpts)
+			if err != nil {
+				cancel()
+				log.Fatalf("Failed to read stdin: %v", err)
+			}
+			log.Printf("Reading logs from stdin")
+		} else if len(*logFiles) > 0 {
+			files, err := journal.NewMultiFileReader(*logFiles, logServerRe, fileOpts)
 			if err != nil {
 				cancel()
-				log.Fatalf("Failed to open log file: %v", err)
+				log.Fatalf("Failed to open log files: %v", err)
 			}
-			log.Printf("Reading logs from file: %s", *logFile)
+			reader = files
+			log.Printf("Reading logs from %d file(s): %v", files.Files(), *logFiles)
 		} else {
 			if runtime.GOOS != "linux" {
 				cancel()
 				log.Fatal("journald is only available on Linux. Use --log.file to read from a file instead.")
 			}
-			reader, err = journal.NewJournalReader(*journalUnits, *journalSince)
+			// A one-shot run counts everything it reads, there is no earlier run that did
+			if *journalBackfill && *oneshotTextfile == "" {
+				coll.SetBackfillUntil(time.Now())
+			}
+			units := *journalUnits
+			if len(*journalMatches) > 0 && !journalUnitsSet {
+				// Only read the default unit when no matches replace it
+				units = nil
+			}
+			reader, err = journal.NewJournalReader(units, *journalSince, journal.JournalOptions{
+				Namespace: *journalNamespace,
+				Directory: *journalDirectory,
+				Matches:   *journalMatches,
+				Once:      *oneshotTextfile != "",
+			})
 			if err != nil {
 				cancel()
 				log.Fatalf("Failed to open journal: %v", err)
 			}
-			log.Printf("Reading logs from journald units: %v (since %s)", *journalUnits, *journalSince)
+			switch {
+			case *journalDirectory != "":
+				log.Printf("Reading logs from journal directory %s, units: %v, matches: %q (since %s)", *journalDirectory, units, *journalMatches, *journalSince)
+			case *journalNamespace != "":
+				log.Printf("Reading logs from journald namespace %s, units: %v, matches: %q (since %s)", *journalNamespace, units, *journalMatches, *journalSince)
+			default:
+				log.Printf("Reading logs from journald units: %v, matches: %q (since %s)", units, *journalMatches, *journalSince)
+			}
 		}
 		defer func() {
 			if err := reader.Close(); err != nil {
@@ -167,6 +1442,30 @@ func main() {
 			}
 		}()
 
+		// Parse on a worker pool so reading keeps up with bursts of log lines
+		process := func(entry *journal.Entry) {
+			bus.ProcessLogLine(entry.Timestamp, entry.Message, entry.Unit)
+		}
+		if *parserWorkers > 1 {
+			pool := workerpool.New(*parserWorkers, *parserQueueSize)
+			defer pool.Close()
+			process = func(entry *journal.Entry) {
+				pool.Submit(parser.UserKey(entry.Message), func() {
+					bus.ProcessLogLine(entry.Timestamp, entry.Message, entry.Unit)
+				})
+			}
+			log.Printf("Parsing log lines on %d workers (queue size %d)", *parserWorkers, *parserQueueSize)
+		}
+
+		journalHealth := checks.Component("journal", true, 0)
+		var lastEntry atomic.Int64 // unix nanoseconds of the last entry's timestamp
+		journalHealth.SetDetail("last_entry_age_seconds", func() any {
+			if lastEntry.Load() == 0 {
+				return nil
+			}
+			return time.Since(time.Unix(0, lastEntry.Load())).Seconds()
+		})
+
 		for {
 			select {
 			case <-ctx.Done():
@@ -175,42 +1474,147 @@ func main() {
 			}
 
 			entry, err := reader.Read()
+			if errors.Is(err, io.EOF) {
+				// Piped input ended; keep serving the metrics collected so far
+				log.Printf("Log input closed, no more events will be processed")
+				return
+			}
 			if err != nil {
 				log.Printf("Error reading log: %v", err)
+				journalHealth.Failure(err)
 				continue
 			}
+			journalHealth.Success()
 			if entry == nil {
 				// EOF for file reader
 				time.Sleep(100 * time.Millisecond)
 				continue
 			}
+			journalHealth.SetDetail("lag_seconds", time.Since(entry.Timestamp).Seconds())
+			lastEntry.Store(entry.Timestamp.UnixNano())
 
-			coll.ProcessLogLine(entry.Timestamp, entry.Message, entry.Unit)
+			process(entry)
 		}
 	}()
 
+	// In one-shot mode the metrics are written once the input is processed, instead of served
+	if *oneshotTextfile != "" {
+		<-logDone
+		if err := prometheus.WriteToTextfile(*oneshotTextfile, textfileGatherer(gatherer)); err != nil {
+			log.Fatalf("Failed to write %s: %v", *oneshotTextfile, err)
+		}
+		log.Printf("Wrote metrics to %s", *oneshotTextfile)
+		cancel()
+		<-electorDone
+		return
+	}
+
+	// Scrape other exporters for fleet-level metrics, exposed on their own registry so their
+	// names don't collide with the metrics of the own logs
+	var federationRegistry *prometheus.Registry
+	if len(*federationTargets) > 0 && !agentMode {
+		rules := federation.DefaultRules
+		if len(*federationRules) > 0 {
+			rules = nil
+			for _, value := range *federationRules {
+				rule, err := federation.ParseRule(value)
+				if err != nil {
+					log.Fatalf("Invalid --federation.rule %q: %v", value, err)
+				}
+				rules = append(rules, rule)
+			}
+		}
+		if *federationInterval <= 0 {
+			log.Fatalf("Invalid --federation.interval %s, must be positive", *federationInterval)
+		}
+		federator := federation.New(*federationTargets, rules, *federationTimeout)
+		federator.Interval = *federationInterval
+		federator.StaleAfter = *federationStaleAfter
+		federationRegistry = prometheus.NewRegistry()
+		federationRegistry.MustRegister(federator)
+		collector.RegisterFederationMetrics(reg)
+		go federator.Run(ctx)
+		log.Printf("Aggregating %d metric(s) of %d exporter(s) on %s", len(rules), len(*federationTargets), *federationPath)
+	}
+
 	// HTTP server
 	mux := http.NewServeMux()
-	mux.Handle(*metricsPath, promhttp.Handler())
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		_, _ = w.Write([]byte(`<html>
+	if !agentMode {
+		// OpenMetrics is negotiated with scrapers asking for it; it carries the exemplars of
+		// auth failure and problematic session counters
+		collector.RegisterHTTPMetrics(reg)
+		metricsHandler := promhttp.InstrumentMetricHandler(reg, promhttp.HandlerFor(ha.Gatherer(gatherer, isLeader), promhttp.HandlerOpts{
+			EnableOpenMetrics:   true,
+			MaxRequestsInFlight: *maxRequests,
+		}))
+		mux.Handle(*metricsPath, promhttp.InstrumentHandlerInFlight(collector.HTTPRequestsInFlight,
+			promhttp.InstrumentHandlerDuration(collector.HTTPRequestDuration,
+				promhttp.InstrumentHandlerResponseSize(collector.HTTPResponseSize, metricsHandler))))
+		if federationRegistry != nil {
+			mux.Handle(*federationPath, promhttp.HandlerFor(ha.Gatherer(federationRegistry, isLeader), promhttp.HandlerOpts{
+				MaxRequestsInFlight: *maxRequests,
+			}))
+		}
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`<html>
 <head><title>ocserv Exporter</title></head>
 <body>
 <h1>ocserv Exporter</h1>
 <p><a href="` + *metricsPath + `">Metrics</a></p>
 </body>
 </html>`))
-	})
+		})
+	}
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte("ok"))
 	})
+	mux.Handle("/healthz", checks)
 
+	// Sockets passed by systemd socket activation replace --web.listen-address
+	listeners := activatedListeners()
+	if len(listeners) > 0 {
+		log.Printf("Using %d socket(s) from systemd socket activation, ignoring --web.listen-address", len(listeners))
+	} else {
+		for _, address := range *listenAddresses {
+			listener, err := listen(address)
+			if err != nil {
+				log.Fatalf("Error listening on %s: %v", address, err)
+			}
+			listeners = append(listeners, listener)
+		}
+	}
 	server := &http.Server{
-		Addr:    *listenAddress,
 		Handler: mux,
 	}
 
+	// Profiling, on the metrics listener or a separate admin listener
+	var pprofServer *http.Server
+	if *enablePprof {
+		if *pprofListenAddress == "" {
+			registerPprof(mux)
+			log.Printf("Serving pprof on %s/debug/pprof/", listenerAddresses(listeners))
+		} else {
+			pprofMux := http.NewServeMux()
+			registerPprof(pprofMux)
+			pprofListener, err := listen(*pprofListenAddress)
+			if err != nil {
+				log.Fatalf("Error listening on %s: %v", *pprofListenAddress, err)
+			}
+			pprofServer = &http.Server{
+				Handler: pprofMux,
+			}
+			go func() {
+				log.Printf("Serving pprof on %s/debug/pprof/", pprofListener.Addr())
+				if err := pprofServer.Serve(pprofListener); err != http.ErrServerClosed {
+					log.Printf("pprof server error: %v", err)
+				}
+			}()
+		}
+	} else if *pprofListenAddress != "" {
+		log.Printf("Warning: --web.pprof-listen-address requires --web.enable-pprof, profiling is disabled")
+	}
+
 	// Graceful shutdown
 	go func() {
 		sigCh := make(chan os.Signal, 1)
@@ -219,6 +1623,13 @@ func main() {
 
 		log.Println("Shutting down...")
 		cancel()
+		if aggregator != nil {
+			aggregator.Stop()
+		}
+		// Let the forwarder send the queued events and close its stream
+		<-forwarderDone
+		// Hand the leadership to the other instance
+		<-electorDone
 
 		// Close GeoIP resolver if initialized
 		if resolver != nil {
@@ -232,108 +1643,603 @@ func main() {
 		if err := server.Shutdown(shutdownCtx); err != nil {
 			log.Printf("Error during shutdown: %v", err)
 		}
+		if pprofServer != nil {
+			_ = pprofServer.Shutdown(shutdownCtx)
+		}
 	}()
 
-	log.Printf("Listening on %s", *listenAddress)
-	if err := server.ListenAndServe(); err != http.ErrServerClosed {
-		cancel()
-		log.Fatalf("HTTP server error: %v", err)
+	serveErrs := make(chan error, len(listeners))
+	for _, listener := range listeners {
+		log.Printf("Listening on %s", listener.Addr())
+		go func() {
+			serveErrs <- server.Serve(listener)
+		}()
+	}
+	for range listeners {
+		if err := <-serveErrs; err != http.ErrServerClosed {
+			cancel()
+			log.Fatalf("HTTP server error: %v", err)
+		}
 	}
 }
 
-// pollOcctl fetches metrics from all occtl clients
-func pollOcctl(clients []*occtl.Client, coll *collector.Collector) {
-	// Collect all stats first, then update metrics atomically
-	allUserAgentStats := make(map[string]map[string]int)
-	allUserSessionCounts := make(map[string]map[string]int)
-	allUsers := make(map[string][]occtl.User)
-	allUserClientTypes := make(map[string]map[string]string)
+// activatedListeners returns the listening sockets systemd passed with socket activation
+// (LISTEN_FDS), if any
+func activatedListeners() []net.Listener {
+	var listeners []net.Listener
+	activated, _ := activation.Listeners()
+	for _, listener := range activated {
+		if listener != nil { // not a stream socket
+			listeners = append(listeners, listener)
+		}
+	}
+	return listeners
+}
 
-	for _, client := range clients {
-		serverName := client.ServerName()
+// listenerAddresses returns the addresses listeners are bound to, for logging
+func listenerAddresses(listeners []net.Listener) string {
+	addresses := make([]string, len(listeners))
+	for i, listener := range listeners {
+		addresses[i] = listener.Addr().String()
+	}
+	return strings.Join(addresses, ", ")
+}
 
-		// Get server status
-		status, err := client.GetStatus()
+// listen opens the listener of a --web.listen-address: "unix:<path>" for a unix socket, anything
+// else is a TCP address. A socket file left by a previous run is replaced.
+func listen(address string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(address, "unix:")
+	if !ok {
+		return net.Listen("tcp", address)
+	}
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen("unix", path)
+}
+
+// registerPprof mounts the net/http/pprof handlers under /debug/pprof/
+func registerPprof(mux *http.ServeMux) {
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+}
+
+// pushMetrics pushes the registry to the Pushgateway, replacing the previously pushed group
+func pushMetrics(pusher *push.Pusher) {
+	start := time.Now()
+	err := pusher.Push()
+	collector.PushDuration.Set(time.Since(start).Seconds())
+	if err != nil {
+		collector.PushTotal.WithLabelValues("failure").Inc()
+		log.Printf("Warning: Failed to push metrics: %v", err)
+		return
+	}
+	collector.PushTotal.WithLabelValues("success").Inc()
+	collector.PushLastSuccessTimestamp.SetToCurrentTime()
+}
+
+// remoteWrite sends the current state of all metrics of g via remote write
+func remoteWrite(ctx context.Context, g prometheus.Gatherer, client *remotewrite.Client) {
+	families, err := g.Gather()
+	if err != nil {
+		log.Printf("Warning: Failed to gather metrics for remote write: %v", err)
+	}
+
+	n, err := client.Send(ctx, families, time.Now())
+	if err != nil {
+		collector.RemoteWriteTotal.WithLabelValues("failure").Inc()
+		log.Printf("Warning: Remote write failed: %v", err)
+		return
+	}
+	collector.RemoteWriteTotal.WithLabelValues("success").Inc()
+	collector.RemoteWriteSamplesTotal.Add(float64(n))
+	collector.RemoteWriteLastSuccessTimestamp.SetToCurrentTime()
+}
+
+// exportOTLP sends the current state of all metrics of g via OTLP
+func exportOTLP(ctx context.Context, g prometheus.Gatherer, exporter *otlp.Exporter) {
+	families, err := g.Gather()
+	if err != nil {
+		log.Printf("Warning: Failed to gather metrics for OTLP export: %v", err)
+	}
+
+	n, err := exporter.Export(ctx, families, time.Now())
+	if err != nil {
+		collector.OTLPExportsTotal.WithLabelValues("failure").Inc()
+		log.Printf("Warning: OTLP export failed: %v", err)
+		return
+	}
+	collector.OTLPExportsTotal.WithLabelValues("success").Inc()
+	collector.OTLPDataPointsTotal.Add(float64(n))
+	collector.OTLPLastSuccessTimestamp.SetToCurrentTime()
+}
+
+// startEventSink registers a queued event sink with the collector and starts its delivery goroutine;
+// events reach the sink only while isLeader reports true. Sinks get the pseudonymized username
+// unless clearUsernames is set (see collector.AddEventSink).
+func startEventSink(ctx context.Context, coll *collector.Collector, isLeader func() bool, name string, flushInterval time.Duration, send sink.SendFunc, clearUsernames bool) {
+	queue := sink.NewQueue(name, sink.DefaultQueueSize, sink.DefaultBatchSize, flushInterval, send)
+	coll.AddEventSink(ha.Sink(queue, isLeader), clearUsernames)
+	go queue.Run(ctx)
+}
+
+// sendInterimUpdates sends RADIUS Interim-Update packets with the per-session traffic the occtl
+// pollers read since the last update, with the usernames the accounting sink gets
+func sendInterimUpdates(ctx context.Context, coll *collector.Collector, acct *radius.Accountant, clearUsernames bool) {
+	now := time.Now()
+	for server, users := range coll.InterimReadings() {
+		usage := make([]radius.Usage, 0, len(users))
+		for _, user := range users {
+			username := user.Username
+			if !clearUsernames {
+				username = collector.Username(username)
+			}
+			usage = append(usage, radius.Usage{
+				Username: username,
+				ClientIP: user.ClientIP,
+				VpnIP:    user.VpnIP,
+				RxBytes:  uint64(max(user.RxBytes, 0)),
+				TxBytes:  uint64(max(user.TxBytes, 0)),
+			})
+		}
+		if err := acct.Interim(ctx, server, usage, now); err != nil {
+			log.Printf("Warning: RADIUS interim update for %s failed: %v", server, err)
+		}
+	}
+}
+
+// checkAgentFlags rejects flags that don't work in agent mode. --journal.backfill is only
+// rejected when given explicitly, its default applies to the exporter.
+func checkAgentFlags(occtlEnabled, backfill, backfillSet bool) error {
+	if occtlEnabled {
+		// Poll the node's occtl from the aggregator over ssh instead
+		return errors.New("--occtl.enabled is not supported in agent mode, use --occtl.socket=name:ssh://host on the aggregator")
+	}
+	if backfill && backfillSet {
+		return errors.New("--journal.backfill is not supported in agent mode, the aggregator would count the replayed events")
+	}
+	return nil
+}
+
+// flagEnvar returns the environment variable of a flag: OCSERV_EXPORTER_ and the flag name in
+// upper case with dots and dashes replaced by underscores, as kingpin derives it with
+// DefaultEnvars. Flags of secrets keep their documented variables, e.g. OCSERV_EXPORTER_HASH_SALT.
+func flagEnvar(flag string) string {
+	return "OCSERV_EXPORTER_" + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(flag))
+}
+
+// applyConfig loads the configuration file, if given, into the collector and the event bus. The
+// exporter and the parse command share it, so an audit parses lines as the exporter would.
+func applyConfig(path string, coll *collector.Collector, bus *eventbus.Bus, reg prometheus.Registerer) *config.Config {
+	if path == "" {
+		return nil
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	coll.SetReasonMap(cfg.ReasonMap())
+	if len(cfg.CountryPolicies) > 0 {
+		policies := make(map[string]collector.CountryPolicy, len(cfg.CountryPolicies))
+		for server, p := range cfg.CountryPolicies {
+			policies[server] = collector.CountryPolicy(p)
+		}
+		collector.RegisterCountryPolicyMetrics(reg)
+		coll.SetCountryPolicies(policies)
+	}
+	bus.SetServerAliases(cfg.ServerAliases)
+	if len(cfg.Patterns) > 0 {
+		patterns, err := cfg.ParserPatterns()
 		if err != nil {
-			log.Printf("Warning: Failed to get occtl status for %s: %v", serverName, err)
+			log.Fatalf("Invalid log patterns: %v", err)
+		}
+		collector.RegisterPatternMetrics(reg)
+		bus.SetPatterns(patterns)
+		log.Printf("Loaded %d custom log pattern(s)", len(patterns))
+	}
+	return cfg
+}
+
+// occtlActions runs policy actions with the occtl client of the event's server
+type occtlActions map[string]*occtl.Client
+
+func newOcctlActions(clients []*occtl.Client) occtlActions {
+	actions := make(occtlActions, len(clients))
+	for _, client := range clients {
+		actions[client.ServerName()] = client
+	}
+	return actions
+}
+
+func (a occtlActions) client(server string) (*occtl.Client, error) {
+	client, ok := a[server]
+	if !ok {
+		return nil, fmt.Errorf("no occtl socket for server %s", server)
+	}
+	return client, nil
+}
+
+// DisconnectUser implements policy.Occtl
+func (a occtlActions) DisconnectUser(server, username string) error {
+	client, err := a.client(server)
+	if err != nil {
+		return err
+	}
+	return client.DisconnectUser(username)
+}
+
+// UnbanIP implements policy.Occtl
+func (a occtlActions) UnbanIP(server, ip string) error {
+	client, err := a.client(server)
+	if err != nil {
+		return err
+	}
+	return client.UnbanIP(ip)
+}
+
+// newOcctlClients creates the clients of the --occtl.socket flags: "name:path", "name:ssh://host"
+// or just "name" for the default socket; without flags the default socket of server "ocserv"
+func newOcctlClients(sockets []string, aliases map[string]string) []*occtl.Client {
+	if len(sockets) == 0 {
+		return []*occtl.Client{occtl.NewClient("", serverAlias(aliases, "ocserv"))}
+	}
+	var clients []*occtl.Client
+	for _, socketCfg := range sockets {
+		name, socketPath, _ := strings.Cut(socketCfg, ":")
+		if strings.HasPrefix(socketPath, occtl.SSHScheme) {
+			client, err := occtl.NewRemoteClient(socketPath, serverAlias(aliases, name))
+			if err != nil {
+				log.Fatalf("Invalid --occtl.socket %q: %v", socketCfg, err)
+			}
+			clients = append(clients, client)
 			continue
 		}
+		clients = append(clients, occtl.NewClient(socketPath, serverAlias(aliases, name)))
+	}
+	return clients
+}
+
+// setOcctlCommand sets the command a client runs occtl with from --occtl.command or --occtl.exec
+func setOcctlCommand(client *occtl.Client, command, execMode string) {
+	if fields := strings.Fields(command); len(fields) > 0 {
+		client.SetCommand(fields)
+	} else if client.Remote() && execMode == occtl.ExecAuto {
+		// The permissions of a remote socket can't be checked
+		client.SetCommand(occtl.ExecCommand(occtl.ExecSudo, client.SocketPath()))
+	} else {
+		client.SetCommand(occtl.ExecCommand(execMode, client.SocketPath()))
+	}
+}
+
+// preflight is a check of the check-config command
+type preflight struct {
+	name string
+	run  func() (string, error) // returns details of a passed check
+	hint string                 // what to do when the check fails
+}
+
+// warning is an error of a preflight that doesn't fail check-config
+type warning struct{ error }
 
-		// Update server metrics
-		collector.ServerRxBytesTotal.WithLabelValues(serverName).Set(float64(status.RxBytes))
-		collector.ServerTxBytesTotal.WithLabelValues(serverName).Set(float64(status.TxBytes))
-		collector.ServerActiveSessions.WithLabelValues(serverName).Set(float64(status.ActiveSessions))
-		collector.ServerTotalSessions.WithLabelValues(serverName).Set(float64(status.TotalSessions))
-		collector.ServerLatencyMedian.WithLabelValues(serverName).Set(status.LatencyMedianMs / 1000.0)
-		collector.ServerLatencyStdev.WithLabelValues(serverName).Set(status.LatencyStdevMs / 1000.0)
-		collector.ServerUptime.WithLabelValues(serverName).Set(status.UptimeSeconds)
-		collector.ServerAvgSessionTime.WithLabelValues(serverName).Set(status.AvgSessionTimeSec)
+// runPreflights runs the checks in order, printing their results; false if any failed
+func runPreflights(checks []preflight) bool {
+	failed := 0
+	for _, check := range checks {
+		detail, err := check.run()
+		var warn warning
+		switch {
+		case errors.As(err, &warn):
+			fmt.Printf("WARN  %s: %v\n", check.name, err)
+			fmt.Printf("      %s\n", check.hint)
+		case err != nil:
+			failed++
+			fmt.Printf("FAIL  %s: %v\n", check.name, err)
+			fmt.Printf("      %s\n", check.hint)
+		default:
+			fmt.Printf("OK    %s: %s\n", check.name, detail)
+		}
+	}
+	if failed > 0 {
+		fmt.Printf("\n%d of %d check(s) failed\n", failed, len(checks))
+		return false
+	}
+	fmt.Printf("\nAll %d check(s) passed\n", len(checks))
+	return true
+}
 
-		// Get user agent statistics
-		userAgentStats, err := client.GetUserAgentStats()
+// checkLogFiles checks that a --log.file pattern matches readable files
+func checkLogFiles(pattern string) (string, error) {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return "", err
+	}
+	if len(paths) == 0 {
+		return "", errors.New("no file matches")
+	}
+	for _, path := range paths {
+		f, err := os.Open(path)
 		if err != nil {
-			log.Printf("Warning: Failed to get occtl sessions for %s: %v", serverName, err)
-			continue
+			return "", err
 		}
-		allUserAgentStats[serverName] = userAgentStats
+		f.Close()
+	}
+	return fmt.Sprintf("%d readable file(s)", len(paths)), nil
+}
+
+// checkJournal opens the journal and reads the first entry within since. An empty journal is
+// only a warning: ocserv may not have logged, but without access to the system journal
+// sd-journal silently reads only the user's own.
+func checkJournal(units []string, since time.Duration, opts journal.JournalOptions) (string, error) {
+	opts.Once = true
+	reader, err := journal.NewJournalReader(units, since, opts)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	if since <= 0 {
+		return "opened, entries not checked without --journal.since", nil
+	}
+	entry, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return "", warning{fmt.Errorf("no entries of units %v in the last %s", units, since)}
+	}
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("readable, first entry of units %v at %s", units, entry.Timestamp.Format(time.RFC3339)), nil
+}
+
+// checkGeoIP opens the GeoIP database; one older than two months is a warning
+func checkGeoIP(path string) (string, error) {
+	resolver, err := geoip.NewResolver(path)
+	if err != nil {
+		return "", err
+	}
+	defer resolver.Close()
+	built := resolver.BuildTime()
+	if age := time.Since(built); age > 60*24*time.Hour {
+		return "", warning{fmt.Errorf("built %s, %d days ago", built.Format(time.DateOnly), int(age.Hours()/24))}
+	}
+	return "built " + built.Format(time.DateOnly), nil
+}
 
-		// Get user session counts (for concurrent sessions detection)
-		userSessionCounts, err := client.GetUserSessionCounts()
+// checkOcctl runs "occtl show status" for a server, first checking that a local socket exists
+func checkOcctl(client *occtl.Client, localSocket bool) (string, error) {
+	if localSocket && !client.Remote() {
+		socket := client.SocketPath()
+		if socket == "" {
+			socket = occtl.DefaultSocketPath
+		}
+		info, err := os.Stat(socket)
 		if err != nil {
-			log.Printf("Warning: Failed to get user session counts for %s: %v", serverName, err)
-			continue
+			return "", err
+		}
+		if info.Mode()&os.ModeSocket == 0 {
+			return "", fmt.Errorf("%s is not a socket", socket)
 		}
-		allUserSessionCounts[serverName] = userSessionCounts
+	}
+	status, err := client.GetStatus()
+	if err != nil {
+		return "", fmt.Errorf("'%s': %w", strings.Join(client.Command(), " "), err)
+	}
+	return fmt.Sprintf("%d active session(s)", status.ActiveSessions), nil
+}
 
-		// Get users list for session info
-		users, err := client.GetUsers()
+// parseKeyValues parses repeated 'name=value' flag values
+func parseKeyValues(flag string, values []string) map[string]string {
+	result := make(map[string]string, len(values))
+	for _, v := range values {
+		name, value, ok := strings.Cut(v, "=")
+		if !ok || name == "" {
+			log.Fatalf("Invalid %s %q, expected 'name=value'", flag, v)
+		}
+		result[name] = value
+	}
+	return result
+}
+
+// textfileGatherer drops the Go runtime and process metrics from g, which would collide with
+// node_exporter's own in its textfile collector
+func textfileGatherer(g prometheus.Gatherer) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		families, err := g.Gather()
+		kept := families[:0]
+		for _, family := range families {
+			if !strings.HasPrefix(family.GetName(), "go_") && !strings.HasPrefix(family.GetName(), "process_") {
+				kept = append(kept, family)
+			}
+		}
+		return kept, err
+	})
+}
+
+// auditLog adds the lines of a log file, or stdin (-), to a parse audit
+func auditLog(report *audit.Audit, path string, opts journal.FileOptions) error {
+	var reader journal.Reader
+	var err error
+	if path == "-" {
+		reader, err = journal.NewStdinReader(opts)
+	} else {
+		reader, err = journal.NewFileReader(path, opts)
+	}
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	for {
+		entry, err := reader.Read()
+		if errors.Is(err, io.EOF) || (err == nil && entry == nil) {
+			// End of stdin, or of the file (which a file reader would follow)
+			return nil
+		}
 		if err != nil {
-			log.Printf("Warning: Failed to get users for %s: %v", serverName, err)
-			continue
+			return err
+		}
+		report.Add(entry.Timestamp, entry.Message, entry.Unit)
+	}
+}
+
+// simulatorReader reads the log lines of a simulator as journal entries
+type simulatorReader struct {
+	*simulate.Simulator
+}
+
+func (r simulatorReader) Read() (*journal.Entry, error) {
+	line, err := r.Next()
+	if err != nil {
+		return nil, err
+	}
+	return &journal.Entry{Timestamp: line.Timestamp, Message: line.Message, Unit: line.Unit}, nil
+}
+
+// writeSimulation writes the simulated log lines to a file, a named pipe or stdout (-) until the
+// simulation ends or the process is interrupted. Paced lines are flushed as they are due, for
+// readers following the output.
+func writeSimulation(sim *simulate.Simulator, path string, paced bool) error {
+	out := os.Stdout
+	if path != "-" {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
 		}
-		allUsers[serverName] = users
+		defer file.Close()
+		out = file
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+	go func() {
+		<-sigCh
+		_ = sim.Close()
+	}()
 
-		// Get user client types for session info
-		userClientTypes, err := client.GetUserClientTypes()
+	w := bufio.NewWriter(out)
+	lines := 0
+	for {
+		line, err := sim.Next()
+		if errors.Is(err, io.EOF) {
+			log.Printf("Wrote %d log lines", lines)
+			return w.Flush()
+		}
 		if err != nil {
-			log.Printf("Warning: Failed to get user client types for %s: %v", serverName, err)
+			return err
+		}
+		if _, err := w.WriteString(line.String() + "\n"); err != nil {
+			return err
+		}
+		lines++
+		if paced {
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// loadOcservConfigs parses ocserv.conf files (key: server name) and updates config metrics
+// Files that fail to parse are logged and skipped
+func loadOcservConfigs(paths map[string]string, coll *collector.Collector) {
+	configs := make(map[string]*ocservconf.File)
+	for server, path := range paths {
+		file, err := ocservconf.Load(path)
+		if err != nil {
+			log.Printf("Warning: Failed to load ocserv config for %s: %v", server, err)
 			continue
 		}
-		allUserClientTypes[serverName] = userClientTypes
+		configs[server] = file
+	}
+	coll.SetServerConfigs(configs)
+}
+
+// fileWatcher detects file changes by modification time and size
+type fileWatcher struct {
+	path    string
+	modTime time.Time
+	size    int64
+}
+
+// changed reports whether the file changed since it was last marked seen, with its current
+// state to mark seen once it was processed
+func (w *fileWatcher) changed() (os.FileInfo, bool, error) {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return nil, false, err
 	}
+	return info, !info.ModTime().Equal(w.modTime) || info.Size() != w.size, nil
+}
+
+// seen records the state of the file as processed, so it only counts as changed again after
+// it is modified. A file that failed to load (e.g. half written) is not marked and is retried.
+func (w *fileWatcher) seen(info os.FileInfo) {
+	w.modTime = info.ModTime()
+	w.size = info.Size()
+}
 
-	// Reset and update all client type metrics at once
-	collector.SessionsByClientType.Reset()
-	for serverName, stats := range allUserAgentStats {
-		for clientType, count := range stats {
-			collector.SessionsByClientType.WithLabelValues(serverName, clientType).Set(float64(count))
+// checkPasswdFiles reloads ocpasswd files (key: server name) that changed since the last check
+func checkPasswdFiles(watchers map[string]*fileWatcher, coll *collector.Collector) {
+	for server, w := range watchers {
+		info, changed, err := w.changed()
+		if err != nil {
+			log.Printf("Warning: Failed to stat ocpasswd file for %s: %v", server, err)
+			continue
+		}
+		if !changed {
+			continue
 		}
+		users, err := ocservconf.LoadPasswd(w.path)
+		if err != nil {
+			log.Printf("Warning: Failed to load ocpasswd file for %s: %v", server, err)
+			continue
+		}
+		w.seen(info)
+		coll.SetPasswdUsers(server, users)
 	}
+}
 
-	// Reset and update user concurrent sessions metrics
-	collector.UserConcurrentSessions.Reset()
-	for serverName, counts := range allUserSessionCounts {
-		for username, count := range counts {
-			collector.UserConcurrentSessions.WithLabelValues(serverName, username).Set(float64(count))
+// parseBuckets parses a comma-separated list of increasing histogram bucket boundaries
+func parseBuckets(s string) ([]float64, error) {
+	var buckets []float64
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
 		}
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bucket %q: %w", part, err)
+		}
+		if len(buckets) > 0 && v <= buckets[len(buckets)-1] {
+			return nil, fmt.Errorf("buckets must be in increasing order: %v after %v", v, buckets[len(buckets)-1])
+		}
+		buckets = append(buckets, v)
+	}
+	if len(buckets) == 0 {
+		return nil, fmt.Errorf("no buckets specified")
 	}
+	return buckets, nil
+}
 
-	// Reset and update session info from occtl users (accurate real-time data)
-	collector.SessionInfo.Reset()
-	for serverName, users := range allUsers {
-		clientTypes := allUserClientTypes[serverName]
-		for _, user := range users {
-			country := ""
-			if coll != nil {
-				country = coll.LookupCountry(user.ClientIP)
-			}
-			clientType := ""
-			if clientTypes != nil {
-				clientType = clientTypes[user.Username]
-			}
-			// Value is session start timestamp (now - since duration)
-			startTime := time.Now().Add(-user.Since)
-			collector.SessionInfo.WithLabelValues(serverName, user.Username, user.VpnIP, country, clientType).Set(float64(startTime.Unix()))
+// serverAlias returns the configured server label for a unit or socket name
+func serverAlias(aliases map[string]string, name string) string {
+	if alias, ok := aliases[name]; ok {
+		return alias
+	}
+	return name
+}
+
+// appendMissing appends the values not yet in list
+func appendMissing(list []string, values ...string) []string {
+	for _, v := range values {
+		if !slices.Contains(list, v) {
+			list = append(list, v)
 		}
 	}
+	return list
 }
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/alecthomas/kingpin/v2"
+
+	"github.com/mogilevich/ocserv_exporter/internal/journal"
+)
+
+func TestCheckAgentFlags(t *testing.T) {
+	tests := []struct {
+		name         string
+		occtl        bool
+		backfill     bool
+		backfillSet  bool
+		wantRejected bool
+	}{
+		{name: "defaults", backfill: true},
+		{name: "backfill given explicitly", backfill: true, backfillSet: true, wantRejected: true},
+		{name: "backfill turned off", backfillSet: true},
+		{name: "occtl", occtl: true, backfill: true, wantRejected: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkAgentFlags(tt.occtl, tt.backfill, tt.backfillSet)
+			if (err != nil) != tt.wantRejected {
+				t.Errorf("checkAgentFlags() = %v, want rejected %v", err, tt.wantRejected)
+			}
+		})
+	}
+}
+
+// Every --log.format value is accepted by the flag and opens a reader
+func TestLogFormats(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ocserv.log")
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(journal.Formats, journal.FormatStderr) {
+		t.Errorf("--log.format doesn't accept %s", journal.FormatStderr)
+	}
+	for _, format := range journal.Formats {
+		app := kingpin.New("test", "")
+		logFormat := app.Flag("log.format", "").Default(journal.FormatSyslog).Enum(journal.Formats...)
+		if _, err := app.Parse([]string{"--log.format=" + format}); err != nil {
+			t.Errorf("--log.format=%s: %v", format, err)
+			continue
+		}
+		reader, err := journal.NewFileReader(path, journal.FileOptions{Format: *logFormat, Once: true})
+		if err != nil {
+			t.Errorf("--log.format=%s: %v", format, err)
+			continue
+		}
+		reader.Close()
+	}
+}
+
+// A file that fails to load is retried on the next check without being modified again
+func TestFileWatcherRetriesFailedLoads(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ocpasswd")
+	if err := os.WriteFile(path, []byte("alice\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	w := &fileWatcher{path: path}
+	info, changed, err := w.changed()
+	if err != nil || !changed {
+		t.Fatalf("changed() = %v, %v, want a change", changed, err)
+	}
+	// Loading failed (half-written file), so the state isn't marked seen
+	if _, changed, _ := w.changed(); !changed {
+		t.Fatal("unprocessed change not reported again")
+	}
+	w.seen(info)
+	if _, changed, _ := w.changed(); changed {
+		t.Error("change reported again after it was processed")
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package occtl
+
+// socketWritable is not checked on non-Unix systems: auto mode runs occtl through sudo
+func socketWritable(path string) bool {
+	return false
+}
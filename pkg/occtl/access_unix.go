@@ -0,0 +1,13 @@
+//go:build unix
+
+package occtl
+
+import "syscall"
+
+// accessWrite is W_OK of access(2), not exported by syscall on all platforms
+const accessWrite = 0x2
+
+// socketWritable reports whether the exporter may write to the socket at path
+func socketWritable(path string) bool {
+	return syscall.Access(path, accessWrite) == nil
+}
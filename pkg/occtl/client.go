@@ -0,0 +1,917 @@
+// Package occtl runs ocserv's occtl control tool, locally, through sudo, a wrapper command or
+// ssh, and parses its output. It is used by the exporter and may be imported by other tools;
+// exported identifiers are kept compatible within a major version.
+package occtl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mogilevich/ocserv_exporter/pkg/parser"
+)
+
+// ServerStatus contains parsed data from "occtl show status"
+type ServerStatus struct {
+	ActiveSessions    int
+	TotalSessions     int
+	AuthFailures      int
+	RxBytes           int64
+	TxBytes           int64
+	LatencyMedianMs   float64
+	LatencyStdevMs    float64
+	AvgSessionTimeSec float64
+	MaxSessionTimeSec float64
+	UptimeSeconds     float64
+}
+
+// Version contains parsed data from "ocserv -v"
+type Version struct {
+	Version      string
+	CompiledWith []string // features listed in "Compiled with:", sorted
+}
+
+// Session contains parsed data from "occtl show sessions all"
+type Session struct {
+	SessionID  string
+	Username   string
+	VHost      string
+	ClientIP   string
+	UserAgent  string
+	CreatedAgo time.Duration
+	Status     string
+}
+
+// IPBan contains parsed data from "occtl --json show ip bans"
+type IPBan struct {
+	IP    string
+	Score int
+}
+
+// User contains parsed data from "occtl show users"
+type User struct {
+	ID         int
+	Username   string
+	VHost      string
+	ClientIP   string
+	VpnIP      string
+	Device     string
+	Since      time.Duration
+	DTLSCipher string
+	Status     string
+	Group      string // only populated from JSON output (GetUsersJSON)
+	UserAgent  string // only populated from JSON output (GetUsersJSON)
+	RxBytes    int64  // only populated from JSON output (GetUsersJSON)
+	TxBytes    int64  // only populated from JSON output (GetUsersJSON)
+}
+
+// Exec modes of occtl (see ExecCommand)
+const (
+	ExecAuto   = "auto"   // directly when the socket is writable, through sudo otherwise
+	ExecDirect = "direct" // directly, relying on socket group permissions
+	ExecSudo   = "sudo"   // through sudo -n
+)
+
+// DefaultSocketPath is the socket occtl connects to without -s
+const DefaultSocketPath = "/var/run/occtl.socket"
+
+// SSHScheme prefixes the socket of a server polled on a remote host (see NewRemoteClient)
+const SSHScheme = "ssh://"
+
+// Client provides interface to occtl command
+type Client struct {
+	socketPath string
+	serverName string
+	command    []string
+	ssh        []string // ssh command prefix for a remote server, nil for a local one
+	mockDir    string   // directory of fixture files replacing command output (see SetMockDir)
+	recordDir  string   // directory the output of commands is recorded to (see SetRecordDir)
+	onRecord   func(error)
+}
+
+// NewClient creates a new occtl client
+// socketPath can be empty to use default socket
+// serverName is used for metrics labeling
+func NewClient(socketPath, serverName string) *Client {
+	return &Client{
+		socketPath: socketPath,
+		serverName: serverName,
+		command:    ExecCommand(ExecSudo, socketPath),
+	}
+}
+
+// NewRemoteClient creates an occtl client running occtl on a remote host over ssh.
+// target is "ssh://[user@]host[:port][/socket/path]"; without a path occtl uses its default
+// socket there. ssh runs non-interactively, so keys and host keys must be set up in advance
+// (e.g. in ~/.ssh/config of the exporter's user).
+func NewRemoteClient(target, serverName string) (*Client, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme+"://" != SSHScheme || u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid ssh target %q, expected 'ssh://[user@]host[:port][/socket/path]'", target)
+	}
+
+	ssh := []string{"ssh", "-o", "BatchMode=yes", "-o", "ConnectTimeout=10"}
+	if u.Port() != "" {
+		ssh = append(ssh, "-p", u.Port())
+	}
+	host := u.Hostname()
+	if u.User != nil {
+		host = u.User.Username() + "@" + host
+	}
+	ssh = append(ssh, host, "--")
+
+	socketPath := ""
+	if u.Path != "" && u.Path != "/" {
+		socketPath = u.Path
+	}
+	return &Client{
+		socketPath: socketPath,
+		serverName: serverName,
+		command:    ExecCommand(ExecSudo, socketPath),
+		ssh:        ssh,
+	}, nil
+}
+
+// ExecCommand returns the command running occtl for a socket in an exec mode. In auto mode
+// occtl is run directly when the exporter may write to the socket (e.g. its user is in the
+// socket's group), and through sudo otherwise.
+func ExecCommand(mode, socketPath string) []string {
+	if socketPath == "" {
+		socketPath = DefaultSocketPath
+	}
+	if mode == ExecDirect || (mode == ExecAuto && socketWritable(socketPath)) {
+		return []string{"occtl"}
+	}
+	return []string{"sudo", "-n", "occtl"}
+}
+
+// SetCommand sets the command occtl is run with, e.g. from ExecCommand or a wrapper like
+// []string{"docker", "exec", "ocserv", "occtl"}. The occtl arguments are appended to it.
+// For a remote server it is the command run on the remote host.
+func (c *Client) SetCommand(command []string) {
+	c.command = command
+}
+
+// SetMockDir makes the client read the output of each command from a fixture file in dir instead
+// of running anything, for development and tests without ocserv. A command's fixture is named
+// after its arguments without dashes, joined by underscores, with .json for JSON output and .txt
+// otherwise: show_status.txt, json_show_users.json, ocserv_v.txt (ocserv -v), ... A fixture in
+// the subdirectory named after the server takes precedence over one in dir. A missing fixture
+// fails the command, as does a file with the fixture's name plus .error, whose content is the
+// error message.
+func (c *Client) SetMockDir(dir string) {
+	c.mockDir = dir
+}
+
+// FixtureName returns the name of the fixture file with the output of a command (see SetMockDir)
+func FixtureName(args ...string) string {
+	parts := make([]string, 0, len(args))
+	ext := ".txt"
+	for _, arg := range args {
+		if arg == "--json" {
+			ext = ".json"
+		}
+		parts = append(parts, strings.TrimLeft(arg, "-"))
+	}
+	return strings.Join(parts, "_") + ext
+}
+
+// readFixture returns the output of a command from its fixture file
+func (c *Client) readFixture(args ...string) (string, error) {
+	name := FixtureName(args...)
+	for _, dir := range []string{filepath.Join(c.mockDir, c.serverName), c.mockDir} {
+		path := filepath.Join(dir, name)
+		if message, err := os.ReadFile(path + ".error"); err == nil {
+			return "", fmt.Errorf("%s: %s", path, strings.TrimSpace(string(message)))
+		}
+		output, err := os.ReadFile(path)
+		if err == nil {
+			return string(output), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("no fixture %s in %s for '%s'", name, c.mockDir, strings.Join(args, " "))
+}
+
+// SetRecordDir makes the client save the raw output of every successful command to
+// dir/<server>/<fixture>, named as by FixtureName and replacing the previous output, so that
+// recordings of real servers can be replayed with SetMockDir or kept as a parser test corpus.
+// onError, if not nil, is called when a recording can't be written; the command still succeeds.
+func (c *Client) SetRecordDir(dir string, onError func(error)) {
+	c.recordDir = dir
+	c.onRecord = onError
+}
+
+// record saves the output of a command if recording is enabled
+func (c *Client) record(output string, args ...string) {
+	if c.recordDir == "" {
+		return
+	}
+	err := writeRecording(filepath.Join(c.recordDir, c.serverName), FixtureName(args...), output)
+	if err != nil && c.onRecord != nil {
+		c.onRecord(err)
+	}
+}
+
+// writeRecording writes a recording through a temporary file, so replays never read a partial one
+func writeRecording(dir, name, output string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, "."+name+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(output); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0o644); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), filepath.Join(dir, name))
+}
+
+// Command returns the command occtl is run with, including ssh for a remote server
+func (c *Client) Command() []string {
+	return append(append([]string{}, c.ssh...), c.command...)
+}
+
+// Remote returns whether occtl runs on a remote host over ssh
+func (c *Client) Remote() bool {
+	return c.ssh != nil
+}
+
+// ServerName returns the server name for this client
+func (c *Client) ServerName() string {
+	return c.serverName
+}
+
+// SocketPath returns the occtl socket of this client, empty for the default socket
+func (c *Client) SocketPath() string {
+	return c.socketPath
+}
+
+// execOcctl runs occtl with given arguments, recording its output
+func (c *Client) execOcctl(args ...string) (string, error) {
+	if c.mockDir != "" {
+		return c.readFixture(args...)
+	}
+	output, err := c.runOcctl(args...)
+	if err != nil {
+		return "", err
+	}
+
+	c.record(output, args...)
+	return output, nil
+}
+
+// runOcctl runs occtl with given arguments
+func (c *Client) runOcctl(args ...string) (string, error) {
+	cmdArgs := args
+	if c.socketPath != "" {
+		cmdArgs = append([]string{"-s", c.socketPath}, args...)
+	}
+
+	command := append(c.Command(), cmdArgs...)
+	cmd := exec.Command(command[0], command[1:]...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		// Include stderr in error message for debugging
+		if stderr.Len() > 0 {
+			return "", fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return "", err
+	}
+
+	return stdout.String(), nil
+}
+
+// DisconnectUser disconnects all sessions of a user with "occtl disconnect user"
+// In mock mode there is no server to act on and nothing is run
+func (c *Client) DisconnectUser(username string) error {
+	if c.mockDir != "" {
+		return nil
+	}
+	_, err := c.runOcctl("disconnect", "user", username)
+	return err
+}
+
+// UnbanIP removes the ban of an IP address with "occtl unban ip"
+// In mock mode there is no server to act on and nothing is run
+func (c *Client) UnbanIP(ip string) error {
+	if c.mockDir != "" {
+		return nil
+	}
+	_, err := c.runOcctl("unban", "ip", ip)
+	return err
+}
+
+// GetStatus returns server status from "occtl show status"
+func (c *Client) GetStatus() (*ServerStatus, error) {
+	output, err := c.execOcctl("show", "status")
+	if err != nil {
+		return nil, err
+	}
+
+	return parseStatus(output)
+}
+
+// GetSessions returns all sessions from "occtl show sessions all"
+func (c *Client) GetSessions() ([]Session, error) {
+	output, err := c.execOcctl("show", "sessions", "all")
+	if err != nil {
+		return nil, err
+	}
+
+	return parseSessions(output)
+}
+
+// GetValidSessions returns the sessions valid for reconnection from "occtl show sessions valid"
+func (c *Client) GetValidSessions() ([]Session, error) {
+	output, err := c.execOcctl("show", "sessions", "valid")
+	if err != nil {
+		return nil, err
+	}
+
+	return parseSessions(output)
+}
+
+// GetIPBans returns the banned IP addresses from "occtl --json show ip bans"
+func (c *Client) GetIPBans() ([]IPBan, error) {
+	output, err := c.execOcctl("--json", "show", "ip", "bans")
+	if err != nil {
+		return nil, err
+	}
+
+	return parseIPBansJSON(output)
+}
+
+// GetUsers returns all users from "occtl show users"
+func (c *Client) GetUsers() ([]User, error) {
+	output, err := c.execOcctl("show", "users")
+	if err != nil {
+		return nil, err
+	}
+
+	return parseUsers(output)
+}
+
+// GetUsersJSON returns all users from "occtl --json show users"
+// The JSON output carries fields missing from the table (group, user agent, per-user traffic)
+func (c *Client) GetUsersJSON() ([]User, error) {
+	output, err := c.execOcctl("--json", "show", "users")
+	if err != nil {
+		return nil, err
+	}
+
+	return parseUsersJSON(output)
+}
+
+// GetVersion returns the version of ocserv from "ocserv -v", run where occtl runs: the occtl
+// command with occtl replaced by ocserv, without sudo (ocserv -v needs no privileges)
+func (c *Client) GetVersion() (*Version, error) {
+	if c.mockDir != "" {
+		output, err := c.readFixture("ocserv", "-v")
+		if err != nil {
+			return nil, err
+		}
+		return parseVersion(output)
+	}
+	command := append([]string{}, c.ssh...)
+	remote := c.command
+	if len(remote) >= 2 && remote[0] == "sudo" && remote[1] == "-n" {
+		remote = remote[2:]
+	}
+	for _, arg := range remote {
+		if arg == "occtl" {
+			arg = "ocserv"
+		}
+		command = append(command, arg)
+	}
+	command = append(command, "-v")
+
+	output, err := exec.Command(command[0], command[1:]...).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
+	}
+	c.record(string(output), "ocserv", "-v")
+	return parseVersion(string(output))
+}
+
+// parseVersion parses output of "ocserv -v"
+func parseVersion(output string) (*Version, error) {
+	version := &Version{}
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if features, ok := strings.CutPrefix(line, "Compiled with:"); ok {
+			for _, feature := range strings.Split(features, ",") {
+				if feature = strings.TrimSpace(feature); feature != "" {
+					version.CompiledWith = append(version.CompiledWith, feature)
+				}
+			}
+			continue
+		}
+		if fields := strings.Fields(line); version.Version == "" && len(fields) == 2 && fields[0] == "ocserv" {
+			version.Version = fields[1]
+		}
+	}
+	if version.Version == "" {
+		return nil, fmt.Errorf("no version in ocserv output")
+	}
+	sort.Strings(version.CompiledWith)
+	return version, nil
+}
+
+// parseStatus parses output of "occtl show status"
+func parseStatus(output string) (*ServerStatus, error) {
+	status := &ServerStatus{}
+
+	patterns := map[string]*regexp.Regexp{
+		"active":     regexp.MustCompile(`Active sessions:\s*(\d+)`),
+		"total":      regexp.MustCompile(`Total sessions:\s*(\d+)`),
+		"authFail":   regexp.MustCompile(`Total authentication failures:\s*(\d+)`),
+		"rx":         regexp.MustCompile(`RX:\s*([\d.]+)\s*(\w+)`),
+		"tx":         regexp.MustCompile(`TX:\s*([\d.]+)\s*(\w+)`),
+		"latencyMed": regexp.MustCompile(`Median latency:\s*<?(\d+)m?s?`),
+		"latencyStd": regexp.MustCompile(`STDEV latency:\s*<?(\d+)m?s?`),
+		"avgSession": regexp.MustCompile(`Average session time:\s*(.+)`),
+		"maxSession": regexp.MustCompile(`Max session time:\s*(.+)`),
+		"uptime":     regexp.MustCompile(`Up since:.+\(\s*(.+?)\s*\)`),
+	}
+
+	lines := strings.Split(output, "\n")
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+
+		if m := patterns["active"].FindStringSubmatch(line); m != nil {
+			status.ActiveSessions, _ = strconv.Atoi(m[1])
+		}
+		if m := patterns["total"].FindStringSubmatch(line); m != nil {
+			status.TotalSessions, _ = strconv.Atoi(m[1])
+		}
+		if m := patterns["authFail"].FindStringSubmatch(line); m != nil {
+			status.AuthFailures, _ = strconv.Atoi(m[1])
+		}
+		if m := patterns["rx"].FindStringSubmatch(line); m != nil {
+			status.RxBytes = parseBytes(m[1], m[2])
+		}
+		if m := patterns["tx"].FindStringSubmatch(line); m != nil {
+			status.TxBytes = parseBytes(m[1], m[2])
+		}
+		if m := patterns["latencyMed"].FindStringSubmatch(line); m != nil {
+			val, _ := strconv.ParseFloat(m[1], 64)
+			status.LatencyMedianMs = val
+		}
+		if m := patterns["latencyStd"].FindStringSubmatch(line); m != nil {
+			val, _ := strconv.ParseFloat(m[1], 64)
+			status.LatencyStdevMs = val
+		}
+		if m := patterns["avgSession"].FindStringSubmatch(line); m != nil {
+			status.AvgSessionTimeSec = parseDuration(m[1])
+		}
+		if m := patterns["maxSession"].FindStringSubmatch(line); m != nil {
+			status.MaxSessionTimeSec = parseDuration(m[1])
+		}
+		if m := patterns["uptime"].FindStringSubmatch(line); m != nil {
+			status.UptimeSeconds = parseDuration(m[1])
+		}
+	}
+
+	return status, nil
+}
+
+// Session statuses shown by occtl
+const (
+	SessionConnected      = "connected"      // authenticated and in use by a connection
+	SessionAuthenticated  = "authenticated"  // authenticated, no connection uses it
+	SessionAuthenticating = "authenticating" // authentication in progress
+	SessionPreAuth        = "pre-auth"       // created, authentication not started
+	SessionFailed         = "failed"         // authentication failed
+	// SessionDisconnected is an authenticated session valid for reconnection ("show sessions valid")
+	SessionDisconnected = "disconnected"
+)
+
+// sessionStatuses are the statuses parseSessions recognizes in the last column of a session line
+var sessionStatuses = []string{SessionConnected, SessionAuthenticated, SessionAuthenticating, SessionPreAuth, SessionFailed}
+
+// parseSessions parses output of "occtl show sessions all"
+func parseSessions(output string) ([]Session, error) {
+	var sessions []Session
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+
+	// Skip header line
+	headerSkipped := false
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// Skip header
+		if strings.HasPrefix(strings.TrimSpace(line), "session") {
+			headerSkipped = true
+			continue
+		}
+		if !headerSkipped {
+			continue
+		}
+
+		// Parse session line
+		// Format: session     user    vhost             ip               user agent  created   status
+		fields := strings.Fields(line)
+		if len(fields) < 7 {
+			continue
+		}
+
+		session := Session{
+			SessionID: fields[0],
+			Username:  fields[1],
+			VHost:     fields[2],
+			ClientIP:  fields[3],
+		}
+
+		// User agent can contain spaces, so we need to find "created" time pattern
+		// Time patterns: 1m:42s, 3h:54m, 58s, etc.
+		timePattern := regexp.MustCompile(`\d+[hms](?::\d+[ms])?`)
+
+		// Find the time field from the end
+		restOfLine := strings.Join(fields[4:], " ")
+
+		// Status is the last column
+		statusIdx := -1
+		for _, status := range sessionStatuses {
+			if strings.HasSuffix(restOfLine, " "+status) {
+				statusIdx = len(restOfLine) - len(status)
+				break
+			}
+		}
+
+		if statusIdx > 0 {
+			beforeStatus := strings.TrimSpace(restOfLine[:statusIdx])
+			session.Status = strings.TrimSpace(restOfLine[statusIdx:])
+
+			// Find time in beforeStatus
+			timeLocs := timePattern.FindAllStringIndex(beforeStatus, -1)
+			if len(timeLocs) > 0 {
+				lastTimeLoc := timeLocs[len(timeLocs)-1]
+				timeStr := beforeStatus[lastTimeLoc[0]:lastTimeLoc[1]]
+				session.CreatedAgo = time.Duration(parseDuration(timeStr)) * time.Second
+				session.UserAgent = strings.TrimSpace(beforeStatus[:lastTimeLoc[0]])
+			} else {
+				session.UserAgent = beforeStatus
+			}
+		}
+
+		if session.Username != "" {
+			sessions = append(sessions, session)
+		}
+	}
+
+	return sessions, nil
+}
+
+// parseUsers parses output of "occtl show users"
+// Format:       id     user    vhost             ip         vpn-ip device   since    dtls-cipher    status
+//
+//	3800826 a.zakiev  default   172.30.30.30    10.88.18.67 ocserv-ru3    35s      (no-dtls) connected
+func parseUsers(output string) ([]User, error) {
+	var users []User
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+
+	// Skip header line
+	headerSkipped := false
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// Skip header (starts with "id")
+		if strings.Contains(line, "id") && strings.Contains(line, "user") && strings.Contains(line, "vpn-ip") {
+			headerSkipped = true
+			continue
+		}
+		if !headerSkipped {
+			continue
+		}
+
+		// Parse user line
+		fields := strings.Fields(line)
+		if len(fields) < 9 {
+			continue
+		}
+
+		id, _ := strconv.Atoi(fields[0])
+		user := User{
+			ID:       id,
+			Username: fields[1],
+			VHost:    fields[2],
+			ClientIP: fields[3],
+			VpnIP:    fields[4],
+			Device:   fields[5],
+			Since:    time.Duration(parseDuration(fields[6])) * time.Second,
+			Status:   fields[len(fields)-1], // last field is status
+		}
+
+		// DTLS cipher is second to last (may contain parentheses)
+		if len(fields) >= 9 {
+			user.DTLSCipher = fields[len(fields)-2]
+		}
+
+		if user.Username != "" {
+			users = append(users, user)
+		}
+	}
+
+	return users, nil
+}
+
+// jsonIPBan is an entry of "occtl --json show ip bans"
+type jsonIPBan struct {
+	IP    string `json:"IP"`
+	Score int    `json:"Score"`
+}
+
+// parseIPBansJSON parses output of "occtl --json show ip bans"
+func parseIPBansJSON(output string) ([]IPBan, error) {
+	if strings.TrimSpace(output) == "" {
+		return nil, nil // no bans
+	}
+	var entries []jsonIPBan
+	if err := json.Unmarshal([]byte(output), &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse occtl JSON output: %w", err)
+	}
+
+	bans := make([]IPBan, 0, len(entries))
+	for _, e := range entries {
+		if e.IP != "" {
+			bans = append(bans, IPBan{IP: e.IP, Score: e.Score})
+		}
+	}
+	return bans, nil
+}
+
+// jsonUser is an entry of "occtl --json show users"
+type jsonUser struct {
+	ID          int    `json:"ID"`
+	Username    string `json:"Username"`
+	Groupname   string `json:"Groupname"`
+	State       string `json:"State"`
+	VHost       string `json:"vhost"`
+	Device      string `json:"Device"`
+	RemoteIP    string `json:"Remote IP"`
+	IPv4        string `json:"IPv4"`
+	UserAgent   string `json:"User-Agent"`
+	RX          string `json:"RX"`
+	TX          string `json:"TX"`
+	DTLSCipher  string `json:"DTLS cipher"`
+	ConnectedAt int64  `json:"raw_connected_at"`
+}
+
+// parseUsersJSON parses output of "occtl --json show users"
+func parseUsersJSON(output string) ([]User, error) {
+	var entries []jsonUser
+	if err := json.Unmarshal([]byte(output), &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse occtl JSON output: %w", err)
+	}
+
+	users := make([]User, 0, len(entries))
+	for _, e := range entries {
+		if e.Username == "" {
+			continue
+		}
+		user := User{
+			ID:         e.ID,
+			Username:   e.Username,
+			Group:      e.Groupname,
+			VHost:      e.VHost,
+			ClientIP:   e.RemoteIP,
+			VpnIP:      e.IPv4,
+			Device:     e.Device,
+			DTLSCipher: e.DTLSCipher,
+			Status:     e.State,
+			UserAgent:  e.UserAgent,
+		}
+		user.RxBytes, _ = strconv.ParseInt(e.RX, 10, 64)
+		user.TxBytes, _ = strconv.ParseInt(e.TX, 10, 64)
+		if e.ConnectedAt > 0 {
+			user.Since = time.Since(time.Unix(e.ConnectedAt, 0)).Truncate(time.Second)
+		}
+		users = append(users, user)
+	}
+
+	return users, nil
+}
+
+// parseBytes converts value and unit (KB, MB, GB) to bytes
+func parseBytes(valueStr, unit string) int64 {
+	value, _ := strconv.ParseFloat(valueStr, 64)
+
+	switch strings.ToUpper(unit) {
+	case "KB":
+		return int64(value * 1024)
+	case "MB":
+		return int64(value * 1024 * 1024)
+	case "GB":
+		return int64(value * 1024 * 1024 * 1024)
+	case "TB":
+		return int64(value * 1024 * 1024 * 1024 * 1024)
+	default:
+		return int64(value)
+	}
+}
+
+// parseDuration parses time strings like "3h:54m", "18m:00s", "58s"
+func parseDuration(s string) float64 {
+	s = strings.TrimSpace(s)
+
+	var totalSeconds float64
+
+	// Handle "3h:54m" format
+	if strings.Contains(s, "h") {
+		parts := strings.Split(s, "h")
+		hours, _ := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+		totalSeconds += hours * 3600
+		if len(parts) > 1 {
+			s = strings.TrimPrefix(parts[1], ":")
+		} else {
+			return totalSeconds
+		}
+	}
+
+	// Handle minutes
+	if strings.Contains(s, "m") {
+		parts := strings.Split(s, "m")
+		minutes, _ := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+		totalSeconds += minutes * 60
+		if len(parts) > 1 {
+			s = strings.TrimPrefix(parts[1], ":")
+		} else {
+			return totalSeconds
+		}
+	}
+
+	// Handle seconds
+	if strings.Contains(s, "s") {
+		secStr := strings.TrimSuffix(s, "s")
+		seconds, _ := strconv.ParseFloat(strings.TrimSpace(secStr), 64)
+		totalSeconds += seconds
+	}
+
+	return totalSeconds
+}
+
+// GetUserAgentStats returns aggregated user agent statistics
+func (c *Client) GetUserAgentStats() (map[string]int, error) {
+	sessions, err := c.GetSessions()
+	if err != nil {
+		return nil, err
+	}
+	return UserAgentStats(sessions), nil
+}
+
+// GetSessionStates returns the number of sessions per status (see SessionStates)
+func (c *Client) GetSessionStates() (map[string]int, error) {
+	sessions, err := c.GetSessions()
+	if err != nil {
+		return nil, err
+	}
+	valid, err := c.GetValidSessions()
+	if err != nil {
+		return nil, err
+	}
+	return SessionStates(sessions, valid), nil
+}
+
+// GetUserSessionCounts returns number of concurrent sessions per username
+func (c *Client) GetUserSessionCounts() (map[string]int, error) {
+	sessions, err := c.GetSessions()
+	if err != nil {
+		return nil, err
+	}
+	return UserSessionCounts(sessions), nil
+}
+
+// GetUserClientTypes returns client type per username
+func (c *Client) GetUserClientTypes() (map[string]string, error) {
+	sessions, err := c.GetSessions()
+	if err != nil {
+		return nil, err
+	}
+	return UserClientTypes(sessions), nil
+}
+
+// GetUserGroups returns group name per username (from JSON output)
+func (c *Client) GetUserGroups() (map[string]string, error) {
+	users, err := c.GetUsersJSON()
+	if err != nil {
+		return nil, err
+	}
+	return UserGroups(users), nil
+}
+
+// UserAgentStats returns the number of sessions per client type
+func UserAgentStats(sessions []Session) map[string]int {
+	stats := make(map[string]int)
+	for _, s := range sessions {
+		clientType := parser.ClassifyUserAgent(s.UserAgent)
+		stats[clientType]++
+	}
+	return stats
+}
+
+// SessionStates returns the number of sessions per status. Authenticated sessions valid for
+// reconnection ("show sessions valid"), i.e. cookies of clients that disconnected and may
+// resume, are counted as SessionDisconnected.
+func SessionStates(sessions, validSessions []Session) map[string]int {
+	valid := make(map[string]bool, len(validSessions))
+	for _, s := range validSessions {
+		valid[s.SessionID] = true
+	}
+
+	states := make(map[string]int)
+	for _, s := range sessions {
+		state := s.Status
+		if state == "" {
+			state = "unknown"
+		}
+		if state == SessionAuthenticated && valid[s.SessionID] {
+			state = SessionDisconnected
+		}
+		states[state]++
+	}
+	return states
+}
+
+// UserSessionCounts returns the number of concurrent sessions per username
+func UserSessionCounts(sessions []Session) map[string]int {
+	counts := make(map[string]int)
+	for _, s := range sessions {
+		counts[s.Username]++
+	}
+	return counts
+}
+
+// UserClientTypes returns the client type per username
+func UserClientTypes(sessions []Session) map[string]string {
+	types := make(map[string]string)
+	for _, s := range sessions {
+		types[s.Username] = parser.ClassifyUserAgent(s.UserAgent)
+	}
+	return types
+}
+
+// UserGroups returns the group name per username of users from GetUsersJSON
+func UserGroups(users []User) map[string]string {
+	groups := make(map[string]string)
+	for _, u := range users {
+		if u.Group != "" {
+			groups[u.Username] = u.Group
+		}
+	}
+	return groups
+}
+
+// NoDTLSCipher is the cipher label of sessions without a DTLS channel (TLS only)
+const NoDTLSCipher = "none"
+
+// DTLSCipherStats returns number of users per DTLS cipher.
+// Users shown as "(no-dtls)" are counted under NoDTLSCipher.
+func DTLSCipherStats(users []User) map[string]int {
+	stats := make(map[string]int)
+	for _, u := range users {
+		stats[normalizeDTLSCipher(u.DTLSCipher)]++
+	}
+	return stats
+}
+
+// normalizeDTLSCipher maps occtl's dtls-cipher column to a label value
+func normalizeDTLSCipher(cipher string) string {
+	cipher = strings.TrimSpace(cipher)
+	if cipher == "" || strings.Contains(strings.ToLower(cipher), "no-dtls") {
+		return NoDTLSCipher
+	}
+	return cipher
+}
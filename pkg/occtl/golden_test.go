@@ -0,0 +1,96 @@
+package occtl
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the .golden files of the recorded occtl outputs")
+
+// goldenParsers parse a recorded output by its fixture name (see FixtureName)
+var goldenParsers = map[string]func(string) (any, error){
+	"show_status.txt":         func(s string) (any, error) { return parseStatus(s) },
+	"show_sessions_all.txt":   func(s string) (any, error) { return parseSessions(s) },
+	"show_sessions_valid.txt": func(s string) (any, error) { return parseSessions(s) },
+	"show_users.txt":          func(s string) (any, error) { return parseUsers(s) },
+	"json_show_ip_bans.json":  func(s string) (any, error) { return parseIPBansJSON(s) },
+	"ocserv_v.txt":            func(s string) (any, error) { return parseVersion(s) },
+	"json_show_users.json": func(s string) (any, error) {
+		users, err := parseUsersJSON(s)
+		for i := range users {
+			users[i].Since = 0 // relative to the time of the test
+		}
+		return users, err
+	},
+}
+
+// TestGolden parses the outputs recorded with --occtl.record-dir in testdata/<corpus>/ and
+// compares the results with the .golden files next to them. After adding a corpus, e.g. the
+// recordings of a new ocserv version, or changing a parser, check the diff of
+// go test ./pkg/occtl -run Golden -update.
+func TestGolden(t *testing.T) {
+	corpora, err := filepath.Glob("testdata/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(corpora) == 0 {
+		t.Fatal("no corpus in testdata")
+	}
+	for _, corpus := range corpora {
+		t.Run(filepath.Base(corpus), func(t *testing.T) {
+			entries, err := os.ReadDir(corpus)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, entry := range entries {
+				name := entry.Name()
+				if entry.IsDir() || strings.HasSuffix(name, ".golden") || strings.HasSuffix(name, ".error") || strings.HasPrefix(name, ".") {
+					continue
+				}
+				parse, ok := goldenParsers[name]
+				if !ok {
+					t.Errorf("%s: no parser for this recording", name)
+					continue
+				}
+				t.Run(name, func(t *testing.T) {
+					testGolden(t, filepath.Join(corpus, name), parse)
+				})
+			}
+		})
+	}
+}
+
+func testGolden(t *testing.T, path string, parse func(string) (any, error)) {
+	output, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []byte
+	result, err := parse(string(output))
+	if err != nil {
+		got = []byte("error: " + err.Error() + "\n")
+	} else if got, err = json.MarshalIndent(result, "", "  "); err != nil {
+		t.Fatal(err)
+	} else {
+		got = append(got, '\n')
+	}
+
+	golden := path + ".golden"
+	if *update {
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("%v (run with -update to create it)", err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("parsed output differs from %s (run with -update to accept it)\ngot:\n%s\nwant:\n%s", golden, got, want)
+	}
+}
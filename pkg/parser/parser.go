@@ -0,0 +1,697 @@
+// Package parser turns ocserv log lines (main, worker and sec-mod messages, as logged to the
+// journal or syslog) into typed events. It is used by the exporter and may be imported by other
+// tools; exported identifiers are kept compatible within a major version.
+package parser
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EventType represents the type of ocserv log event
+type EventType int
+
+const (
+	EventUnknown EventType = iota
+	EventUserLogin
+	EventUserDisconnect
+	EventSessionStart
+	EventSessionInvalidate
+	EventVPNIPAssigned
+	EventAuthFailed
+	EventByePacket          // worker received BYE packet from client
+	EventDPDWarning         // worker DPD timeout warning
+	EventSecModClose        // sec-mod temporarily closing session (mobile sleep)
+	EventAuthFailureReason  // auth backend / certificate line explaining why authentication failed
+	EventAuthInit           // sec-mod started authenticating a user
+	EventAuthSuccess        // auth backend accepted a user
+	EventAuthBackendError   // auth backend (radius/pam) error not tied to a specific user
+	EventCertAuth           // worker accepted a client certificate
+	EventUserGroup          // line associating a user with an ocserv group
+	EventConnectionRejected // connection refused before authentication (limits, bans)
+	EventMTU                // worker configured or adjusted the link MTU
+	EventRekey              // worker rekeyed the CSTP (TLS) or DTLS channel
+	EventServerStart        // ocserv main process started
+	EventServerStop         // ocserv main process shutting down
+	EventServerReload       // ocserv reloading its configuration (SIGHUP)
+	EventCustom             // line matched by a user-defined pattern without event type
+	EventClientInfo         // worker logged the client's user agent or hostname during the handshake
+)
+
+// String returns the event type name used in exported events (e.g. "login", "auth_failure")
+func (t EventType) String() string {
+	switch t {
+	case EventUserLogin:
+		return "login"
+	case EventUserDisconnect:
+		return "disconnect"
+	case EventSessionStart:
+		return "session_start"
+	case EventSessionInvalidate:
+		return "session_invalidate"
+	case EventVPNIPAssigned:
+		return "vpn_ip_assigned"
+	case EventAuthFailed:
+		return "auth_failure"
+	case EventByePacket:
+		return "bye_packet"
+	case EventDPDWarning:
+		return "dpd_warning"
+	case EventSecModClose:
+		return "sec_mod_close"
+	case EventAuthFailureReason:
+		return "auth_failure_reason"
+	case EventAuthInit:
+		return "auth_init"
+	case EventAuthSuccess:
+		return "auth_success"
+	case EventAuthBackendError:
+		return "auth_backend_error"
+	case EventCertAuth:
+		return "cert_auth"
+	case EventUserGroup:
+		return "user_group"
+	case EventConnectionRejected:
+		return "connection_rejected"
+	case EventMTU:
+		return "mtu"
+	case EventRekey:
+		return "rekey"
+	case EventServerStart:
+		return "server_start"
+	case EventServerStop:
+		return "server_stop"
+	case EventServerReload:
+		return "server_reload"
+	case EventCustom:
+		return "custom"
+	case EventClientInfo:
+		return "client_info"
+	}
+	return "unknown"
+}
+
+// Authentication failure reasons (Event.Reason for EventAuthFailed and EventAuthFailureReason)
+const (
+	AuthReasonUnknown        = "unknown"
+	AuthReasonUnknownUser    = "unknown user"
+	AuthReasonWrongPassword  = "wrong password"
+	AuthReasonSecondFactor   = "wrong second factor"
+	AuthReasonExpiredAccount = "expired account"
+	AuthReasonLockedAccount  = "locked account"
+	AuthReasonCertificate    = "certificate rejected"
+	AuthReasonRadiusTimeout  = "radius timeout"
+	AuthReasonBackendTimeout = "backend timeout" // a timeout of another auth module (pam, gssapi, ...)
+	AuthReasonInvalidCookie  = "invalid cookie"
+	AuthReasonInvalidToken   = "invalid token"
+)
+
+// Rejected connection reasons (Event.Reason for EventConnectionRejected)
+const (
+	RejectReasonMaxClients      = "max clients"
+	RejectReasonMaxSameClients  = "max same clients"
+	RejectReasonBanned          = "banned"
+	RejectReasonTLSAuthRequired = "tls auth required"
+)
+
+// Event represents a parsed ocserv log event
+type Event struct {
+	Type       EventType
+	Timestamp  time.Time
+	Server     string // VPN server name (e.g., "ocserv", "ocserv-ru")
+	Username   string
+	ClientIP   string
+	Port       int
+	VpnIP      string
+	SessionID  string
+	Reason     string
+	Group      string // ocserv group name, when the line mentions "group 'x'"
+	VHost      string // virtual host name, when the line carries a "vhost:name:" prefix
+	RxBytes    uint64
+	TxBytes    uint64
+	Raw        string
+	DPDSeconds int    // seconds since last DPD (for EventDPDWarning)
+	MTU        int    // link MTU (for EventMTU)
+	Channel    string // rekeyed channel: cstp or dtls (for EventRekey)
+	UserAgent  string // client user agent (for EventClientInfo)
+	Hostname   string // client hostname from X-CSTP-Hostname (for EventClientInfo)
+
+	AuthBackend string // auth module that logged the line: plain, pam, radius, gssapi, oidc (may be empty)
+
+	CertCN     string // client certificate common name (for EventCertAuth)
+	CertSerial string // client certificate serial number (for EventCertAuth, may be empty)
+	CertError  string // certificate failure class: expired, untrusted, revoked, missing, failed
+
+	TokenError string // OIDC token failure class: expired, issuer_mismatch, audience_mismatch, invalid_signature, malformed, invalid
+
+	Pattern string // name of the user-defined pattern that matched the line (may be empty)
+}
+
+// Parser parses ocserv log lines
+// Login, disconnect, VPN IP and failed authentication lines - the bulk of the
+// recognized lines - are matched by hand-written scanners (scan.go); the other
+// patterns are regular expressions that only run when a keyword they require
+// is present, so most unrelated lines never reach the regexp engine.
+type Parser struct {
+	reSessionStart      *regexp.Regexp
+	reSessionInvalidate *regexp.Regexp
+	reCookieAuthFailed  *regexp.Regexp
+	reByePacket         *regexp.Regexp
+	reDPDWarning        *regexp.Regexp
+	reSecModClose       *regexp.Regexp
+	reMTU               *regexp.Regexp
+	reRekey             *regexp.Regexp
+	reClientInfo        *regexp.Regexp
+	reServerStart       *regexp.Regexp
+	reServerStop        *regexp.Regexp
+	reServerReload      *regexp.Regexp
+	reAuthBackend       *regexp.Regexp
+	reCertFailure       *regexp.Regexp
+	reQuotedUser        *regexp.Regexp
+	reCertSuccess       *regexp.Regexp
+	reCertCN            *regexp.Regexp
+	reGroup             *regexp.Regexp
+	reUserGroup         *regexp.Regexp
+	reAuthInit          *regexp.Regexp
+	reAuthSuccess       *regexp.Regexp
+	reVHost             *regexp.Regexp
+
+	patterns []*Pattern // user-defined patterns, tried after the built-in ones
+}
+
+// New creates a new Parser
+func New() *Parser {
+	return &Parser{
+		// sec-mod: initiating session for user 'a.mogilevich' (session: yKsy7b)
+		reSessionStart: regexp.MustCompile(`sec-mod: initiating session for user '([^']+)'(?: of group '[^']*')? \(session: ([^)]+)\)`),
+
+		// sec-mod: invalidating session of user 'a.mogilevich' (session: yKsy7b)
+		reSessionInvalidate: regexp.MustCompile(`sec-mod: invalidating session of user '([^']+)' \(session: ([^)]+)\)`),
+
+		// worker: 172.30.30.30 failed cookie authentication attempt
+		reCookieAuthFailed: regexp.MustCompile(`worker(?:\[([^\]]*)\])?: ([^ ]+) failed cookie authentication attempt`),
+
+		// worker[username]: 172.30.30.30 received BYE packet; exiting
+		reByePacket: regexp.MustCompile(`worker\[([^\]]+)\]: ([^ ]+) received BYE packet`),
+
+		// worker[username]: 172.30.30.30 have not received TCP DPD for long (137 secs)
+		reDPDWarning: regexp.MustCompile(`worker\[([^\]]+)\]: ([^ ]+) have not received TCP DPD for long \((\d+) secs\)`),
+
+		// sec-mod: temporarily closing session for a.mogilevich (session: u7N/JC)
+		reSecModClose: regexp.MustCompile(`sec-mod: temporarily closing session for ([^ ]+) \(session: ([^)]+)\)`),
+
+		// worker[bob]: 172.30.30.30 configured link MTU is 1420
+		// worker[bob]: 172.30.30.30 setting data MTU to 1380
+		reMTU: regexp.MustCompile(`worker(?:\[([^\]]*)\])?: ([^ ]+) .*?\bMTU\b.*? (?:is|to) (\d+)`),
+
+		// worker[bob]: 172.30.30.30 DTLS: rekeying
+		// worker[bob]: 172.30.30.30 TLS rekey (re-handshake) completed
+		reRekey: regexp.MustCompile(`worker(?:\[([^\]]*)\])?: ([^ ]+) (.*(?i:rekey).*)$`),
+
+		// worker: 172.30.30.30 User-agent: 'Open AnyConnect VPN Agent v9.12'
+		// worker: 172.30.30.30 HTTP processing: X-CSTP-Hostname: laptop-42
+		reClientInfo: regexp.MustCompile(`worker(?:\[([^\]]*)\])?: ([^ ]+) (?:HTTP processing: )?(User-[Aa]gent|(?:X-CSTP-)?Hostname): '?(.*?)'?$`),
+
+		// main: initialized ocserv 1.2.4
+		reServerStart: regexp.MustCompile(`^main: initialized ocserv`),
+
+		// main: termination request received; waiting for sessions to die
+		reServerStop: regexp.MustCompile(`^main: termination request received`),
+
+		// main: reloading configuration
+		reServerReload: regexp.MustCompile(`^main: reloading configuration`),
+
+		// sec-mod: plain-auth: user 'bob' not found in password file
+		// sec-mod: pam-auth: error authenticating user 'bob': Authentication failure
+		// sec-mod: radius-auth: error authenticating user 'bob' (timeout)
+		reAuthBackend: regexp.MustCompile(`^sec-mod: (plain|pam|radius|gssapi|oidc)(?:-auth)?: (.+)$`),
+
+		// worker: 172.30.30.30 failed to verify client certificate: certificate has expired
+		// worker[bob]: 172.30.30.30 certificate is not trusted
+		reCertFailure: regexp.MustCompile(`worker(?:\[([^\]]*)\])?: ([^ ]+) (.*(?:certificate|cert ).*)$`),
+
+		reQuotedUser: regexp.MustCompile(`user '([^']*)'`),
+
+		// worker: 172.30.30.30 received client certificate with CN 'bob' (serial: 4A:1F:02)
+		// worker: 172.30.30.30 found client certificate CN 'bob'
+		reCertSuccess: regexp.MustCompile(`worker(?:\[([^\]]*)\])?: ([^ ]+) (?:received|found|using|verified) client certificate (?:with )?CN '([^']*)'(?:.*serial:? ([0-9A-Fa-f:]+))?`),
+
+		reCertCN: regexp.MustCompile(`CN '([^']*)'`),
+
+		// sec-mod: initiating session for user 'bob' of group 'employees' (session: yKsy7b)
+		reGroup: regexp.MustCompile(`group '([^']*)'`),
+
+		// sec-mod: user 'bob' of group 'employees' authenticated
+		// main[bob]:172.30.30.30:56078 user of group 'employees' ...
+		reUserGroup: regexp.MustCompile(`(?:user '([^']*)'|main\[([^\]]+)\]:\S+) (?:user )?of group '([^']*)'`),
+
+		// sec-mod: auth init for user 'bob' (session: yKsy7b) from 172.30.30.30
+		reAuthInit: regexp.MustCompile(`sec-mod: auth init for user '([^']*)'(?: \(session: ([^)]+)\))?(?: from ([^ ]+))?`),
+
+		// sec-mod: radius-auth: user 'bob' authenticated
+		// sec-mod: user 'bob' (session: yKsy7b) authenticated
+		reAuthSuccess: regexp.MustCompile(`user '([^']*)'(?: \(session: ([^)]+)\))? (?:successfully )?authenticated`),
+
+		// main[bob]:172.30.30.30:56078 vhost:vpn.example.com: user logged in
+		// sec-mod: vhost:vpn.example.com: initiating session for user 'bob' (session: yKsy7b)
+		reVHost: regexp.MustCompile(`(?:^|[\s:\]])(vhost:([^\s:]+): )`),
+	}
+}
+
+// SetPatterns sets the user-defined patterns tried on lines no built-in pattern matches
+func (p *Parser) SetPatterns(patterns []*Pattern) {
+	p.patterns = patterns
+}
+
+// Parse parses a log line and returns an Event
+func (p *Parser) Parse(ts time.Time, message string, server string) *Event {
+	// On multi-vhost setups ocserv inserts "vhost:name: " into the line; strip it
+	// so the patterns below match regardless of vhost
+	raw, vhost := message, ""
+	if strings.Contains(message, "vhost:") {
+		if loc := p.reVHost.FindStringSubmatchIndex(message); loc != nil {
+			vhost = message[loc[4]:loc[5]]
+			message = message[:loc[2]] + message[loc[3]:]
+		}
+	}
+
+	event := p.parse(ts, message, server)
+	event.Raw = raw
+	event.VHost = vhost
+
+	// Group name may appear on several kinds of lines
+	if strings.Contains(message, "group '") {
+		if event.Type == EventUnknown {
+			if matches := p.reUserGroup.FindStringSubmatch(message); matches != nil {
+				event.Type = EventUserGroup
+				event.Username = matches[1]
+				if event.Username == "" {
+					event.Username = matches[2]
+				}
+			}
+		}
+		if matches := p.reGroup.FindStringSubmatch(message); matches != nil {
+			event.Group = matches[1]
+		}
+	}
+
+	return event
+}
+
+func (p *Parser) parse(ts time.Time, message string, server string) *Event {
+	event := &Event{
+		Type:      EventUnknown,
+		Timestamp: ts,
+		Server:    server,
+		Raw:       message,
+	}
+
+	// Try login pattern
+	// main[a.mogilevich]:62.4.32.53:30595 user logged in
+	if scanLogin(message, event) {
+		event.Type = EventUserLogin
+		return event
+	}
+
+	// Try disconnect pattern
+	// main[a.mogilevich]:62.4.32.53:30595 user disconnected (reason: user disconnected, rx: 13295, tx: 24650)
+	if scanDisconnect(message, event) {
+		event.Type = EventUserDisconnect
+		return event
+	}
+
+	// Try session start pattern
+	if matches := find(p.reSessionStart, message, "initiating session"); matches != nil {
+		event.Type = EventSessionStart
+		event.Username = matches[1]
+		event.SessionID = matches[2]
+		return event
+	}
+
+	// Try session invalidate pattern
+	if matches := find(p.reSessionInvalidate, message, "invalidating session"); matches != nil {
+		event.Type = EventSessionInvalidate
+		event.Username = matches[1]
+		event.SessionID = matches[2]
+		return event
+	}
+
+	// Try VPN IP pattern
+	// worker[a.mogilevich]: 62.4.32.53 sending IPv4 10.88.9.156
+	if scanVPNIP(message, event) {
+		event.Type = EventVPNIPAssigned
+		return event
+	}
+
+	// Try auth failed pattern
+	// main:172.30.30.30:56078 failed authentication attempt for user ''
+	// main[username]:ip:port failed authentication attempt for user 'username'
+	if scanAuthFailed(message, event) {
+		event.Type = EventAuthFailed
+		return event
+	}
+
+	// Try client user agent / hostname pattern
+	if matches := find(p.reClientInfo, message, "User-agent:", "User-Agent:", "Hostname:"); matches != nil {
+		event.Type = EventClientInfo
+		event.Username = matches[1] // empty before authentication
+		event.ClientIP = matches[2]
+		if strings.HasSuffix(matches[3], "Hostname") {
+			event.Hostname = matches[4]
+		} else {
+			event.UserAgent = matches[4]
+		}
+		return event
+	}
+
+	// Try cookie auth failed pattern
+	if matches := find(p.reCookieAuthFailed, message, "failed cookie authentication"); matches != nil {
+		event.Type = EventAuthFailed
+		event.Username = matches[1] // may be empty
+		event.ClientIP = matches[2]
+		event.Reason = AuthReasonInvalidCookie
+		return event
+	}
+
+	// Try auth init pattern (start of backend authentication)
+	if matches := find(p.reAuthInit, message, "auth init for user"); matches != nil {
+		event.Type = EventAuthInit
+		event.Username = matches[1]
+		event.SessionID = matches[2]
+		event.ClientIP = matches[3]
+		return event
+	}
+
+	// Try auth backend patterns (failure reason, backend error, success)
+	if matches := find(p.reAuthBackend, message, "plain", "pam", "radius", "gssapi", "oidc"); matches != nil {
+		event.AuthBackend = matches[1]
+		if m := p.reQuotedUser.FindStringSubmatch(matches[2]); m != nil {
+			event.Username = m[1]
+		}
+		if event.AuthBackend == "oidc" {
+			if class := ClassifyTokenError(matches[2]); class != "" {
+				event.Type = EventAuthFailureReason
+				event.Reason = AuthReasonInvalidToken
+				event.TokenError = class
+				return event
+			}
+		}
+		if reason := ClassifyAuthFailure(matches[2]); reason != "" {
+			// reason for a following failed authentication attempt
+			if event.AuthBackend == "gssapi" && reason == AuthReasonWrongPassword {
+				reason = AuthReasonSecondFactor // Kerberos tickets aren't passwords; count them with second factors
+			}
+			if event.AuthBackend == "radius" && reason == AuthReasonBackendTimeout {
+				reason = AuthReasonRadiusTimeout
+			}
+			event.Type = EventAuthFailureReason
+			event.Reason = reason
+			return event
+		}
+		if class := ClassifyBackendError(matches[2]); class != "" {
+			event.Type = EventAuthBackendError
+			event.Reason = class
+			return event
+		}
+		event.AuthBackend = ""
+		event.Username = ""
+	}
+
+	// Try auth success pattern
+	if matches := find(p.reAuthSuccess, message, "authenticated"); matches != nil {
+		event.Type = EventAuthSuccess
+		event.Username = matches[1]
+		event.SessionID = matches[2]
+		if m := p.reAuthBackend.FindStringSubmatch(message); m != nil {
+			event.AuthBackend = m[1]
+		}
+		return event
+	}
+
+	// Try client certificate success pattern
+	if matches := find(p.reCertSuccess, message, "client certificate"); matches != nil {
+		event.Type = EventCertAuth
+		event.Username = matches[1] // may be empty
+		event.ClientIP = matches[2]
+		event.CertCN = matches[3]
+		event.CertSerial = matches[4]
+		return event
+	}
+
+	// Try client certificate failure pattern
+	if matches := find(p.reCertFailure, message, "cert"); matches != nil {
+		if reason := ClassifyAuthFailure(matches[3]); reason != "" {
+			event.Type = EventAuthFailureReason
+			event.Reason = AuthReasonCertificate
+			event.Username = matches[1] // may be empty
+			event.ClientIP = matches[2]
+			event.CertError = ClassifyCertError(matches[3])
+			if m := p.reCertCN.FindStringSubmatch(matches[3]); m != nil {
+				event.CertCN = m[1]
+			}
+			return event
+		}
+	}
+
+	// Try BYE packet pattern
+	if matches := find(p.reByePacket, message, "received BYE packet"); matches != nil {
+		event.Type = EventByePacket
+		event.Username = matches[1]
+		event.ClientIP = matches[2]
+		return event
+	}
+
+	// Try DPD warning pattern
+	if matches := find(p.reDPDWarning, message, "have not received TCP DPD"); matches != nil {
+		event.Type = EventDPDWarning
+		event.Username = matches[1]
+		event.ClientIP = matches[2]
+		event.DPDSeconds, _ = strconv.Atoi(matches[3])
+		return event
+	}
+
+	// Try sec-mod close pattern (mobile sleep)
+	if matches := find(p.reSecModClose, message, "temporarily closing session"); matches != nil {
+		event.Type = EventSecModClose
+		event.Username = matches[1]
+		event.SessionID = matches[2]
+		return event
+	}
+
+	// Try link MTU pattern
+	if matches := find(p.reMTU, message, "MTU"); matches != nil {
+		event.Type = EventMTU
+		event.Username = matches[1]
+		event.ClientIP = matches[2]
+		event.MTU, _ = strconv.Atoi(matches[3])
+		return event
+	}
+
+	// Try rekey pattern
+	if matches := find(p.reRekey, message, "rekey", "Rekey", "REKEY"); matches != nil {
+		event.Type = EventRekey
+		event.Username = matches[1]
+		event.ClientIP = matches[2]
+		event.Channel = "cstp"
+		if strings.Contains(matches[3], "DTLS") {
+			event.Channel = "dtls"
+		}
+		return event
+	}
+
+	// Try rejected connection patterns
+	// main: reached maximum client limit (active: 1024)
+	// main[bob]:172.30.30.30:56078 user 'bob' tried to connect more than 2 times
+	// main: 172.30.30.30 is banned, rejecting connection
+	if containsAny(message, "limit", "more than", "same clients", "ban", "tls-auth") {
+		if reason := ClassifyRejection(message); reason != "" {
+			event.Type = EventConnectionRejected
+			event.Reason = reason
+			if m := p.reQuotedUser.FindStringSubmatch(message); m != nil {
+				event.Username = m[1]
+			}
+			return event
+		}
+	}
+
+	// Try server lifecycle patterns
+	if find(p.reServerStart, message, "initialized ocserv") != nil {
+		event.Type = EventServerStart
+		return event
+	}
+	if find(p.reServerStop, message, "termination request") != nil {
+		event.Type = EventServerStop
+		return event
+	}
+	if find(p.reServerReload, message, "reloading configuration") != nil {
+		event.Type = EventServerReload
+		return event
+	}
+
+	// Try user-defined patterns
+	for _, pattern := range p.patterns {
+		if pattern.match(event, message) {
+			return event
+		}
+	}
+
+	return event
+}
+
+// find runs re only on messages containing one of keywords, literals one of which
+// every match of re contains
+func find(re *regexp.Regexp, message string, keywords ...string) []string {
+	if !containsAny(message, keywords...) {
+		return nil
+	}
+	return re.FindStringSubmatch(message)
+}
+
+// ClassifyAuthFailure maps an authentication error message to one of the AuthReason* values
+// Returns an empty string if the message doesn't describe an authentication failure
+func ClassifyAuthFailure(msg string) string {
+	msg = strings.ToLower(msg)
+
+	switch {
+	case strings.Contains(msg, "certificate") || strings.Contains(msg, "cert "):
+		if containsAny(msg, "fail", "not trusted", "expired", "revoked", "invalid", "no certificate", "did not", "reject") {
+			return AuthReasonCertificate
+		}
+		return ""
+	case strings.Contains(msg, "timeout") || strings.Contains(msg, "timed out") || strings.Contains(msg, "no response"):
+		return AuthReasonBackendTimeout
+	case containsAny(msg, "otp", "one-time", "verification code", "token code", "second factor", "2fa", "totp", "hotp") &&
+		containsAny(msg, "fail", "invalid", "wrong", "incorrect", "reject", "expired", "mismatch"):
+		return AuthReasonSecondFactor
+	case containsAny(msg, "not found", "unknown user", "no such user", "user unknown"):
+		return AuthReasonUnknownUser
+	case containsAny(msg, "expired"):
+		return AuthReasonExpiredAccount
+	case containsAny(msg, "locked", "disabled"):
+		return AuthReasonLockedAccount
+	case containsAny(msg, "error authenticating", "authentication failure", "wrong password", "incorrect password", "access-reject", "rejected"):
+		return AuthReasonWrongPassword
+	}
+	return ""
+}
+
+// ClassifyRejection maps a message about a refused connection to one of the RejectReason* values
+// Returns an empty string if the message doesn't describe a rejected connection
+func ClassifyRejection(msg string) string {
+	msg = strings.ToLower(msg)
+
+	switch {
+	case containsAny(msg, "maximum client limit", "max-clients", "too many clients"):
+		return RejectReasonMaxClients
+	case containsAny(msg, "tried to connect more than", "maximum number of same clients", "max-same-clients"):
+		return RejectReasonMaxSameClients
+	case containsAny(msg, "is banned", "due to ban", "previous ban", "banned ip", "banned address"):
+		return RejectReasonBanned
+	case containsAny(msg, "tls-auth") && containsAny(msg, "required", "missing", "fail", "reject"):
+		return RejectReasonTLSAuthRequired
+	}
+	return ""
+}
+
+// ClassifyUserAgent maps a VPN client user agent to a client type
+// (e.g. "AnyConnect (Windows)", "OpenConnect (CLI)"); "Unknown" if ua is empty
+func ClassifyUserAgent(ua string) string {
+	ua = strings.ToLower(ua)
+
+	switch {
+	case strings.Contains(ua, "android"):
+		return "AnyConnect Mobile (Android)"
+	case strings.Contains(ua, "applesslvpn") || strings.Contains(ua, "iphone") || strings.Contains(ua, "ipad"):
+		return "AnyConnect Mobile (iOS)"
+	case strings.Contains(ua, "openconnect-gui"):
+		return "OpenConnect GUI"
+	case strings.Contains(ua, "openconnect vpn agent"):
+		return "OpenConnect VPN Agent"
+	case strings.Contains(ua, "open anyconnect"):
+		return "Open AnyConnect"
+	case strings.Contains(ua, "anyconnect darwin"):
+		return "AnyConnect (macOS)"
+	case strings.Contains(ua, "anyconnect windows"):
+		return "AnyConnect (Windows)"
+	case strings.Contains(ua, "anyconnect"):
+		return "AnyConnect (Other)"
+	case strings.Contains(ua, "openconnect"):
+		return "OpenConnect (CLI)"
+	default:
+		if ua == "" {
+			return "Unknown"
+		}
+		return "Other"
+	}
+}
+
+// ClassifyCertError maps a certificate failure message to a failure class
+// (expired, untrusted, revoked, missing, failed)
+func ClassifyCertError(msg string) string {
+	msg = strings.ToLower(msg)
+
+	switch {
+	case containsAny(msg, "expired", "not yet valid"):
+		return "expired"
+	case containsAny(msg, "revoked"):
+		return "revoked"
+	case containsAny(msg, "not trusted", "untrusted", "unknown ca", "issuer"):
+		return "untrusted"
+	case containsAny(msg, "no certificate", "did not present", "not provided", "no client certificate"):
+		return "missing"
+	}
+	return "failed"
+}
+
+// ClassifyTokenError maps an OIDC token validation failure to a failure class. Returns an empty
+// string if the message is not about a rejected token (e.g. the provider's keys could not be fetched).
+func ClassifyTokenError(msg string) string {
+	msg = strings.ToLower(msg)
+
+	if !containsAny(msg, "token", "jwt", "claim", "issuer", "audience", "signature") {
+		return ""
+	}
+	if containsAny(msg, "jwks", "discovery", "openid-configuration") && containsAny(msg, "fetch", "download", "connect", "retriev", "load") {
+		return ""
+	}
+	switch {
+	case containsAny(msg, "expired", "not yet valid", "exp claim", "nbf"):
+		return "expired"
+	case containsAny(msg, "issuer", "iss claim"):
+		return "issuer_mismatch"
+	case containsAny(msg, "audience", "aud claim"):
+		return "audience_mismatch"
+	case containsAny(msg, "signature"):
+		return "invalid_signature"
+	case containsAny(msg, "parse", "malformed", "decode", "missing"):
+		return "malformed"
+	}
+	return "invalid"
+}
+
+// ClassifyBackendError maps an auth backend error message to an error class
+// (unreachable, timeout, error). Returns an empty string if the message is not an error.
+func ClassifyBackendError(msg string) string {
+	msg = strings.ToLower(msg)
+
+	switch {
+	case containsAny(msg, "could not connect", "cannot connect", "failed to connect", "connection refused", "unreachable", "no route"):
+		return "unreachable"
+	case containsAny(msg, "timeout", "timed out", "no response"):
+		return "timeout"
+	case containsAny(msg, "error", "fail", "cannot", "could not"):
+		return "error"
+	}
+	return ""
+}
+
+func containsAny(s string, substrs ...string) bool {
+	for _, sub := range substrs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
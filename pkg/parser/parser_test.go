@@ -0,0 +1,367 @@
+package parser
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParser(t *testing.T) {
+	p := New()
+	ts := time.Now()
+
+	tests := []struct {
+		name     string
+		message  string
+		wantType EventType
+		check    func(*Event) bool
+	}{
+		{
+			name:     "user login",
+			message:  "main[a.mogilevich]:62.4.32.53:30595 user logged in",
+			wantType: EventUserLogin,
+			check: func(e *Event) bool {
+				return e.Username == "a.mogilevich" &&
+					e.ClientIP == "62.4.32.53" &&
+					e.Port == 30595
+			},
+		},
+		{
+			name:     "user disconnect",
+			message:  "main[a.mogilevich]:62.4.32.53:30595 user disconnected (reason: user disconnected, rx: 13295, tx: 24650)",
+			wantType: EventUserDisconnect,
+			check: func(e *Event) bool {
+				return e.Username == "a.mogilevich" &&
+					e.ClientIP == "62.4.32.53" &&
+					e.Reason == "user disconnected" &&
+					e.RxBytes == 13295 &&
+					e.TxBytes == 24650
+			},
+		},
+		{
+			name:     "session start",
+			message:  "sec-mod: initiating session for user 'a.mogilevich' (session: yKsy7b)",
+			wantType: EventSessionStart,
+			check: func(e *Event) bool {
+				return e.Username == "a.mogilevich" &&
+					e.SessionID == "yKsy7b"
+			},
+		},
+		{
+			name:     "user login with vhost",
+			message:  "main[bob]:62.4.32.53:30595 vhost:vpn.example.com: user logged in",
+			wantType: EventUserLogin,
+			check: func(e *Event) bool {
+				return e.Username == "bob" &&
+					e.ClientIP == "62.4.32.53" &&
+					e.Port == 30595 &&
+					e.VHost == "vpn.example.com"
+			},
+		},
+		{
+			name:     "session start with vhost",
+			message:  "sec-mod: vhost:cdn.example.net: initiating session for user 'bob' (session: yKsy7b)",
+			wantType: EventSessionStart,
+			check: func(e *Event) bool {
+				return e.Username == "bob" &&
+					e.SessionID == "yKsy7b" &&
+					e.VHost == "cdn.example.net"
+			},
+		},
+		{
+			name:     "session invalidate",
+			message:  "sec-mod: invalidating session of user 'a.mogilevich' (session: yKsy7b)",
+			wantType: EventSessionInvalidate,
+			check: func(e *Event) bool {
+				return e.Username == "a.mogilevich" &&
+					e.SessionID == "yKsy7b"
+			},
+		},
+		{
+			name:     "vpn ip assigned",
+			message:  "worker[a.mogilevich]: 62.4.32.53 sending IPv4 10.88.9.156",
+			wantType: EventVPNIPAssigned,
+			check: func(e *Event) bool {
+				return e.Username == "a.mogilevich" &&
+					e.VpnIP == "10.88.9.156"
+			},
+		},
+		{
+			name:     "auth failed",
+			message:  "main:172.30.30.30:56078 failed authentication attempt for user ''",
+			wantType: EventAuthFailed,
+			check: func(e *Event) bool {
+				return e.ClientIP == "172.30.30.30" && e.Port == 56078 && e.Reason == ""
+			},
+		},
+		{
+			name:     "cookie auth failed",
+			message:  "worker: 172.30.30.30 failed cookie authentication attempt",
+			wantType: EventAuthFailed,
+			check: func(e *Event) bool {
+				return e.ClientIP == "172.30.30.30" && e.Reason == AuthReasonInvalidCookie
+			},
+		},
+		{
+			name:     "auth reason unknown user",
+			message:  "sec-mod: plain-auth: user 'bob' not found in password file",
+			wantType: EventAuthFailureReason,
+			check: func(e *Event) bool {
+				return e.Username == "bob" && e.Reason == AuthReasonUnknownUser
+			},
+		},
+		{
+			name:     "auth reason wrong password",
+			message:  "sec-mod: pam-auth: error authenticating user 'bob': Authentication failure",
+			wantType: EventAuthFailureReason,
+			check: func(e *Event) bool {
+				return e.Username == "bob" && e.Reason == AuthReasonWrongPassword
+			},
+		},
+		{
+			name:     "auth reason radius timeout",
+			message:  "sec-mod: radius-auth: error authenticating user 'bob' (timeout)",
+			wantType: EventAuthFailureReason,
+			check: func(e *Event) bool {
+				return e.Username == "bob" && e.Reason == AuthReasonRadiusTimeout
+			},
+		},
+		{
+			name:     "auth reason pam timeout",
+			message:  "sec-mod: pam-auth: error authenticating user 'bob': Connection timed out",
+			wantType: EventAuthFailureReason,
+			check: func(e *Event) bool {
+				return e.AuthBackend == "pam" && e.Reason == AuthReasonBackendTimeout
+			},
+		},
+		{
+			name:     "auth module name outside sec-mod",
+			message:  "main: forwarding message 'pam: error authenticating user 'bob' (timeout)'",
+			wantType: EventUnknown,
+			check: func(e *Event) bool {
+				return e.AuthBackend == "" && e.Reason == ""
+			},
+		},
+		{
+			name:     "auth reason certificate",
+			message:  "worker: 172.30.30.30 failed to verify client certificate: certificate has expired",
+			wantType: EventAuthFailureReason,
+			check: func(e *Event) bool {
+				return e.ClientIP == "172.30.30.30" && e.Reason == AuthReasonCertificate && e.CertError == "expired"
+			},
+		},
+		{
+			name:     "certificate accepted",
+			message:  "worker: 172.30.30.30 received client certificate with CN 'bob' (serial: 4A:1F:02)",
+			wantType: EventCertAuth,
+			check: func(e *Event) bool {
+				return e.ClientIP == "172.30.30.30" && e.CertCN == "bob" && e.CertSerial == "4A:1F:02"
+			},
+		},
+		{
+			name:     "auth init",
+			message:  "sec-mod: auth init for user 'bob' (session: yKsy7b) from 172.30.30.30",
+			wantType: EventAuthInit,
+			check: func(e *Event) bool {
+				return e.Username == "bob" && e.SessionID == "yKsy7b" && e.ClientIP == "172.30.30.30"
+			},
+		},
+		{
+			name:     "auth success",
+			message:  "sec-mod: radius-auth: user 'bob' authenticated",
+			wantType: EventAuthSuccess,
+			check: func(e *Event) bool {
+				return e.Username == "bob" && e.AuthBackend == "radius"
+			},
+		},
+		{
+			name:     "oidc auth success",
+			message:  "sec-mod: oidc: user 'bob' authenticated",
+			wantType: EventAuthSuccess,
+			check: func(e *Event) bool {
+				return e.Username == "bob" && e.AuthBackend == "oidc"
+			},
+		},
+		{
+			name:     "oidc expired token",
+			message:  "sec-mod: oidc: user 'bob': token has expired (exp claim)",
+			wantType: EventAuthFailureReason,
+			check: func(e *Event) bool {
+				return e.Username == "bob" && e.Reason == AuthReasonInvalidToken && e.TokenError == "expired"
+			},
+		},
+		{
+			name:     "oidc issuer mismatch",
+			message:  "sec-mod: oidc: token issuer https://sso.example.com/realms/test does not match configured issuer",
+			wantType: EventAuthFailureReason,
+			check: func(e *Event) bool {
+				return e.AuthBackend == "oidc" && e.TokenError == "issuer_mismatch"
+			},
+		},
+		{
+			name:     "oidc bad signature",
+			message:  "sec-mod: oidc: failed to verify JWT signature",
+			wantType: EventAuthFailureReason,
+			check: func(e *Event) bool {
+				return e.TokenError == "invalid_signature"
+			},
+		},
+		{
+			name:     "oidc jwks unreachable",
+			message:  "sec-mod: oidc: failed to fetch jwks for token validation: could not connect to sso.example.com",
+			wantType: EventAuthBackendError,
+			check: func(e *Event) bool {
+				return e.AuthBackend == "oidc" && e.Reason == "unreachable"
+			},
+		},
+		{
+			name:     "otp rejected",
+			message:  "sec-mod: pam-auth: user 'bob': Invalid verification code",
+			wantType: EventAuthFailureReason,
+			check: func(e *Event) bool {
+				return e.Username == "bob" && e.Reason == AuthReasonSecondFactor
+			},
+		},
+		{
+			name:     "gssapi rejected",
+			message:  "sec-mod: gssapi-auth: user 'bob': authentication failure",
+			wantType: EventAuthFailureReason,
+			check: func(e *Event) bool {
+				return e.Reason == AuthReasonSecondFactor
+			},
+		},
+		{
+			name:     "wrong password is no second factor",
+			message:  "sec-mod: pam-auth: user 'bob': authentication failure",
+			wantType: EventAuthFailureReason,
+			check: func(e *Event) bool {
+				return e.Reason == AuthReasonWrongPassword
+			},
+		},
+		{
+			name:     "auth backend unreachable",
+			message:  "sec-mod: radius-auth: could not connect to radius server 10.0.0.5:1812",
+			wantType: EventAuthBackendError,
+			check: func(e *Event) bool {
+				return e.AuthBackend == "radius" && e.Reason == "unreachable"
+			},
+		},
+		{
+			name:     "pam error",
+			message:  "sec-mod: pam-auth: PAM error: Module is unknown",
+			wantType: EventAuthBackendError,
+			check: func(e *Event) bool {
+				return e.AuthBackend == "pam" && e.Reason == "error"
+			},
+		},
+		{
+			name:     "session start with group",
+			message:  "sec-mod: initiating session for user 'bob' of group 'employees' (session: yKsy7b)",
+			wantType: EventSessionStart,
+			check: func(e *Event) bool {
+				return e.Username == "bob" && e.SessionID == "yKsy7b" && e.Group == "employees"
+			},
+		},
+		{
+			name:     "user group",
+			message:  "sec-mod: user 'bob' of group 'contractors' authenticated via radius",
+			wantType: EventUserGroup,
+			check: func(e *Event) bool {
+				return e.Username == "bob" && e.Group == "contractors"
+			},
+		},
+		{
+			name:     "link mtu",
+			message:  "worker[bob]: 62.4.32.53 configured link MTU is 1420",
+			wantType: EventMTU,
+			check: func(e *Event) bool {
+				return e.Username == "bob" && e.ClientIP == "62.4.32.53" && e.MTU == 1420
+			},
+		},
+		{
+			name:     "dtls rekey",
+			message:  "worker[bob]: 62.4.32.53 DTLS: rekeying",
+			wantType: EventRekey,
+			check:    func(e *Event) bool { return e.Username == "bob" && e.Channel == "dtls" },
+		},
+		{
+			name:     "client user agent",
+			message:  "worker: 62.4.32.53 User-agent: 'AnyConnect Windows 4.10.07061'",
+			wantType: EventClientInfo,
+			check: func(e *Event) bool {
+				return e.Username == "" && e.ClientIP == "62.4.32.53" && e.UserAgent == "AnyConnect Windows 4.10.07061" &&
+					ClassifyUserAgent(e.UserAgent) == "AnyConnect (Windows)"
+			},
+		},
+		{
+			name:     "client hostname",
+			message:  "worker[bob]: 62.4.32.53 HTTP processing: X-CSTP-Hostname: laptop-42",
+			wantType: EventClientInfo,
+			check:    func(e *Event) bool { return e.Username == "bob" && e.Hostname == "laptop-42" && e.UserAgent == "" },
+		},
+		{
+			name:     "max clients",
+			message:  "main: reached maximum client limit (active: 1024)",
+			wantType: EventConnectionRejected,
+			check:    func(e *Event) bool { return e.Reason == RejectReasonMaxClients },
+		},
+		{
+			name:     "max same clients",
+			message:  "main[bob]:172.30.30.30:56078 user 'bob' tried to connect more than 2 times",
+			wantType: EventConnectionRejected,
+			check: func(e *Event) bool {
+				return e.Reason == RejectReasonMaxSameClients && e.Username == "bob"
+			},
+		},
+		{
+			name:     "banned",
+			message:  "main: 172.30.30.30 is banned, rejecting connection",
+			wantType: EventConnectionRejected,
+			check:    func(e *Event) bool { return e.Reason == RejectReasonBanned },
+		},
+		{
+			name:     "ban list is not a rejection",
+			message:  "main: added IP '172.30.30.30' (with score 80) to ban list, will be reset at: Mon Jan  6 10:00:00 2025",
+			wantType: EventUnknown,
+			check:    func(e *Event) bool { return true },
+		},
+		{
+			name:     "server start",
+			message:  "main: initialized ocserv 1.2.4",
+			wantType: EventServerStart,
+			check:    func(e *Event) bool { return e.Username == "" },
+		},
+		{
+			name:     "server stop",
+			message:  "main: termination request received; waiting for sessions to die",
+			wantType: EventServerStop,
+			check:    func(e *Event) bool { return true },
+		},
+		{
+			name:     "server reload",
+			message:  "main: reloading configuration",
+			wantType: EventServerReload,
+			check:    func(e *Event) bool { return true },
+		},
+		{
+			name:     "unknown message",
+			message:  "worker[a.mogilevich]: 62.4.32.53 suggesting DPD of 90 secs",
+			wantType: EventUnknown,
+			check:    func(e *Event) bool { return true },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := p.Parse(ts, tt.message, "ocserv")
+			if event.Type != tt.wantType {
+				t.Errorf("got type %v, want %v", event.Type, tt.wantType)
+			}
+			if event.Server != "ocserv" {
+				t.Errorf("got server %v, want ocserv", event.Server)
+			}
+			if !tt.check(event) {
+				t.Errorf("check failed for event: %+v", event)
+			}
+		})
+	}
+}
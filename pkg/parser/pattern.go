@@ -0,0 +1,101 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// Event fields a user-defined pattern can fill from its capture groups
+var patternFields = map[string]func(event *Event, value string){
+	"username":   func(e *Event, v string) { e.Username = v },
+	"client_ip":  func(e *Event, v string) { e.ClientIP = v },
+	"port":       func(e *Event, v string) { e.Port, _ = strconv.Atoi(v) },
+	"vpn_ip":     func(e *Event, v string) { e.VpnIP = v },
+	"session_id": func(e *Event, v string) { e.SessionID = v },
+	"reason":     func(e *Event, v string) { e.Reason = v },
+	"group":      func(e *Event, v string) { e.Group = v },
+	"rx_bytes":   func(e *Event, v string) { e.RxBytes, _ = strconv.ParseUint(v, 10, 64) },
+	"tx_bytes":   func(e *Event, v string) { e.TxBytes, _ = strconv.ParseUint(v, 10, 64) },
+}
+
+// Pattern is a user-defined log line pattern, tried on lines none of the
+// built-in patterns match
+type Pattern struct {
+	name   string
+	re     *regexp.Regexp
+	typ    EventType
+	groups map[string]int // event field -> capture group index
+}
+
+// NewPattern compiles a user-defined pattern. Matching lines become events of
+// type event (as returned by EventType.String), or EventCustom named name when
+// event is empty. fields maps event fields (username, client_ip, port, vpn_ip,
+// session_id, reason, group, rx_bytes, tx_bytes) to capture group names or
+// numbers; named groups called like a field are used without mapping.
+func NewPattern(name, expr, event string, fields map[string]string) (*Pattern, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("pattern %q: %w", name, err)
+	}
+
+	typ := EventCustom
+	if event != "" {
+		if typ = ParseEventType(event); typ == EventUnknown || typ == EventCustom {
+			return nil, fmt.Errorf("pattern %q: unknown event type %q", name, event)
+		}
+	} else if name == "" {
+		return nil, fmt.Errorf("pattern for %q needs a name or an event type", expr)
+	}
+
+	p := &Pattern{name: name, re: re, typ: typ, groups: make(map[string]int)}
+	for i, group := range re.SubexpNames() {
+		if _, ok := patternFields[group]; ok {
+			p.groups[group] = i
+		}
+	}
+	for field, group := range fields {
+		if _, ok := patternFields[field]; !ok {
+			return nil, fmt.Errorf("pattern %q: unknown field %q", name, field)
+		}
+		i := re.SubexpIndex(group)
+		if n, err := strconv.Atoi(group); err == nil {
+			i = n
+		}
+		if i < 1 || i > re.NumSubexp() {
+			return nil, fmt.Errorf("pattern %q: no capture group %q for field %q", name, group, field)
+		}
+		p.groups[field] = i
+	}
+	return p, nil
+}
+
+// Name returns the pattern name
+func (p *Pattern) Name() string {
+	return p.name
+}
+
+// match fills event from message and reports whether the pattern matched
+func (p *Pattern) match(event *Event, message string) bool {
+	matches := p.re.FindStringSubmatch(message)
+	if matches == nil {
+		return false
+	}
+	event.Type = p.typ
+	event.Pattern = p.name
+	for field, i := range p.groups {
+		patternFields[field](event, matches[i])
+	}
+	return true
+}
+
+// ParseEventType returns the event type with the given name, EventUnknown if
+// there is none
+func ParseEventType(name string) EventType {
+	for t := EventUnknown + 1; t <= EventCustom; t++ {
+		if t.String() == name {
+			return t
+		}
+	}
+	return EventUnknown
+}
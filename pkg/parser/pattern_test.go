@@ -0,0 +1,52 @@
+package parser
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUserPatterns(t *testing.T) {
+	otp, err := NewPattern("otp", `sec-mod: otp: user '(?P<username>[^']+)' from (\S+) rejected`, "auth_failure", map[string]string{"client_ip": "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	quota, err := NewPattern("quota_exceeded", `quota-plugin: (?P<user>\S+) over quota`, "", map[string]string{"username": "user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := New()
+	p.SetPatterns([]*Pattern{otp, quota})
+
+	event := p.Parse(time.Now(), "sec-mod: otp: user 'bob' from 10.0.0.1 rejected", "ocserv")
+	if event.Type != EventAuthFailed || event.Username != "bob" || event.ClientIP != "10.0.0.1" || event.Pattern != "otp" {
+		t.Errorf("otp pattern: got %+v", event)
+	}
+
+	event = p.Parse(time.Now(), "vhost:corp: quota-plugin: alice over quota", "ocserv")
+	if event.Type != EventCustom || event.Username != "alice" || event.Pattern != "quota_exceeded" || event.VHost != "corp" {
+		t.Errorf("custom pattern: got %+v", event)
+	}
+
+	// Built-in patterns win
+	event = p.Parse(time.Now(), "main[bob]:10.0.0.1:1234 user logged in", "ocserv")
+	if event.Type != EventUserLogin || event.Pattern != "" {
+		t.Errorf("built-in pattern: got %+v", event)
+	}
+
+	for _, bad := range []struct{ name, expr, event string }{
+		{"re", `(`, ""},
+		{"type", `x`, "no_such_event"},
+		{"custom", `x`, "custom"},
+		{"", `x`, ""},
+	} {
+		if _, err := NewPattern(bad.name, bad.expr, bad.event, nil); err == nil {
+			t.Errorf("NewPattern(%q, %q, %q) succeeded, want error", bad.name, bad.expr, bad.event)
+		}
+	}
+	if _, err := NewPattern("group", `(\S+)`, "", map[string]string{"username": "2"}); err == nil {
+		t.Error("NewPattern accepted a missing capture group")
+	}
+	if _, err := NewPattern("field", `(\S+)`, "", map[string]string{"password": "1"}); err == nil {
+		t.Error("NewPattern accepted an unknown field")
+	}
+}
@@ -0,0 +1,196 @@
+package parser
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Hand-written matchers for the most frequent lines. Each one accepts exactly
+// what the regular expression in its comment accepts (leftmost match), but
+// avoids running the regexp engine on every log line.
+
+// scanMainAddr parses the `main\[([^\]]+)\]:([^:]+):(\d+)` prefix of s
+// (bracketed user optional if optionalUser) and returns the rest of s
+func scanMainAddr(s string, optionalUser bool) (user, ip, port, rest string, ok bool) {
+	s, ok = strings.CutPrefix(s, "main")
+	if !ok {
+		return
+	}
+	if inner, found := strings.CutPrefix(s, "["); found {
+		end := strings.IndexByte(inner, ']')
+		if end < 0 || (end == 0 && !optionalUser) {
+			return "", "", "", "", false
+		}
+		user, s = inner[:end], inner[end+1:]
+	} else if !optionalUser {
+		return "", "", "", "", false
+	}
+	if s, ok = strings.CutPrefix(s, ":"); !ok {
+		return
+	}
+	end := strings.IndexByte(s, ':')
+	if end <= 0 {
+		return "", "", "", "", false
+	}
+	ip, s = s[:end], s[end+1:]
+	if port, s = scanDigits(s); port == "" {
+		return "", "", "", "", false
+	}
+	return user, ip, port, s, true
+}
+
+// scanDigits splits a leading run of ASCII digits from s
+func scanDigits(s string) (digits, rest string) {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+// eachIndex calls fn with s from every occurrence of substr on, until fn returns true
+func eachIndex(s, substr string, fn func(s string) bool) bool {
+	for i := 0; ; {
+		j := strings.Index(s[i:], substr)
+		if j < 0 {
+			return false
+		}
+		if fn(s[i+j:]) {
+			return true
+		}
+		i += j + 1
+	}
+}
+
+// scanLogin matches `main\[([^\]]+)\]:([^:]+):(\d+) user logged in`
+func scanLogin(message string, event *Event) bool {
+	if !strings.Contains(message, " user logged in") {
+		return false
+	}
+	return eachIndex(message, "main[", func(s string) bool {
+		user, ip, port, rest, ok := scanMainAddr(s, false)
+		if !ok || !strings.HasPrefix(rest, " user logged in") {
+			return false
+		}
+		event.Username = user
+		event.ClientIP = ip
+		event.Port, _ = strconv.Atoi(port)
+		return true
+	})
+}
+
+// scanDisconnect matches
+// `main\[([^\]]+)\]:([^:]+):(\d+) user disconnected \(reason: ([^,]+), rx: (\d+), tx: (\d+)\)`
+func scanDisconnect(message string, event *Event) bool {
+	if !strings.Contains(message, " user disconnected (reason: ") {
+		return false
+	}
+	return eachIndex(message, "main[", func(s string) bool {
+		user, ip, port, rest, ok := scanMainAddr(s, false)
+		if !ok {
+			return false
+		}
+		if rest, ok = strings.CutPrefix(rest, " user disconnected (reason: "); !ok {
+			return false
+		}
+		end := strings.IndexByte(rest, ',')
+		if end <= 0 {
+			return false
+		}
+		reason := rest[:end]
+		if rest, ok = strings.CutPrefix(rest[end:], ", rx: "); !ok {
+			return false
+		}
+		rx, rest := scanDigits(rest)
+		if rest, ok = strings.CutPrefix(rest, ", tx: "); rx == "" || !ok {
+			return false
+		}
+		tx, rest := scanDigits(rest)
+		if tx == "" || !strings.HasPrefix(rest, ")") {
+			return false
+		}
+		event.Username = user
+		event.ClientIP = ip
+		event.Port, _ = strconv.Atoi(port)
+		event.Reason = reason
+		event.RxBytes, _ = strconv.ParseUint(rx, 10, 64)
+		event.TxBytes, _ = strconv.ParseUint(tx, 10, 64)
+		return true
+	})
+}
+
+// scanVPNIP matches `worker\[([^\]]+)\]: [^ ]+ sending IPv4 ([0-9.]+)`
+func scanVPNIP(message string, event *Event) bool {
+	if !strings.Contains(message, " sending IPv4 ") {
+		return false
+	}
+	return eachIndex(message, "worker[", func(s string) bool {
+		s = s[len("worker["):]
+		end := strings.IndexByte(s, ']')
+		if end <= 0 {
+			return false
+		}
+		user := s[:end]
+		s, ok := strings.CutPrefix(s[end+1:], ": ")
+		if !ok {
+			return false
+		}
+		end = strings.IndexByte(s, ' ')
+		if end <= 0 {
+			return false
+		}
+		s, ok = strings.CutPrefix(s[end:], " sending IPv4 ")
+		if !ok {
+			return false
+		}
+		i := 0
+		for i < len(s) && (s[i] == '.' || s[i] >= '0' && s[i] <= '9') {
+			i++
+		}
+		if i == 0 {
+			return false
+		}
+		event.Username = user
+		event.VpnIP = s[:i]
+		return true
+	})
+}
+
+// scanAuthFailed matches `main(?:\[([^\]]*)\])?:([^:]+):(\d+) failed authentication attempt`
+func scanAuthFailed(message string, event *Event) bool {
+	if !strings.Contains(message, " failed authentication attempt") {
+		return false
+	}
+	return eachIndex(message, "main", func(s string) bool {
+		user, ip, port, rest, ok := scanMainAddr(s, true)
+		if !ok || !strings.HasPrefix(rest, " failed authentication attempt") {
+			return false
+		}
+		event.Username = user // may be empty
+		event.ClientIP = ip
+		event.Port, _ = strconv.Atoi(port)
+		return true
+	})
+}
+
+// UserKey returns the user a log line is about without parsing it: the name in
+// main[user] or worker[user], the first quoted user 'name', or the name in
+// "closing session for name". Lines that name no user return "".
+func UserKey(message string) string {
+	if i := strings.IndexByte(message, '['); i >= 0 {
+		if end := strings.IndexByte(message[i+1:], ']'); end > 0 {
+			return message[i+1 : i+1+end]
+		}
+	}
+	if _, rest, ok := strings.Cut(message, "user '"); ok {
+		if end := strings.IndexByte(rest, '\''); end >= 0 {
+			return rest[:end]
+		}
+	}
+	if _, rest, ok := strings.Cut(message, "closing session for "); ok {
+		if end := strings.IndexByte(rest, ' '); end >= 0 {
+			return rest[:end]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,130 @@
+package parser
+
+import (
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// The regular expressions the scanners replace; the scanners must agree with them
+var (
+	reLogin      = regexp.MustCompile(`main\[([^\]]+)\]:([^:]+):(\d+) user logged in`)
+	reDisconnect = regexp.MustCompile(`main\[([^\]]+)\]:([^:]+):(\d+) user disconnected \(reason: ([^,]+), rx: (\d+), tx: (\d+)\)`)
+	reVPNIP      = regexp.MustCompile(`worker\[([^\]]+)\]: [^ ]+ sending IPv4 ([0-9.]+)`)
+	reAuthFailed = regexp.MustCompile(`main(?:\[([^\]]*)\])?:([^:]+):(\d+) failed authentication attempt`)
+)
+
+var scanSeeds = []string{
+	"main[a.mogilevich]:62.4.32.53:30595 user logged in",
+	"main[]:62.4.32.53:30595 user logged in",
+	"main[bob]:62.4.32.53: user logged in",
+	"main[bob]::30595 user logged in",
+	"main[bob:62.4.32.53:30595 main[eve]:10.0.0.1:1 user logged in",
+	"main[bob]:62.4.32.53:30595 user logged in main[eve]:10.0.0.1:2 user logged in",
+	"main[bob]:2001:db8::1:443 user logged in",
+	"main[a.mogilevich]:62.4.32.53:30595 user disconnected (reason: user disconnected, rx: 13295, tx: 24650)",
+	"main[bob]:62.4.32.53:30595 user disconnected (reason: , rx: 1, tx: 2)",
+	"main[bob]:62.4.32.53:30595 user disconnected (reason: idle, rx: , tx: 2)",
+	"main[bob]:62.4.32.53:30595 user disconnected (reason: idle, rx: 1, tx: 2",
+	"main[bob]:62.4.32.53:30595 user disconnected (reason: a, b, rx: 1, tx: 2)",
+	"main[bob]:62.4.32.53:30595 user disconnected (reason: dpd, rx: 99999999999999999999, tx: 0)",
+	"worker[a.mogilevich]: 62.4.32.53 sending IPv4 10.88.9.156",
+	"worker[a.mogilevich]: 62.4.32.53 sending IPv4 ",
+	"worker[]: 62.4.32.53 sending IPv4 10.0.0.1",
+	"worker[bob]:  sending IPv4 10.0.0.1",
+	"worker[bob]: 62.4.32.53 sending IPv6 fd00::1",
+	"worker[bob] worker[eve]: 1.2.3.4 sending IPv4 10.0.0.2.",
+	"main:172.30.30.30:56078 failed authentication attempt for user ''",
+	"main[]:172.30.30.30:56078 failed authentication attempt for user ''",
+	"main[bob]:172.30.30.30:56078 failed authentication attempt for user 'bob'",
+	"main[bob:172.30.30.30:56078 failed authentication attempt",
+	"domain main:1.2.3.4:5 failed authentication attempt",
+	"mainmain:1.2.3.4:5 failed authentication attempt",
+	"main:1.2.3.4:x failed authentication attempt",
+}
+
+func TestScannersMatchRegexps(t *testing.T) {
+	for _, line := range scanSeeds {
+		checkScanners(t, line)
+	}
+}
+
+func FuzzScanners(f *testing.F) {
+	for _, line := range scanSeeds {
+		f.Add(line)
+	}
+	f.Fuzz(checkScanners)
+}
+
+func checkScanners(t *testing.T, line string) {
+	t.Helper()
+
+	check := func(name string, re *regexp.Regexp, scan func(string, *Event) bool, want func([]string) Event) {
+		var got Event
+		ok := scan(line, &got)
+		m := re.FindStringSubmatch(line)
+		if ok != (m != nil) {
+			t.Errorf("%s(%q) = %v, regexp matched %v", name, line, ok, m != nil)
+			return
+		}
+		if ok && got != want(m) {
+			t.Errorf("%s(%q) = %+v, want %+v", name, line, got, want(m))
+		}
+	}
+	atoi := func(s string) int { n, _ := strconv.Atoi(s); return n }
+	parseUint := func(s string) uint64 { n, _ := strconv.ParseUint(s, 10, 64); return n }
+
+	check("scanLogin", reLogin, scanLogin, func(m []string) Event {
+		return Event{Username: m[1], ClientIP: m[2], Port: atoi(m[3])}
+	})
+	check("scanDisconnect", reDisconnect, scanDisconnect, func(m []string) Event {
+		return Event{Username: m[1], ClientIP: m[2], Port: atoi(m[3]), Reason: m[4], RxBytes: parseUint(m[5]), TxBytes: parseUint(m[6])}
+	})
+	check("scanVPNIP", reVPNIP, scanVPNIP, func(m []string) Event {
+		return Event{Username: m[1], VpnIP: m[2]}
+	})
+	check("scanAuthFailed", reAuthFailed, scanAuthFailed, func(m []string) Event {
+		return Event{Username: m[1], ClientIP: m[2], Port: atoi(m[3])}
+	})
+}
+
+func TestUserKey(t *testing.T) {
+	for line, want := range map[string]string{
+		"main[bob]:62.4.32.53:30595 user logged in":                                         "bob",
+		"worker[bob]: 62.4.32.53 sending IPv4 10.88.9.156":                                  "bob",
+		"sec-mod: initiating session for user 'bob' (session: yKsy7b)":                      "bob",
+		"main:172.30.30.30:56078 failed authentication attempt for user 'bob'":              "bob",
+		"main:172.30.30.30:56078 failed authentication attempt for user ''":                 "",
+		"sec-mod: temporarily closing session for bob (session: u7N/JC)":                    "bob",
+		"worker: 172.30.30.30 failed to verify client certificate: certificate has expired": "",
+	} {
+		if got := UserKey(line); got != want {
+			t.Errorf("UserKey(%q) = %q, want %q", line, got, want)
+		}
+	}
+}
+
+// benchLines is a mix of lines logged during a reconnect storm, most of which
+// match no pattern
+var benchLines = []string{
+	"main[a.mogilevich]:62.4.32.53:30595 user logged in",
+	"worker[a.mogilevich]: 62.4.32.53 sending IPv4 10.88.9.156",
+	"worker[a.mogilevich]: 62.4.32.53 configured link MTU is 1420",
+	"worker[a.mogilevich]: 62.4.32.53 DTLS ciphersuite: (DTLS1.2)-(ECDHE-RSA)-(AES-256-GCM)",
+	"sec-mod: initiating session for user 'a.mogilevich' (session: yKsy7b)",
+	"sec-mod: auth init for user 'a.mogilevich' (session: yKsy7b) from 62.4.32.53",
+	"main[a.mogilevich]:62.4.32.53:30595 user disconnected (reason: user disconnected, rx: 13295, tx: 24650)",
+	"main: 62.4.32.53:30595 worker-vpn.c:1234: sent periodic stats",
+	"main:172.30.30.30:56078 failed authentication attempt for user ''",
+	"worker: 62.4.32.53 worker-auth.c:1421: sending authentication cookie",
+}
+
+func BenchmarkParse(b *testing.B) {
+	p := New()
+	ts := time.Now()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		p.Parse(ts, benchLines[i%len(benchLines)], "ocserv")
+	}
+}